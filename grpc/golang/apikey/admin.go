@@ -0,0 +1,96 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	adminpb "github.com/shrivatsas/exp-codegen/grpc/protos/admin"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ServiceName is the KeyAdmin service's full name. It checks the admin
+// token itself, so allowlist it in the auth interceptors' Options.
+var ServiceName = adminpb.KeyAdmin_ServiceDesc.ServiceName
+
+// Register adds the KeyAdmin service managing k to s.
+func (k *Keys) Register(s grpc.ServiceRegistrar) {
+	adminpb.RegisterKeyAdminServer(s, adminService{k: k})
+}
+
+// adminService implements KeyAdmin on Keys.
+type adminService struct {
+	adminpb.UnimplementedKeyAdminServer
+	k *Keys
+}
+
+// CreateApiKey implements the CreateApiKey RPC method.
+func (a adminService) CreateApiKey(ctx context.Context, req *adminpb.CreateApiKeyRequest) (*adminpb.CreateApiKeyResponse, error) {
+	if err := a.k.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if req.Identity == "" {
+		return nil, status.Error(codes.InvalidArgument, "identity must not be empty")
+	}
+	key, secret, err := a.k.Create(ctx, req.Identity)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "creating API key: %v", err)
+	}
+	return &adminpb.CreateApiKeyResponse{ApiKey: apiKeyProto(key), Key: secret}, nil
+}
+
+// ListApiKeys implements the ListApiKeys RPC method.
+func (a adminService) ListApiKeys(ctx context.Context, _ *adminpb.ListApiKeysRequest) (*adminpb.ListApiKeysResponse, error) {
+	if err := a.k.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	keys, err := a.k.List(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "listing API keys: %v", err)
+	}
+	resp := &adminpb.ListApiKeysResponse{}
+	for _, key := range keys {
+		resp.ApiKeys = append(resp.ApiKeys, apiKeyProto(key))
+	}
+	return resp, nil
+}
+
+// RevokeApiKey implements the RevokeApiKey RPC method.
+func (a adminService) RevokeApiKey(ctx context.Context, req *adminpb.RevokeApiKeyRequest) (*adminpb.ApiKey, error) {
+	if err := a.k.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	key, err := a.k.Revoke(ctx, req.Id)
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		return nil, status.Errorf(codes.NotFound, "no API key %q", req.Id)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "revoking API key: %v", err)
+	}
+	return apiKeyProto(key), nil
+}
+
+// checkAdmin returns Unauthenticated for a call without a bearer token and
+// PermissionDenied for one whose token is not the admin token.
+func (k *Keys) checkAdmin(ctx context.Context) error {
+	token, ok := auth.BearerToken(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing admin token")
+	}
+	if k.opts.Admin == nil || k.opts.Admin.Validate(ctx, token) != nil {
+		return status.Error(codes.PermissionDenied, "managing API keys requires the admin token")
+	}
+	return nil
+}
+
+func apiKeyProto(key store.APIKey) *adminpb.ApiKey {
+	p := &adminpb.ApiKey{Id: key.ID, Identity: key.Identity, CreateTime: timestamppb.New(key.Created)}
+	if !key.Revoked.IsZero() {
+		p.RevokeTime = timestamppb.New(key.Revoked)
+	}
+	return p
+}
@@ -0,0 +1,259 @@
+// Package apikey issues API keys, which clients send in x-api-key metadata
+// in place of a bearer token, and resolves them to the identity they were
+// issued to for the auth interceptors. Keys are managed through the
+// KeyAdmin service, which requires a separate admin token.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultRefreshInterval is how often keys are reloaded from the store
+// unless Options.RefreshInterval is set.
+const DefaultRefreshInterval = 30 * time.Second
+
+// prefix starts every key, so leaked keys are easy to recognize.
+const prefix = "gk_"
+
+// unknownKeyTTL is how long an ID the store does not have is rejected
+// without asking the store again, so callers sending made-up keys cost a
+// store read per ID at most this often.
+const unknownKeyTTL = 10 * time.Second
+
+// maxUnknownKeys bounds the IDs remembered as unknown; they are forgotten
+// all at once when it is reached.
+const maxUnknownKeys = 10000
+
+var errUnknownKey = errors.New("unknown key")
+
+var _ auth.APIKeyResolver = (*Keys)(nil)
+
+// Options configures Keys.
+type Options struct {
+	// Store keeps the keys. A store.MemoryAPIKeys is used when nil.
+	Store store.APIKeyStore
+	// Admin validates the bearer token every KeyAdmin call must carry.
+	// KeyAdmin refuses every call when nil.
+	Admin auth.TokenValidator
+	// RefreshInterval is how long keys are cached before being reloaded
+	// from Store, and so how long a key revoked through another server
+	// keeps working on this one. DefaultRefreshInterval is used when zero.
+	RefreshInterval time.Duration
+}
+
+// Keys issues, revokes and resolves API keys.
+type Keys struct {
+	opts Options
+	now  func() time.Time
+	// reads shares store reads between concurrent lookups: the reload of
+	// every key under "reload", and reads of single keys under "key:" and
+	// their IDs.
+	reads singleflight.Group
+
+	mu sync.Mutex
+	// cache holds the keys by ID as of loaded, plus those looked up or
+	// changed here since.
+	cache  map[string]store.APIKey
+	loaded time.Time
+	// unknown holds when each ID the store did not have was looked up.
+	unknown map[string]time.Time
+	// reloading is set while every key is read from the store; changes
+	// holds the keys created or revoked here meanwhile, which the keys
+	// read may predate.
+	reloading bool
+	changes   []store.APIKey
+}
+
+// New returns Keys applying opts.
+func New(opts Options) *Keys {
+	if opts.Store == nil {
+		opts.Store = store.NewMemoryAPIKeys()
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = DefaultRefreshInterval
+	}
+	return &Keys{opts: opts, now: time.Now}
+}
+
+// Create issues a key for identity, returning it and the key itself, which
+// only its salted hash is stored for.
+func (k *Keys) Create(ctx context.Context, identity string) (store.APIKey, string, error) {
+	id, secret, salt := make([]byte, 8), make([]byte, 32), make([]byte, 16)
+	for _, b := range [][]byte{id, secret, salt} {
+		if _, err := rand.Read(b); err != nil {
+			return store.APIKey{}, "", err
+		}
+	}
+	key := store.APIKey{
+		ID:       hex.EncodeToString(id),
+		Identity: identity,
+		Salt:     salt,
+		Hash:     hash(salt, secret),
+		Created:  k.now(),
+	}
+	if err := k.opts.Store.CreateAPIKey(ctx, key); err != nil {
+		return store.APIKey{}, "", err
+	}
+	k.changed(key)
+	return key, prefix + key.ID + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// List returns every key issued, revoked ones included, oldest first.
+func (k *Keys) List(ctx context.Context) ([]store.APIKey, error) {
+	return k.opts.Store.APIKeys(ctx)
+}
+
+// Revoke revokes the key with id, which this server then rejects at once
+// and others within their refresh interval. It returns
+// store.ErrAPIKeyNotFound for an unknown id.
+func (k *Keys) Revoke(ctx context.Context, id string) (store.APIKey, error) {
+	key, err := k.opts.Store.RevokeAPIKey(ctx, id, k.now())
+	if err != nil {
+		return store.APIKey{}, err
+	}
+	k.changed(key)
+	return key, nil
+}
+
+// changed caches key, as just written to the store.
+func (k *Keys) changed(key store.APIKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.cache != nil {
+		k.cache[key.ID] = key
+	}
+	if k.reloading {
+		k.changes = append(k.changes, key)
+	}
+	delete(k.unknown, key.ID)
+}
+
+// Resolve implements auth.APIKeyResolver.
+func (k *Keys) Resolve(ctx context.Context, key string) (string, error) {
+	id, encSecret, ok := strings.Cut(strings.TrimPrefix(key, prefix), ".")
+	if !ok || id == "" || !strings.HasPrefix(key, prefix) {
+		return "", errors.New("malformed key")
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(encSecret)
+	if err != nil {
+		return "", errors.New("malformed key")
+	}
+	stored, err := k.lookup(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare(hash(stored.Salt, secret), stored.Hash) != 1 {
+		return "", errUnknownKey
+	}
+	if !stored.Revoked.IsZero() {
+		return "", fmt.Errorf("key revoked at %s", stored.Revoked.UTC().Format(time.RFC3339))
+	}
+	return stored.Identity, nil
+}
+
+// lookup returns the key with id, reloading every key once the cache is a
+// refresh interval old. A key missing from the cache, perhaps issued by
+// another server since, is read from the store, unless the store did not
+// have it within unknownKeyTTL. The store is read without holding mu, so
+// lookups of cached keys never wait on it.
+func (k *Keys) lookup(ctx context.Context, id string) (store.APIKey, error) {
+	k.mu.Lock()
+	stale := k.cache == nil || k.now().Sub(k.loaded) >= k.opts.RefreshInterval
+	k.mu.Unlock()
+	if stale {
+		if err := k.reload(ctx); err != nil {
+			return store.APIKey{}, err
+		}
+	}
+
+	k.mu.Lock()
+	key, ok := k.cache[id]
+	missed, wasMissing := k.unknown[id]
+	now := k.now()
+	k.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if wasMissing && now.Sub(missed) < unknownKeyTTL {
+		return store.APIKey{}, errUnknownKey
+	}
+	v, err, _ := k.reads.Do("key:"+id, func() (any, error) {
+		return k.opts.Store.APIKey(ctx, id)
+	})
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		k.mu.Lock()
+		if k.unknown == nil || len(k.unknown) >= maxUnknownKeys {
+			k.unknown = make(map[string]time.Time)
+		}
+		k.unknown[id] = now
+		k.mu.Unlock()
+		return store.APIKey{}, errUnknownKey
+	}
+	if err != nil {
+		return store.APIKey{}, err
+	}
+	key = v.(store.APIKey)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// A revocation here while the key was read wins over what was read
+	if cached, ok := k.cache[id]; ok {
+		return cached, nil
+	}
+	k.cache[id] = key
+	return key, nil
+}
+
+// reload replaces the cache with every key in the store.
+func (k *Keys) reload(ctx context.Context) error {
+	_, err, _ := k.reads.Do("reload", func() (any, error) {
+		k.mu.Lock()
+		k.reloading, k.changes = true, nil
+		loaded := k.now()
+		k.mu.Unlock()
+
+		keys, err := k.opts.Store.APIKeys(ctx)
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		changes := k.changes
+		k.reloading, k.changes = false, nil
+		if err != nil {
+			return nil, err
+		}
+		k.cache = make(map[string]store.APIKey, len(keys))
+		for _, key := range keys {
+			k.cache[key.ID] = key
+		}
+		for _, key := range changes {
+			k.cache[key.ID] = key
+		}
+		k.loaded = loaded
+		// Unknown IDs are asked of the store again once it has been reread
+		k.unknown = nil
+		return nil, nil
+	})
+	return err
+}
+
+// hash returns the salted hash stored for secret. Secrets are random, not
+// chosen by people, so a fast hash suffices.
+func hash(salt, secret []byte) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write(secret)
+	return h.Sum(nil)
+}
@@ -0,0 +1,390 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	adminpb "github.com/shrivatsas/exp-codegen/grpc/protos/admin"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	adminToken = "admin-token"
+	userToken  = "user-token"
+)
+
+// clock is a settable time source for Keys.now.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// server is a Greeter and KeyAdmin served behind the auth interceptors,
+// accepting userToken and keys resolved by its Keys.
+type server struct {
+	*testutil.Server
+	keys *Keys
+	mu   sync.Mutex
+	// subject is who the last authenticated call was made by.
+	subject string
+}
+
+func start(t *testing.T, opts Options, c *clock) *server {
+	t.Helper()
+	s := &server{keys: New(opts)}
+	s.keys.now = c.now
+	authOpts := auth.DefaultOptions()
+	authOpts.APIKeys = s.keys
+	authOpts.Allowlist = append(authOpts.Allowlist, ServiceName)
+	v := auth.NewStaticValidator(userToken)
+	record := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		s.mu.Lock()
+		s.subject, _ = auth.SubjectFromContext(ctx)
+		s.mu.Unlock()
+		return handler(ctx, req)
+	}
+	s.Server = testutil.Start(t,
+		testutil.WithRegister(func(gs *grpc.Server) { s.keys.Register(gs) }),
+		testutil.WithServerOptions(grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(v, authOpts), record)))
+	return s
+}
+
+func (s *server) admin() adminpb.KeyAdminClient {
+	return adminpb.NewKeyAdminClient(s.Conn)
+}
+
+// hello calls SayHello with key, returning who the server saw calling.
+func (s *server) hello(ctx context.Context, key string) (string, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, auth.APIKeyMetadataKey, key)
+	if _, err := s.Client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subject, nil
+}
+
+func asAdmin(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, auth.MetadataKey, "Bearer "+adminToken)
+}
+
+func TestLifecycle(t *testing.T) {
+	c := &clock{t: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	srv := start(t, Options{Admin: auth.NewStaticValidator(adminToken)}, c)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := srv.admin().CreateApiKey(asAdmin(ctx), &adminpb.CreateApiKeyRequest{Identity: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Key, prefix+created.ApiKey.Id+".") || created.ApiKey.Identity != "alice" {
+		t.Errorf("CreateApiKey = %v, want a key for alice beginning with its ID", created)
+	}
+	if who, err := srv.hello(ctx, created.Key); err != nil || who != "alice" {
+		t.Fatalf("call with the key was made by %q, %v; want alice", who, err)
+	}
+
+	list, err := srv.admin().ListApiKeys(asAdmin(ctx), &adminpb.ListApiKeysRequest{})
+	if err != nil || len(list.ApiKeys) != 1 || list.ApiKeys[0].Id != created.ApiKey.Id || list.ApiKeys[0].RevokeTime != nil {
+		t.Fatalf("ListApiKeys = %v, %v; want the active key", list, err)
+	}
+
+	revoked, err := srv.admin().RevokeApiKey(asAdmin(ctx), &adminpb.RevokeApiKeyRequest{Id: created.ApiKey.Id})
+	if err != nil || !revoked.RevokeTime.AsTime().Equal(c.now()) {
+		t.Fatalf("RevokeApiKey = %v, %v; want it revoked now", revoked, err)
+	}
+	// The server that revoked the key rejects it at once
+	if _, err := srv.hello(ctx, created.Key); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call with the revoked key got %v, want Unauthenticated", err)
+	}
+	if _, err := srv.admin().RevokeApiKey(asAdmin(ctx), &adminpb.RevokeApiKeyRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("revoking an unknown key got %v, want NotFound", err)
+	}
+}
+
+func TestRevokeOnAnotherServer(t *testing.T) {
+	c := &clock{t: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	shared := store.NewMemoryAPIKeys()
+	a := start(t, Options{Store: shared, Admin: auth.NewStaticValidator(adminToken)}, c)
+	b := start(t, Options{Store: shared, RefreshInterval: time.Minute}, c)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := a.admin().CreateApiKey(asAdmin(ctx), &adminpb.CreateApiKeyRequest{Identity: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b has not loaded the key before, so finds it in the store
+	if who, err := b.hello(ctx, created.Key); err != nil || who != "alice" {
+		t.Fatalf("call to the other server was made by %q, %v; want alice", who, err)
+	}
+	if _, err := a.admin().RevokeApiKey(asAdmin(ctx), &adminpb.RevokeApiKeyRequest{Id: created.ApiKey.Id}); err != nil {
+		t.Fatal(err)
+	}
+	c.advance(59 * time.Second)
+	if _, err := b.hello(ctx, created.Key); err != nil {
+		t.Errorf("call within the refresh interval got %v, want the cached key accepted", err)
+	}
+	c.advance(time.Second)
+	if _, err := b.hello(ctx, created.Key); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call a refresh interval after the revocation got %v, want Unauthenticated", err)
+	}
+}
+
+func TestHashOnlyStorage(t *testing.T) {
+	c := &clock{t: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	keys := store.NewMemoryAPIKeys()
+	srv := start(t, Options{Store: keys, Admin: auth.NewStaticValidator(adminToken)}, c)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The clock stands still, so the keys are paired with their secrets by ID
+	// rather than creation order
+	secrets := make(map[string][]byte)
+	for _, identity := range []string{"alice", "bob"} {
+		created, err := srv.admin().CreateApiKey(asAdmin(ctx), &adminpb.CreateApiKeyRequest{Identity: identity})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, enc, _ := strings.Cut(created.Key, ".")
+		secret, err := base64.RawURLEncoding.DecodeString(enc)
+		if err != nil {
+			t.Fatalf("key %q has no secret: %v", created.Key, err)
+		}
+		secrets[created.ApiKey.Id] = secret
+	}
+
+	stored, err := keys.APIKeys(ctx)
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("APIKeys = %v, %v; want both keys", stored, err)
+	}
+	for _, k := range stored {
+		secret := secrets[k.ID]
+		for _, field := range [][]byte{[]byte(k.ID), []byte(k.Identity), k.Salt, k.Hash} {
+			if bytes.Contains(field, secret) || bytes.Contains(field, []byte(base64.RawURLEncoding.EncodeToString(secret))) {
+				t.Errorf("key %s stores its secret", k.ID)
+			}
+		}
+		if !bytes.Equal(k.Hash, hash(k.Salt, secret)) {
+			t.Errorf("key %s is not stored as the salted hash of its secret", k.ID)
+		}
+	}
+	if bytes.Equal(stored[0].Salt, stored[1].Salt) {
+		t.Error("both keys have the same salt")
+	}
+
+	// The ID alone does not authenticate
+	wrong := prefix + stored[0].ID + "." + base64.RawURLEncoding.EncodeToString(secrets[stored[1].ID])
+	if _, err := srv.hello(ctx, wrong); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call with another key's secret got %v, want Unauthenticated", err)
+	}
+}
+
+// slowStore counts the single keys read from it, holding each read until
+// release is closed if it is set, and likewise holds reloads of every key
+// until reloadRelease is closed.
+type slowStore struct {
+	store.APIKeyStore
+	mu            sync.Mutex
+	reads         int
+	release       chan struct{}
+	reloads       int
+	reloadRelease chan struct{}
+}
+
+func (s *slowStore) APIKeys(ctx context.Context) ([]store.APIKey, error) {
+	s.mu.Lock()
+	s.reloads++
+	release := s.reloadRelease
+	s.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	return s.APIKeyStore.APIKeys(ctx)
+}
+
+func (s *slowStore) reloadCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reloads
+}
+
+func (s *slowStore) APIKey(ctx context.Context, id string) (store.APIKey, error) {
+	s.mu.Lock()
+	s.reads++
+	release := s.release
+	s.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	return s.APIKeyStore.APIKey(ctx, id)
+}
+
+func (s *slowStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
+
+func TestEmptyIDDuringRefresh(t *testing.T) {
+	c := &clock{t: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	slow := &slowStore{APIKeyStore: store.NewMemoryAPIKeys()}
+	keys := New(Options{Store: slow, RefreshInterval: time.Minute})
+	keys.now = c.now
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, key, err := keys.Create(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := prefix + "." + base64.RawURLEncoding.EncodeToString([]byte("guess"))
+
+	// Hold a refresh of every key, started by a valid key, while a key
+	// with an empty ID arrives; neither may be answered for the other
+	slow.mu.Lock()
+	slow.reloadRelease = make(chan struct{})
+	slow.mu.Unlock()
+	type result struct {
+		who string
+		err error
+	}
+	valid := make(chan result, 1)
+	go func() {
+		who, err := keys.Resolve(ctx, key)
+		valid <- result{who, err}
+	}()
+	for slow.reloadCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := keys.Resolve(ctx, empty); err == nil || err.Error() != "malformed key" {
+		t.Errorf("Resolve of a key with an empty ID = %v, want malformed key", err)
+	}
+	close(slow.reloadRelease)
+	if r := <-valid; r.err != nil || r.who != "alice" {
+		t.Errorf("Resolve of a valid key during the refresh = %q, %v; want alice", r.who, r.err)
+	}
+	if got := slow.count(); got != 0 {
+		t.Errorf("store read %d single keys, want none", got)
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	c := &clock{t: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	slow := &slowStore{APIKeyStore: store.NewMemoryAPIKeys()}
+	keys := New(Options{Store: slow, RefreshInterval: time.Hour})
+	keys.now = c.now
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, key, err := keys.Create(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	made := prefix + "0123456789abcdef." + base64.RawURLEncoding.EncodeToString([]byte("guess"))
+
+	// A made-up ID is asked of the store once per unknownKeyTTL
+	for i := 0; i < 3; i++ {
+		if _, err := keys.Resolve(ctx, made); err == nil {
+			t.Fatal("resolved a made-up key")
+		}
+	}
+	if got := slow.count(); got != 1 {
+		t.Errorf("store read %d times for a made-up key, want once", got)
+	}
+	c.advance(unknownKeyTTL)
+	if _, err := keys.Resolve(ctx, made); err == nil {
+		t.Fatal("resolved a made-up key")
+	}
+	if got := slow.count(); got != 2 {
+		t.Errorf("store read %d times after unknownKeyTTL, want twice", got)
+	}
+
+	// A slow store read does not hold up keys already cached
+	c.advance(unknownKeyTTL)
+	slow.mu.Lock()
+	slow.release = make(chan struct{})
+	slow.mu.Unlock()
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := keys.Resolve(ctx, made)
+		blocked <- err
+	}()
+	for slow.count() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if who, err := keys.Resolve(ctx, key); err != nil || who != "alice" {
+		t.Errorf("Resolve during a store read = %q, %v; want alice", who, err)
+	}
+	close(slow.release)
+	if err := <-blocked; err == nil {
+		t.Error("resolved a made-up key")
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	c := &clock{t: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	srv := start(t, Options{Admin: auth.NewStaticValidator(adminToken)}, c)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	created, err := srv.admin().CreateApiKey(asAdmin(ctx), &adminpb.CreateApiKeyRequest{Identity: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callers := []struct {
+		name string
+		md   metadata.MD
+		want codes.Code
+	}{
+		{"no credentials", nil, codes.Unauthenticated},
+		{"API key", metadata.Pairs(auth.APIKeyMetadataKey, created.Key), codes.Unauthenticated},
+		{"user token", metadata.Pairs(auth.MetadataKey, "Bearer "+userToken), codes.PermissionDenied},
+		{"bad token", metadata.Pairs(auth.MetadataKey, "Bearer guess"), codes.PermissionDenied},
+	}
+	for _, caller := range callers {
+		ctx := metadata.NewOutgoingContext(ctx, caller.md)
+		calls := map[string]error{}
+		_, calls["CreateApiKey"] = srv.admin().CreateApiKey(ctx, &adminpb.CreateApiKeyRequest{Identity: "mallory"})
+		_, calls["ListApiKeys"] = srv.admin().ListApiKeys(ctx, &adminpb.ListApiKeysRequest{})
+		_, calls["RevokeApiKey"] = srv.admin().RevokeApiKey(ctx, &adminpb.RevokeApiKeyRequest{Id: created.ApiKey.Id})
+		for method, err := range calls {
+			if status.Code(err) != caller.want {
+				t.Errorf("%s with %s got %v, want %v", method, caller.name, err, caller.want)
+			}
+		}
+	}
+
+	// Nothing changed, and without an admin validator nobody is admin
+	list, err := srv.admin().ListApiKeys(asAdmin(ctx), &adminpb.ListApiKeysRequest{})
+	if err != nil || len(list.ApiKeys) != 1 || list.ApiKeys[0].RevokeTime != nil {
+		t.Errorf("ListApiKeys = %v, %v; want only alice's active key", list, err)
+	}
+	noAdmin := start(t, Options{}, c)
+	if _, err := noAdmin.admin().ListApiKeys(asAdmin(ctx), &adminpb.ListApiKeysRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ListApiKeys without an admin validator got %v, want PermissionDenied", err)
+	}
+}
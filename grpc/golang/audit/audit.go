@@ -0,0 +1,325 @@
+// Package audit provides server interceptors that append one JSON line per
+// RPC to a size-rotated audit log, recording who called what and with which
+// outcome, with names hashed rather than stored. Each line carries the hash
+// of the one before, so lines edited, removed or reordered in the middle of
+// the log break the chain; lines cut from its end do not.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Entry is one line of the audit log.
+type Entry struct {
+	// Time is when the call started.
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// Caller is the subject the auth interceptors authenticated the call as,
+	// empty for calls they allowlisted or rejected and for tokens naming
+	// nobody.
+	Caller    string `json:"caller,omitempty"`
+	Peer      string `json:"peer,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Code      string `json:"code"`
+	// DurationMS is how long the call took, in milliseconds.
+	DurationMS float64 `json:"duration_ms"`
+	// NameSHA256 holds the hex SHA-256 of each distinct non-empty name the
+	// call's requests carried, in the order first seen and at most
+	// maxNames of them.
+	NameSHA256 []string `json:"name_sha256,omitempty"`
+	// Messages counts a streaming call's messages; unset for unary calls.
+	Messages *Messages `json:"messages,omitempty"`
+	// Prev is the hex SHA-256 of the previous line of the log, without its
+	// newline, carried across rotation and reopening. It is empty only for
+	// the first entry a log ever holds.
+	Prev string `json:"prev,omitempty"`
+}
+
+// Messages counts the messages of a streaming call in each direction.
+type Messages struct {
+	Sent     int `json:"sent"`
+	Received int `json:"received"`
+}
+
+// maxNames caps the name hashes recorded for one streaming call.
+const maxNames = 64
+
+// defaultQueueSize is the number of entries waiting to be written when
+// Options.QueueSize is unset.
+const defaultQueueSize = 1024
+
+// Options configures a Log.
+type Options struct {
+	// MaxSize, if positive, rotates the log before an entry would take it
+	// past that many bytes.
+	MaxSize int64
+	// MaxFiles is how many rotated files are kept, path.1 the newest; older
+	// ones are removed. Zero keeps none, so rotating truncates the log.
+	MaxFiles int
+	// Sync flushes each entry to stable storage before the next is written.
+	Sync bool
+	// QueueSize is how many entries may wait to be written; calls that find
+	// the queue full are not logged. Defaults to 1024.
+	QueueSize int
+	// Dropped, if set, is incremented for every entry not written; see
+	// NewDroppedCounter.
+	Dropped prometheus.Counter
+}
+
+// NewDroppedCounter registers a counter of audit entries dropped on reg.
+func NewDroppedCounter(reg prometheus.Registerer) (prometheus.Counter, error) {
+	c := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "grpc_server_audit_entries_dropped_total",
+		Help: "Total number of audit log entries dropped because the queue was full or the write failed.",
+	})
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Log writes entries to a file from its own goroutine, so calls only wait
+// to queue their entry and never on the disk.
+type Log struct {
+	opts    Options
+	file    *rotatingFile
+	queue   chan Entry
+	done    chan struct{}
+	dropped atomic.Uint64
+	// write stores one encoded entry; tests replace it to stall the writer.
+	write func([]byte) error
+	// prev is the Prev of the next entry, used by the writer alone.
+	prev string
+
+	// mu guards closed, so no entry is queued once Close closes the queue.
+	mu     sync.RWMutex
+	closed bool
+	// err is the first write error, reported by Close.
+	err error
+}
+
+// Open opens, creating if needed, the audit log at path and starts writing
+// entries to it. Close it to write the queued entries and release the file.
+func Open(path string, opts Options) (*Log, error) {
+	f, err := openRotating(path, opts.MaxSize, opts.MaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	last, err := f.lastLine()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	l := &Log{
+		opts:  opts,
+		file:  f,
+		queue: make(chan Entry, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	if last != nil {
+		l.prev = lineHash(last)
+	}
+	l.write = l.writeFile
+	go l.run()
+	return l, nil
+}
+
+// Dropped returns the number of entries not written so far.
+func (l *Log) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close writes the entries still queued, closes the file and returns the
+// first error met writing. Entries of calls ending later are dropped.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+	if err := l.file.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// record queues e without waiting, dropping it if the queue is full.
+func (l *Log) record(e Entry) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if !l.closed {
+		select {
+		case l.queue <- e:
+			return
+		default:
+		}
+	}
+	l.drop()
+}
+
+func (l *Log) drop() {
+	l.dropped.Add(1)
+	if l.opts.Dropped != nil {
+		l.opts.Dropped.Inc()
+	}
+}
+
+func (l *Log) run() {
+	defer close(l.done)
+	for e := range l.queue {
+		e.Prev = l.prev
+		line, err := json.Marshal(e)
+		if err == nil {
+			err = l.write(append(line, '\n'))
+		}
+		if err != nil {
+			if l.err == nil {
+				l.err = err
+			}
+			l.drop()
+			continue
+		}
+		l.prev = lineHash(line)
+	}
+}
+
+// lineHash returns the hex SHA-256 of line, the Prev of the entry after it.
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+func (l *Log) writeFile(line []byte) error {
+	if err := l.file.Write(line); err != nil {
+		return err
+	}
+	if l.opts.Sync {
+		return l.file.Sync()
+	}
+	return nil
+}
+
+// UnaryServerInterceptor records each unary call once it completes. Place
+// it before the auth interceptors so calls they reject are recorded too;
+// entries still name the callers auth admits.
+func (l *Log) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx, caller := auth.RecordSubject(ctx)
+		resp, err := handler(ctx, req)
+
+		e := newEntry(ctx, info.FullMethod, start, caller(), err)
+		var names nameHashes
+		names.add(req)
+		e.NameSHA256 = names
+		l.record(e)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records each streaming call once it completes,
+// with the number of messages sent and received. Like
+// UnaryServerInterceptor, place it before the auth interceptors.
+func (l *Log) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, caller := auth.RecordSubject(ss.Context())
+		as := &auditServerStream{ServerStream: ss, ctx: ctx}
+		err := handler(srv, as)
+
+		e := newEntry(ctx, info.FullMethod, start, caller(), err)
+		e.NameSHA256 = as.names
+		e.Messages = &Messages{Sent: as.sent, Received: as.received}
+		l.record(e)
+		return err
+	}
+}
+
+type auditServerStream struct {
+	grpc.ServerStream
+	ctx            context.Context
+	sent, received int
+	names          nameHashes
+}
+
+func (s *auditServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *auditServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+	}
+	return err
+}
+
+func (s *auditServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received++
+		s.names.add(m)
+	}
+	return err
+}
+
+// newEntry describes a completed call. caller is the subject auth reported
+// after running later in the chain; when empty, auth may instead have run
+// earlier and left the subject in ctx.
+func newEntry(ctx context.Context, method string, start time.Time, caller string, err error) Entry {
+	e := Entry{
+		Time:       start,
+		Method:     method,
+		Caller:     caller,
+		Code:       status.Code(err).String(),
+		DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if e.Caller == "" {
+		e.Caller, _ = auth.SubjectFromContext(ctx)
+	}
+	e.RequestID, _ = requestid.FromContext(ctx)
+	if p, ok := peer.FromContext(ctx); ok {
+		e.Peer = p.Addr.String()
+	}
+	return e
+}
+
+// nameHashes collects the hashes of the names in a call's requests.
+type nameHashes []string
+
+// add records the hash of m's name, if it has one not seen before.
+func (h *nameHashes) add(m any) {
+	named, ok := m.(interface{ GetName() string })
+	if !ok || named.GetName() == "" || len(*h) == maxNames {
+		return
+	}
+	sum := sha256.Sum256([]byte(named.GetName()))
+	hash := hex.EncodeToString(sum[:])
+	for _, seen := range *h {
+		if seen == hash {
+			return
+		}
+	}
+	*h = append(*h, hash)
+}
@@ -0,0 +1,362 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var key = []byte("audit-test-key")
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(_ context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name must not be empty")
+	}
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!"}, nil
+}
+
+func (greeter) SayHelloChat(stream pb.Greeter_SayHelloChatServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.HelloReply{Message: "Hello, " + req.Name + "!"}); err != nil {
+			return err
+		}
+	}
+}
+
+// newClient serves greeter behind l and HMAC auth, returning a client
+// authenticated as subject, or sending no token if subject is empty.
+func newClient(t *testing.T, l *Log, subject string) pb.GreeterClient {
+	t.Helper()
+	v := auth.NewHMACValidator(key)
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(l.UnaryServerInterceptor(), auth.UnaryServerInterceptor(v, auth.Options{})),
+		grpc.ChainStreamInterceptor(l.StreamServerInterceptor(), auth.StreamServerInterceptor(v, auth.Options{})))
+	pb.RegisterGreeterServer(s, greeter{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	opts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if subject != "" {
+		token := auth.SignToken(key, subject, time.Now().Add(time.Hour))
+		opts = append(opts, grpc.WithPerRPCCredentials(auth.TokenCredentials{Token: token, AllowInsecure: true}))
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewGreeterClient(conn)
+}
+
+// readEntries returns the entries in the file at path.
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func hash(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, Options{Sync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newClient(t, l, "svc-a")
+	anonymous := newClient(t, l, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	before := time.Now()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument", err)
+	}
+	if _, err := anonymous.SayHello(ctx, &pb.HelloRequest{Name: "Eve"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+	stream, err := client.SayHelloChat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Ada", "Bob", "Ada"} {
+		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream.CloseSend()
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("got %v, want the chat to end", err)
+	}
+	// The server records the stream after the client sees its end
+	if err := waitFor(func() bool { return len(readEntries(t, path)) == 4 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readEntries(t, path)
+	hello, failed, rejected, chat := entries[0], entries[1], entries[2], entries[3]
+	if hello.Method != "/example.Greeter/SayHello" || hello.Code != "OK" || hello.Caller != "svc-a" || hello.Peer == "" {
+		t.Errorf("got SayHello entry %+v", hello)
+	}
+	if hello.Time.Before(before.Add(-time.Second)) || hello.DurationMS < 0 || hello.Messages != nil {
+		t.Errorf("got SayHello entry %+v", hello)
+	}
+	if want := []string{hash("alice@example.com")}; len(hello.NameSHA256) != 1 || hello.NameSHA256[0] != want[0] {
+		t.Errorf("got name hashes %q, want %q", hello.NameSHA256, want)
+	}
+	line, _ := os.ReadFile(path)
+	if strings.Contains(string(line), "alice") {
+		t.Error("the log holds the raw name")
+	}
+	if failed.Code != "InvalidArgument" || failed.NameSHA256 != nil {
+		t.Errorf("got failed entry %+v, want InvalidArgument without names", failed)
+	}
+	if rejected.Code != "Unauthenticated" || rejected.Caller != "" || rejected.Peer == "" {
+		t.Errorf("got rejected entry %+v, want Unauthenticated without a caller", rejected)
+	}
+	if chat.Method != "/example.Greeter/SayHelloChat" || chat.Caller != "svc-a" {
+		t.Errorf("got chat entry %+v", chat)
+	}
+	if chat.Messages == nil || *chat.Messages != (Messages{Sent: 3, Received: 3}) {
+		t.Errorf("got chat messages %+v, want 3 each way", chat.Messages)
+	}
+	if want := []string{hash("Ada"), hash("Bob")}; len(chat.NameSHA256) != 2 || chat.NameSHA256[0] != want[0] || chat.NameSHA256[1] != want[1] {
+		t.Errorf("got chat name hashes %q, want %q", chat.NameSHA256, want)
+	}
+}
+
+// waitFor polls cond until it holds or five seconds pass.
+func waitFor(cond func() bool) error {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return errors.New("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, Options{MaxSize: 700, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newClient(t, l, "svc-a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 20; i++ {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 700 {
+			t.Errorf("%s is %d bytes, over the 700 limit", p, info.Size())
+		}
+		total += len(readEntries(t, p))
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v for a third rotated file, want only two kept", err)
+	}
+	// Entries are about 310 bytes, so two fit in each file and the 14 before
+	// the newest 6 were in files since removed
+	if total != 6 {
+		t.Errorf("got %d entries in the kept files, want 6", total)
+	}
+}
+
+func TestChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The chain carries on across rotation and reopening the log
+	for i := 0; i < 2; i++ {
+		l, err := Open(path, Options{MaxSize: 700, MaxFiles: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := newClient(t, l, "svc-a")
+		for j := 0; j < 3; j++ {
+			if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var lines [][]byte
+	for _, p := range []string{path + ".2", path + ".1", path} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))...)
+	}
+	if len(lines) != 6 {
+		t.Fatalf("got %d lines, want 6", len(lines))
+	}
+	for i, line := range lines {
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatal(err)
+		}
+		want := ""
+		if i > 0 {
+			sum := sha256.Sum256(lines[i-1])
+			want = hex.EncodeToString(sum[:])
+		}
+		if e.Prev != want {
+			t.Errorf("line %d has prev %q, want %q", i, e.Prev, want)
+		}
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped"})
+	l, err := Open(path, Options{QueueSize: 2, Dropped: dropped})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stall the writer on the first entry
+	var once sync.Once
+	writing, release := make(chan struct{}), make(chan struct{})
+	l.write = func(line []byte) error {
+		once.Do(func() {
+			close(writing)
+			<-release
+		})
+		return l.writeFile(line)
+	}
+	client := newClient(t, l, "svc-a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	<-writing
+	// Two entries fill the queue and the rest are dropped, without calls
+	// waiting for the writer
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("calls took %v with the writer stalled", elapsed)
+	}
+	if got := l.Dropped(); got != 3 {
+		t.Errorf("got %d dropped, want 3", got)
+	}
+	if got := testutil.ToFloat64(dropped); got != 3 {
+		t.Errorf("got counter %v, want 3", got)
+	}
+
+	close(release)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(readEntries(t, path)); got != 3 {
+		t.Errorf("got %d entries written, want 3", got)
+	}
+}
+
+func TestCloseDropsLateEntries(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "audit.log"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	l.record(Entry{Method: "/late"})
+	if got := l.Dropped(); got != 1 {
+		t.Errorf("got %d dropped, want 1", got)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// rotatingFile appends to path, moving it aside to path.1, path.1 to path.2
+// and so on up to maxFiles before a write would take it past maxSize. It is
+// used by the Log's goroutine alone.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func openRotating(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("audit: %w", err)
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// lastLine returns the last line written, without its newline, from path or,
+// if that is empty, from path.1; nil if there is none.
+func (r *rotatingFile) lastLine() ([]byte, error) {
+	for _, p := range []string{r.path, r.rotated(1)} {
+		line, err := lastLine(p)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("audit: %w", err)
+		}
+		if line != nil {
+			return line, nil
+		}
+	}
+	return nil, nil
+}
+
+// lastLine reads the file at path backwards until it holds a whole last
+// line, returning it without its newline.
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var tail []byte
+	for off := end; off > 0; {
+		n := min(off, 4096)
+		off -= n
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, off); err != nil {
+			return nil, err
+		}
+		tail = append(chunk, tail...)
+		line := bytes.TrimSuffix(tail, []byte("\n"))
+		if i := bytes.LastIndexByte(line, '\n'); i >= 0 {
+			return line[i+1:], nil
+		}
+		if off == 0 && len(line) > 0 {
+			return line, nil
+		}
+	}
+	return nil, nil
+}
+
+// Write appends line, rotating first if it would not fit. A line longer
+// than maxSize gets a file of its own.
+func (r *rotatingFile) Write(line []byte) error {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(line)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.f.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+func (r *rotatingFile) Sync() error {
+	if err := r.f.Sync(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+func (r *rotatingFile) Close() error {
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+// rotate closes the current file, shifts the rotated ones along, dropping
+// the oldest, and opens a new, empty file at path. If the files cannot be
+// moved the current one is reopened, so entries keep being appended.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	err := r.shift()
+	if openErr := r.open(); err == nil {
+		err = openErr
+	}
+	return err
+}
+
+func (r *rotatingFile) shift() error {
+	if r.maxFiles == 0 {
+		if err := os.Remove(r.path); err != nil {
+			return fmt.Errorf("audit: %w", err)
+		}
+		return nil
+	}
+	if err := os.Remove(r.rotated(r.maxFiles)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("audit: %w", err)
+	}
+	for n := r.maxFiles - 1; n >= 1; n-- {
+		if err := os.Rename(r.rotated(n), r.rotated(n+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("audit: %w", err)
+		}
+	}
+	if err := os.Rename(r.path, r.rotated(1)); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+func (r *rotatingFile) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
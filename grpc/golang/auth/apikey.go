@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// APIKeyMetadataKey is the metadata key carrying an API key.
+const APIKeyMetadataKey = "x-api-key"
+
+// APIKeyResolver looks up who API keys were issued to.
+type APIKeyResolver interface {
+	// Resolve returns the identity key was issued to, or an error if key
+	// is unknown or revoked.
+	Resolve(ctx context.Context, key string) (string, error)
+}
+
+// apiKey extracts the call's API key.
+func apiKey(ctx context.Context) (string, bool) {
+	values := metadata.ValueFromIncomingContext(ctx, APIKeyMetadataKey)
+	if len(values) == 0 || values[0] == "" {
+		return "", false
+	}
+	return values[0], true
+}
+
+var _ credentials.PerRPCCredentials = APIKeyCredentials{}
+
+// APIKeyCredentials attaches an API key to every RPC. Use it with
+// grpc.WithPerRPCCredentials.
+type APIKeyCredentials struct {
+	// Key is sent as "x-api-key: <Key>".
+	Key string
+	// AllowInsecure permits sending the key over a plaintext connection,
+	// which gRPC otherwise refuses. Only use it for local development.
+	AllowInsecure bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c APIKeyCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{APIKeyMetadataKey: c.Key}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c APIKeyCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
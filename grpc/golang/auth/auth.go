@@ -0,0 +1,170 @@
+// Package auth provides bearer-token authentication for gRPC: server
+// interceptors that check the "authorization" metadata against a
+// TokenValidator, or an "x-api-key" entry against an APIKeyResolver, and
+// client credentials that attach the token or key to each RPC.
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataKey is the metadata key carrying the bearer token.
+const MetadataKey = "authorization"
+
+// HealthService is the health checking service name, allowlisted by
+// DefaultOptions so load balancers can probe without a token.
+var HealthService = healthpb.Health_ServiceDesc.ServiceName
+
+// TokenValidator decides whether a bearer token is acceptable.
+type TokenValidator interface {
+	// Validate returns nil if token is valid and an error describing why
+	// it is not otherwise.
+	Validate(ctx context.Context, token string) error
+}
+
+// SubjectValidator is a TokenValidator whose tokens name the subject they
+// were issued to. The interceptors record the subject of each authenticated
+// call so it can be read with SubjectFromContext.
+type SubjectValidator interface {
+	TokenValidator
+	// Subject returns the subject of a token that passed Validate.
+	Subject(token string) string
+}
+
+type subjectKey struct{}
+
+// SubjectFromContext returns the subject of the token that authenticated the
+// call, if the validator is a SubjectValidator.
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(string)
+	return subject, ok && subject != ""
+}
+
+type subjectRecordKey struct{}
+
+// RecordSubject returns ctx and a function reporting the subject the auth
+// interceptors further down the chain authenticated the call as, once they
+// have run. It lets interceptors placed before auth, such as the audit
+// log's, name the caller of calls that auth went on to admit.
+func RecordSubject(ctx context.Context) (context.Context, func() string) {
+	subject := new(string)
+	return context.WithValue(ctx, subjectRecordKey{}, subject), func() string { return *subject }
+}
+
+// withSubject returns ctx carrying subject, also reporting it to an
+// earlier RecordSubject.
+func withSubject(ctx context.Context, subject string) context.Context {
+	if recorded, ok := ctx.Value(subjectRecordKey{}).(*string); ok {
+		*recorded = subject
+	}
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// Options controls which RPCs the interceptors authenticate.
+type Options struct {
+	// Allowlist names RPCs that skip authentication, either as full method
+	// names ("/pkg.Service/Method") or as service names ("pkg.Service") to
+	// cover every method of the service.
+	Allowlist []string
+	// APIKeys, if set, authenticates calls carrying an APIKeyMetadataKey
+	// entry, in place of a bearer token, as the identity it resolves the
+	// key to.
+	APIKeys APIKeyResolver
+}
+
+// DefaultOptions allowlists the health service.
+func DefaultOptions() Options {
+	return Options{Allowlist: []string{HealthService}}
+}
+
+// allowed reports whether fullMethod skips authentication.
+func (o Options) allowed(fullMethod string) bool {
+	for _, entry := range o.Allowlist {
+		if entry == fullMethod || strings.HasPrefix(fullMethod, "/"+entry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor rejects unary RPCs without a valid token with Unauthenticated.
+func UnaryServerInterceptor(v TokenValidator, opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, v, opts, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streaming RPCs without a valid token with Unauthenticated.
+func StreamServerInterceptor(v TokenValidator, opts Options) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), v, opts, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		if ctx != ss.Context() {
+			ss = &serverStream{ServerStream: ss, ctx: ctx}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// authenticate checks the call's token and returns ctx carrying its subject
+// when v can name one.
+func authenticate(ctx context.Context, v TokenValidator, opts Options, fullMethod string) (context.Context, error) {
+	if opts.allowed(fullMethod) {
+		return ctx, nil
+	}
+	if key, ok := apiKey(ctx); ok && opts.APIKeys != nil {
+		identity, err := opts.APIKeys.Resolve(ctx, key)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid API key: %v", err)
+		}
+		return withSubject(ctx, identity), nil
+	}
+	token, ok := BearerToken(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	if err := v.Validate(ctx, token); err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+	}
+	if sv, ok := v.(SubjectValidator); ok {
+		ctx = withSubject(ctx, sv.Subject(token))
+	}
+	return ctx, nil
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// BearerToken extracts the token from the call's "authorization: Bearer
+// <token>" entry, e.g. for a service checking a token of its own.
+func BearerToken(ctx context.Context) (string, bool) {
+	values := metadata.ValueFromIncomingContext(ctx, MetadataKey)
+	if len(values) == 0 {
+		return "", false
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newTestConn serves the Greeter and health services behind the interceptors.
+func newTestConn(t *testing.T, v TokenValidator, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	return testutil.Start(t,
+		testutil.WithServerOptions(
+			grpc.UnaryInterceptor(UnaryServerInterceptor(v, DefaultOptions())),
+			grpc.StreamInterceptor(StreamServerInterceptor(v, DefaultOptions()))),
+		testutil.WithDialOptions(opts...),
+	).Conn
+}
+
+func TestInterceptors(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want codes.Code
+	}{
+		{"missing token", nil, codes.Unauthenticated},
+		{"wrong scheme", metadata.Pairs(MetadataKey, "Basic secret"), codes.Unauthenticated},
+		{"bad token", metadata.Pairs(MetadataKey, "Bearer guess"), codes.Unauthenticated},
+		{"good token", metadata.Pairs(MetadataKey, "Bearer secret"), codes.OK},
+		{"lowercase scheme", metadata.Pairs(MetadataKey, "bearer secret"), codes.OK},
+	}
+	client := pb.NewGreeterClient(newTestConn(t, NewStaticValidator("secret")))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = metadata.NewOutgoingContext(ctx, tt.md)
+
+			_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"})
+			if status.Code(err) != tt.want {
+				t.Errorf("SayHello: got %v, want %v", err, tt.want)
+			}
+
+			stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice"})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if status.Code(err) != tt.want {
+				t.Errorf("SayHelloStream: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthBypassesAuth(t *testing.T) {
+	conn := newTestConn(t, NewStaticValidator("secret"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check without a token: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("got status %v, want SERVING", resp.Status)
+	}
+}
+
+func TestTokenCredentials(t *testing.T) {
+	creds := TokenCredentials{Token: "secret", AllowInsecure: true}
+	conn := newTestConn(t, NewStaticValidator("secret"), grpc.WithPerRPCCredentials(creds))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.Message != "Hello, Alice!" {
+		t.Errorf("got message %q", resp.Message)
+	}
+
+	if !(TokenCredentials{Token: "secret"}).RequireTransportSecurity() {
+		t.Error("TokenCredentials without AllowInsecure does not require transport security")
+	}
+}
+
+func TestOptionsAllowed(t *testing.T) {
+	opts := Options{Allowlist: []string{HealthService, "/example.Greeter/SayHello"}}
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"/grpc.health.v1.Health/Check", true},
+		{"/grpc.health.v1.Health/Watch", true},
+		{"/grpc.health.v1.HealthX/Check", false},
+		{"/example.Greeter/SayHello", true},
+		{"/example.Greeter/SayHelloStream", false},
+	}
+	for _, tt := range tests {
+		if got := opts.allowed(tt.method); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
+
+// subjectGreeter replies with the authenticated subject.
+type subjectGreeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (subjectGreeter) SayHello(ctx context.Context, _ *pb.HelloRequest) (*pb.HelloReply, error) {
+	subject, _ := SubjectFromContext(ctx)
+	return &pb.HelloReply{Message: subject}, nil
+}
+
+func (subjectGreeter) SayHelloStream(_ *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	subject, _ := SubjectFromContext(stream.Context())
+	return stream.Send(&pb.HelloReply{Message: subject})
+}
+
+func TestSubjectFromContext(t *testing.T) {
+	key := []byte("signing key")
+	v := NewHMACValidator(key)
+	client := testutil.Start(t,
+		testutil.WithService(subjectGreeter{}),
+		testutil.WithServerOptions(
+			grpc.UnaryInterceptor(UnaryServerInterceptor(v, DefaultOptions())),
+			grpc.StreamInterceptor(StreamServerInterceptor(v, DefaultOptions()))),
+	).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, "Bearer "+SignToken(key, "alice", time.Now().Add(time.Hour)))
+
+	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.Message != "alice" {
+		t.Errorf("SayHello handler saw subject %q, want alice", resp.Message)
+	}
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.Message != "alice" {
+		t.Errorf("SayHelloStream handler saw subject %v (err %v), want alice", resp, err)
+	}
+}
+
+// mapResolver resolves the API keys in it to their identities.
+type mapResolver map[string]string
+
+func (r mapResolver) Resolve(_ context.Context, key string) (string, error) {
+	identity, ok := r[key]
+	if !ok {
+		return "", errors.New("unknown key")
+	}
+	return identity, nil
+}
+
+func TestAPIKeys(t *testing.T) {
+	opts := DefaultOptions()
+	opts.APIKeys = mapResolver{"key-1": "alice"}
+	v := NewStaticValidator("secret")
+	client := testutil.Start(t,
+		testutil.WithService(subjectGreeter{}),
+		testutil.WithServerOptions(
+			grpc.UnaryInterceptor(UnaryServerInterceptor(v, opts)),
+			grpc.StreamInterceptor(StreamServerInterceptor(v, opts))),
+	).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name        string
+		md          metadata.MD
+		want        codes.Code
+		wantSubject string
+	}{
+		{"good key", metadata.Pairs(APIKeyMetadataKey, "key-1"), codes.OK, "alice"},
+		{"unknown key", metadata.Pairs(APIKeyMetadataKey, "key-2"), codes.Unauthenticated, ""},
+		// A key is checked in place of the token, so a bad one fails
+		{"unknown key and token", metadata.Pairs(APIKeyMetadataKey, "key-2", MetadataKey, "Bearer secret"), codes.Unauthenticated, ""},
+		{"token only", metadata.Pairs(MetadataKey, "Bearer secret"), codes.OK, ""},
+	}
+	for _, tt := range tests {
+		resp, err := client.SayHello(metadata.NewOutgoingContext(ctx, tt.md), &pb.HelloRequest{Name: "Alice"})
+		if status.Code(err) != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err == nil && resp.Message != tt.wantSubject {
+			t.Errorf("%s: handler saw subject %q, want %q", tt.name, resp.Message, tt.wantSubject)
+		}
+	}
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice"},
+		grpc.PerRPCCredentials(APIKeyCredentials{Key: "key-1", AllowInsecure: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.Message != "alice" {
+		t.Errorf("SayHelloStream with APIKeyCredentials saw subject %v (err %v), want alice", resp, err)
+	}
+}
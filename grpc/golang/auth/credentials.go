@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+var _ credentials.PerRPCCredentials = TokenCredentials{}
+
+// TokenCredentials attaches a bearer token to every RPC. Use it with
+// grpc.WithPerRPCCredentials.
+type TokenCredentials struct {
+	// Token is sent as "authorization: Bearer <Token>".
+	Token string
+	// AllowInsecure permits sending the token over a plaintext connection,
+	// which gRPC otherwise refuses. Only use it for local development.
+	AllowInsecure bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c TokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{MetadataKey: "Bearer " + c.Token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c TokenCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticValidator(t *testing.T) {
+	v := NewStaticValidator("alpha", "beta")
+	for _, token := range []string{"alpha", "beta"} {
+		if err := v.Validate(context.Background(), token); err != nil {
+			t.Errorf("Validate(%q): %v", token, err)
+		}
+	}
+	for _, token := range []string{"", "alph", "alphabet", "gamma"} {
+		if err := v.Validate(context.Background(), token); err == nil {
+			t.Errorf("Validate(%q) accepted an unknown token", token)
+		}
+	}
+}
+
+func TestHMACValidator(t *testing.T) {
+	key := []byte("signing key")
+	now := time.Unix(1_700_000_000, 0)
+	v := NewHMACValidator(key)
+	v.now = func() time.Time { return now }
+
+	valid := SignToken(key, "alice|admin", now.Add(time.Hour))
+	payload, _, _ := strings.Cut(valid, ".")
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", valid, ""},
+		{"expired", SignToken(key, "alice", now), "expired"},
+		{"other key", SignToken([]byte("other key"), "alice", now.Add(time.Hour)), "bad signature"},
+		{"tampered signature", payload + ".AAAA", "bad signature"},
+		{"tampered payload", encode([]byte("mallory|9999999999")) + valid[len(payload):], "bad signature"},
+		{"no separator", payload, "malformed"},
+		{"bad encoding", "!!!.!!!", "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(context.Background(), tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				if got := v.Subject(tt.token); got != "alice|admin" {
+					t.Errorf("Subject = %q, want alice|admin", got)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Package capture records every RPC a server handles, its metadata and each
+// message either way, to a file that Replay can later send to a server
+// again, reporting where its responses differ from those recorded.
+package capture
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	capturepb "github.com/shrivatsas/exp-codegen/grpc/protos/capture"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// StrippedMetadata lists the request metadata keys never written to a
+// capture, as they carry credentials.
+var StrippedMetadata = []string{"authorization", auth.APIKeyMetadataKey, "cookie"}
+
+// Options configures a Recorder.
+type Options struct {
+	// Strip names request metadata keys left out of the capture besides
+	// StrippedMetadata.
+	Strip []string
+	// Exclude names RPCs that are not captured, either as full method names
+	// ("/pkg.Service/Method") or as service names ("pkg.Service") to cover
+	// every method of the service.
+	Exclude []string
+}
+
+// Recorder writes the calls passing through its interceptors to a capture
+// file as capturepb.Record messages, each preceded by its length as a
+// varint. Failing to write never fails a call; Close reports the first
+// error.
+type Recorder struct {
+	opts  Options
+	now   func() time.Time
+	calls atomic.Uint64
+
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	err error
+}
+
+// Open creates, or truncates, the capture file at path and returns a
+// Recorder writing to it. It is created readable only by its owner, as
+// messages may hold personal data.
+func Open(path string, opts Options) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{opts: opts, now: time.Now, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Close closes the file and returns the first error met writing to it.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return r.err
+	}
+	if err := r.f.Close(); r.err == nil {
+		r.err = err
+	}
+	r.f = nil
+	return r.err
+}
+
+// write appends rec to the file, flushing it so a capture can be read while
+// the server runs.
+func (r *Recorder) write(rec *capturepb.Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil || r.err != nil {
+		return
+	}
+	if _, err := protodelim.MarshalTo(r.w, rec); err != nil {
+		r.err = err
+		return
+	}
+	r.err = r.w.Flush()
+}
+
+func (r *Recorder) excluded(fullMethod string) bool {
+	for _, entry := range r.opts.Exclude {
+		if entry == fullMethod || strings.HasPrefix(fullMethod, "/"+entry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stripped reports whether the metadata key is left out of captures.
+func (r *Recorder) stripped(key string) bool {
+	for _, k := range StrippedMetadata {
+		if k == key {
+			return true
+		}
+	}
+	for _, k := range r.opts.Strip {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// call records the events of one RPC.
+type call struct {
+	r      *Recorder
+	id     uint64
+	method string
+}
+
+// start numbers a call to method arriving with ctx and records its start.
+func (r *Recorder) start(ctx context.Context, method string, clientStreams, serverStreams bool) *call {
+	c := &call{r: r, id: r.calls.Add(1), method: method}
+	rec := c.record(capturepb.Record_KIND_START)
+	rec.ClientStreams, rec.ServerStreams = clientStreams, serverStreams
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		if !r.stripped(key) {
+			rec.Metadata = append(rec.Metadata, &capturepb.Metadata{Key: key, Values: values})
+		}
+	}
+	// Map order is random; sorted keys keep captures of the same call alike
+	sort.Slice(rec.Metadata, func(i, j int) bool { return rec.Metadata[i].Key < rec.Metadata[j].Key })
+	r.write(rec)
+	return c
+}
+
+func (c *call) record(kind capturepb.Record_Kind) *capturepb.Record {
+	return &capturepb.Record{Call: c.id, Method: c.method, Kind: kind, Time: timestamppb.New(c.r.now())}
+}
+
+// message records m as sent by the client or server. Messages of codecs
+// other than protobuf are recorded without their content.
+func (c *call) message(kind capturepb.Record_Kind, m any) {
+	rec := c.record(kind)
+	if pm, ok := m.(proto.Message); ok {
+		a, err := anypb.New(pm)
+		if err != nil {
+			c.r.mu.Lock()
+			if c.r.err == nil {
+				c.r.err = err
+			}
+			c.r.mu.Unlock()
+			return
+		}
+		rec.Message = a
+	}
+	c.r.write(rec)
+}
+
+// end records the status the call finished with.
+func (c *call) end(err error) {
+	rec := c.record(capturepb.Record_KIND_END)
+	if err != nil {
+		st := status.Convert(err)
+		rec.Code, rec.Error = int32(st.Code()), st.Message()
+	}
+	c.r.write(rec)
+}
+
+// UnaryServerInterceptor captures unary calls. Place it near the start of
+// the chain so calls rejected by later interceptors are captured too.
+func (r *Recorder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if r.excluded(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		c := r.start(ctx, info.FullMethod, false, false)
+		c.message(capturepb.Record_KIND_REQUEST, req)
+		resp, err := handler(ctx, req)
+		if err == nil {
+			c.message(capturepb.Record_KIND_RESPONSE, resp)
+		}
+		c.end(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor captures streaming calls, recording each message
+// as it is received or sent.
+func (r *Recorder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if r.excluded(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		c := r.start(ss.Context(), info.FullMethod, info.IsClientStream, info.IsServerStream)
+		err := handler(srv, &serverStream{ServerStream: ss, call: c})
+		c.end(err)
+		return err
+	}
+}
+
+// serverStream records the messages of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	call *call
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.call.message(capturepb.Record_KIND_REQUEST, m)
+	return nil
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	s.call.message(capturepb.Record_KIND_RESPONSE, m)
+	return nil
+}
+
+// Reader reads the records of a capture file in the order they were
+// written.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader reading a capture from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record, or io.EOF after the last.
+func (r *Reader) Next() (*capturepb.Record, error) {
+	rec := &capturepb.Record{}
+	if err := (protodelim.UnmarshalOptions{MaxSize: -1}).UnmarshalFrom(r.r, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
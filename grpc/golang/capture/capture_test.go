@@ -0,0 +1,182 @@
+package capture
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	capturepb "github.com/shrivatsas/exp-codegen/grpc/protos/capture"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// ignore leaves out the fields that differ between any two servers.
+var ignore = ReplayOptions{Ignore: []string{"served_at"}}
+
+// shouting greets in capitals, as a changed handler might.
+type shouting struct{}
+
+func (shouting) Format(_ greeter.MessageKind, _ string, data greeter.MessageData) (string, bool, error) {
+	return "HELLO, " + strings.ToUpper(data.Name) + "!", true, nil
+}
+
+// start serves a Greeter streaming without pauses, configured by opts.
+func start(t *testing.T, opts ...testutil.Option) *testutil.Server {
+	t.Helper()
+	defaults := testutil.WithGreeterOptions(greeter.WithStreamInterval(0), greeter.WithInstanceID("greeter-1"))
+	return testutil.Start(t, append([]testutil.Option{defaults}, opts...)...)
+}
+
+// session captures a mix of unary and streaming calls and returns the path
+// of the capture.
+func session(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture")
+	r, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := start(t, testutil.WithServerOptions(grpc.UnaryInterceptor(r.UnaryServerInterceptor()), grpc.StreamInterceptor(r.StreamServerInterceptor())))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret", "x-trace", "t-1")
+
+	if _, err := ts.Client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := ts.Client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Ada", Count: proto.Int32(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	chat, err := ts.Client.SayHelloChat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Grace", "Linus"} {
+		if err := chat.Send(&pb.HelloRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chat.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chat.CloseSend()
+	if _, err := chat.Recv(); err != io.EOF {
+		t.Fatalf("chat ended with %v, want EOF", err)
+	}
+	if _, err := ts.Client.SayHello(ctx, &pb.HelloRequest{}); err == nil {
+		t.Fatal("SayHello without a name succeeded")
+	}
+
+	ts.Stop()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readCalls(t *testing.T, path string) []*Call {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	calls, err := ReadCalls(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return calls
+}
+
+func TestCapture(t *testing.T) {
+	path := session(t)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var kinds []string
+	rd := NewReader(f)
+	for {
+		rec, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Time == nil {
+			t.Errorf("record %v has no time", rec)
+		}
+		if rec.Kind == capturepb.Record_KIND_START {
+			var keys []string
+			for _, md := range rec.Metadata {
+				keys = append(keys, md.Key)
+			}
+			if got := strings.Join(keys, " "); strings.Contains(got, "authorization") || !strings.Contains(got, "x-trace") {
+				t.Errorf("call %d captured metadata keys %s, want x-trace but not authorization", rec.Call, got)
+			}
+		}
+		kinds = append(kinds, strings.TrimPrefix(rec.Kind.String(), "KIND_"))
+	}
+	want := "START REQUEST RESPONSE END " +
+		"START REQUEST RESPONSE RESPONSE RESPONSE END " +
+		"START REQUEST RESPONSE REQUEST RESPONSE END " +
+		"START REQUEST END"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("got records\n%s\nwant\n%s", got, want)
+	}
+
+	calls := readCalls(t, path)
+	if len(calls) != 4 {
+		t.Fatalf("got %d calls, want 4", len(calls))
+	}
+	if c := calls[3]; c.Method != pb.Greeter_SayHello_FullMethodName || c.Code != codes.InvalidArgument {
+		t.Errorf("last call is %s finishing %v, want SayHello rejected with InvalidArgument", c.Method, c.Code)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	calls := readCalls(t, session(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if diffs := Replay(ctx, start(t).Conn, calls, ignore); len(diffs) > 0 {
+		t.Errorf("replay against the same server differs: %v", diffs)
+	}
+
+	diffs := Replay(ctx, start(t, testutil.WithGreeterOptions(greeter.WithFormatter(shouting{}))).Conn, calls, ignore)
+	methods := make(map[string]int)
+	for _, d := range diffs {
+		methods[d.Call.Method]++
+		if !strings.Contains(d.Problem, "HELLO") {
+			t.Errorf("diff %v does not show the changed greeting", d)
+		}
+	}
+	if methods[pb.Greeter_SayHello_FullMethodName] != 1 || methods[pb.Greeter_SayHelloStream_FullMethodName] != 3 || methods[pb.Greeter_SayHelloChat_FullMethodName] != 2 {
+		t.Errorf("got diffs %v, want one for each greeting", diffs)
+	}
+
+	// Without ignoring the reply time, every greeting differs
+	if diffs := Replay(ctx, start(t).Conn, calls, ReplayOptions{}); len(diffs) != 6 {
+		t.Errorf("got %d diffs comparing served_at, want 6", len(diffs))
+	}
+}
@@ -0,0 +1,252 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	capturepb "github.com/shrivatsas/exp-codegen/grpc/protos/capture"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Call is a captured RPC, assembled from its records.
+type Call struct {
+	// ID numbers the call within its capture.
+	ID            uint64
+	Method        string
+	Metadata      metadata.MD
+	ClientStreams bool
+	ServerStreams bool
+	Requests      []proto.Message
+	Responses     []proto.Message
+	// Code and Error are the status the call finished with.
+	Code  codes.Code
+	Error string
+}
+
+// ReadCalls reads a capture and returns its calls in the order they
+// arrived. Calls the capture does not see finish, as when the server
+// stopped during them, are left out. Messages are decoded with the types
+// linked into the program, so import the packages defining them.
+func ReadCalls(r io.Reader) ([]*Call, error) {
+	var (
+		calls   []*Call
+		started = make(map[uint64]*Call)
+	)
+	rd := NewReader(r)
+	for {
+		rec, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading capture: %w", err)
+		}
+		if rec.Kind == capturepb.Record_KIND_START {
+			c := &Call{ID: rec.Call, Method: rec.Method, Metadata: metadata.MD{}, ClientStreams: rec.ClientStreams, ServerStreams: rec.ServerStreams}
+			for _, md := range rec.Metadata {
+				c.Metadata[md.Key] = md.Values
+			}
+			started[rec.Call] = c
+			continue
+		}
+		c := started[rec.Call]
+		if c == nil {
+			return nil, fmt.Errorf("call %d has a %v record before its start", rec.Call, rec.Kind)
+		}
+		switch rec.Kind {
+		case capturepb.Record_KIND_REQUEST, capturepb.Record_KIND_RESPONSE:
+			if rec.Message == nil {
+				return nil, fmt.Errorf("call %d to %s has a message recorded without its content", c.ID, c.Method)
+			}
+			m, err := rec.Message.UnmarshalNew()
+			if err != nil {
+				return nil, fmt.Errorf("call %d to %s: %w", c.ID, c.Method, err)
+			}
+			if rec.Kind == capturepb.Record_KIND_REQUEST {
+				c.Requests = append(c.Requests, m)
+			} else {
+				c.Responses = append(c.Responses, m)
+			}
+		case capturepb.Record_KIND_END:
+			c.Code, c.Error = codes.Code(rec.Code), rec.Error
+			calls = append(calls, c)
+			delete(started, rec.Call)
+		}
+	}
+	return calls, nil
+}
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Ignore names fields left out when comparing responses, wherever they
+	// appear in them, e.g. "served_at" for a reply's time.
+	Ignore []string
+}
+
+// Diff is how a replayed call's outcome differs from its capture.
+type Diff struct {
+	Call *Call
+	// Problem describes the difference, or why the call could not be
+	// replayed.
+	Problem string
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("call %d %s: %s", d.Call.ID, d.Call.Method, d.Problem)
+}
+
+// Replay sends each call again over cc, one at a time in order, and returns
+// the differences between the responses and status each gets and those
+// captured. A call's requests are all sent before its responses are read.
+// The captured metadata is sent with each call, less the keys gRPC sets
+// itself; credentials were stripped when capturing, so give cc its own.
+func Replay(ctx context.Context, cc grpc.ClientConnInterface, calls []*Call, opts ReplayOptions) []Diff {
+	ignore := make(map[protoreflect.Name]bool, len(opts.Ignore))
+	for _, name := range opts.Ignore {
+		ignore[protoreflect.Name(name)] = true
+	}
+	var diffs []Diff
+	for _, c := range calls {
+		for _, problem := range replay(ctx, cc, c, ignore) {
+			diffs = append(diffs, Diff{Call: c, Problem: problem})
+		}
+	}
+	return diffs
+}
+
+// replay sends c over cc and describes how the outcome differs.
+func replay(ctx context.Context, cc grpc.ClientConnInterface, c *Call, ignore map[protoreflect.Name]bool) []string {
+	respType, err := responseType(c.Method)
+	if err != nil {
+		return []string{fmt.Sprintf("not replayed: %v", err)}
+	}
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(ctx, replayable(c.Metadata)))
+	defer cancel()
+	stream, err := cc.NewStream(ctx, &grpc.StreamDesc{ClientStreams: c.ClientStreams, ServerStreams: c.ServerStreams}, c.Method)
+	var got []proto.Message
+	if err == nil {
+		err = exchange(stream, c.Requests, respType, &got)
+	}
+
+	var problems []string
+	if len(got) != len(c.Responses) {
+		problems = append(problems, fmt.Sprintf("got %d responses, captured %d", len(got), len(c.Responses)))
+	}
+	for i := 0; i < min(len(got), len(c.Responses)); i++ {
+		g, w := proto.Clone(got[i]), proto.Clone(c.Responses[i])
+		clearFields(g.ProtoReflect(), ignore)
+		clearFields(w.ProtoReflect(), ignore)
+		if !proto.Equal(g, w) {
+			problems = append(problems, fmt.Sprintf("response %d is %s, captured %s", i+1, format(g), format(w)))
+		}
+	}
+	st := status.Convert(err)
+	if st.Code() != c.Code || st.Message() != c.Error {
+		problems = append(problems, fmt.Sprintf("finished with %v %q, captured %v %q", st.Code(), st.Message(), c.Code, c.Error))
+	}
+	return problems
+}
+
+// exchange sends reqs on stream, then receives its responses into got until
+// it ends, returning its error.
+func exchange(stream grpc.ClientStream, reqs []proto.Message, respType protoreflect.MessageType, got *[]proto.Message) error {
+	for _, req := range reqs {
+		// A stream the server ended returns io.EOF; RecvMsg has the status
+		if err := stream.SendMsg(req); err != nil {
+			break
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		m := respType.New().Interface()
+		if err := stream.RecvMsg(m); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		*got = append(*got, m)
+	}
+}
+
+// responseType looks up the response message of the full method name in
+// the descriptors linked into the program.
+func responseType(fullMethod string) (protoreflect.MessageType, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("malformed method name %q", fullMethod)
+	}
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("unknown service %s", service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("unknown method %s", fullMethod)
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(md.Output().FullName())
+}
+
+// replayable returns md without the keys gRPC sets on every call itself.
+func replayable(md metadata.MD) metadata.MD {
+	out := metadata.MD{}
+	for key, values := range md {
+		switch {
+		case strings.HasPrefix(key, ":"), strings.HasPrefix(key, "grpc-"),
+			key == "content-type", key == "user-agent", key == "te":
+		default:
+			out[key] = values
+		}
+	}
+	return out
+}
+
+// clearFields clears the fields named in ignore throughout m.
+func clearFields(m protoreflect.Message, ignore map[protoreflect.Name]bool) {
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case ignore[fd.Name()]:
+			fields = append(fields, fd)
+		case fd.IsList() && fd.Message() != nil:
+			for i := 0; i < v.List().Len(); i++ {
+				clearFields(v.List().Get(i).Message(), ignore)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				clearFields(mv.Message(), ignore)
+				return true
+			})
+		case fd.Message() != nil:
+			clearFields(v.Message(), ignore)
+		}
+		return true
+	})
+	for _, fd := range fields {
+		m.Clear(fd)
+	}
+}
+
+func format(m proto.Message) string {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return fmt.Sprint(m)
+	}
+	return string(b)
+}
@@ -1,58 +1,265 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/compression"
+	"github.com/shrivatsas/exp-codegen/grpc/config"
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"github.com/shrivatsas/exp-codegen/grpc/retry"
+	"github.com/shrivatsas/exp-codegen/grpc/tlsconfig"
+	"github.com/shrivatsas/exp-codegen/grpc/tracing"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
-	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/status"
 )
 
+// buildConfig parses args into a config, writing usage to output on bad input.
+// Settings come from, in rising precedence, their defaults, the -config
+// file, GREETER_ environment variables and the flags in args.
+func buildConfig(args []string, output io.Writer) (config.ClientConfig, error) {
+	cfg := config.DefaultClientConfig()
+
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", "", "YAML file of settings, overridden by GREETER_ environment variables and then by flags")
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return config.ClientConfig{}, err
+	}
+
+	err := config.Load(&cfg, fs, *configFile, os.Getenv)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Fprintln(output, err)
+		fs.Usage()
+		return config.ClientConfig{}, err
+	}
+	return cfg, nil
+}
+
 func main() {
+	cfg, err := buildConfig(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	os.Exit(run(cfg))
+}
+
+// run calls the RPCs selected by cfg and returns the exit status. An
+// interrupt or SIGTERM cancels the calls in flight; the summary of what was
+// received is printed and run returns 0.
+func run(cfg config.ClientConfig) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	creds := insecure.NewCredentials()
+	if cfg.TLS.Enabled {
+		creds, err = tlsconfig.Client(tlsconfig.ClientOptions{
+			CACertFile: cfg.TLS.CACert,
+			CertFile:   cfg.TLS.Cert,
+			KeyFile:    cfg.TLS.Key,
+		})
+		if err != nil {
+			log.Fatalf("Failed to load TLS credentials: %v", err)
+		}
+	}
+
+	retryPolicy := retry.DefaultPolicy()
+	retryPolicy.MaxAttempts = cfg.Retry.Attempts
+	retryPolicy.MaxElapsed = cfg.Retry.MaxElapsed
+
+	tracer, err := tracing.InitTracer(ctx, tracing.OptionsFromEnv(os.Getenv, "greeter-client"))
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer tracer.Shutdown(context.Background())
+
+	opts := []greeterclient.Option{
+		greeterclient.WithCredentials(creds),
+		greeterclient.WithTimeout(cfg.Timeout),
+		greeterclient.WithLocale(cfg.Locale),
+		greeterclient.WithMaxRecvMsgSize(cfg.MaxRecvMsgSize),
+		greeterclient.WithMaxSendMsgSize(cfg.MaxSendMsgSize),
+		greeterclient.WithWaitForReady(cfg.WaitForReady),
+		greeterclient.WithRejectUnknownFields(cfg.StrictFields),
+		greeterclient.WithConnectTimeout(cfg.ConnectTimeout),
+		greeterclient.WithBackoff(cfg.Backoff.Config()),
+		// Tag calls with a request ID before retrying so every attempt shares it
+		greeterclient.WithUnaryInterceptors(requestid.UnaryClientInterceptor(), retry.UnaryClientInterceptor(retryPolicy)),
+		greeterclient.WithStreamInterceptors(requestid.StreamClientInterceptor()),
+		greeterclient.WithDialOptions(tracer.DialOptions()...),
+		greeterclient.WithDialOptions(cfg.Keepalive.DialOptions()...),
+	}
+	if cfg.Token != "" {
+		// Plaintext is only used for local development, so allow the token over it
+		opts = append(opts, greeterclient.WithDialOptions(
+			grpc.WithPerRPCCredentials(auth.TokenCredentials{Token: cfg.Token, AllowInsecure: !cfg.TLS.Enabled})))
+	}
+	if cfg.APIKey != "" {
+		opts = append(opts, greeterclient.WithDialOptions(
+			grpc.WithPerRPCCredentials(auth.APIKeyCredentials{Key: cfg.APIKey, AllowInsecure: !cfg.TLS.Enabled})))
+	}
+	if cfg.Proxy != "" {
+		// Validate has checked the URL
+		dialer, _ := endpoint.ProxyDialer(cfg.Proxy)
+		opts = append(opts, greeterclient.WithDialer(dialer))
+	}
+	if cfg.DrainFailoverWait > 0 {
+		opts = append(opts, greeterclient.WithDrainAware(cfg.DrainFailoverWait))
+	}
+	if cfg.Compress {
+		compression.Register(0)
+		opts = append(opts, greeterclient.WithDialOptions(
+			grpc.WithDefaultCallOptions(grpc.UseCompressor(compression.Name))))
+	}
+
 	// Set up a connection to the server
-	conn, err := grpc.Dial("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	client, err := greeterclient.New(cfg.Addr, opts...)
 	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+		log.Printf("Failed to connect: %v", err)
+		return 1
 	}
-	defer conn.Close()
+	defer client.Close()
 
-	// Create a client
-	client := pb.NewGreeterClient(conn)
+	p := printer{format: cfg.Output, out: os.Stdout, errOut: os.Stderr}
+	switch cfg.Mode {
+	case "chat":
+		err = runChat(ctx, client, cfg, p)
+	case "batch":
+		err = runBatch(ctx, client, cfg, os.Stdin, p)
+	default:
+		err = runHello(ctx, client, cfg, p)
+	}
+	switch {
+	case err == nil:
+		return 0
+	case ctx.Err() != nil && status.Code(err) == codes.Canceled:
+		// Interrupted by the user, who has seen the summary
+		return 0
+	}
+	return 1
+}
 
+// runHello calls SayHello followed by SayHelloStream.
+func runHello(ctx context.Context, client *greeterclient.Client, cfg config.ClientConfig, p printer) error {
 	// Contact the server and print out its response
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	start := time.Now()
+	resp, err := client.HelloReply(ctx, cfg.Name)
+	if err != nil {
+		return p.fail("Could not greet", err)
+	}
+	rtt := time.Since(start)
+	if err := p.reply("", resp); err != nil {
+		return p.fail("Failed to write reply", err)
+	}
+	if resp.ServedBy != "" {
+		p.note("Served by: " + resp.ServedBy)
+	}
+	if resp.ServedAt != nil {
+		p.note(fmt.Sprintf("Served at: %s (round trip %v)", resp.ServedAt.AsTime().Format(time.RFC3339Nano), rtt))
+	}
+
+	p.note("\nStreaming responses:")
+	ctx, cancel := context.WithTimeout(ctx, cfg.StreamTimeout)
+	defer cancel()
+
+	var streamOpts []greeterclient.StreamOption
+	if cfg.Count >= 0 {
+		streamOpts = append(streamOpts, greeterclient.StreamCount(int32(cfg.Count)))
+	}
+	if cfg.Interval >= 0 {
+		streamOpts = append(streamOpts, greeterclient.StreamInterval(cfg.Interval))
+	}
+	summary, err := client.HelloStream(ctx, "Streaming "+cfg.Name, func(resp *pb.HelloReply) error {
+		return p.reply("stream", resp)
+	}, streamOpts...)
+	if partial := (*greeterclient.PartialStreamError)(nil); errors.As(err, &partial) {
+		return p.interrupted(partial)
+	}
+	if err != nil {
+		return p.fail("Failed to receive stream", err)
+	}
+	if summary.Mismatch() {
+		fmt.Fprintf(p.errOut, "Warning: the server sent %d stream messages but %d arrived\n", summary.Sent, summary.Received)
+	}
+	return nil
+}
+
+// runChat sends cfg.ChatCount names over SayHelloChat while printing replies
+// as they arrive.
+func runChat(ctx context.Context, client *greeterclient.Client, cfg config.ClientConfig, p printer) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.StreamTimeout)
 	defer cancel()
 
-	// Call SayHello RPC
-	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World from Go"})
+	names := make([]string, cfg.ChatCount)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s %d", cfg.Name, i+1)
+	}
+	err := client.Chat(ctx, names, func(resp *pb.HelloReply) error {
+		return p.reply("chat", resp)
+	})
 	if err != nil {
-		log.Fatalf("Could not greet: %v", err)
+		return p.fail("Chat failed", err)
 	}
-	fmt.Printf("Greeter client received: %s (Count: %d)\n", resp.Message, resp.GreetingCount)
+	return nil
+}
 
-	// Call SayHelloStream RPC
-	fmt.Println("\nStreaming responses:")
-	streamCtx, streamCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer streamCancel()
-	
-	stream, err := client.SayHelloStream(streamCtx, &pb.HelloRequest{Name: "Streaming World from Go"})
+// runBatch streams names from -names, or from stdin when -names is empty,
+// over SayHelloBatch and prints the summary reply.
+func runBatch(ctx context.Context, client *greeterclient.Client, cfg config.ClientConfig, stdin io.Reader, p printer) error {
+	names, err := batchNames(cfg.Names, stdin)
 	if err != nil {
-		log.Fatalf("Could not greet with stream: %v", err)
+		return p.fail("Failed to read names", err)
 	}
-	
-	for {
-		streamResp, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Fatalf("Failed to receive stream: %v", err)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.StreamTimeout)
+	defer cancel()
+
+	message, count, err := client.Batch(ctx, names)
+	if err != nil {
+		return p.fail("Could not greet batch", err)
+	}
+	if err := p.reply("batch", &pb.HelloReply{Message: message, GreetingCount: int32(count)}); err != nil {
+		return p.fail("Failed to write reply", err)
+	}
+	return nil
+}
+
+// batchNames returns list, falling back to one name per non-blank line of r
+// when list is empty.
+func batchNames(list []string, r io.Reader) ([]string, error) {
+	if len(list) > 0 {
+		return list, nil
+	}
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
 		}
-		fmt.Printf("Greeter client received stream: %s (Count: %d)\n", 
-			streamResp.Message, streamResp.GreetingCount)
 	}
-}
\ No newline at end of file
+	return names, scanner.Err()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/config"
+	"github.com/shrivatsas/exp-codegen/grpc/keepaliveconfig"
+)
+
+func TestBuildConfigDefaults(t *testing.T) {
+	cfg, err := buildConfig(nil, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("buildConfig: %v", err)
+	}
+	want := config.ClientConfig{
+		Addr:          "localhost:50051",
+		Timeout:       time.Second,
+		StreamTimeout: 10 * time.Second,
+		Name:          "World from Go",
+		Mode:          "hello",
+		ChatCount:     3,
+		Count:         -1,
+		Interval:      -1,
+		Retry:         config.Retry{Attempts: 4, MaxElapsed: 10 * time.Second},
+		Output:        "text",
+		Backoff:       config.Backoff{BaseDelay: time.Second, Multiplier: 1.6, MaxDelay: 2 * time.Minute},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+}
+
+func TestBuildConfigOverrides(t *testing.T) {
+	args := []string{
+		"-addr", "staging.example.com:443",
+		"-timeout", "3s",
+		"-stream-timeout", "1m",
+		"-name", "Staging",
+		"-locale", "fr-CA",
+		"-mode", "chat",
+		"-chat-count", "10",
+		"-count", "0",
+		"-interval", "250ms",
+		"-retry-attempts", "1",
+		"-retry-max-elapsed", "30s",
+		"-keepalive-time", "20s",
+		"-keepalive-timeout", "5s",
+		"-keepalive-permit-without-stream",
+		"-compress",
+		"-token", "secret",
+		"-output", "jsonl",
+		"-max-recv-msg-size", "1048576",
+		"-max-send-msg-size", "2048",
+		"-wait-for-ready",
+		"-connect-timeout", "30s",
+		"-backoff-base-delay", "100ms",
+		"-backoff-max-delay", "5s",
+		"-backoff-multiplier", "2",
+	}
+	cfg, err := buildConfig(args, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("buildConfig: %v", err)
+	}
+	want := config.ClientConfig{
+		Addr:          "staging.example.com:443",
+		Timeout:       3 * time.Second,
+		StreamTimeout: time.Minute,
+		Name:          "Staging",
+		Locale:        "fr-CA",
+		Mode:          "chat",
+		ChatCount:     10,
+		Count:         0,
+		Interval:      250 * time.Millisecond,
+		Retry:         config.Retry{Attempts: 1, MaxElapsed: 30 * time.Second},
+		Keepalive: keepaliveconfig.Client{
+			Time:                20 * time.Second,
+			Timeout:             5 * time.Second,
+			PermitWithoutStream: true,
+		},
+		Compress:       true,
+		Token:          "secret",
+		Output:         "jsonl",
+		MaxRecvMsgSize: 1 << 20,
+		MaxSendMsgSize: 2048,
+		WaitForReady:   true,
+		ConnectTimeout: 30 * time.Second,
+		Backoff:        config.Backoff{BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second, Multiplier: 2},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+}
+
+func TestBuildConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"zero timeout", []string{"-timeout", "0s"}, "timeout: must be positive"},
+		{"negative stream timeout", []string{"-stream-timeout", "-1s"}, "stream-timeout: must be positive"},
+		{"malformed duration", []string{"-timeout", "soon"}, "invalid value"},
+		{"unknown flag", []string{"-port", "50051"}, "flag provided but not defined"},
+		{"no attempts", []string{"-retry-attempts", "0"}, "retry.attempts: must be at least 1"},
+		{"zero retry budget", []string{"-retry-max-elapsed", "0s"}, "retry.max-elapsed: must be positive"},
+		{"negative keepalive", []string{"-keepalive-time", "-1s"}, "must not be negative"},
+		{"unknown mode", []string{"-mode", "shout"}, "mode: must be hello, chat or batch"},
+		{"unknown output", []string{"-output", "yaml"}, "output: must be text, json or jsonl"},
+		{"backoff base over max", []string{"-backoff-base-delay", "10s", "-backoff-max-delay", "1s"}, "at most backoff.max-delay"},
+		{"shrinking backoff", []string{"-backoff-multiplier", "0.5"}, "backoff.multiplier: must be at least 1"},
+		{"negative message size", []string{"-max-send-msg-size", "-1"}, "must not be negative"},
+		{"negative chat count", []string{"-chat-count", "-1"}, "chat-count: must not be negative"},
+		{"cert without tls", []string{"-ca-cert", "ca.pem"}, "require enabled"},
+		{"cert without key", []string{"-tls", "-client-cert", "client.pem"}, "must be set together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if _, err := buildConfig(tt.args, &out); err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output %q does not contain %q", out.String(), tt.want)
+			}
+			if !strings.Contains(out.String(), "Usage of client") {
+				t.Errorf("output %q does not contain usage", out.String())
+			}
+		})
+	}
+}
+
+func TestBuildConfigHelp(t *testing.T) {
+	if _, err := buildConfig([]string{"-h"}, &bytes.Buffer{}); err != flag.ErrHelp {
+		t.Errorf("got %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestBatchNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		list  string
+		stdin string
+		want  []string
+	}{
+		{"flag", "Alice, Bob,,Carol", "ignored\n", []string{"Alice", "Bob", "Carol"}},
+		{"stdin", "", "Alice\n\n  Bob  \nCarol", []string{"Alice", "Bob", "Carol"}},
+		{"empty", "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var list config.List
+			list.Set(tt.list)
+			got, err := batchNames(list, strings.NewReader(tt.stdin))
+			if err != nil {
+				t.Fatalf("batchNames: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
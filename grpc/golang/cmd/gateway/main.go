@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// timeoutHeader carries the deadline, as a Go duration such as "500ms", for
+// the proxied gRPC call.
+const timeoutHeader = "X-Timeout"
+
+// config holds the gateway settings that can be overridden from the command line.
+type config struct {
+	addr     string
+	grpcAddr string
+	// strict rejects request bodies with keys the messages do not have.
+	strict bool
+}
+
+// buildConfig parses args into a config, writing usage to output on bad input.
+func buildConfig(args []string, output io.Writer) (config, error) {
+	var cfg config
+
+	fs := flag.NewFlagSet("gateway", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&cfg.addr, "addr", ":8080", "HTTP address to listen on")
+	fs.StringVar(&cfg.grpcAddr, "grpc-addr", "localhost:50051", "address of the Greeter gRPC server, either host:port or unix:///path/to.sock")
+	fs.BoolVar(&cfg.strict, "strict", false, "reject JSON requests with fields the Greeter messages do not have, such as misspelled ones, with 400 instead of ignoring them")
+
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+// newHandler returns an HTTP handler that proxies REST/JSON requests to the
+// v1 and v2 Greeter services on conn, under /v1 and /v2. gRPC status codes
+// are mapped to HTTP status codes by the gateway runtime, e.g.
+// InvalidArgument becomes 400. Unknown JSON keys are ignored unless strict
+// is set.
+func newHandler(ctx context.Context, conn *grpc.ClientConn, strict bool) (http.Handler, error) {
+	var muxOpts []runtime.ServeMuxOption
+	if strict {
+		// The runtime's default marshaler, but keeping unknown keys errors
+		muxOpts = append(muxOpts, runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.HTTPBodyMarshaler{
+			Marshaler: &runtime.JSONPb{
+				MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+				UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: false},
+			},
+		}))
+	}
+	mux := runtime.NewServeMux(muxOpts...)
+	if err := pb.RegisterGreeterHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	if err := pbv2.RegisterGreeterHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return withTimeoutHeader(mux), nil
+}
+
+// withTimeoutHeader applies the deadline from the X-Timeout header to the
+// request context so it propagates to the gRPC call.
+func withTimeoutHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(timeoutHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			http.Error(w, fmt.Sprintf("invalid %s header %q", timeoutHeader, value), http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func main() {
+	cfg, err := buildConfig(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	target, opts := endpoint.Dial(cfg.grpcAddr)
+	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	handler, err := newHandler(context.Background(), conn, cfg.strict)
+	if err != nil {
+		log.Fatalf("Failed to register gateway: %v", err)
+	}
+
+	log.Printf("Gateway listening on %s, proxying to %s", cfg.addr, cfg.grpcAddr)
+	if err := http.ListenAndServe(cfg.addr, handler); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
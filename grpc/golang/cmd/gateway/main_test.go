@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	switch req.Name {
+	case "":
+		return nil, status.Error(codes.InvalidArgument, "name must not be empty")
+	case "slow":
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return &pb.HelloReply{Message: fmt.Sprintf("Hello, %s!", req.Name), GreetingCount: 7}, nil
+}
+
+func (greeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	for i := 1; i <= 3; i++ {
+		err := stream.Send(&pb.HelloReply{Message: fmt.Sprintf("Hello %d, %s!", i, req.Name), GreetingCount: int32(i)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTestGateway proxies an httptest server to an in-memory Greeter server.
+func newTestGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+	return startGateway(t, false)
+}
+
+// startGateway is newTestGateway with the gateway's strictness set.
+func startGateway(t *testing.T, strict bool) *httptest.Server {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pb.RegisterGreeterServer(s, greeter{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	handler, err := newHandler(context.Background(), conn, strict)
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func postGreeting(t *testing.T, ts *httptest.Server, body string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/greetings", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestSayHello(t *testing.T) {
+	ts := newTestGateway(t)
+
+	resp := postGreeting(t, ts, `{"name": "curl"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply pb.HelloReply
+	if err := protojson.Unmarshal(body, &reply); err != nil {
+		t.Fatalf("unmarshal %s: %v", body, err)
+	}
+	if reply.Message != "Hello, curl!" || reply.GreetingCount != 7 {
+		t.Errorf("got %q (Count: %d)", reply.Message, reply.GreetingCount)
+	}
+}
+
+func TestSayHelloInvalidArgument(t *testing.T) {
+	ts := newTestGateway(t)
+
+	resp := postGreeting(t, ts, `{"name": ""}`, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	const body = `{"name": "curl", "nmae": "curl"}`
+	if resp := postGreeting(t, newTestGateway(t), body, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d for an unknown key by default, want 200", resp.StatusCode)
+	}
+
+	resp := postGreeting(t, startGateway(t, true), body, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %d for an unknown key in strict mode, want 400", resp.StatusCode)
+	}
+	var errBody struct {
+		Code    codes.Code `json:"code"`
+		Message string     `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&errBody); err != nil {
+		t.Fatal(err)
+	}
+	if errBody.Code != codes.InvalidArgument || !strings.Contains(errBody.Message, `unknown field "nmae"`) {
+		t.Errorf("got error %+v, want InvalidArgument naming nmae", errBody)
+	}
+}
+
+func TestSayHelloTimeoutHeader(t *testing.T) {
+	ts := newTestGateway(t)
+
+	resp := postGreeting(t, ts, `{"name": "slow"}`, http.Header{timeoutHeader: {"50ms"}})
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("got status %d, want 504", resp.StatusCode)
+	}
+
+	resp = postGreeting(t, ts, `{"name": "curl"}`, http.Header{timeoutHeader: {"soon"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %d for a malformed header, want 400", resp.StatusCode)
+	}
+}
+
+func TestSayHelloStream(t *testing.T) {
+	ts := newTestGateway(t)
+
+	resp, err := http.Get(ts.URL + "/v1/greetings/curl/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+
+	// Each chunk is a JSON object wrapping one HelloReply in "result".
+	var count int
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var chunk struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			t.Fatalf("unmarshal %s: %v", scanner.Bytes(), err)
+		}
+		var reply pb.HelloReply
+		if err := protojson.Unmarshal(chunk.Result, &reply); err != nil {
+			t.Fatalf("unmarshal %s: %v", chunk.Result, err)
+		}
+		count++
+		if want := fmt.Sprintf("Hello %d, curl!", count); reply.Message != want {
+			t.Errorf("got message %q, want %q", reply.Message, want)
+		}
+	}
+	if count != 3 {
+		t.Errorf("got %d replies, want 3", count)
+	}
+}
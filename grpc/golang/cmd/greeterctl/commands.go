@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/status"
+)
+
+// runnable is a greeterctl subcommand.
+type runnable interface {
+	// flags registers the command's flags on fs.
+	flags(fs *flag.FlagSet)
+	// run executes the command against client, writing results to e.stdout.
+	run(ctx context.Context, client *greeterclient.Client, e env) error
+}
+
+// argsParser is implemented by commands that take positional arguments
+// after their flags.
+type argsParser interface {
+	args(args []string) error
+}
+
+// commands lists the subcommands by name.
+var commands = map[string]struct {
+	synopsis string
+	new      func() runnable
+}{
+	"hello":          {"call SayHello once", func() runnable { return &helloCmd{} }},
+	"stream":         {"print the greetings from SayHelloStream", func() runnable { return &streamCmd{} }},
+	"batch":          {"greet several names with one SayHelloBatch call", func() runnable { return &batchCmd{} }},
+	"chat":           {"greet names over SayHelloChat as replies arrive", func() runnable { return &chatCmd{} }},
+	"list":           {"print the greetings recorded by ListGreetings, oldest first", func() runnable { return &listCmd{} }},
+	"count":          {"print how often a name, or anyone, has been greeted", func() runnable { return &countCmd{} }},
+	"debug":          {"dump the server's channelz state: debug channelz", func() runnable { return &debugCmd{} }},
+	"keys":           {"manage API keys with the admin -token: keys create <identity> | list | revoke <id>", func() runnable { return &keysCmd{} }},
+	"loadtest":       {"call SayHello, and optionally SayHelloStream, from concurrent workers and report latencies", func() runnable { return &loadtestCmd{} }},
+	"ping":           {"check the server is reachable, and with -deep that it is serving", func() runnable { return &pingCmd{} }},
+	"replay":         {"call SayHello with each request in a protojson lines file and print the results", func() runnable { return &replayCmd{} }},
+	"replay-capture": {"send the calls in a server -capture file again and report responses differing from those captured", func() runnable { return &replayCaptureCmd{} }},
+}
+
+// errEnough stops a stream once the requested number of replies arrived.
+var errEnough = errors.New("enough replies")
+
+type helloCmd struct {
+	name string
+}
+
+func (c *helloCmd) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.name, "name", "world", "name to greet")
+}
+
+func (c *helloCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	message, count, err := client.Hello(ctx, c.name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "%s (Count: %d)\n", message, count)
+	return nil
+}
+
+type streamCmd struct {
+	name  string
+	count int
+}
+
+func (c *streamCmd) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.name, "name", "world", "name to greet")
+	fs.IntVar(&c.count, "count", 0, "stop after this many greetings (0 reads the whole stream)")
+}
+
+func (c *streamCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	received := 0
+	summary, err := client.HelloStream(ctx, c.name, func(resp *pb.HelloReply) error {
+		fmt.Fprintln(e.stdout, resp.Message)
+		received++
+		if c.count > 0 && received >= c.count {
+			return errEnough
+		}
+		return nil
+	})
+	if errors.Is(err, errEnough) {
+		return nil
+	}
+	if summary.Mismatch() {
+		fmt.Fprintf(e.stderr, "warning: the server sent %d messages but %d arrived\n", summary.Sent, summary.Received)
+	}
+	return err
+}
+
+type batchCmd struct {
+	names string
+}
+
+func (c *batchCmd) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.names, "names", "", "comma-separated names to greet; read one per line from stdin when empty")
+}
+
+func (c *batchCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	names, err := namesFrom(c.names, e)
+	if err != nil {
+		return err
+	}
+	message, count, err := client.Batch(ctx, names)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "%s (Count: %d)\n", message, count)
+	return nil
+}
+
+type chatCmd struct {
+	names string
+}
+
+func (c *chatCmd) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.names, "names", "", "comma-separated names to greet; read one per line from stdin when empty")
+}
+
+func (c *chatCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	names, err := namesFrom(c.names, e)
+	if err != nil {
+		return err
+	}
+	return client.Chat(ctx, names, func(resp *pb.HelloReply) error {
+		fmt.Fprintln(e.stdout, resp.Message)
+		return nil
+	})
+}
+
+type listCmd struct {
+	limit int
+}
+
+func (c *listCmd) flags(fs *flag.FlagSet) {
+	fs.IntVar(&c.limit, "limit", 0, "stop after this many greetings (0 lists them all)")
+}
+
+func (c *listCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	return client.List(ctx, c.limit, func(g *pb.GreetingRecord) error {
+		fmt.Fprintf(e.stdout, "%s\t%s\t%s\n", g.Timestamp.AsTime().Format(time.RFC3339), g.Name, g.Message)
+		return nil
+	})
+}
+
+type countCmd struct {
+	name   string
+	strict bool
+}
+
+func (c *countCmd) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.name, "name", "", "name to report on (empty for the total over all names)")
+	fs.BoolVar(&c.strict, "strict", false, "fail with NotFound for a name never greeted")
+}
+
+func (c *countCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	count, last, err := client.Count(ctx, c.name, c.strict)
+	if err != nil {
+		return err
+	}
+	label := c.name
+	if label == "" {
+		label = "total"
+	}
+	lastGreeted := last.Format(time.RFC3339)
+	switch {
+	case count == 0:
+		lastGreeted = "never"
+	case last.IsZero():
+		lastGreeted = "unknown"
+	}
+	fmt.Fprintf(e.stdout, "%s\t%d\t%s\n", label, count, lastGreeted)
+	return nil
+}
+
+type pingCmd struct {
+	deep bool
+	json bool
+}
+
+func (c *pingCmd) flags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.deep, "deep", false, "also require the Greeter's health check to report SERVING")
+	fs.BoolVar(&c.json, "json", false, "print the result as a JSON object")
+}
+
+// pingResult is the -json output of ping.
+type pingResult struct {
+	Target  string `json:"target"`
+	OK      bool   `json:"ok"`
+	Failure string `json:"failure,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (c *pingCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	err := client.Ping(ctx, c.deep)
+	if c.json {
+		res := pingResult{Target: client.Conn().Target(), OK: err == nil}
+		var pe *greeterclient.PingError
+		if errors.As(err, &pe) {
+			res.Failure = string(pe.Reason)
+			res.Error = status.Convert(pe.Err).Message()
+		}
+		if jerr := json.NewEncoder(e.stdout).Encode(res); jerr != nil && err == nil {
+			return jerr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if c.deep {
+		fmt.Fprintln(e.stdout, "SERVING")
+	} else {
+		fmt.Fprintln(e.stdout, "READY")
+	}
+	return nil
+}
+
+// namesFrom splits a comma-separated list, or reads one name per line from
+// stdin when list is empty. Blank entries are skipped.
+func namesFrom(list string, e env) ([]string, error) {
+	var names []string
+	if list != "" {
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+	if e.stdin == nil {
+		return nil, nil
+	}
+	scanner := bufio.NewScanner(e.stdin)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
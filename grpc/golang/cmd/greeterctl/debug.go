@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// debugCmd dumps diagnostic state from the server. The only topic is
+// channelz, which needs the server to register the channelz service.
+type debugCmd struct{}
+
+func (c *debugCmd) flags(fs *flag.FlagSet) {
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: greeterctl [global flags] debug channelz")
+	}
+}
+
+func (c *debugCmd) args(args []string) error {
+	if len(args) != 1 || args[0] != "channelz" {
+		return errors.New("debug takes one topic: channelz")
+	}
+	return nil
+}
+
+func (c *debugCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	d := channelzDump{client: channelzpb.NewChannelzClient(client.Conn()), w: e.stdout}
+	return d.dump(ctx)
+}
+
+// channelzDump prints the channelz tree of a server: its top channels with
+// their subchannels and sockets, then its servers with their sockets.
+type channelzDump struct {
+	client channelzpb.ChannelzClient
+	w      io.Writer
+}
+
+func (d channelzDump) dump(ctx context.Context) error {
+	fmt.Fprintln(d.w, "Top channels:")
+	var start int64
+	for {
+		resp, err := d.client.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{StartChannelId: start})
+		if err != nil {
+			return err
+		}
+		for _, ch := range resp.Channel {
+			if err := d.channel(ctx, 1, ch); err != nil {
+				return err
+			}
+			start = ch.Ref.ChannelId + 1
+		}
+		if resp.End || len(resp.Channel) == 0 {
+			break
+		}
+	}
+
+	fmt.Fprintln(d.w, "Servers:")
+	start = 0
+	for {
+		resp, err := d.client.GetServers(ctx, &channelzpb.GetServersRequest{StartServerId: start})
+		if err != nil {
+			return err
+		}
+		for _, srv := range resp.Server {
+			if err := d.server(ctx, srv); err != nil {
+				return err
+			}
+			start = srv.Ref.ServerId + 1
+		}
+		if resp.End || len(resp.Server) == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// channel prints a channel and, recursively, its child channels,
+// subchannels and sockets.
+func (d channelzDump) channel(ctx context.Context, depth int, ch *channelzpb.Channel) error {
+	d.line(depth, "channel %d %q %s", ch.Ref.ChannelId, ch.Data.GetTarget(), state(ch.Data))
+	d.line(depth+1, "%s", calls(ch.Data))
+	return d.children(ctx, depth+1, ch.ChannelRef, ch.SubchannelRef, ch.SocketRef)
+}
+
+func (d channelzDump) subchannel(ctx context.Context, depth int, sc *channelzpb.Subchannel) error {
+	d.line(depth, "subchannel %d %s", sc.Ref.SubchannelId, state(sc.Data))
+	d.line(depth+1, "%s", calls(sc.Data))
+	return d.children(ctx, depth+1, sc.ChannelRef, sc.SubchannelRef, sc.SocketRef)
+}
+
+func (d channelzDump) children(ctx context.Context, depth int, channels []*channelzpb.ChannelRef, subchannels []*channelzpb.SubchannelRef, sockets []*channelzpb.SocketRef) error {
+	for _, ref := range channels {
+		resp, err := d.client.GetChannel(ctx, &channelzpb.GetChannelRequest{ChannelId: ref.ChannelId})
+		if err != nil {
+			return err
+		}
+		if err := d.channel(ctx, depth, resp.Channel); err != nil {
+			return err
+		}
+	}
+	for _, ref := range subchannels {
+		resp, err := d.client.GetSubchannel(ctx, &channelzpb.GetSubchannelRequest{SubchannelId: ref.SubchannelId})
+		if err != nil {
+			return err
+		}
+		if err := d.subchannel(ctx, depth, resp.Subchannel); err != nil {
+			return err
+		}
+	}
+	for _, ref := range sockets {
+		if err := d.socket(ctx, depth, "->", ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d channelzDump) server(ctx context.Context, srv *channelzpb.Server) error {
+	d.line(1, "server %d", srv.Ref.ServerId)
+	d.line(2, "%s", calls(srv.Data))
+	for _, ref := range srv.ListenSocket {
+		d.line(2, "listen socket %d %s", ref.SocketId, ref.Name)
+	}
+	var start int64
+	for {
+		resp, err := d.client.GetServerSockets(ctx, &channelzpb.GetServerSocketsRequest{ServerId: srv.Ref.ServerId, StartSocketId: start})
+		if err != nil {
+			return err
+		}
+		for _, ref := range resp.SocketRef {
+			if err := d.socket(ctx, 2, "<-", ref); err != nil {
+				return err
+			}
+			start = ref.SocketId + 1
+		}
+		if resp.End || len(resp.SocketRef) == 0 {
+			return nil
+		}
+	}
+}
+
+// socket prints the socket ref points to. arrow shows which way the
+// connection was made: "->" for client sockets, "<-" for server ones.
+func (d channelzDump) socket(ctx context.Context, depth int, arrow string, ref *channelzpb.SocketRef) error {
+	resp, err := d.client.GetSocket(ctx, &channelzpb.GetSocketRequest{SocketId: ref.SocketId, Summary: true})
+	if err != nil {
+		return err
+	}
+	s, data := resp.Socket, resp.Socket.Data
+	d.line(depth, "socket %d %s %s %s", ref.SocketId, address(s.Local), arrow, address(s.Remote))
+	d.line(depth+1, "streams: %d started, %d succeeded, %d failed; messages: %d sent, %d received; last activity %s",
+		data.GetStreamsStarted(), data.GetStreamsSucceeded(), data.GetStreamsFailed(),
+		data.GetMessagesSent(), data.GetMessagesReceived(),
+		timestamp(latest(data.GetLastLocalStreamCreatedTimestamp(), data.GetLastRemoteStreamCreatedTimestamp(),
+			data.GetLastMessageSentTimestamp(), data.GetLastMessageReceivedTimestamp())))
+	return nil
+}
+
+func (d channelzDump) line(depth int, format string, args ...any) {
+	fmt.Fprintf(d.w, "%s%s\n", strings.Repeat("  ", depth), fmt.Sprintf(format, args...))
+}
+
+// callData is implemented by the channelz data of channels, subchannels and
+// servers.
+type callData interface {
+	GetCallsStarted() int64
+	GetCallsSucceeded() int64
+	GetCallsFailed() int64
+	GetLastCallStartedTimestamp() *timestamppb.Timestamp
+}
+
+func calls(data callData) string {
+	return fmt.Sprintf("calls: %d started, %d succeeded, %d failed; last call %s",
+		data.GetCallsStarted(), data.GetCallsSucceeded(), data.GetCallsFailed(), timestamp(data.GetLastCallStartedTimestamp()))
+}
+
+func state(data *channelzpb.ChannelData) string {
+	return data.GetState().GetState().String()
+}
+
+// latest returns the most recent of ts, or nil if none is set.
+func latest(ts ...*timestamppb.Timestamp) *timestamppb.Timestamp {
+	var last *timestamppb.Timestamp
+	for _, t := range ts {
+		if t != nil && (last == nil || t.AsTime().After(last.AsTime())) {
+			last = t
+		}
+	}
+	return last
+}
+
+func timestamp(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return "never"
+	}
+	return ts.AsTime().Format(time.RFC3339Nano)
+}
+
+func address(a *channelzpb.Address) string {
+	switch addr := a.GetAddress().(type) {
+	case *channelzpb.Address_TcpipAddress:
+		return net.JoinHostPort(net.IP(addr.TcpipAddress.IpAddress).String(), strconv.Itoa(int(addr.TcpipAddress.Port)))
+	case *channelzpb.Address_UdsAddress_:
+		return "unix:" + addr.UdsAddress.Filename
+	case *channelzpb.Address_OtherAddress_:
+		return addr.OtherAddress.Name
+	}
+	return "unknown"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	adminpb "github.com/shrivatsas/exp-codegen/grpc/protos/admin"
+)
+
+// keysCmd manages API keys through the KeyAdmin service, authenticating
+// with the admin token passed as -token.
+type keysCmd struct {
+	action string
+	// arg is the identity to create a key for or the ID of the key to
+	// revoke.
+	arg string
+}
+
+func (c *keysCmd) flags(fs *flag.FlagSet) {
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: greeterctl -token <admin token> [global flags] keys create <identity> | list | revoke <id>")
+	}
+}
+
+func (c *keysCmd) args(args []string) error {
+	if len(args) > 0 {
+		c.action = args[0]
+	}
+	switch {
+	case c.action == "list" && len(args) == 1:
+	case (c.action == "create" || c.action == "revoke") && len(args) == 2:
+		c.arg = args[1]
+	default:
+		return errors.New("keys takes create <identity>, list or revoke <id>")
+	}
+	return nil
+}
+
+func (c *keysCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	admin := adminpb.NewKeyAdminClient(client.Conn())
+	switch c.action {
+	case "create":
+		resp, err := admin.CreateApiKey(ctx, &adminpb.CreateApiKeyRequest{Identity: c.arg})
+		if err != nil {
+			return err
+		}
+		// The key cannot be retrieved again, so it goes last where it is
+		// easy to cut
+		fmt.Fprintf(e.stdout, "%s\t%s\t%s\n", resp.ApiKey.Id, resp.ApiKey.Identity, resp.Key)
+	case "list":
+		resp, err := admin.ListApiKeys(ctx, &adminpb.ListApiKeysRequest{})
+		if err != nil {
+			return err
+		}
+		for _, key := range resp.ApiKeys {
+			printKey(e.stdout, key)
+		}
+	case "revoke":
+		key, err := admin.RevokeApiKey(ctx, &adminpb.RevokeApiKeyRequest{Id: c.arg})
+		if err != nil {
+			return err
+		}
+		printKey(e.stdout, key)
+	}
+	return nil
+}
+
+// printKey writes key's ID, identity, creation time and revocation time,
+// or "active".
+func printKey(w io.Writer, key *adminpb.ApiKey) {
+	revoked := "active"
+	if key.RevokeTime != nil {
+		revoked = "revoked " + key.RevokeTime.AsTime().Format(time.RFC3339)
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key.Id, key.Identity, key.CreateTime.AsTime().Format(time.RFC3339), revoked)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errNoCalls fails a load test that ended before any call completed.
+var errNoCalls = errors.New("no calls completed")
+
+type loadtestCmd struct {
+	name           string
+	concurrency    int
+	total          int
+	duration       time.Duration
+	rate           float64
+	streamRatio    float64
+	streamReplies  int
+	streamInterval time.Duration
+	json           bool
+}
+
+func (c *loadtestCmd) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.name, "name", "loadtest", "name to greet")
+	fs.IntVar(&c.concurrency, "concurrency", 10, "number of workers issuing calls")
+	fs.IntVar(&c.total, "total", 1000, "number of calls to make, unless -duration is set")
+	fs.DurationVar(&c.duration, "duration", 0, "keep calling for this long instead of making -total calls; the global -timeout still applies")
+	fs.Float64Var(&c.rate, "rate", 0, "maximum calls per second across all workers (0 for no limit)")
+	fs.Float64Var(&c.streamRatio, "stream-ratio", 0, "fraction of calls made with SayHelloStream instead of SayHello, from 0 to 1")
+	fs.IntVar(&c.streamReplies, "stream-replies", 3, "replies requested by each streaming call")
+	fs.DurationVar(&c.streamInterval, "stream-interval", 10*time.Millisecond, "interval requested between the replies of a streaming call")
+	fs.BoolVar(&c.json, "json", false, "print the report as a JSON object")
+}
+
+// args checks the flag values; loadtest takes no positional arguments.
+func (c *loadtestCmd) args(args []string) error {
+	switch {
+	case len(args) > 0:
+		return fmt.Errorf("loadtest takes no arguments, got %q", args)
+	case c.concurrency < 1:
+		return fmt.Errorf("-concurrency must be at least 1, got %d", c.concurrency)
+	case c.duration == 0 && c.total < 1:
+		return fmt.Errorf("-total must be at least 1, got %d", c.total)
+	case c.duration < 0:
+		return fmt.Errorf("-duration must not be negative, got %v", c.duration)
+	case c.rate < 0:
+		return fmt.Errorf("-rate must not be negative, got %v", c.rate)
+	case c.streamRatio < 0 || c.streamRatio > 1:
+		return fmt.Errorf("-stream-ratio must be between 0 and 1, got %v", c.streamRatio)
+	case c.streamReplies < 1:
+		return fmt.Errorf("-stream-replies must be at least 1, got %d", c.streamReplies)
+	}
+	return nil
+}
+
+func (c *loadtestCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	runCtx := ctx
+	if c.duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, c.duration)
+		defer cancel()
+	}
+	var (
+		issued atomic.Int64
+		pace   = newPacer(c.rate)
+		mu     sync.Mutex
+		total  = newLoadResult()
+		wg     sync.WaitGroup
+	)
+	start := time.Now()
+	for w := 0; w < c.concurrency; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			res := newLoadResult()
+			rnd := rand.New(rand.NewSource(seed))
+			for c.duration > 0 || issued.Add(1) <= int64(c.total) {
+				if err := pace.wait(runCtx); err != nil {
+					break
+				}
+				stream := rnd.Float64() < c.streamRatio
+				began := time.Now()
+				err := c.call(runCtx, client, stream)
+				if runCtx.Err() != nil {
+					// Cut short by the end of the run rather than failed
+					break
+				}
+				res.record(stream, status.Code(err), time.Since(began))
+			}
+			mu.Lock()
+			total.merge(res)
+			mu.Unlock()
+		}(start.UnixNano() + int64(w))
+	}
+	wg.Wait()
+	rep := total.report(time.Since(start))
+	if c.json {
+		if err := json.NewEncoder(e.stdout).Encode(rep); err != nil {
+			return err
+		}
+	} else {
+		rep.print(e)
+	}
+	if rep.Calls == 0 {
+		return errNoCalls
+	}
+	return nil
+}
+
+// call makes one SayHello call, or one SayHelloStream call read to the end.
+func (c *loadtestCmd) call(ctx context.Context, client *greeterclient.Client, stream bool) error {
+	if !stream {
+		_, err := client.HelloReply(ctx, c.name)
+		return err
+	}
+	_, err := client.HelloStream(ctx, c.name, func(*pb.HelloReply) error { return nil },
+		greeterclient.StreamCount(int32(c.streamReplies)), greeterclient.StreamInterval(c.streamInterval))
+	return err
+}
+
+// pacer spaces calls shared by any number of workers so they start at most
+// rate per second, with no limit for a rate of zero.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(rate float64) *pacer {
+	p := &pacer{}
+	if rate > 0 {
+		p.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return p
+}
+
+// wait blocks until the caller's turn to start a call, or fails if ctx ends
+// first.
+func (p *pacer) wait(ctx context.Context) error {
+	if p.interval == 0 {
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	at := p.next
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loadResult accumulates the outcome of a worker's calls.
+type loadResult struct {
+	unary, streams int
+	codes          map[codes.Code]int
+	latency        histogram
+}
+
+func newLoadResult() *loadResult {
+	return &loadResult{codes: map[codes.Code]int{}}
+}
+
+func (r *loadResult) record(stream bool, code codes.Code, d time.Duration) {
+	if stream {
+		r.streams++
+	} else {
+		r.unary++
+	}
+	r.codes[code]++
+	r.latency.record(d)
+}
+
+func (r *loadResult) merge(o *loadResult) {
+	r.unary += o.unary
+	r.streams += o.streams
+	for code, n := range o.codes {
+		r.codes[code] += n
+	}
+	r.latency.merge(&o.latency)
+}
+
+// loadReport is the summary loadtest prints, and its -json output.
+type loadReport struct {
+	Calls          int            `json:"calls"`
+	Unary          int            `json:"unary"`
+	Streams        int            `json:"streams"`
+	Errors         int            `json:"errors"`
+	ElapsedSeconds float64        `json:"elapsed_seconds"`
+	CallsPerSecond float64        `json:"calls_per_second"`
+	Codes          map[string]int `json:"codes"`
+	Latency        latencyReport  `json:"latency_ms"`
+}
+
+// latencyReport holds latency percentiles in milliseconds.
+type latencyReport struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func (r *loadResult) report(elapsed time.Duration) loadReport {
+	rep := loadReport{
+		Calls:          r.unary + r.streams,
+		Unary:          r.unary,
+		Streams:        r.streams,
+		ElapsedSeconds: elapsed.Seconds(),
+		Codes:          map[string]int{},
+		Latency: latencyReport{
+			P50: millis(r.latency.percentile(50)),
+			P90: millis(r.latency.percentile(90)),
+			P99: millis(r.latency.percentile(99)),
+			Max: millis(r.latency.max),
+		},
+	}
+	for code, n := range r.codes {
+		rep.Codes[code.String()] = n
+		if code != codes.OK {
+			rep.Errors += n
+		}
+	}
+	if elapsed > 0 {
+		rep.CallsPerSecond = float64(rep.Calls) / elapsed.Seconds()
+	}
+	return rep
+}
+
+func (rep loadReport) print(e env) {
+	fmt.Fprintf(e.stdout, "Calls:      %d (%d unary, %d streaming) in %.3fs, %.1f/s\n",
+		rep.Calls, rep.Unary, rep.Streams, rep.ElapsedSeconds, rep.CallsPerSecond)
+	fmt.Fprintf(e.stdout, "Codes:      %d errors\n", rep.Errors)
+	names := make([]string, 0, len(rep.Codes))
+	for name := range rep.Codes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(e.stdout, "  %-18s %d\n", name, rep.Codes[name])
+	}
+	fmt.Fprintf(e.stdout, "Latency:    p50 %.3fms  p90 %.3fms  p99 %.3fms  max %.3fms\n",
+		rep.Latency.P50, rep.Latency.P90, rep.Latency.P99, rep.Latency.Max)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// subBucketBits sets the histogram's precision: each power of two is split
+// into 1<<subBucketBits buckets, so a value is reported within 1% of itself.
+const subBucketBits = 7
+
+// histogram counts durations in log-linear buckets, the layout of an HDR
+// histogram: exact below 1<<(subBucketBits+1) nanoseconds, then a fixed
+// number of buckets per power of two. Its zero value is empty.
+type histogram struct {
+	counts []int64
+	total  int64
+	max    time.Duration
+}
+
+// bucket returns the index of the bucket counting v.
+func bucket(v int64) int {
+	shift := max(bits.Len64(uint64(v))-subBucketBits-1, 0)
+	return shift<<subBucketBits + int(v>>shift)
+}
+
+// bucketHigh returns the highest value counted by bucket i.
+func bucketHigh(i int) int64 {
+	shift := max(i>>subBucketBits-1, 0)
+	low := int64(i-shift<<subBucketBits) << shift
+	return low + 1<<shift - 1
+}
+
+func (h *histogram) record(d time.Duration) {
+	d = max(d, 0)
+	i := bucket(int64(d))
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+func (h *histogram) merge(o *histogram) {
+	if len(o.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]int64, len(o.counts)-len(h.counts))...)
+	}
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.total += o.total
+	h.max = max(h.max, o.max)
+}
+
+// percentile returns the duration that p percent of the recorded durations
+// do not exceed, or zero for an empty histogram.
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := max(int64(math.Ceil(p/100*float64(h.total))), 1)
+	var seen int64
+	for i, n := range h.counts {
+		if seen += n; seen >= rank {
+			return min(time.Duration(bucketHigh(i)), h.max)
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,223 @@
+// Command greeterctl calls each Greeter RPC from the command line:
+//
+//	greeterctl [global flags] <command> [command flags]
+//
+// The exit status reflects the RPC's gRPC status code so the tool can be
+// used from scripts; see exitCode for the mapping.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"github.com/shrivatsas/exp-codegen/grpc/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit statuses beyond those derived from gRPC codes.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// exitCode maps the error from a command to the process exit status:
+//
+//	0  OK
+//	1  any other failure
+//	2  InvalidArgument, or bad command-line usage
+//	3  NotFound
+//	4  DeadlineExceeded
+//	5  Unauthenticated or PermissionDenied
+//	6  ResourceExhausted
+//	7  Unavailable
+//	8  Canceled
+//
+// A failed ping exits 1 whatever the cause; the reason is in its output.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var pe *greeterclient.PingError
+	if errors.As(err, &pe) {
+		return exitFailure
+	}
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return exitUsage
+	case codes.NotFound:
+		return 3
+	case codes.DeadlineExceeded:
+		return 4
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return 5
+	case codes.ResourceExhausted:
+		return 6
+	case codes.Unavailable:
+		return 7
+	case codes.Canceled:
+		return 8
+	}
+	return exitFailure
+}
+
+// env holds what a greeterctl invocation reads from and writes to.
+type env struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	// clientOpts are added to those built from the global flags; tests use
+	// them to reach an in-process server.
+	clientOpts []greeterclient.Option
+}
+
+// globals holds the flags shared by every command.
+type globals struct {
+	addr    string
+	tls     bool
+	caCert  string
+	token   string
+	apiKey  string
+	proxy   string
+	timeout time.Duration
+	v2      bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+// run executes the command line args and returns the exit status.
+func run(args []string, e env) int {
+	var g globals
+	fs := flag.NewFlagSet("greeterctl", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.StringVar(&g.addr, "addr", "localhost:50051", "address of the Greeter server: host:port, comma-separated host:port replicas, a dns:/// target, a filewatch:///path endpoint file or unix:///path/to.sock")
+	fs.BoolVar(&g.tls, "tls", false, "connect using TLS")
+	fs.StringVar(&g.caCert, "ca-cert", "", "PEM CA bundle used to verify the server (requires -tls)")
+	fs.StringVar(&g.token, "token", "", "bearer token sent with every RPC")
+	fs.StringVar(&g.apiKey, "api-key", "", "API key sent with every RPC in x-api-key metadata")
+	fs.StringVar(&g.proxy, "proxy", "", "reach the server through this socks5:// or http:// (CONNECT) proxy URL, with optional user:password@")
+	fs.DurationVar(&g.timeout, "timeout", 10*time.Second, "deadline for the whole command")
+	fs.BoolVar(&g.v2, "v2", false, "call the greeter.v2.Greeter API instead of example.Greeter")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: greeterctl [global flags] <command> [command flags]\n\nCommands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(fs.Output(), "  %-8s %s\n", name, commands[name].synopsis)
+		}
+		fmt.Fprintln(fs.Output(), "\nGlobal flags:")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	var err error
+	switch {
+	case fs.NArg() == 0:
+		err = errors.New("missing command")
+	case g.timeout <= 0:
+		err = fmt.Errorf("-timeout must be positive, got %v", g.timeout)
+	case !g.tls && g.caCert != "":
+		err = errors.New("-ca-cert requires -tls")
+	case g.token != "" && g.apiKey != "":
+		err = errors.New("-token and -api-key are mutually exclusive")
+	}
+	if err != nil {
+		fmt.Fprintln(e.stderr, err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	name := fs.Arg(0)
+	entry, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(e.stderr, "unknown command %q\n", name)
+		fs.Usage()
+		return exitUsage
+	}
+	cmd := entry.new()
+	cmdFlags := flag.NewFlagSet("greeterctl "+name, flag.ContinueOnError)
+	cmdFlags.SetOutput(e.stderr)
+	cmd.flags(cmdFlags)
+	if err := cmdFlags.Parse(fs.Args()[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if p, ok := cmd.(argsParser); ok {
+		if err := p.args(cmdFlags.Args()); err != nil {
+			fmt.Fprintln(e.stderr, err)
+			cmdFlags.Usage()
+			return exitUsage
+		}
+	}
+
+	client, err := dial(g, e)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "greeterctl: %v\n", err)
+		return exitFailure
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+	if err := cmd.run(ctx, client, e); err != nil {
+		fmt.Fprintf(e.stderr, "greeterctl: %s\n", greeterclient.DescribeError(err))
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// dial connects to the server named by the global flags.
+func dial(g globals, e env) (*greeterclient.Client, error) {
+	var opts []greeterclient.Option
+	if g.tls {
+		creds, err := tlsconfig.Client(tlsconfig.ClientOptions{CACertFile: g.caCert})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, greeterclient.WithCredentials(creds))
+	}
+	if g.proxy != "" {
+		dialer, err := endpoint.ProxyDialer(g.proxy)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, greeterclient.WithDialer(dialer))
+	}
+	if g.token != "" {
+		opts = append(opts, greeterclient.WithDialOptions(
+			grpc.WithPerRPCCredentials(auth.TokenCredentials{Token: g.token, AllowInsecure: !g.tls})))
+	}
+	if g.apiKey != "" {
+		opts = append(opts, greeterclient.WithDialOptions(
+			grpc.WithPerRPCCredentials(auth.APIKeyCredentials{Key: g.apiKey, AllowInsecure: !g.tls})))
+	}
+	opts = append(opts,
+		greeterclient.WithV2(g.v2),
+		greeterclient.WithUserAgent("greeterctl"),
+		greeterclient.WithUnaryInterceptors(requestid.UnaryClientInterceptor()),
+		greeterclient.WithStreamInterceptors(requestid.StreamClientInterceptor()))
+	return greeterclient.New(g.addr, append(opts, e.clientOpts...)...)
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/apikey"
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/capture"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	"github.com/shrivatsas/exp-codegen/grpc/greeterserver"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// stallingGreeter answers SayHello only once the deadline passes.
+type stallingGreeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (stallingGreeter) SayHello(ctx context.Context, _ *pb.HelloRequest) (*pb.HelloReply, error) {
+	<-ctx.Done()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+// runAgainst runs greeterctl with args against ts and returns its exit
+// status, stdout and stderr.
+func runAgainst(t *testing.T, ts *testutil.Server, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	e := env{
+		stdin:      strings.NewReader(stdin),
+		stdout:     &stdout,
+		stderr:     &stderr,
+		clientOpts: []greeterclient.Option{greeterclient.WithDialOptions(grpc.WithContextDialer(ts.Dialer()))},
+	}
+	code := run(append([]string{"-addr", testutil.Target}, args...), e)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0), greeter.WithMaxBatch(2)))
+
+	tests := []struct {
+		name       string
+		stdin      string
+		args       []string
+		wantCode   int
+		wantStdout string
+	}{
+		{
+			name:       "hello",
+			args:       []string{"hello", "-name", "Alice"},
+			wantStdout: "Hello, Alice! (Count: 1)\n",
+		},
+		{
+			name:     "hello empty name",
+			args:     []string{"hello", "-name", ""},
+			wantCode: 2,
+		},
+		{
+			name:       "stream",
+			args:       []string{"stream", "-name", "Bob", "-count", "2"},
+			wantStdout: "Hello 1, Bob!\nHello 2, Bob!\n",
+		},
+		{
+			name:       "batch",
+			args:       []string{"batch", "-names", "Carol, Dave"},
+			wantStdout: "Hello Carol, Dave (Count: 2)\n",
+		},
+		{
+			name:     "batch over the limit",
+			args:     []string{"batch", "-names", "a,b,c"},
+			wantCode: 6,
+		},
+		{
+			name:       "chat from stdin",
+			stdin:      "Erin\n\nFrank\n",
+			args:       []string{"chat"},
+			wantStdout: "Hello, Erin!\nHello, Frank!\n",
+		},
+		{
+			name:     "unknown command",
+			args:     []string{"wave"},
+			wantCode: 2,
+		},
+		{
+			name:     "missing command",
+			wantCode: 2,
+		},
+		{
+			name:     "bad command flag",
+			args:     []string{"hello", "-count", "1"},
+			wantCode: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runAgainst(t, ts, tt.stdin, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code %d, want %d (stderr: %q)", code, tt.wantCode, stderr)
+			}
+			if stdout != tt.wantStdout {
+				t.Errorf("stdout %q, want %q", stdout, tt.wantStdout)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	ts := testutil.Start(t)
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		if code, _, stderr := runAgainst(t, ts, "", "hello", "-name", name); code != 0 {
+			t.Fatalf("hello %s: exit code %d (stderr: %q)", name, code, stderr)
+		}
+	}
+
+	code, stdout, stderr := runAgainst(t, ts, "", "list", "--limit", "2")
+	if code != 0 {
+		t.Fatalf("exit code %d (stderr: %q)", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "\tAlice\tHello, Alice!") || !strings.HasSuffix(lines[1], "\tBob\tHello, Bob!") {
+		t.Errorf("stdout %q, want Alice and Bob", stdout)
+	}
+}
+
+func TestCount(t *testing.T) {
+	ts := testutil.Start(t)
+	for _, name := range []string{"Alice", "Alice", "Bob"} {
+		if code, _, stderr := runAgainst(t, ts, "", "hello", "-name", name); code != 0 {
+			t.Fatalf("hello %s: exit code %d (stderr: %q)", name, code, stderr)
+		}
+	}
+
+	for _, tt := range []struct {
+		args       []string
+		wantCode   int
+		wantPrefix string
+	}{
+		{[]string{"count", "-name", "Alice"}, 0, "Alice\t2\t2"},
+		{[]string{"count"}, 0, "total\t3\t2"},
+		{[]string{"count", "-name", "Carol"}, 0, "Carol\t0\tnever\n"},
+		{[]string{"count", "-name", "Carol", "-strict"}, 3, ""},
+	} {
+		code, stdout, stderr := runAgainst(t, ts, "", tt.args...)
+		if code != tt.wantCode {
+			t.Errorf("%v: exit code %d, want %d (stderr: %q)", tt.args, code, tt.wantCode, stderr)
+		}
+		if !strings.HasPrefix(stdout, tt.wantPrefix) || (tt.wantPrefix == "") != (stdout == "") {
+			t.Errorf("%v: stdout %q, want it to start with %q", tt.args, stdout, tt.wantPrefix)
+		}
+	}
+}
+
+func TestDeadlineExceeded(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithService(stallingGreeter{}))
+	code, _, stderr := runAgainst(t, ts, "", "-timeout", "50ms", "hello")
+	if code != 4 {
+		t.Errorf("exit code %d, want 4", code)
+	}
+	if !strings.Contains(stderr, "DeadlineExceeded") {
+		t.Errorf("stderr %q does not name the status code", stderr)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for c, want := range map[codes.Code]int{
+		codes.OK:                0,
+		codes.InvalidArgument:   2,
+		codes.NotFound:          3,
+		codes.DeadlineExceeded:  4,
+		codes.Unauthenticated:   5,
+		codes.PermissionDenied:  5,
+		codes.ResourceExhausted: 6,
+		codes.Unavailable:       7,
+		codes.Canceled:          8,
+		codes.Internal:          1,
+	} {
+		if got := exitCode(status.Error(c, "x")); got != want {
+			t.Errorf("exitCode(%v) = %d, want %d", c, got, want)
+		}
+	}
+}
+
+func TestDebugChannelz(t *testing.T) {
+	srv, err := greeterserver.New(greeterserver.WithAddress("127.0.0.1:0"), greeterserver.WithChannelz())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Keep a connection open with a few finished RPCs on it
+	client, err := greeterclient.New(srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		if _, _, err := client.Hello(context.Background(), name); err != nil {
+			t.Fatalf("Hello: %v", err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-addr", srv.Addr().String(), "debug", "channelz"}, env{stdout: &stdout, stderr: &stderr})
+	if code != 0 {
+		t.Fatalf("exit code %d (stderr: %q)", code, stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{"Top channels:", "Servers:", "listen socket", "READY"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	succeeded := regexp.MustCompile(`streams: \d+ started, ([1-9]\d*) succeeded`)
+	if !succeeded.MatchString(out) {
+		t.Errorf("no socket reports a succeeded call:\n%s", out)
+	}
+}
+
+func TestDebugUsage(t *testing.T) {
+	ts := testutil.Start(t)
+	for _, args := range [][]string{{"debug"}, {"debug", "pprof"}} {
+		if code, _, _ := runAgainst(t, ts, "", args...); code != 2 {
+			t.Errorf("%v: exit code %d, want 2", args, code)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	keys := apikey.New(apikey.Options{Admin: auth.NewStaticValidator("admin")})
+	ts := testutil.Start(t, testutil.WithRegister(func(s *grpc.Server) { keys.Register(s) }))
+
+	code, stdout, stderr := runAgainst(t, ts, "", "-token", "admin", "keys", "create", "alice")
+	fields := strings.Split(strings.TrimSuffix(stdout, "\n"), "\t")
+	if code != 0 || len(fields) != 3 || fields[1] != "alice" || !strings.HasPrefix(fields[2], "gk_"+fields[0]+".") {
+		t.Fatalf("keys create: code %d stdout %q (stderr %q), want the ID, alice and the key", code, stdout, stderr)
+	}
+	id := fields[0]
+	_, stdout, _ = runAgainst(t, ts, "", "-token", "admin", "keys", "list")
+	if !regexp.MustCompile(`^` + id + `\talice\t\S+\tactive\n$`).MatchString(stdout) {
+		t.Errorf("keys list printed %q, want alice's active key", stdout)
+	}
+	_, stdout, _ = runAgainst(t, ts, "", "-token", "admin", "keys", "revoke", id)
+	if !regexp.MustCompile(`^` + id + `\talice\t\S+\trevoked \S+\n$`).MatchString(stdout) {
+		t.Errorf("keys revoke printed %q, want alice's key revoked", stdout)
+	}
+
+	for _, args := range [][]string{{"keys"}, {"keys", "create"}, {"keys", "list", "extra"}, {"keys", "rotate", id}} {
+		if code, _, _ := runAgainst(t, ts, "", append([]string{"-token", "admin"}, args...)...); code != 2 {
+			t.Errorf("%v: exit code %d, want 2", args, code)
+		}
+	}
+	if code, _, _ := runAgainst(t, ts, "", "-token", "guess", "keys", "list"); code != 5 {
+		t.Errorf("keys list with the wrong token: exit code %d, want 5", code)
+	}
+}
+
+func TestPing(t *testing.T) {
+	t.Run("healthy", func(t *testing.T) {
+		ts := testutil.Start(t)
+		code, stdout, stderr := runAgainst(t, ts, "", "ping", "-deep")
+		if code != 0 || stdout != "SERVING\n" {
+			t.Errorf("got code %d stdout %q (stderr %q), want 0 and SERVING", code, stdout, stderr)
+		}
+	})
+	t.Run("no server", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := lis.Addr().String()
+		lis.Close()
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"-addr", addr, "ping", "-json"}, env{stdout: &stdout, stderr: &stderr})
+		if code != 1 {
+			t.Errorf("exit code %d, want 1", code)
+		}
+		var res pingResult
+		if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+			t.Fatalf("decoding %q: %v", stdout.String(), err)
+		}
+		if res.OK || res.Failure != "connection_refused" || res.Target != addr || res.Error == "" {
+			t.Errorf("got %+v, want a connection_refused failure for %s", res, addr)
+		}
+		if !strings.Contains(stderr.String(), "connection_refused") {
+			t.Errorf("stderr %q does not name the failure", stderr.String())
+		}
+	})
+	t.Run("not serving", func(t *testing.T) {
+		ts := testutil.Start(t)
+		ts.Service.SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+		if code, stdout, _ := runAgainst(t, ts, "", "ping"); code != 0 || stdout != "READY\n" {
+			t.Errorf("shallow ping: got code %d stdout %q, want 0 and READY", code, stdout)
+		}
+		code, stdout, _ := runAgainst(t, ts, "", "ping", "-deep", "-json")
+		var res pingResult
+		if err := json.Unmarshal([]byte(stdout), &res); err != nil {
+			t.Fatalf("decoding %q: %v", stdout, err)
+		}
+		if code != 1 || res.OK || res.Failure != "not_serving" {
+			t.Errorf("deep ping: got code %d and %+v, want 1 and a not_serving failure", code, res)
+		}
+	})
+}
+
+func TestLoadtest(t *testing.T) {
+	ts := testutil.Start(t)
+	code, stdout, stderr := runAgainst(t, ts, "", "loadtest", "-json", "-concurrency", "4", "-total", "60",
+		"-stream-ratio", "0.5", "-stream-replies", "2", "-stream-interval", "1ms")
+	if code != 0 {
+		t.Fatalf("exit code %d (stderr %q)", code, stderr)
+	}
+	var rep loadReport
+	if err := json.Unmarshal([]byte(stdout), &rep); err != nil {
+		t.Fatalf("decoding %q: %v", stdout, err)
+	}
+	if rep.Calls != 60 || rep.Unary+rep.Streams != rep.Calls {
+		t.Errorf("got %d calls (%d unary, %d streaming), want 60 in all", rep.Calls, rep.Unary, rep.Streams)
+	}
+	if rep.Unary == 0 || rep.Streams == 0 {
+		t.Errorf("got %d unary and %d streaming calls, want a mix", rep.Unary, rep.Streams)
+	}
+	sum := 0
+	for _, n := range rep.Codes {
+		sum += n
+	}
+	if sum != rep.Calls || rep.Codes["OK"] != rep.Calls || rep.Errors != 0 {
+		t.Errorf("codes %v with %d errors, want all %d OK", rep.Codes, rep.Errors, rep.Calls)
+	}
+	l := rep.Latency
+	if !(0 < l.P50 && l.P50 <= l.P90 && l.P90 <= l.P99 && l.P99 <= l.Max) {
+		t.Errorf("latency percentiles out of order: %+v", l)
+	}
+	if rep.CallsPerSecond <= 0 {
+		t.Errorf("throughput %v, want positive", rep.CallsPerSecond)
+	}
+}
+
+func TestLoadtestErrorsAndRate(t *testing.T) {
+	// Every call fails, and the rate spaces 10 calls over at least 450ms
+	ts := testutil.Start(t, testutil.WithService(pb.UnimplementedGreeterServer{}))
+	code, stdout, stderr := runAgainst(t, ts, "", "loadtest", "-concurrency", "3", "-total", "10", "-rate", "20")
+	if code != 0 {
+		t.Fatalf("exit code %d (stderr %q)", code, stderr)
+	}
+	for _, want := range []string{"Calls:      10 (10 unary, 0 streaming)", "Codes:      10 errors", "Unimplemented      10", "p50 "} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout)
+		}
+	}
+	m := regexp.MustCompile(`in ([0-9.]+)s`).FindStringSubmatch(stdout)
+	if m == nil {
+		t.Fatalf("no elapsed time in %q", stdout)
+	}
+	if elapsed, _ := time.ParseDuration(m[1] + "s"); elapsed < 450*time.Millisecond {
+		t.Errorf("10 calls at 20/s took %v, want at least 450ms", elapsed)
+	}
+}
+
+func TestLoadtestUsage(t *testing.T) {
+	ts := testutil.Start(t)
+	for _, args := range [][]string{
+		{"-concurrency", "0"},
+		{"-stream-ratio", "1.5"},
+		{"-rate", "-1"},
+		{"extra"},
+	} {
+		if code, _, _ := runAgainst(t, ts, "", append([]string{"loadtest"}, args...)...); code != exitUsage {
+			t.Errorf("loadtest %v: exit code %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Microsecond)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{{50, 500 * time.Microsecond}, {90, 900 * time.Microsecond}, {99, 990 * time.Microsecond}, {100, time.Millisecond}} {
+		got := h.percentile(tt.p)
+		if diff := math.Abs(float64(got-tt.want)) / float64(tt.want); diff > 0.01 {
+			t.Errorf("p%v = %v, want %v within 1%%", tt.p, got, tt.want)
+		}
+	}
+	if h.max != time.Millisecond {
+		t.Errorf("max = %v, want 1ms", h.max)
+	}
+
+	var merged histogram
+	merged.merge(&h)
+	merged.record(time.Second)
+	if merged.total != 1001 || merged.percentile(100) != time.Second || merged.percentile(50) != h.percentile(50) {
+		t.Errorf("after merging: total %d, p100 %v, p50 %v", merged.total, merged.percentile(100), merged.percentile(50))
+	}
+	for _, v := range []int64{0, 1, 255, 256, 257, 1000, 1 << 20, 1<<40 + 12345} {
+		if high := bucketHigh(bucket(v)); high < v || float64(high-v) > float64(v)/100 {
+			t.Errorf("value %d lands in a bucket reaching %d", v, high)
+		}
+	}
+}
+
+func TestV2(t *testing.T) {
+	ts := testutil.Start(t)
+	for i, args := range [][]string{{"hello", "-name", "Alice"}, {"-v2", "hello", "-name", "Alice"}} {
+		code, stdout, stderr := runAgainst(t, ts, "", args...)
+		want := []string{"Hello, Alice! (Count: 1)\n", "Hello again, Alice! That makes 2 greetings. (Count: 2)\n"}[i]
+		if code != 0 || stdout != want {
+			t.Errorf("%v: got code %d stdout %q (stderr %q), want %q", args, code, stdout, stderr, want)
+		}
+	}
+	if code, stdout, _ := runAgainst(t, ts, "", "-v2", "count", "-name", "Alice"); code != 0 || !strings.HasPrefix(stdout, "Alice\t2\t") {
+		t.Errorf("-v2 count: got code %d stdout %q, want a count of 2", code, stdout)
+	}
+}
+
+// replayFixture holds five requests, the third with a misspelt field.
+const replayFixture = `{"name": "Alice"}
+{"name": "Bob", "locale": "es"}
+{"nmae": "Carol"}
+
+{"name": "Dave"}
+{"name": "Alice"}
+`
+
+// decodeReplay parses replay's JSON lines output.
+func decodeReplay(t *testing.T, out string) []replayResult {
+	t.Helper()
+	var results []replayResult
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var res replayResult
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("decoding %q: %v", line, err)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func TestReplay(t *testing.T) {
+	ts := testutil.Start(t)
+	code, stdout, stderr := runAgainst(t, ts, replayFixture, "replay")
+	if code != 1 || !strings.Contains(stderr, "1 of 5 requests failed") {
+		t.Errorf("got code %d stderr %q, want 1 and one failure", code, stderr)
+	}
+
+	results := decodeReplay(t, stdout)
+	wantLines := []int{1, 2, 3, 5, 6}
+	if len(results) != len(wantLines) {
+		t.Fatalf("got %d results, want %d: %q", len(results), len(wantLines), stdout)
+	}
+	responses := 0
+	for i, res := range results {
+		if res.Line != wantLines[i] {
+			t.Errorf("result %d is for line %d, want %d", i, res.Line, wantLines[i])
+		}
+		if res.Response != nil {
+			responses++
+		}
+	}
+	if responses != 4 {
+		t.Errorf("got %d responses, want 4", responses)
+	}
+	if bad := results[2]; bad.Response != nil || bad.Code != "" || !strings.HasPrefix(bad.Error, "line 3: ") || !strings.Contains(bad.Error, "nmae") {
+		t.Errorf("got %+v for the bad line, want a parse error naming line 3 and the field", bad)
+	}
+	var last struct {
+		Message       string `json:"message"`
+		GreetingCount int    `json:"greetingCount"`
+	}
+	if err := json.Unmarshal(results[4].Response, &last); err != nil || last.Message != "Hello again, Alice! That makes 2 greetings." || last.GreetingCount != 2 {
+		t.Errorf("second greeting of Alice = %s, want the count at 2", results[4].Response)
+	}
+	if !strings.Contains(string(results[1].Request), `"locale":"es"`) {
+		t.Errorf("request %s does not echo the locale", results[1].Request)
+	}
+}
+
+func TestReplayConcurrentFiles(t *testing.T) {
+	ts := testutil.Start(t)
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "in.jsonl"), filepath.Join(dir, "out.jsonl")
+	var fixture strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&fixture, "{\"name\": \"user%d\"}\n", i)
+	}
+	if err := os.WriteFile(input, []byte(fixture.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr := runAgainst(t, ts, "", "replay", "-input", input, "-output", output, "-concurrency", "4")
+	if code != 0 || stdout != "" {
+		t.Fatalf("got code %d stdout %q (stderr %q), want 0 and no output", code, stdout, stderr)
+	}
+	out, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[int]bool{}
+	for _, res := range decodeReplay(t, string(out)) {
+		if res.Error != "" || res.Response == nil {
+			t.Errorf("line %d failed: %s", res.Line, res.Error)
+		}
+		seen[res.Line] = true
+	}
+	if len(seen) != 20 {
+		t.Errorf("got results for %d distinct lines, want 20", len(seen))
+	}
+
+	if code, _, _ := runAgainst(t, ts, "", "replay", "-concurrency", "0"); code != exitUsage {
+		t.Errorf("-concurrency 0: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+// FuzzProtojsonInput checks that parsing replay input never panics, that
+// each line either parses to a request that survives a round trip or fails
+// with a protojson error naming the line, and that reading stops only at
+// an overlong line.
+func FuzzProtojsonInput(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"\n\n",
+		`{"name":"Alice","locale":"fr"}`,
+		`{"name":"Alice"` + "\n" + `{"name":`,
+		`{"name":"Al\xffce"}`,
+		"{\"name\":\"Al\xffce\"}",
+		`{"name":"Alice","nmae":"typo"}`,
+		`{"count":-1,"interval":"1.5s"}`,
+		`{"interval":"forever"}`,
+		`[]`,
+		`{"name":"` + strings.Repeat("x", maxReplayLine) + `"}`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		jobs := make(chan replayJob)
+		done := make(chan error, 1)
+		go func() {
+			done <- readReplay(context.Background(), strings.NewReader(input), jobs)
+			close(jobs)
+		}()
+		for j := range jobs {
+			if j.err != nil {
+				if j.req != nil || !errors.Is(j.err, proto.Error) || !strings.HasPrefix(j.err.Error(), fmt.Sprintf("line %d: ", j.line)) {
+					t.Errorf("line %d: got request %v and error %v, want only a protojson error naming the line", j.line, j.req, j.err)
+				}
+				continue
+			}
+			data, err := protojson.Marshal(j.req)
+			if err != nil {
+				t.Fatalf("line %d: re-encoding %v: %v", j.line, j.req, err)
+			}
+			var again pb.HelloRequest
+			if err := protojson.Unmarshal(data, &again); err != nil || !proto.Equal(j.req, &again) {
+				t.Errorf("line %d: %v does not round trip: got %v, %v", j.line, j.req, &again, err)
+			}
+		}
+		if err := <-done; err != nil && !errors.Is(err, bufio.ErrTooLong) {
+			t.Errorf("readReplay: %v", err)
+		}
+	})
+}
+
+func TestReplayCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+	r, err := capture.Open(path, capture.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := testutil.Start(t,
+		testutil.WithGreeterOptions(greeter.WithStreamInterval(0)),
+		testutil.WithServerOptions(grpc.UnaryInterceptor(r.UnaryServerInterceptor()), grpc.StreamInterceptor(r.StreamServerInterceptor())))
+	for _, args := range [][]string{{"hello", "-name", "Alice"}, {"stream", "-name", "Bob"}} {
+		if code, _, stderr := runAgainst(t, ts, "", args...); code != 0 {
+			t.Fatalf("%v: exit code %d (stderr %q)", args, code, stderr)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	same := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0), greeter.WithInstanceID("other")))
+	code, stdout, stderr := runAgainst(t, same, "", "replay-capture", path)
+	if code != 0 || stdout != "2 calls replayed, 0 differ\n" {
+		t.Errorf("replay against the same greeter: code %d stdout %q (stderr %q), want no differences", code, stdout, stderr)
+	}
+
+	// Alice's name is now too long
+	changed := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0), greeter.WithMaxNameLength(3)))
+	code, stdout, stderr = runAgainst(t, changed, "", "replay-capture", path)
+	if code != 1 || !strings.Contains(stdout, "call 1 /example.Greeter/SayHello: finished with InvalidArgument") ||
+		!strings.HasSuffix(stdout, "2 calls replayed, 1 differ\n") || !strings.Contains(stderr, "1 of 2 calls differ") {
+		t.Errorf("replay against a changed greeter: code %d stdout %q (stderr %q), want SayHello to differ", code, stdout, stderr)
+	}
+
+	if code, _, _ := runAgainst(t, same, "", "replay-capture"); code != exitUsage {
+		t.Errorf("replay-capture without a file: exit code %d, want %d", code, exitUsage)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxReplayLine bounds one line of replay input.
+const maxReplayLine = 1 << 20
+
+type replayCmd struct {
+	input       string
+	output      string
+	concurrency int
+}
+
+func (c *replayCmd) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.input, "input", "-", "file of HelloRequest messages in protojson, one per line (- for stdin)")
+	fs.StringVar(&c.output, "output", "", "file the results are written to as JSON lines (stdout when empty)")
+	fs.IntVar(&c.concurrency, "concurrency", 1, "requests in flight at once; results are written in input order only when 1")
+}
+
+// args checks the flag values; replay takes no positional arguments.
+func (c *replayCmd) args(args []string) error {
+	switch {
+	case len(args) > 0:
+		return fmt.Errorf("replay takes no arguments, got %q", args)
+	case c.concurrency < 1:
+		return fmt.Errorf("-concurrency must be at least 1, got %d", c.concurrency)
+	}
+	return nil
+}
+
+// replayJob is one input line to replay.
+type replayJob struct {
+	line int
+	req  *pb.HelloRequest
+	// err is why the line could not be parsed; req is nil when it is set.
+	err error
+}
+
+// replayResult is the JSON line written for each input line. Code is set
+// for failed calls and empty for lines that could not be parsed.
+type replayResult struct {
+	Line     int             `json:"line"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+func (c *replayCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	in := e.stdin
+	if c.input != "-" {
+		f, err := os.Open(c.input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	out := e.stdout
+	if c.output != "" {
+		f, err := os.Create(c.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var (
+		mu       sync.Mutex
+		enc      = json.NewEncoder(out)
+		writeErr error
+		total    int
+		failed   int
+		wg       sync.WaitGroup
+		jobs     = make(chan replayJob)
+	)
+	for w := 0; w < c.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res := replay(ctx, client, j)
+				mu.Lock()
+				total++
+				if res.Error != "" {
+					failed++
+				}
+				if err := enc.Encode(res); err != nil && writeErr == nil {
+					writeErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := readReplay(ctx, in, jobs)
+	close(jobs)
+	wg.Wait()
+	switch {
+	case err != nil:
+		return err
+	case writeErr != nil:
+		return writeErr
+	case failed > 0:
+		return fmt.Errorf("%d of %d requests failed", failed, total)
+	}
+	return nil
+}
+
+// readReplay parses each non-blank line of in and passes it to jobs, until
+// in ends or ctx is done.
+func readReplay(ctx context.Context, in io.Reader, jobs chan<- replayJob) error {
+	if in == nil {
+		return nil
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, maxReplayLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		j := replayJob{line: line, req: &pb.HelloRequest{}}
+		// Unknown fields are rejected, so a typo is not replayed as an
+		// empty field
+		if err := protojson.Unmarshal([]byte(text), j.req); err != nil {
+			j.req, j.err = nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		select {
+		case jobs <- j:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return scanner.Err()
+}
+
+// replay calls SayHello with j's request, if it has one, and returns the
+// result to write.
+func replay(ctx context.Context, client *greeterclient.Client, j replayJob) replayResult {
+	res := replayResult{Line: j.line}
+	if j.err != nil {
+		res.Error = j.err.Error()
+		return res
+	}
+	res.Request = marshalResult(j.req)
+	resp, err := client.HelloRequest(ctx, j.req)
+	if err != nil {
+		st := status.Convert(err)
+		res.Code, res.Error = st.Code().String(), st.Message()
+		return res
+	}
+	res.Response = marshalResult(resp)
+	return res
+}
+
+// marshalResult renders m for a replayResult, or returns nil if it cannot.
+func marshalResult(m proto.Message) json.RawMessage {
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shrivatsas/exp-codegen/grpc/capture"
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	// Captured messages are decoded with the types linked in
+	_ "github.com/shrivatsas/exp-codegen/grpc/protos"
+	_ "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	_ "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// defaultIgnore lists the reply fields that differ from one server, or one
+// moment, to the next.
+const defaultIgnore = "served_at,served_by,timestamp,greeted_at,last_greeted"
+
+// replayCaptureCmd sends the calls of a server's -capture file again and
+// reports where the responses differ from those captured.
+type replayCaptureCmd struct {
+	file   string
+	ignore string
+}
+
+func (c *replayCaptureCmd) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ignore, "ignore", defaultIgnore, "comma-separated fields left out when comparing responses, wherever they appear")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: greeterctl [global flags] replay-capture [-ignore fields] <file>")
+		fs.PrintDefaults()
+	}
+}
+
+func (c *replayCaptureCmd) args(args []string) error {
+	if len(args) != 1 {
+		return errors.New("replay-capture takes the capture file")
+	}
+	c.file = args[0]
+	return nil
+}
+
+func (c *replayCaptureCmd) run(ctx context.Context, client *greeterclient.Client, e env) error {
+	f, err := os.Open(c.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	calls, err := capture.ReadCalls(f)
+	if err != nil {
+		return err
+	}
+
+	diffs := capture.Replay(ctx, client.Conn(), calls, capture.ReplayOptions{Ignore: strings.Split(c.ignore, ",")})
+	differ := make(map[uint64]bool)
+	for _, d := range diffs {
+		fmt.Fprintln(e.stdout, d)
+		differ[d.Call.ID] = true
+	}
+	fmt.Fprintf(e.stdout, "%d calls replayed, %d differ\n", len(calls), len(differ))
+	if len(differ) > 0 {
+		return fmt.Errorf("%d of %d calls differ from the capture", len(differ), len(calls))
+	}
+	return nil
+}
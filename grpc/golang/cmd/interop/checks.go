@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamReplies is the number of replies every Greeter implementation sends
+// from SayHelloStream by default.
+const streamReplies = 5
+
+// settings tunes the checks to the server under test.
+type settings struct {
+	// payloadSize is the length in bytes of the large_payload name.
+	payloadSize int
+	// deadline is the deadline_exceeded call's deadline. It must be shorter
+	// than the server takes to send every SayHelloStream reply.
+	deadline time.Duration
+}
+
+// check is one interop test case. It returns nil if the server behaved as
+// every Greeter implementation must.
+type check struct {
+	name string
+	run  func(ctx context.Context, client pb.GreeterClient, s settings) error
+}
+
+// suite lists the checks in the order they run. They only use fields every
+// language's Greeter supports, so any server can be tested.
+var suite = []check{
+	{"unary", checkUnary},
+	{"empty_name", checkEmptyName},
+	{"stream_count", checkStreamCount},
+	{"large_payload", checkLargePayload},
+	{"deadline_exceeded", checkDeadlineExceeded},
+}
+
+func checkUnary(ctx context.Context, client pb.GreeterClient, _ settings) error {
+	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "interop"})
+	if err != nil {
+		return fmt.Errorf("SayHello: %w", err)
+	}
+	if resp.GreetingCount < 1 {
+		return fmt.Errorf("got greeting count %d, want at least 1", resp.GreetingCount)
+	}
+	// A server may word its greeting differently for a name it greeted
+	// before, as on an earlier run of the suite
+	if want := "Hello, interop!"; resp.GreetingCount == 1 && resp.Message != want {
+		return fmt.Errorf("got message %q, want %q", resp.Message, want)
+	}
+	if !strings.Contains(resp.Message, "interop") {
+		return fmt.Errorf("got message %q, want one greeting interop", resp.Message)
+	}
+	return nil
+}
+
+func checkEmptyName(ctx context.Context, client pb.GreeterClient, _ settings) error {
+	_, err := client.SayHello(ctx, &pb.HelloRequest{})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		return fmt.Errorf("got %v, want InvalidArgument", code)
+	}
+	return nil
+}
+
+func checkStreamCount(ctx context.Context, client pb.GreeterClient, _ settings) error {
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "interop"})
+	if err != nil {
+		return fmt.Errorf("SayHelloStream: %w", err)
+	}
+	for n := 0; ; n++ {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			if n != streamReplies {
+				return fmt.Errorf("got %d replies, want %d", n, streamReplies)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Recv after %d replies: %w", n, err)
+		}
+		if want := fmt.Sprintf("Hello %d, interop!", n+1); resp.Message != want {
+			return fmt.Errorf("reply %d has message %q, want %q", n+1, resp.Message, want)
+		}
+	}
+}
+
+func checkLargePayload(ctx context.Context, client pb.GreeterClient, s settings) error {
+	name := strings.Repeat("x", s.payloadSize)
+	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: name})
+	if err != nil {
+		return fmt.Errorf("SayHello with a %d-byte name: %w", s.payloadSize, err)
+	}
+	if !strings.Contains(resp.Message, name) {
+		return fmt.Errorf("reply of %d bytes does not contain the %d-byte name", len(resp.Message), s.payloadSize)
+	}
+	return nil
+}
+
+func checkDeadlineExceeded(ctx context.Context, client pb.GreeterClient, s settings) error {
+	ctx, cancel := context.WithTimeout(ctx, s.deadline)
+	defer cancel()
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "interop"})
+	if err != nil {
+		return fmt.Errorf("SayHelloStream: %w", err)
+	}
+	for n := 0; ; n++ {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			return fmt.Errorf("stream finished within %v, want DeadlineExceeded", s.deadline)
+		}
+		if err != nil {
+			if code := status.Code(err); code != codes.DeadlineExceeded {
+				return fmt.Errorf("got %v after %d replies, want DeadlineExceeded", code, n)
+			}
+			return nil
+		}
+	}
+}
+
+// result is the outcome of one check in the report.
+type result struct {
+	Name     string  `json:"name"`
+	Passed   bool    `json:"passed"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// report is the JSON document interop writes.
+type report struct {
+	Target  string   `json:"target"`
+	Passed  bool     `json:"passed"`
+	Results []result `json:"results"`
+}
+
+// runSuite runs checks against client, giving each at most timeout.
+func runSuite(ctx context.Context, client pb.GreeterClient, checks []check, s settings, timeout time.Duration) []result {
+	results := make([]result, 0, len(checks))
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := c.run(checkCtx, client, s)
+		cancel()
+		r := result{Name: c.name, Passed: err == nil, Duration: time.Since(start).Seconds()}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,120 @@
+// Command interop checks that a Greeter server, in any language, behaves as
+// the Go client expects:
+//
+//	interop -addr host:port
+//
+// It talks to the server only through the generated stubs, runs a fixed
+// suite of checks and writes a JSON report to stdout. The exit status is 0
+// if every check passed, 1 if any failed and 2 for bad usage.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// config holds the settings that can be overridden from the command line.
+type config struct {
+	addr     string
+	tls      bool
+	caCert   string
+	timeout  time.Duration
+	settings settings
+}
+
+// buildConfig parses args into a config, writing usage to output on bad input.
+func buildConfig(args []string, output io.Writer) (config, error) {
+	var cfg config
+
+	fs := flag.NewFlagSet("interop", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&cfg.addr, "addr", "localhost:50051", "address of the Greeter server under test: host:port, a dns:/// target or unix:///path/to.sock")
+	fs.BoolVar(&cfg.tls, "tls", false, "connect using TLS")
+	fs.StringVar(&cfg.caCert, "ca-cert", "", "PEM CA bundle used to verify the server (requires -tls)")
+	fs.DurationVar(&cfg.timeout, "timeout", 15*time.Second, "time allowed for each check")
+	fs.IntVar(&cfg.settings.payloadSize, "payload-size", 256<<10, "bytes in the large_payload name; lower it for servers that cap name length")
+	fs.DurationVar(&cfg.settings.deadline, "deadline", 100*time.Millisecond, "deadline of the deadline_exceeded stream, which must be shorter than the server takes to stream every reply")
+
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	var err error
+	switch {
+	case cfg.timeout <= 0:
+		err = fmt.Errorf("-timeout must be positive, got %v", cfg.timeout)
+	case cfg.settings.payloadSize <= 0:
+		err = fmt.Errorf("-payload-size must be positive, got %d", cfg.settings.payloadSize)
+	case cfg.settings.deadline <= 0:
+		err = fmt.Errorf("-deadline must be positive, got %v", cfg.settings.deadline)
+	case !cfg.tls && cfg.caCert != "":
+		err = fmt.Errorf("-ca-cert requires -tls")
+	}
+	if err != nil {
+		fmt.Fprintln(output, err)
+		fs.Usage()
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+func main() {
+	cfg, err := buildConfig(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	os.Exit(run(cfg, os.Stdout, os.Stderr))
+}
+
+// run executes the suite against the server in cfg, writing the report to
+// stdout, and returns the exit status. dialOpts are added to those built
+// from cfg; tests use them to reach an in-process server.
+func run(cfg config, stdout, stderr io.Writer, dialOpts ...grpc.DialOption) int {
+	creds := insecure.NewCredentials()
+	if cfg.tls {
+		var err error
+		creds, err = tlsconfig.Client(tlsconfig.ClientOptions{CACertFile: cfg.caCert})
+		if err != nil {
+			fmt.Fprintf(stderr, "interop: %v\n", err)
+			return 2
+		}
+	}
+	target, opts := endpoint.Dial(cfg.addr)
+	opts = append(opts, grpc.WithTransportCredentials(creds), grpc.WithUserAgent("interop"))
+	conn, err := grpc.NewClient(target, append(opts, dialOpts...)...)
+	if err != nil {
+		fmt.Fprintf(stderr, "interop: %v\n", err)
+		return 2
+	}
+	defer conn.Close()
+
+	rep := report{Target: cfg.addr, Passed: true}
+	rep.Results = runSuite(context.Background(), pb.NewGreeterClient(conn), suite, cfg.settings, cfg.timeout)
+	for _, r := range rep.Results {
+		rep.Passed = rep.Passed && r.Passed
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rep); err != nil {
+		fmt.Fprintf(stderr, "interop: writing report: %v\n", err)
+		return 1
+	}
+	if !rep.Passed {
+		return 1
+	}
+	return 0
+}
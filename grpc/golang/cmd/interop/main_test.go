@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+)
+
+// runAgainst runs the suite against ts and returns the exit status and the
+// decoded report.
+func runAgainst(t *testing.T, ts *testutil.Server) (int, report) {
+	t.Helper()
+	cfg, err := buildConfig([]string{"-addr", testutil.Target, "-timeout", "5s"}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("buildConfig: %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := run(cfg, &stdout, &stderr, grpc.WithContextDialer(ts.Dialer()))
+	var rep report
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+		t.Fatalf("report %q is not JSON: %v (stderr: %q)", stdout.String(), err, stderr.String())
+	}
+	return code, rep
+}
+
+func TestSuitePasses(t *testing.T) {
+	// The replies must be slower than the deadline_exceeded deadline
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(50*time.Millisecond)))
+	code, rep := runAgainst(t, ts)
+	if code != 0 || !rep.Passed {
+		t.Errorf("exit code %d and passed %v, want 0 and true: %+v", code, rep.Passed, rep.Results)
+	}
+	if len(rep.Results) != len(suite) {
+		t.Fatalf("got %d results, want %d", len(rep.Results), len(suite))
+	}
+	for i, r := range rep.Results {
+		if r.Name != suite[i].name || !r.Passed {
+			t.Errorf("result %d = %+v, want %s to pass", i, r, suite[i].name)
+		}
+	}
+}
+
+// brokenGreeter accepts empty names and stops streaming one reply short.
+type brokenGreeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (brokenGreeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!", GreetingCount: 1}, nil
+}
+
+func (brokenGreeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	for i := 0; i < streamReplies-1; i++ {
+		if err := stream.Send(&pb.HelloReply{Message: fmt.Sprintf("Hello %d, %s!", i+1, req.Name)}); err != nil {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestSuiteDetectsFailures(t *testing.T) {
+	code, rep := runAgainst(t, testutil.Start(t, testutil.WithService(brokenGreeter{})))
+	if code != 1 || rep.Passed {
+		t.Errorf("exit code %d and passed %v, want 1 and false", code, rep.Passed)
+	}
+	want := map[string]bool{
+		"unary":             true,
+		"empty_name":        false,
+		"stream_count":      false,
+		"large_payload":     true,
+		"deadline_exceeded": true,
+	}
+	for _, r := range rep.Results {
+		if r.Passed != want[r.Name] {
+			t.Errorf("%s passed = %v, want %v (error: %q)", r.Name, r.Passed, want[r.Name], r.Error)
+		}
+		if !r.Passed && r.Error == "" {
+			t.Errorf("%s failed without an error", r.Name)
+		}
+	}
+}
+
+func TestBuildConfigInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"-timeout", "0s"},
+		{"-payload-size", "0"},
+		{"-deadline", "-1s"},
+		{"-ca-cert", "ca.pem"},
+	} {
+		if _, err := buildConfig(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("buildConfig(%q) succeeded", args)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// generatedSuffixes end the names of the files the plugins write, so that
+// committed stubs no .proto file generates any more can be found.
+var generatedSuffixes = []string{".pb.go", ".pb.gw.go"}
+
+// maxDiffLines caps the lines shown from each side of a stale file's change.
+const maxDiffLines = 8
+
+// compare returns a description of each file under root that differs from
+// its freshly generated copy under generated, sorted by path: stale files
+// with their changed lines, missing ones, and stubs in root's protoDir that
+// were not generated at all.
+func compare(generated, root string) ([]string, error) {
+	diffs := map[string]string{}
+	want := map[string]bool{}
+	err := filepath.WalkDir(generated, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(generated, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		want[name] = true
+		fresh, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		committed, err := os.ReadFile(filepath.Join(root, rel))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			diffs[name] = name + ": missing\n"
+		case err != nil:
+			return err
+		case !bytes.Equal(committed, fresh):
+			diffs[name] = describe(name, committed, fresh)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(filepath.Join(root, protoDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isGenerated(path) {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); !want[name] {
+			diffs[name] = name + ": not generated from any .proto file\n"
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(diffs))
+	for name := range diffs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = diffs[name]
+	}
+	return out, nil
+}
+
+func isGenerated(path string) bool {
+	for _, s := range generatedSuffixes {
+		if strings.HasSuffix(path, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe names the stale file and shows the span of lines between the
+// first and last that differ, committed lines marked - and generated ones +.
+func describe(name string, committed, fresh []byte) string {
+	old, new := strings.Split(string(committed), "\n"), strings.Split(string(fresh), "\n")
+	start := 0
+	for start < len(old) && start < len(new) && old[start] == new[start] {
+		start++
+	}
+	end := 0
+	for end < len(old)-start && end < len(new)-start && old[len(old)-1-end] == new[len(new)-1-end] {
+		end++
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: stale from line %d\n", name, start+1)
+	writeLines(&b, "-", old[start:len(old)-end])
+	writeLines(&b, "+", new[start:len(new)-end])
+	return b.String()
+}
+
+func writeLines(b *strings.Builder, mark string, lines []string) {
+	for i, l := range lines {
+		if i == maxDiffLines {
+			fmt.Fprintf(b, "\t%s ... %d more lines\n", mark, len(lines)-i)
+			return
+		}
+		fmt.Fprintf(b, "\t%s %s\n", mark, l)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// protoDir holds the .proto files, relative to the module root.
+const protoDir = "protos"
+
+// importPaths are the directories, relative to the module root, that
+// imports are resolved against after the well-known types.
+var importPaths = []string{".", "third_party/googleapis"}
+
+// plugins run, in order, on every .proto file, each with pluginParam.
+var plugins = []string{"protoc-gen-go", "protoc-gen-go-grpc", "protoc-gen-grpc-gateway"}
+
+const pluginParam = "paths=source_relative"
+
+// generate compiles the .proto files under root and writes the stubs the
+// plugins produce for them under out.
+func generate(root, out string) error {
+	files, err := protoFiles(root)
+	if err != nil {
+		return err
+	}
+	req, err := compile(root, files)
+	if err != nil {
+		return err
+	}
+	for _, name := range plugins {
+		resp, err := runPlugin(name, req)
+		if err != nil {
+			return err
+		}
+		for _, f := range resp.File {
+			if f.GetInsertionPoint() != "" {
+				return fmt.Errorf("%s: insertion points are not supported, got one in %s", name, f.GetName())
+			}
+			path := filepath.Join(out, filepath.FromSlash(f.GetName()))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, []byte(f.GetContent()), 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// protoFiles returns the .proto files under root's protoDir, as paths
+// relative to root with forward slashes, the way they are imported.
+func protoFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(filepath.Join(root, protoDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".proto" {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .proto files in %s", filepath.Join(root, protoDir))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// compile parses and links files, returning the request that asks a plugin
+// to generate them. Errors name the file, line and column at fault.
+func compile(root string, files []string) (*pluginpb.CodeGeneratorRequest, error) {
+	var dirs []string
+	for _, p := range importPaths {
+		dirs = append(dirs, filepath.Join(root, p))
+	}
+	c := protocompile.Compiler{
+		Resolver:       protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: dirs}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	compiled, err := c.Compile(context.Background(), files...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plugins want every file the generated ones import, dependencies first
+	req := &pluginpb.CodeGeneratorRequest{FileToGenerate: files, Parameter: proto.String(pluginParam)}
+	seen := map[string]bool{}
+	var add func(protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		req.ProtoFile = append(req.ProtoFile, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range compiled {
+		add(fd)
+	}
+	return req, nil
+}
+
+// runPlugin runs the named plugin from PATH on req, as protoc would.
+func runPlugin(name string, req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found on PATH; go doc ./cmd/protogen lists the plugins to install", name)
+	}
+	in, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	resp := &pluginpb.CodeGeneratorResponse{}
+	if err := proto.Unmarshal(out, resp); err != nil {
+		return nil, fmt.Errorf("%s: reading response: %w", name, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%s: %s", name, resp.GetError())
+	}
+	return resp, nil
+}
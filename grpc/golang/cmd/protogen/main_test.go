@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// moduleRoot is the module root, relative to this package.
+const moduleRoot = "../.."
+
+// requirePlugins skips the test unless every plugin is on PATH.
+func requirePlugins(t *testing.T) {
+	t.Helper()
+	for _, name := range plugins {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s is not on PATH", name)
+		}
+	}
+}
+
+// copyTree copies the protos and third_party directories of the module into
+// a temporary directory and returns it.
+func copyTree(t *testing.T) string {
+	t.Helper()
+	dst := t.TempDir()
+	for _, dir := range []string{protoDir, "third_party"} {
+		err := filepath.WalkDir(filepath.Join(moduleRoot, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(moduleRoot, path)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(dst, rel)
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, 0o644)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dst
+}
+
+// appendProto adds text to the named .proto file under root.
+func appendProto(t *testing.T, root, name, text string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(data, text...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func check(t *testing.T, root string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	status := run(config{root: root, check: true}, &stdout, &stderr)
+	if stderr.Len() > 0 {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return status, stdout.String()
+}
+
+func TestCheckCommitted(t *testing.T) {
+	requirePlugins(t)
+	if status, out := check(t, moduleRoot); status != 0 {
+		t.Errorf("got status %d, want the committed stubs up to date:\n%s", status, out)
+	}
+}
+
+func TestCheckStale(t *testing.T) {
+	requirePlugins(t)
+	root := copyTree(t)
+	appendProto(t, root, "protos/service.proto", "\nmessage Unused {\n  string note = 1;\n}\n")
+	if err := os.Remove(filepath.Join(root, "protos/v2/greeter.pb.gw.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "protos/old.pb.go"), []byte("package proto\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out := check(t, root)
+	if status != 1 {
+		t.Fatalf("got status %d, want 1:\n%s", status, out)
+	}
+	for _, want := range []string{
+		"protos/old.pb.go: not generated from any .proto file\n",
+		"protos/service.pb.go: stale from line",
+		"+ type Unused struct {",
+		"protos/v2/greeter.pb.gw.go: missing\n",
+		"3 generated files are out of date",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "service_grpc.pb.go") {
+		t.Errorf("output names service_grpc.pb.go, which the change leaves alone:\n%s", out)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	requirePlugins(t)
+	root := copyTree(t)
+	appendProto(t, root, "protos/v2/greeter.proto", "\nmessage Unused {}\n")
+	if status := run(config{root: root}, io.Discard, io.Discard); status != 0 {
+		t.Fatalf("got status %d, want 0", status)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "protos/v2/greeter.pb.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("type Unused struct {")) {
+		t.Error("greeter.pb.go was not regenerated")
+	}
+	if status, out := check(t, root); status != 0 {
+		t.Errorf("got status %d after generating, want 0:\n%s", status, out)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	root := copyTree(t)
+	appendProto(t, root, "protos/service.proto", "\nmessage Broken {\n")
+	var stderr bytes.Buffer
+	if status := run(config{root: root, check: true}, io.Discard, &stderr); status != 2 {
+		t.Errorf("got status %d, want 2", status)
+	}
+	if !strings.Contains(stderr.String(), "protos/service.proto:") {
+		t.Errorf("got %q, want an error naming the file", stderr.String())
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	cfg, err := buildConfig([]string{"-root", "..", "-check"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != (config{root: "..", check: true}) {
+		t.Errorf("got %+v", cfg)
+	}
+	if _, err := buildConfig([]string{"protos"}, io.Discard); err == nil {
+		t.Error("buildConfig accepted an argument, want an error")
+	}
+}
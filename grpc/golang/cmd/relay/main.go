@@ -0,0 +1,213 @@
+// Command relay is a Greeter server whose SayHello fans out to several
+// downstream Greeter servers and answers with their replies combined. It
+// shows how a handler passes its caller's deadline, request ID and
+// cancellation on to the calls it makes.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ErrorDomain is the domain of the ErrorInfo details naming the downstreams
+// that failed.
+const ErrorDomain = "relay.greeter"
+
+// config holds the relay settings that can be overridden from the command line.
+type config struct {
+	addr        string
+	downstreams []string
+	margin      time.Duration
+	timeout     time.Duration
+}
+
+// buildConfig parses args into a config, writing usage to output on bad input.
+func buildConfig(args []string, output io.Writer) (config, error) {
+	var cfg config
+
+	fs := flag.NewFlagSet("relay", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&cfg.addr, "addr", ":50052", "address to listen on, either host:port or unix:///path/to.sock")
+	downstreams := fs.String("downstreams", "localhost:50051", "comma-separated addresses of the Greeter servers each SayHello is relayed to")
+	fs.DurationVar(&cfg.margin, "deadline-margin", 50*time.Millisecond, "how much sooner than the caller's deadline the downstream calls must finish, leaving time to answer")
+	fs.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "deadline of the downstream calls when the caller set none")
+
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	for _, addr := range strings.Split(*downstreams, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.downstreams = append(cfg.downstreams, addr)
+		}
+	}
+
+	var err error
+	switch {
+	case len(cfg.downstreams) == 0:
+		err = fmt.Errorf("-downstreams must name at least one server")
+	case cfg.margin < 0:
+		err = fmt.Errorf("-deadline-margin must not be negative, got %v", cfg.margin)
+	case cfg.timeout <= 0:
+		err = fmt.Errorf("-timeout must be positive, got %v", cfg.timeout)
+	}
+	if err != nil {
+		fmt.Fprintln(output, err)
+		fs.Usage()
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+// downstream is a Greeter server the relay calls.
+type downstream struct {
+	addr   string
+	client pb.GreeterClient
+}
+
+// relay implements SayHello by calling every downstream at once. Only
+// SayHello is relayed; the other methods are unimplemented.
+type relay struct {
+	pb.UnimplementedGreeterServer
+	downstreams []downstream
+	margin      time.Duration
+	timeout     time.Duration
+}
+
+type result struct {
+	reply *pb.HelloReply
+	err   error
+}
+
+// SayHello asks every downstream to greet req.Name and answers with their
+// messages joined and their counts summed. The downstream calls end margin
+// before the caller's deadline, or after timeout if it set none, and are
+// cancelled along with the caller's call. Their context carries the
+// caller's request ID, which the requestid client interceptor sends on.
+//
+// If any downstream fails, SayHello fails with an ErrorInfo detail for each
+// one, holding its address and status, and a HelloReply detail combining
+// the replies that did arrive. The code is Unavailable when some
+// downstreams answered and that of the first failure when none did.
+func (r *relay) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-r.margin))
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+	}
+	defer cancel()
+
+	results := make([]result, len(r.downstreams))
+	var wg sync.WaitGroup
+	for i, d := range r.downstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := d.client.SayHello(ctx, req)
+			results[i] = result{reply, err}
+		}()
+	}
+	wg.Wait()
+
+	combined := &pb.HelloReply{ServedAt: timestamppb.Now()}
+	var (
+		messages, servedBy []string
+		failures           []*status.Status
+		details            []*errdetails.ErrorInfo
+	)
+	for i, res := range results {
+		if res.err != nil {
+			st := status.Convert(res.err)
+			failures = append(failures, st)
+			details = append(details, &errdetails.ErrorInfo{
+				Reason:   "DOWNSTREAM_FAILED",
+				Domain:   ErrorDomain,
+				Metadata: map[string]string{"downstream": r.downstreams[i].addr, "code": st.Code().String(), "message": st.Message()},
+			})
+			continue
+		}
+		messages = append(messages, res.reply.Message)
+		servedBy = append(servedBy, res.reply.ServedBy)
+		combined.GreetingCount += res.reply.GreetingCount
+	}
+	combined.Message = strings.Join(messages, " ")
+	combined.ServedBy = strings.Join(servedBy, ",")
+	if len(failures) == 0 {
+		return combined, nil
+	}
+
+	code := codes.Unavailable
+	if len(failures) == len(results) {
+		code = failures[0].Code()
+	}
+	st := status.Newf(code, "%d of %d downstreams failed, first %s", len(failures), len(results), failures[0].Message())
+	for _, d := range details {
+		if withDetail, err := st.WithDetails(d); err == nil {
+			st = withDetail
+		}
+	}
+	if len(messages) > 0 {
+		if withReply, err := st.WithDetails(combined); err == nil {
+			st = withReply
+		}
+	}
+	return nil, st.Err()
+}
+
+// newServer returns a gRPC server relaying SayHello to downstreams that
+// propagates each caller's request ID.
+func newServer(downstreams []downstream, cfg config) *grpc.Server {
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(requestid.UnaryServerInterceptor()))
+	pb.RegisterGreeterServer(s, &relay{downstreams: downstreams, margin: cfg.margin, timeout: cfg.timeout})
+	return s
+}
+
+func main() {
+	cfg, err := buildConfig(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	var downstreams []downstream
+	for _, addr := range cfg.downstreams {
+		target, opts := endpoint.Dial(addr)
+		opts = append(opts,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithChainUnaryInterceptor(requestid.UnaryClientInterceptor()))
+		conn, err := grpc.NewClient(target, opts...)
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %v", addr, err)
+		}
+		defer conn.Close()
+		downstreams = append(downstreams, downstream{addr: addr, client: pb.NewGreeterClient(conn)})
+	}
+
+	lis, err := endpoint.Listen(cfg.addr, endpoint.ListenOptions{})
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	log.Printf("Relay listening on %s, relaying to %s", lis.Addr(), strings.Join(cfg.downstreams, ", "))
+	if err := newServer(downstreams, cfg).Serve(lis); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
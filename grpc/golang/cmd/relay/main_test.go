@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// greeter is a downstream that answers with its name, or blocks until its
+// call ends when block is set, reporting what each call carried.
+type greeter struct {
+	pb.UnimplementedGreeterServer
+	name  string
+	count int32
+	block bool
+	// calls receives the request ID and deadline of each call once it
+	// starts, and ended the context error of each blocked call.
+	calls chan call
+	ended chan error
+}
+
+type call struct {
+	requestID string
+	deadline  time.Time
+}
+
+func newGreeter(name string, count int32) *greeter {
+	return &greeter{name: name, count: count, calls: make(chan call, 1), ended: make(chan error, 1)}
+}
+
+func (g *greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var c call
+	if ids := md.Get(requestid.MetadataKey); len(ids) > 0 {
+		c.requestID = ids[0]
+	}
+	c.deadline, _ = ctx.Deadline()
+	g.calls <- c
+	if g.block {
+		<-ctx.Done()
+		g.ended <- ctx.Err()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return &pb.HelloReply{Message: fmt.Sprintf("Hello, %s!", req.Name), GreetingCount: g.count, ServedBy: g.name}, nil
+}
+
+// dial serves s over an in-memory listener and returns a connection to it
+// sending request IDs.
+func dial(t *testing.T, s *grpc.Server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(requestid.UnaryClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// startRelay runs a relay in front of the downstream greeters.
+func startRelay(t *testing.T, margin time.Duration, greeters ...*greeter) pb.GreeterClient {
+	t.Helper()
+	var downstreams []downstream
+	for _, g := range greeters {
+		s := grpc.NewServer()
+		pb.RegisterGreeterServer(s, g)
+		downstreams = append(downstreams, downstream{addr: g.name, client: pb.NewGreeterClient(dial(t, s))})
+	}
+	cfg := config{margin: margin, timeout: 5 * time.Second}
+	return pb.NewGreeterClient(dial(t, newServer(downstreams, cfg)))
+}
+
+func TestRelay(t *testing.T) {
+	a, b := newGreeter("a", 2), newGreeter("b", 3)
+	client := startRelay(t, time.Second, a, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = requestid.NewContext(ctx, "req-1")
+	reply, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello, Ada! Hello, Ada!"; reply.Message != want {
+		t.Errorf("got message %q, want %q", reply.Message, want)
+	}
+	if reply.GreetingCount != 5 {
+		t.Errorf("got count %d, want 5", reply.GreetingCount)
+	}
+	if reply.ServedBy != "a,b" {
+		t.Errorf("got served_by %q, want a,b", reply.ServedBy)
+	}
+
+	deadline, _ := ctx.Deadline()
+	for _, g := range []*greeter{a, b} {
+		c := <-g.calls
+		if c.requestID != "req-1" {
+			t.Errorf("%s got request ID %q, want req-1", g.name, c.requestID)
+		}
+		// The margin is taken off the caller's deadline; deadlines travel as
+		// timeouts, so they shift by the time taken to send the call
+		if want := deadline.Add(-time.Second); c.deadline.IsZero() || c.deadline.After(want.Add(100*time.Millisecond)) {
+			t.Errorf("%s got deadline %v, want about %v", g.name, c.deadline, want)
+		}
+	}
+}
+
+func TestRelayDownstreamTimeout(t *testing.T) {
+	a, b := newGreeter("a", 2), newGreeter("b", 3)
+	b.block = true
+	client := startRelay(t, 200*time.Millisecond, a, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"})
+	if ctx.Err() != nil {
+		t.Fatalf("relay answered after the caller's deadline: %v", err)
+	}
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable {
+		t.Fatalf("got %v, want Unavailable", err)
+	}
+
+	var (
+		failed  []string
+		partial *pb.HelloReply
+	)
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if d.Domain != ErrorDomain || d.Metadata["code"] != codes.DeadlineExceeded.String() {
+				t.Errorf("got ErrorInfo %v, want a %s one for DeadlineExceeded", d, ErrorDomain)
+			}
+			failed = append(failed, d.Metadata["downstream"])
+		case *pb.HelloReply:
+			partial = d
+		}
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("got failed downstreams %q, want %q", failed, want)
+	}
+	if partial.GetMessage() != "Hello, Ada!" || partial.GetGreetingCount() != 2 {
+		t.Errorf("got partial reply %v, want a's", partial)
+	}
+}
+
+func TestRelayAllFailed(t *testing.T) {
+	a, b := newGreeter("a", 2), newGreeter("b", 3)
+	a.block, b.block = true, true
+	client := startRelay(t, 0, a, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"})
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestRelayCancellation(t *testing.T) {
+	a, b := newGreeter("a", 2), newGreeter("b", 3)
+	a.block, b.block = true, true
+	client := startRelay(t, 0, a, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"})
+		errc <- err
+	}()
+	<-a.calls
+	<-b.calls
+	cancel()
+
+	for _, g := range []*greeter{a, b} {
+		select {
+		case err := <-g.ended:
+			if err != context.Canceled {
+				t.Errorf("%s call ended with %v, want %v", g.name, err, context.Canceled)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s call was not cancelled", g.name)
+		}
+	}
+	if code := status.Code(<-errc); code != codes.Canceled {
+		t.Errorf("got %v, want Canceled", code)
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	cfg, err := buildConfig([]string{"-downstreams", "a:1, b:2,"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a:1", "b:2"}; !reflect.DeepEqual(cfg.downstreams, want) {
+		t.Errorf("got downstreams %q, want %q", cfg.downstreams, want)
+	}
+	for _, args := range [][]string{{"-downstreams", ""}, {"-deadline-margin", "-1s"}, {"-timeout", "0"}} {
+		if _, err := buildConfig(args, io.Discard); err == nil {
+			t.Errorf("buildConfig(%q) succeeded, want an error", args)
+		}
+	}
+}
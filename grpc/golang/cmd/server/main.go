@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shrivatsas/exp-codegen/grpc/apikey"
+	"github.com/shrivatsas/exp-codegen/grpc/audit"
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/capture"
+	"github.com/shrivatsas/exp-codegen/grpc/compression"
+	"github.com/shrivatsas/exp-codegen/grpc/concurrency"
+	"github.com/shrivatsas/exp-codegen/grpc/config"
+	"github.com/shrivatsas/exp-codegen/grpc/deadline"
+	"github.com/shrivatsas/exp-codegen/grpc/experiment"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"github.com/shrivatsas/exp-codegen/grpc/greeterserver"
+	"github.com/shrivatsas/exp-codegen/grpc/logging"
+	"github.com/shrivatsas/exp-codegen/grpc/metrics"
+	"github.com/shrivatsas/exp-codegen/grpc/quota"
+	"github.com/shrivatsas/exp-codegen/grpc/ratelimit"
+	"github.com/shrivatsas/exp-codegen/grpc/recovery"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"github.com/shrivatsas/exp-codegen/grpc/tlsconfig"
+	"github.com/shrivatsas/exp-codegen/grpc/tracing"
+	"github.com/shrivatsas/exp-codegen/grpc/validate"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionalphapb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// infraServices are the health, reflection and channelz services, which
+// the quota, the concurrency limit and the handler deadline leave alone, so
+// probes, tooling and drain-aware clients' long-lived health watches keep
+// working on a busy server.
+var infraServices = []string{
+	auth.HealthService,
+	reflectionpb.ServerReflection_ServiceDesc.ServiceName,
+	reflectionalphapb.ServerReflection_ServiceDesc.ServiceName,
+	channelzpb.Channelz_ServiceDesc.ServiceName,
+}
+
+// buildConfig parses args into a config, writing usage to output on bad input.
+// Settings come from, in rising precedence, their defaults, the -config
+// file, GREETER_ environment variables and the flags in args.
+func buildConfig(args []string, output io.Writer) (config.ServerConfig, error) {
+	cfg := config.DefaultServerConfig()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", "", "YAML file of settings, overridden by GREETER_ environment variables and then by flags")
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return config.ServerConfig{}, err
+	}
+
+	err := config.Load(&cfg, fs, *configFile, os.Getenv)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Fprintln(output, err)
+		fs.Usage()
+		return config.ServerConfig{}, err
+	}
+	return cfg, nil
+}
+
+func main() {
+	cfg, err := buildConfig(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	tracer, err := tracing.InitTracer(context.Background(), tracing.OptionsFromEnv(os.Getenv, "greeter-server"))
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer tracer.Shutdown(context.Background())
+
+	// Register gzip so clients that compress are answered in kind
+	compression.Register(cfg.CompressMinSize)
+
+	opts := []greeterserver.Option{
+		greeterserver.WithAddress(cfg.Addr),
+		greeterserver.WithSocketMode(os.FileMode(cfg.SocketMode)),
+		greeterserver.WithDrainTimeout(cfg.DrainTimeout),
+		greeterserver.WithDrainNotice(cfg.DrainNotice),
+		greeterserver.WithMaxRecvMsgSize(cfg.Limits.MaxRecvMsgSize),
+		greeterserver.WithMaxSendMsgSize(cfg.Limits.MaxSendMsgSize),
+		greeterserver.WithServerOptions(tracer.ServerOptions()...),
+		greeterserver.WithServerOptions(cfg.Keepalive.ServerOptions()...),
+	}
+	if cfg.TLS.Cert != "" {
+		reloader, err := tlsconfig.NewCertReloader(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.ReloadInterval, slog.Default())
+		if err != nil {
+			log.Fatalf("Failed to load TLS credentials: %v", err)
+		}
+		defer reloader.Close()
+		tlsCfg, err := tlsconfig.NewServerConfig(tlsconfig.ServerOptions{
+			Reloader:     reloader,
+			ClientCAFile: cfg.TLS.ClientCA,
+		})
+		if err != nil {
+			log.Fatalf("Failed to load TLS credentials: %v", err)
+		}
+		opts = append(opts, greeterserver.WithTLS(tlsCfg))
+	}
+	if cfg.HTTP.GRPCWeb {
+		opts = append(opts, greeterserver.WithGRPCWeb(cfg.HTTP.GRPCWebOrigins...))
+	}
+	if cfg.HTTP.Endpoints {
+		opts = append(opts, greeterserver.WithHTTPEndpoints(greeterserver.HTTPEndpoints{
+			Metrics: promhttp.Handler(),
+			Pprof:   cfg.HTTP.Pprof,
+		}))
+	}
+	// Metrics are collected when something serves them
+	withMetrics := cfg.HTTP.MetricsAddr != "" || cfg.HTTP.Endpoints
+
+	// Interceptors run in the canonical order whatever order they are set
+	// up in here; see greeterserver.DefaultInterceptors
+	ic := greeterserver.InterceptorConfig{
+		Recovery:  &recovery.Options{Logger: slog.Default()},
+		RequestID: true,
+		Logger:    slog.Default(),
+		LogOptions: logging.Options{
+			LogPayloads:     cfg.Logging.Payloads,
+			SampleEvery:     cfg.Logging.Sample,
+			MaxPayloadBytes: cfg.Logging.MaxPayload,
+		},
+	}
+	if len(cfg.Logging.Redact) > 0 {
+		ic.LogOptions.Redact = logging.FieldRedactor(cfg.Logging.Redact...)
+	}
+	if withMetrics {
+		ic.Metrics, err = metrics.NewServerMetrics(prometheus.DefaultRegisterer, metrics.Options{})
+		if err != nil {
+			log.Fatalf("Failed to register metrics: %v", err)
+		}
+		ic.Recovery.Panics, err = recovery.NewPanicsCounter(prometheus.DefaultRegisterer)
+		if err != nil {
+			log.Fatalf("Failed to register metrics: %v", err)
+		}
+	}
+	if cfg.Limits.MaxConcurrentRequests > 0 {
+		ic.Concurrency = concurrency.MaxConcurrentRequests(cfg.Limits.MaxConcurrentRequests, cfg.Limits.QueueTimeout)
+		ic.Concurrency.Exempt = infraServices
+		if withMetrics {
+			if err := ic.Concurrency.RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+				log.Fatalf("Failed to register metrics: %v", err)
+			}
+		}
+	}
+	if cfg.Limits.MaxHandlerTimeout > 0 {
+		ic.Deadline = &deadline.Options{Max: cfg.Limits.MaxHandlerTimeout, Exempt: infraServices}
+		if withMetrics {
+			ic.Deadline.Clamped, err = deadline.NewClampedCounter(prometheus.DefaultRegisterer)
+			if err != nil {
+				log.Fatalf("Failed to register metrics: %v", err)
+			}
+		}
+	}
+	if cfg.HTTP.MetricsAddr != "" {
+		go serveMetrics(cfg.HTTP.MetricsAddr)
+	}
+
+	// The SQLite store, when set, also keeps quota usage and API keys
+	var db *store.SQLiteStore
+	if cfg.Store.SQLiteDSN != "" {
+		db, err = store.NewSQLiteStore(cfg.Store.SQLiteDSN)
+		if err != nil {
+			log.Fatalf("Failed to open greeting store: %v", err)
+		}
+		defer db.Close()
+		opts = append(opts, greeterserver.WithCountStore(db),
+			greeterserver.WithGreeterOptions(greeter.WithHistoryStore(db)))
+	}
+
+	validator, err := tokenValidator(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load auth settings: %v", err)
+	}
+	var keys *apikey.Keys
+	if cfg.Auth.AdminTokenFile != "" {
+		adminToken, err := readSecret(cfg.Auth.AdminTokenFile)
+		if err != nil {
+			log.Fatalf("Failed to load auth settings: %v", err)
+		}
+		keysOpts := apikey.Options{Admin: auth.NewStaticValidator(adminToken), RefreshInterval: cfg.Auth.APIKeyRefresh}
+		if db != nil {
+			keysOpts.Store = db
+		}
+		keys = apikey.New(keysOpts)
+		opts = append(opts, greeterserver.WithRegister(keys.Register))
+		if validator == nil {
+			// Only API keys are accepted
+			validator = auth.NewStaticValidator()
+		}
+	}
+	if validator != nil {
+		ic.Auth, ic.AuthOptions = validator, auth.DefaultOptions()
+		if keys != nil {
+			// KeyAdmin checks the admin token itself
+			ic.AuthOptions.APIKeys = keys
+			ic.AuthOptions.Allowlist = append(ic.AuthOptions.Allowlist, apikey.ServiceName)
+		}
+	}
+	if cfg.Audit.File != "" {
+		auditOpts := audit.Options{
+			MaxSize:   int64(cfg.Audit.MaxSize),
+			MaxFiles:  cfg.Audit.MaxFiles,
+			Sync:      cfg.Audit.Sync,
+			QueueSize: cfg.Audit.Queue,
+		}
+		if withMetrics {
+			auditOpts.Dropped, err = audit.NewDroppedCounter(prometheus.DefaultRegisterer)
+			if err != nil {
+				log.Fatalf("Failed to register metrics: %v", err)
+			}
+		}
+		ic.Audit, err = audit.Open(cfg.Audit.File, auditOpts)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer func() {
+			if err := ic.Audit.Close(); err != nil {
+				log.Printf("Failed to write audit log: %v", err)
+			}
+		}()
+	}
+	if cfg.Capture != "" {
+		// KeyAdmin responses carry new keys
+		ic.Capture, err = capture.Open(cfg.Capture, capture.Options{Exclude: []string{apikey.ServiceName}})
+		if err != nil {
+			log.Fatalf("Failed to open capture file: %v", err)
+		}
+		defer func() {
+			if err := ic.Capture.Close(); err != nil {
+				log.Printf("Failed to write capture file: %v", err)
+			}
+		}()
+	}
+	if cfg.Limits.RateLimit > 0 {
+		limiterOpts := ratelimit.Options{Default: ratelimit.Limit{Rate: cfg.Limits.RateLimit, Burst: cfg.Limits.RateBurst}}
+		if validator != nil {
+			// Authenticated clients are keyed by subject
+			limiterOpts.Key = ratelimit.AuthSubject
+		}
+		ic.RateLimit = ratelimit.New(limiterOpts)
+	}
+	if cfg.Quota.Limit > 0 {
+		// Validate has checked the time zone
+		loc, _ := time.LoadLocation(cfg.Quota.Timezone)
+		quotaOpts := quota.Options{
+			Limit:    int64(cfg.Quota.Limit),
+			Window:   cfg.Quota.Window,
+			Location: loc,
+			Exempt:   infraServices,
+		}
+		if db != nil {
+			quotaOpts.Store = db
+		}
+		ic.Quota = quota.New(quotaOpts)
+	}
+	// Validate every request message, including those on streams
+	ic.Validate = &validate.Options{MaxNameLength: cfg.Limits.MaxNameLength, RejectUnknown: cfg.StrictFields}
+	opts = append(opts, greeterserver.WithInterceptors(greeterserver.DefaultInterceptors(ic)...))
+
+	greeterOpts := []greeter.Option{
+		greeter.WithMaxBatch(cfg.Limits.MaxBatch),
+		greeter.WithInstanceID(cfg.InstanceID),
+		greeter.WithStreamBuffer(cfg.Stream.Buffer),
+		greeter.WithStreamSendTimeout(cfg.Stream.SendTimeout),
+		greeter.WithHeartbeatInterval(cfg.Stream.HeartbeatInterval),
+	}
+	if withMetrics {
+		slow, err := greeter.NewSlowStreamsCounter(prometheus.DefaultRegisterer)
+		if err != nil {
+			log.Fatalf("Failed to register metrics: %v", err)
+		}
+		greeterOpts = append(greeterOpts, greeter.WithSlowStreamsCounter(slow))
+	}
+	if cfg.GreetingTemplates != "" {
+		f, err := greeter.NewTemplateFormatter(os.DirFS(cfg.GreetingTemplates), ".")
+		if err != nil {
+			log.Fatalf("Failed to load greeting templates: %v", err)
+		}
+		greeterOpts = append(greeterOpts, greeter.WithFormatter(f))
+	}
+	if vs := cfg.Experiment.Variants; len(vs) > 0 {
+		variants := make([]experiment.Variant, len(vs))
+		formatters := make(map[string]greeter.Formatter)
+		for i, v := range vs {
+			variants[i] = experiment.Variant{Name: v.Name, Weight: uint32(v.Weight)}
+			if v.Templates == "" {
+				continue
+			}
+			f, err := greeter.NewTemplateFormatter(os.DirFS(v.Templates), ".")
+			if err != nil {
+				log.Fatalf("Failed to load the greeting templates of variant %s: %v", v.Name, err)
+			}
+			formatters[v.Name] = f
+		}
+		// Authenticated callers keep their variant by subject, and anonymous
+		// ones by IP, since request IDs are new for most calls
+		e, err := experiment.New(experiment.Options{Variants: variants, Identity: ratelimit.AuthSubject})
+		if err != nil {
+			log.Fatalf("Failed to start the experiment: %v", err)
+		}
+		greeterOpts = append(greeterOpts, greeter.WithExperiment(e, formatters))
+		opts = append(opts, greeterserver.WithRegister(e.Register))
+	}
+	if cfg.Limits.ClientQuota > 0 {
+		greeterOpts = append(greeterOpts, greeter.WithClientQuota(cfg.Limits.ClientQuota, cfg.Limits.ClientQuotaWindow))
+	}
+	opts = append(opts, greeterserver.WithGreeterOptions(greeterOpts...))
+	if cfg.Store.CountFile != "" {
+		counts, err := store.NewFileStore(cfg.Store.CountFile, cfg.Store.CountFlushInterval)
+		if err != nil {
+			log.Fatalf("Failed to open greeting counts: %v", err)
+		}
+		defer func() {
+			if err := counts.Close(); err != nil {
+				log.Printf("Failed to save greeting counts: %v", err)
+			}
+		}()
+		opts = append(opts, greeterserver.WithCountStore(counts))
+	}
+	if cfg.Reflection {
+		opts = append(opts, greeterserver.WithReflection())
+	}
+	if cfg.Channelz {
+		opts = append(opts, greeterserver.WithChannelz())
+	}
+
+	srv, err := greeterserver.New(opts...)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		if cfg.DrainNotice > 0 {
+			log.Printf("Shutting down, serving as NOT_SERVING for %v, then draining in-flight RPCs for up to %v", cfg.DrainNotice, cfg.DrainTimeout)
+			return
+		}
+		log.Printf("Shutting down, draining in-flight RPCs for up to %v", cfg.DrainTimeout)
+	}()
+
+	log.Printf("Server started on %s", srv.Addr())
+	err = srv.Serve(ctx)
+	switch {
+	case errors.Is(err, greeterserver.ErrForcedStop):
+		log.Printf("Drain timeout elapsed, forced remaining RPCs closed")
+	case err != nil:
+		log.Fatalf("Failed to serve: %v", err)
+	}
+	log.Printf("Server stopped")
+}
+
+// tokenValidator returns the validator selected by the auth flags, or nil
+// when authentication is disabled.
+func tokenValidator(cfg config.ServerConfig) (auth.TokenValidator, error) {
+	switch {
+	case len(cfg.Auth.Tokens) > 0:
+		return auth.NewStaticValidator(cfg.Auth.Tokens...), nil
+	case cfg.Auth.HMACKeyFile != "":
+		key, err := readSecret(cfg.Auth.HMACKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewHMACValidator([]byte(key)), nil
+	}
+	return nil, nil
+}
+
+// readSecret returns the contents of the file at path without surrounding
+// whitespace, failing if nothing is left.
+func readSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return string(b), nil
+}
+
+// serveMetrics exposes the default Prometheus registry on addr.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Printf("Metrics available on %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("Failed to serve metrics: %v", err)
+	}
+}
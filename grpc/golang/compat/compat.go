@@ -0,0 +1,114 @@
+// Package compat converts between the messages of the example.Greeter (v1)
+// and greeter.v2.Greeter APIs, so one implementation can serve both and
+// clients can switch versions without changing their own types.
+//
+// Conversions are lossless except where v1 is narrower: greeting counts
+// above math.MaxInt32 are reported to v1 as math.MaxInt32.
+package compat
+
+import (
+	"math"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+)
+
+// V1HelloRequest converts a v2 HelloRequest to v1.
+func V1HelloRequest(req *pbv2.HelloRequest) *pb.HelloRequest {
+	return &pb.HelloRequest{
+		Name:       req.GetName(),
+		Locale:     req.GetLocale(),
+		Count:      req.Count,
+		Interval:   req.GetInterval(),
+		ResumeFrom: req.GetResumeFrom(),
+	}
+}
+
+// V2HelloRequest converts a v1 HelloRequest to v2.
+func V2HelloRequest(req *pb.HelloRequest) *pbv2.HelloRequest {
+	return &pbv2.HelloRequest{
+		Name:       req.GetName(),
+		Locale:     req.GetLocale(),
+		Count:      req.Count,
+		Interval:   req.GetInterval(),
+		ResumeFrom: req.GetResumeFrom(),
+	}
+}
+
+// V1HelloReply converts a v2 HelloReply to v1, capping the count.
+func V1HelloReply(reply *pbv2.HelloReply) *pb.HelloReply {
+	return &pb.HelloReply{
+		Message:       reply.GetGreeting(),
+		GreetingCount: int32(min(reply.GetGreetingCount(), math.MaxInt32)),
+		ServedAt:      reply.GetServedAt(),
+		ServedBy:      reply.GetServedBy(),
+		IsHeartbeat:   reply.GetIsHeartbeat(),
+	}
+}
+
+// V2HelloReply converts a v1 HelloReply to v2.
+func V2HelloReply(reply *pb.HelloReply) *pbv2.HelloReply {
+	return &pbv2.HelloReply{
+		Greeting:      reply.GetMessage(),
+		GreetingCount: int64(reply.GetGreetingCount()),
+		ServedAt:      reply.GetServedAt(),
+		ServedBy:      reply.GetServedBy(),
+		IsHeartbeat:   reply.GetIsHeartbeat(),
+	}
+}
+
+// V1ListGreetingsRequest converts a v2 ListGreetingsRequest to v1.
+func V1ListGreetingsRequest(req *pbv2.ListGreetingsRequest) *pb.ListGreetingsRequest {
+	return &pb.ListGreetingsRequest{PageSize: req.GetPageSize(), PageToken: req.GetPageToken()}
+}
+
+// V2ListGreetingsRequest converts a v1 ListGreetingsRequest to v2.
+func V2ListGreetingsRequest(req *pb.ListGreetingsRequest) *pbv2.ListGreetingsRequest {
+	return &pbv2.ListGreetingsRequest{PageSize: req.GetPageSize(), PageToken: req.GetPageToken()}
+}
+
+// V1ListGreetingsResponse converts a v2 ListGreetingsResponse to v1.
+func V1ListGreetingsResponse(resp *pbv2.ListGreetingsResponse) *pb.ListGreetingsResponse {
+	out := &pb.ListGreetingsResponse{NextPageToken: resp.GetNextPageToken()}
+	for _, g := range resp.GetGreetings() {
+		out.Greetings = append(out.Greetings, &pb.GreetingRecord{
+			Name:      g.GetName(),
+			Message:   g.GetGreeting(),
+			Timestamp: g.GetGreetedAt(),
+		})
+	}
+	return out
+}
+
+// V2ListGreetingsResponse converts a v1 ListGreetingsResponse to v2.
+func V2ListGreetingsResponse(resp *pb.ListGreetingsResponse) *pbv2.ListGreetingsResponse {
+	out := &pbv2.ListGreetingsResponse{NextPageToken: resp.GetNextPageToken()}
+	for _, g := range resp.GetGreetings() {
+		out.Greetings = append(out.Greetings, &pbv2.GreetingRecord{
+			Name:      g.GetName(),
+			Greeting:  g.GetMessage(),
+			GreetedAt: g.GetTimestamp(),
+		})
+	}
+	return out
+}
+
+// V1GetCountRequest converts a v2 GetCountRequest to v1.
+func V1GetCountRequest(req *pbv2.GetCountRequest) *pb.GetCountRequest {
+	return &pb.GetCountRequest{Name: req.GetName(), Strict: req.GetStrict()}
+}
+
+// V2GetCountRequest converts a v1 GetCountRequest to v2.
+func V2GetCountRequest(req *pb.GetCountRequest) *pbv2.GetCountRequest {
+	return &pbv2.GetCountRequest{Name: req.GetName(), Strict: req.GetStrict()}
+}
+
+// V1GetCountResponse converts a v2 GetCountResponse to v1.
+func V1GetCountResponse(resp *pbv2.GetCountResponse) *pb.GetCountResponse {
+	return &pb.GetCountResponse{Count: resp.GetCount(), LastGreeted: resp.GetLastGreeted()}
+}
+
+// V2GetCountResponse converts a v1 GetCountResponse to v2.
+func V2GetCountResponse(resp *pb.GetCountResponse) *pbv2.GetCountResponse {
+	return &pbv2.GetCountResponse{Count: resp.GetCount(), LastGreeted: resp.GetLastGreeted()}
+}
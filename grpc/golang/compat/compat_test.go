@@ -0,0 +1,54 @@
+package compat
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestRoundTrip(t *testing.T) {
+	count := int32(3)
+	now := timestamppb.New(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	req := &pb.HelloRequest{Name: "Alice", Locale: "es", Count: &count, Interval: durationpb.New(time.Second), ResumeFrom: 2}
+	reply := &pb.HelloReply{Message: "¡Hola, Alice!", GreetingCount: 7, ServedAt: now, ServedBy: "host-1"}
+	list := &pb.ListGreetingsResponse{
+		Greetings:     []*pb.GreetingRecord{{Name: "Alice", Message: "Hello, Alice!", Timestamp: now}},
+		NextPageToken: "next",
+	}
+	for _, tt := range []struct{ got, want proto.Message }{
+		{V1HelloRequest(V2HelloRequest(req)), req},
+		{V1HelloReply(V2HelloReply(reply)), reply},
+		{V1HelloReply(V2HelloReply(&pb.HelloReply{IsHeartbeat: true})), &pb.HelloReply{IsHeartbeat: true}},
+		{V1ListGreetingsRequest(V2ListGreetingsRequest(&pb.ListGreetingsRequest{PageSize: 5, PageToken: "t"})), &pb.ListGreetingsRequest{PageSize: 5, PageToken: "t"}},
+		{V1ListGreetingsResponse(V2ListGreetingsResponse(list)), list},
+		{V1GetCountRequest(V2GetCountRequest(&pb.GetCountRequest{Name: "Alice", Strict: true})), &pb.GetCountRequest{Name: "Alice", Strict: true}},
+		{V1GetCountResponse(V2GetCountResponse(&pb.GetCountResponse{Count: 9, LastGreeted: now})), &pb.GetCountResponse{Count: 9, LastGreeted: now}},
+	} {
+		if !proto.Equal(tt.got, tt.want) {
+			t.Errorf("round trip of %v gave %v", tt.want, tt.got)
+		}
+	}
+	if v2 := V2HelloReply(reply); v2.Greeting != reply.Message || v2.GreetingCount != 7 {
+		t.Errorf("V2HelloReply = %v", v2)
+	}
+	if V2HelloRequest(&pb.HelloRequest{Name: "Bob"}).Count != nil {
+		t.Error("V2HelloRequest set a count the v1 request left unset")
+	}
+}
+
+func TestCountCapped(t *testing.T) {
+	for _, tt := range []struct {
+		v2   int64
+		want int32
+	}{{5, 5}, {math.MaxInt32, math.MaxInt32}, {math.MaxInt32 + 1, math.MaxInt32}, {math.MaxInt64, math.MaxInt32}} {
+		if got := V1HelloReply(&pbv2.HelloReply{GreetingCount: tt.v2}).GreetingCount; got != tt.want {
+			t.Errorf("V1HelloReply with count %d gave %d, want %d", tt.v2, got, tt.want)
+		}
+	}
+}
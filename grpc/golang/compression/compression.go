@@ -0,0 +1,108 @@
+// Package compression registers a gzip compressor that can skip compressing
+// small messages.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the compressor name to pass to grpc.UseCompressor.
+const Name = "gzip"
+
+// Register installs the gzip compressor for both sending and receiving.
+// Messages smaller than minSize bytes are written as stored (uncompressed)
+// gzip blocks: gRPC flags every message from a compressor as compressed, so
+// this keeps the wire format valid for any gzip peer while skipping the
+// deflate work. Register replaces gRPC's default gzip compressor and, like
+// encoding.RegisterCompressor, must be called during initialization.
+func Register(minSize int) {
+	encoding.RegisterCompressor(newCompressor(minSize))
+}
+
+type compressor struct {
+	minSize int
+	// stored and compressed pool gzip writers at NoCompression and
+	// DefaultCompression respectively.
+	stored, compressed sync.Pool
+	readers            sync.Pool
+}
+
+func newCompressor(minSize int) *compressor {
+	c := &compressor{minSize: minSize}
+	c.stored.New = func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.NoCompression)
+		return w
+	}
+	c.compressed.New = func() any {
+		return gzip.NewWriter(io.Discard)
+	}
+	return c
+}
+
+func (c *compressor) Name() string { return Name }
+
+// Compress buffers the message so its size is known before choosing a level.
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &bufferedWriter{c: c, dst: w}, nil
+}
+
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	z, ok := c.readers.Get().(*gzip.Reader)
+	if !ok {
+		var err error
+		if z, err = gzip.NewReader(r); err != nil {
+			return nil, err
+		}
+	} else if err := z.Reset(r); err != nil {
+		c.readers.Put(z)
+		return nil, err
+	}
+	return &pooledReader{Reader: z, pool: &c.readers}, nil
+}
+
+type bufferedWriter struct {
+	c   *compressor
+	dst io.Writer
+	buf bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *bufferedWriter) Close() error {
+	pool := &w.c.compressed
+	if w.buf.Len() < w.c.minSize {
+		pool = &w.c.stored
+	}
+	z := pool.Get().(*gzip.Writer)
+	defer pool.Put(z)
+	z.Reset(w.dst)
+	if _, err := z.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// pooledReader returns its gzip.Reader to the pool once fully read.
+type pooledReader struct {
+	*gzip.Reader
+	pool *sync.Pool
+}
+
+func (r *pooledReader) Read(p []byte) (int, error) {
+	if r.Reader == nil {
+		return 0, io.EOF
+	}
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.Reader)
+		r.Reader = nil
+	}
+	return n, err
+}
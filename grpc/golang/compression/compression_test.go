@@ -0,0 +1,114 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+func init() {
+	Register(64)
+}
+
+func roundTrip(t *testing.T, c *compressor, msg []byte) []byte {
+	t.Helper()
+	var wire bytes.Buffer
+	w, err := c.Compress(&wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Decompress(bytes.NewReader(wire.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("round trip returned %q, want %q", got, msg)
+	}
+	return wire.Bytes()
+}
+
+func TestCompressorMinSize(t *testing.T) {
+	c := newCompressor(64)
+
+	small := []byte("hello hello hello")
+	if wire := roundTrip(t, c, small); !bytes.Contains(wire, small) {
+		t.Errorf("message below the minimum size was compressed: %x", wire)
+	}
+
+	large := []byte(strings.Repeat("hello ", 100))
+	if wire := roundTrip(t, c, large); len(wire) >= len(large) {
+		t.Errorf("compressed %d bytes to %d, want fewer", len(large), len(wire))
+	}
+}
+
+// encodingRecorder records the encoding of the response headers seen by a client.
+type encodingRecorder struct {
+	mu       sync.Mutex
+	encoding string
+}
+
+func (r *encodingRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+func (r *encodingRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+func (r *encodingRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+func (r *encodingRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.InHeader); ok {
+		r.mu.Lock()
+		r.encoding = h.Compression
+		r.mu.Unlock()
+	}
+}
+
+func TestSayHello(t *testing.T) {
+	tests := []struct {
+		name         string
+		callOpts     []grpc.CallOption
+		wantEncoding string
+	}{
+		{"compressed", []grpc.CallOption{grpc.UseCompressor(Name)}, Name},
+		{"uncompressed", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &encodingRecorder{}
+			client, _ := testutil.StartTestServer(t, testutil.WithDialOptions(grpc.WithStatsHandler(rec)))
+
+			// Long enough to cross the minimum size in both directions
+			name := strings.Repeat("World ", 20)
+			resp, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: name}, tt.callOpts...)
+			if err != nil {
+				t.Fatalf("SayHello: %v", err)
+			}
+			if want := "Hello, " + name + "!"; resp.Message != want {
+				t.Errorf("got message %q, want %q", resp.Message, want)
+			}
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			if rec.encoding != tt.wantEncoding {
+				t.Errorf("response encoding %q, want %q", rec.encoding, tt.wantEncoding)
+			}
+		})
+	}
+}
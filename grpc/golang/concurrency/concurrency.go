@@ -0,0 +1,143 @@
+// Package concurrency provides server interceptors that cap how many
+// handlers run at once, queueing the excess for a while before rejecting it.
+package concurrency
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limiter admits at most a fixed number of concurrent handlers. Calls over
+// the limit wait in a queue for a free slot and fail with ResourceExhausted
+// once the queue timeout passes. Streaming RPCs hold their slot until the
+// stream ends.
+type Limiter struct {
+	// Exempt names RPCs that run without a slot, either as full method
+	// names ("/pkg.Service/Method") or as service names ("pkg.Service") to
+	// cover every method of the service. Set it before the interceptors
+	// serve calls.
+	Exempt []string
+
+	slots        chan struct{}
+	queueTimeout time.Duration
+	inFlight     atomic.Int64
+	queued       atomic.Int64
+}
+
+// MaxConcurrentRequests returns a Limiter admitting n concurrent handlers
+// and queueing further calls for up to queueTimeout. With a queueTimeout of
+// zero, calls over the limit are rejected at once. n below 1 is treated as 1.
+func MaxConcurrentRequests(n int, queueTimeout time.Duration) *Limiter {
+	return &Limiter{slots: make(chan struct{}, max(n, 1)), queueTimeout: queueTimeout}
+}
+
+// InFlight returns the number of handlers running.
+func (l *Limiter) InFlight() int {
+	return int(l.inFlight.Load())
+}
+
+// Queued returns the number of calls waiting for a slot.
+func (l *Limiter) Queued() int {
+	return int(l.queued.Load())
+}
+
+// RegisterMetrics registers gauges of the in-flight and queued calls on reg.
+func (l *Limiter) RegisterMetrics(reg prometheus.Registerer) error {
+	for _, g := range []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "grpc_server_concurrency_in_flight",
+			Help: "Number of handlers holding a concurrency limiter slot.",
+		}, func() float64 { return float64(l.InFlight()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "grpc_server_concurrency_queued",
+			Help: "Number of calls waiting for a concurrency limiter slot.",
+		}, func() float64 { return float64(l.Queued()) }),
+	} {
+		if err := reg.Register(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Limiter) exempt(fullMethod string) bool {
+	for _, entry := range l.Exempt {
+		if entry == fullMethod || strings.HasPrefix(fullMethod, "/"+entry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// acquire takes a slot, waiting up to the queue timeout for one, and returns
+// the function that gives it back.
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		if err := l.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	l.inFlight.Add(1)
+	return func() {
+		l.inFlight.Add(-1)
+		<-l.slots
+	}, nil
+}
+
+// wait queues for a slot. It fails with ResourceExhausted after the queue
+// timeout, or with the context's error if the caller gives up first.
+func (l *Limiter) wait(ctx context.Context) error {
+	l.queued.Add(1)
+	defer l.queued.Add(-1)
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return status.Errorf(codes.ResourceExhausted, "server is at its limit of %d concurrent requests, gave up after queueing for %v", cap(l.slots), l.queueTimeout)
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// UnaryServerInterceptor runs each unary handler once a slot is free.
+// Exempt methods run at once.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if l.exempt(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		release, err := l.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor runs each stream handler once a slot is free and
+// holds the slot until the handler returns. Exempt methods run at once.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if l.exempt(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		release, err := l.acquire(ss.Context())
+		if err != nil {
+			return err
+		}
+		defer release()
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,191 @@
+package concurrency_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shrivatsas/exp-codegen/grpc/concurrency"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// slowGreeter answers SayHello after delay and records how many calls it
+// handles at once.
+type slowGreeter struct {
+	pb.UnimplementedGreeterServer
+	delay         time.Duration
+	running, peak atomic.Int32
+}
+
+func (g *slowGreeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	n := g.running.Add(1)
+	defer g.running.Add(-1)
+	for {
+		peak := g.peak.Load()
+		if n <= peak || g.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(g.delay)
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!"}, nil
+}
+
+func start(t *testing.T, l *concurrency.Limiter, svc pb.GreeterServer) pb.GreeterClient {
+	t.Helper()
+	return testutil.Start(t, testutil.WithService(svc), testutil.WithServerOptions(
+		grpc.ChainUnaryInterceptor(l.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(l.StreamServerInterceptor()))).Client
+}
+
+func TestQueueing(t *testing.T) {
+	const n = 2
+	// n calls run at once, the next n get their slots when those finish
+	// within the queue timeout, and the last n time out waiting
+	svc := &slowGreeter{delay: 300 * time.Millisecond}
+	client := start(t, concurrency.MaxConcurrentRequests(n, 450*time.Millisecond), svc)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	codesSeen := make(chan codes.Code, 3*n)
+	var wg sync.WaitGroup
+	for i := 0; i < 3*n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"})
+			codesSeen <- status.Code(err)
+		}()
+	}
+	wg.Wait()
+	close(codesSeen)
+
+	counts := map[codes.Code]int{}
+	for c := range codesSeen {
+		counts[c]++
+	}
+	if counts[codes.OK] != 2*n || counts[codes.ResourceExhausted] != n {
+		t.Errorf("got %v, want %d OK (%d of them after queueing) and %d ResourceExhausted", counts, 2*n, n, n)
+	}
+	if peak := svc.peak.Load(); peak != n {
+		t.Errorf("%d handlers ran at once, want %d", peak, n)
+	}
+}
+
+func TestStreamHoldsSlot(t *testing.T) {
+	l := concurrency.MaxConcurrentRequests(1, 0)
+	client := start(t, l, greeter.New())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count := int32(2)
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice", Count: &count, Interval: durationpb.New(200 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first reply means the handler holds the only slot
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Bob"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("SayHello during the stream: got %v, want ResourceExhausted", err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Bob"}); err != nil {
+		t.Errorf("SayHello after the stream: %v", err)
+	}
+}
+
+func TestExempt(t *testing.T) {
+	l := concurrency.MaxConcurrentRequests(1, 0)
+	l.Exempt = []string{pb.Greeter_SayHelloStream_FullMethodName}
+	client := start(t, l, greeter.New())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count := int32(2)
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice", Count: &count, Interval: durationpb.New(200 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// The exempt stream holds no slot, so SayHello still gets the only one
+	if got := l.InFlight(); got != 0 {
+		t.Errorf("InFlight during the exempt stream = %d, want 0", got)
+	}
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Bob"}); err != nil {
+		t.Errorf("SayHello during the exempt stream: %v", err)
+	}
+}
+
+func TestGauges(t *testing.T) {
+	l := concurrency.MaxConcurrentRequests(1, time.Second)
+	reg := prometheus.NewRegistry()
+	if err := l.RegisterMetrics(reg); err != nil {
+		t.Fatal(err)
+	}
+	svc := &slowGreeter{delay: 300 * time.Millisecond}
+	client := start(t, l, svc)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err != nil {
+				t.Errorf("SayHello: %v", err)
+			}
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for l.InFlight() != 1 || l.Queued() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("in flight %d, queued %d; want 1 and 1", l.InFlight(), l.Queued())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for name, want := range map[string]float64{
+		"grpc_server_concurrency_in_flight": 1,
+		"grpc_server_concurrency_queued":    1,
+	} {
+		if got := gaugeValue(t, reg, name); got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	wg.Wait()
+	if l.InFlight() != 0 || l.Queued() != 0 {
+		t.Errorf("after the calls: in flight %d, queued %d; want 0 and 0", l.InFlight(), l.Queued())
+	}
+}
+
+// gaugeValue returns the value of the gauge registered on reg under name.
+func gaugeValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() == name {
+			return f.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("metric %s not registered", name)
+	return 0
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	"github.com/shrivatsas/exp-codegen/grpc/keepaliveconfig"
+	"google.golang.org/grpc/backoff"
+)
+
+// ClientConfig holds the settings of the Greeter client.
+type ClientConfig struct {
+	// Addr is the server: host:port, comma-separated host:port replicas, a
+	// dns:/// target, a filewatch:/// endpoint file or unix:///path/to.sock.
+	Addr string `yaml:"addr"`
+	// Timeout bounds each SayHello call and StreamTimeout each stream.
+	Timeout       time.Duration `yaml:"timeout"`
+	StreamTimeout time.Duration `yaml:"stream-timeout"`
+	Name          string        `yaml:"name"`
+	Locale        string        `yaml:"locale"`
+	// Mode is hello, chat or batch.
+	Mode string `yaml:"mode"`
+	// Count and Interval are asked of SayHelloStream; negative values leave
+	// the server's defaults.
+	Count    int           `yaml:"count"`
+	Interval time.Duration `yaml:"interval"`
+	// ChatCount is how many names are sent in chat mode.
+	ChatCount int `yaml:"chat-count"`
+	// Names are sent in batch mode; they are read from stdin when empty.
+	Names List `yaml:"names"`
+	// Output is text, json or jsonl.
+	Output         string `yaml:"output"`
+	Token          string `yaml:"token"`
+	APIKey         string `yaml:"api-key"`
+	Compress       bool   `yaml:"compress"`
+	MaxRecvMsgSize int    `yaml:"max-recv-msg-size"`
+	MaxSendMsgSize int    `yaml:"max-send-msg-size"`
+	WaitForReady   bool   `yaml:"wait-for-ready"`
+	// StrictFields fails calls whose replies have fields the client's
+	// schema does not, instead of ignoring them.
+	StrictFields bool `yaml:"strict-fields"`
+	// ConnectTimeout is how long each call waits for a ready connection;
+	// zero does not wait.
+	ConnectTimeout time.Duration `yaml:"connect-timeout"`
+	// Proxy is a socks5:// or http:// URL of the proxy the server is reached
+	// through; see endpoint.ProxyDialer.
+	Proxy string `yaml:"proxy"`
+	// DrainFailoverWait, if positive, makes the client drain-aware: calls
+	// avoid servers reporting NOT_SERVING, and those failing on draining
+	// servers are retried on another ready within this time.
+	DrainFailoverWait time.Duration `yaml:"drain-failover-wait"`
+
+	TLS       ClientTLS              `yaml:"tls"`
+	Retry     Retry                  `yaml:"retry"`
+	Keepalive keepaliveconfig.Client `yaml:"keepalive"`
+	Backoff   Backoff                `yaml:"backoff"`
+}
+
+// ClientTLS holds the client's TLS settings.
+type ClientTLS struct {
+	Enabled bool `yaml:"enabled"`
+	// CACert verifies the server; the system roots are used when empty.
+	CACert string `yaml:"ca-cert"`
+	// Cert and Key are the client certificate for mTLS.
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// Retry holds how SayHello is retried.
+type Retry struct {
+	Attempts   int           `yaml:"attempts"`
+	MaxElapsed time.Duration `yaml:"max-elapsed"`
+}
+
+// Backoff holds how reconnection attempts are spaced.
+type Backoff struct {
+	BaseDelay  time.Duration `yaml:"base-delay"`
+	MaxDelay   time.Duration `yaml:"max-delay"`
+	Multiplier float64       `yaml:"multiplier"`
+}
+
+// Config returns b as gRPC backoff settings, with gRPC's default jitter.
+func (b Backoff) Config() backoff.Config {
+	return backoff.Config{BaseDelay: b.BaseDelay, MaxDelay: b.MaxDelay, Multiplier: b.Multiplier}
+}
+
+// DefaultClientConfig returns the settings the client runs with when
+// nothing overrides them.
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		Addr:          "localhost:50051",
+		Timeout:       time.Second,
+		StreamTimeout: 10 * time.Second,
+		Name:          "World from Go",
+		Mode:          "hello",
+		Count:         -1,
+		Interval:      -1,
+		ChatCount:     3,
+		Output:        "text",
+		Retry:         Retry{Attempts: 4, MaxElapsed: 10 * time.Second},
+		Backoff: Backoff{
+			BaseDelay:  backoff.DefaultConfig.BaseDelay,
+			MaxDelay:   backoff.DefaultConfig.MaxDelay,
+			Multiplier: backoff.DefaultConfig.Multiplier,
+		},
+	}
+}
+
+// RegisterFlags defines a flag on fs for each setting, defaulting to its
+// current value in c.
+func (c *ClientConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "address of the Greeter server: host:port, comma-separated host:port replicas, a dns:/// target, a filewatch:///path endpoint file or unix:///path/to.sock")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "timeout for the SayHello call")
+	fs.DurationVar(&c.StreamTimeout, "stream-timeout", c.StreamTimeout, "timeout for the SayHelloStream call")
+	fs.StringVar(&c.Name, "name", c.Name, "name to greet")
+	fs.StringVar(&c.Locale, "locale", c.Locale, "locale to be greeted in, e.g. es or fr-CA (empty for the server default, English)")
+	fs.StringVar(&c.Mode, "mode", c.Mode, "RPCs to call: hello (SayHello and SayHelloStream), chat (SayHelloChat) or batch (SayHelloBatch)")
+	fs.IntVar(&c.Count, "count", c.Count, "number of SayHelloStream replies to ask for (negative for the server default)")
+	fs.DurationVar(&c.Interval, "interval", c.Interval, "pause between SayHelloStream replies to ask for (negative for the server default)")
+	fs.IntVar(&c.ChatCount, "chat-count", c.ChatCount, "number of names to send in chat mode")
+	fs.Var(&c.Names, "names", "comma-separated names to send in batch mode; read one per line from stdin when empty")
+	fs.IntVar(&c.Retry.Attempts, "retry-attempts", c.Retry.Attempts, "maximum SayHello attempts on Unavailable or ResourceExhausted (1 disables retries)")
+	fs.DurationVar(&c.Retry.MaxElapsed, "retry-max-elapsed", c.Retry.MaxElapsed, "maximum time spent retrying SayHello")
+	fs.DurationVar(&c.Keepalive.Time, "keepalive-time", c.Keepalive.Time, "ping the server after this much inactivity (0 disables keepalive pings; minimum 10s)")
+	fs.DurationVar(&c.Keepalive.Timeout, "keepalive-timeout", c.Keepalive.Timeout, "close the connection if a keepalive ping is not acknowledged within this time (0 uses the gRPC default)")
+	fs.BoolVar(&c.Keepalive.PermitWithoutStream, "keepalive-permit-without-stream", c.Keepalive.PermitWithoutStream, "send keepalive pings even with no active RPCs")
+	fs.IntVar(&c.MaxRecvMsgSize, "max-recv-msg-size", c.MaxRecvMsgSize, "largest reply in bytes the client accepts (0 uses the gRPC default of 4MiB)")
+	fs.IntVar(&c.MaxSendMsgSize, "max-send-msg-size", c.MaxSendMsgSize, "largest request in bytes the client sends (0 for no limit)")
+	fs.BoolVar(&c.WaitForReady, "wait-for-ready", c.WaitForReady, "make calls wait for the server to become ready instead of failing while it is down")
+	fs.BoolVar(&c.StrictFields, "strict-fields", c.StrictFields, "fail calls whose replies have fields unknown to the client's schema instead of ignoring them")
+	fs.DurationVar(&c.ConnectTimeout, "connect-timeout", c.ConnectTimeout, "give up with \"server never became ready\" if no connection is ready within this time (0 to not wait)")
+	fs.DurationVar(&c.DrainFailoverWait, "drain-failover-wait", c.DrainFailoverWait, "avoid servers reporting NOT_SERVING and retry calls failing on draining servers on another one ready within this time (0 disables)")
+	fs.StringVar(&c.Proxy, "proxy", c.Proxy, "reach the server through this socks5:// or http:// (CONNECT) proxy URL, with optional user:password@")
+	fs.DurationVar(&c.Backoff.BaseDelay, "backoff-base-delay", c.Backoff.BaseDelay, "delay before the first reconnection attempt")
+	fs.DurationVar(&c.Backoff.MaxDelay, "backoff-max-delay", c.Backoff.MaxDelay, "upper bound on the delay between reconnection attempts")
+	fs.Float64Var(&c.Backoff.Multiplier, "backoff-multiplier", c.Backoff.Multiplier, "factor the reconnection delay grows by after each failed attempt")
+	fs.BoolVar(&c.Compress, "compress", c.Compress, "gzip-compress requests and ask for compressed responses")
+	fs.StringVar(&c.Token, "token", c.Token, "bearer token sent with every RPC")
+	fs.StringVar(&c.APIKey, "api-key", c.APIKey, "API key sent with every RPC in x-api-key metadata")
+	fs.StringVar(&c.Output, "output", c.Output, "output format: text, json (one indented protojson object per reply) or jsonl (one object per line)")
+	fs.BoolVar(&c.TLS.Enabled, "tls", c.TLS.Enabled, "connect using TLS")
+	fs.StringVar(&c.TLS.CACert, "ca-cert", c.TLS.CACert, "PEM CA bundle used to verify the server (requires -tls)")
+	fs.StringVar(&c.TLS.Cert, "client-cert", c.TLS.Cert, "PEM client certificate for mTLS (requires -tls)")
+	fs.StringVar(&c.TLS.Key, "client-key", c.TLS.Key, "PEM private key for -client-cert (requires -tls)")
+}
+
+// Validate checks the settings, reporting every problem found, one per
+// line and each prefixed by the setting's path.
+func (c *ClientConfig) Validate() error {
+	var p problems
+	if c.Timeout <= 0 {
+		p.addf("timeout", "must be positive, got %v", c.Timeout)
+	}
+	if c.StreamTimeout <= 0 {
+		p.addf("stream-timeout", "must be positive, got %v", c.StreamTimeout)
+	}
+	if c.Token != "" && c.APIKey != "" {
+		p.addf("api-key", "token and api-key are mutually exclusive")
+	}
+	if c.Retry.Attempts < 1 {
+		p.addf("retry.attempts", "must be at least 1, got %d", c.Retry.Attempts)
+	}
+	if c.Retry.MaxElapsed <= 0 {
+		p.addf("retry.max-elapsed", "must be positive, got %v", c.Retry.MaxElapsed)
+	}
+	if c.Keepalive.Time < 0 {
+		p.addf("keepalive.time", "must not be negative, got %v", c.Keepalive.Time)
+	}
+	if c.Keepalive.Timeout < 0 {
+		p.addf("keepalive.timeout", "must not be negative, got %v", c.Keepalive.Timeout)
+	}
+	if c.Mode != "hello" && c.Mode != "chat" && c.Mode != "batch" {
+		p.addf("mode", "must be hello, chat or batch, got %q", c.Mode)
+	}
+	if c.Output != "text" && c.Output != "json" && c.Output != "jsonl" {
+		p.addf("output", "must be text, json or jsonl, got %q", c.Output)
+	}
+	if c.MaxRecvMsgSize < 0 {
+		p.addf("max-recv-msg-size", "must not be negative, got %d", c.MaxRecvMsgSize)
+	}
+	if c.MaxSendMsgSize < 0 {
+		p.addf("max-send-msg-size", "must not be negative, got %d", c.MaxSendMsgSize)
+	}
+	if c.ConnectTimeout < 0 {
+		p.addf("connect-timeout", "must not be negative, got %v", c.ConnectTimeout)
+	}
+	if c.DrainFailoverWait < 0 {
+		p.addf("drain-failover-wait", "must not be negative, got %v", c.DrainFailoverWait)
+	}
+	if c.Proxy != "" {
+		if _, err := endpoint.ProxyDialer(c.Proxy); err != nil {
+			p.addf("proxy", "%v", err)
+		}
+	}
+	if c.Backoff.BaseDelay <= 0 || c.Backoff.MaxDelay < c.Backoff.BaseDelay {
+		p.addf("backoff.base-delay", "must be positive and at most backoff.max-delay")
+	}
+	if c.Backoff.Multiplier < 1 {
+		p.addf("backoff.multiplier", "must be at least 1, got %v", c.Backoff.Multiplier)
+	}
+	if c.Count > math.MaxInt32 {
+		p.addf("count", "must be at most %d, got %d", math.MaxInt32, c.Count)
+	}
+	if c.ChatCount < 0 {
+		p.addf("chat-count", "must not be negative, got %d", c.ChatCount)
+	}
+	if !c.TLS.Enabled && (c.TLS.CACert != "" || c.TLS.Cert != "" || c.TLS.Key != "") {
+		p.addf("tls", "ca-cert, cert and key require enabled")
+	}
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		p.addf("tls", "cert and key must be set together")
+	}
+	return p.err()
+}
@@ -0,0 +1,223 @@
+// Package config defines the settings of the client and server binaries
+// and loads them from, in rising precedence, their defaults, a YAML file,
+// GREETER_ environment variables and command-line flags.
+//
+// Settings are addressed by their YAML path, such as "tls.cert". The
+// environment variable for a setting is GREETER_ followed by its path in
+// upper case with dots and dashes turned into underscores, e.g.
+// GREETER_TLS_CERT or GREETER_LIMITS_RATE_LIMIT.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of every environment variable read by Load.
+const EnvPrefix = "GREETER_"
+
+// Load fills cfg, a pointer to a ServerConfig or ClientConfig whose flags
+// are registered on fs and already parsed, from the YAML file at path, if
+// path is not empty, and then from the environment as read by getenv.
+// Flags set on the command line keep their values. YAML keys that name no
+// setting are an error, so typos are caught. Load does not validate cfg.
+func Load(cfg any, fs *flag.FlagSet, path string, getenv func(string) string) error {
+	// Values from the command line are put back once the rest is loaded
+	var set []*flag.Flag
+	fs.Visit(func(f *flag.Flag) { set = append(set, f) })
+	explicit := make([]string, len(set))
+	for i, f := range set {
+		explicit[i] = f.Value.String()
+	}
+
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return err
+		}
+	}
+	if err := loadEnv(reflect.ValueOf(cfg).Elem(), "", getenv); err != nil {
+		return err
+	}
+	for i, f := range set {
+		if err := fs.Set(f.Name, explicit[i]); err != nil {
+			return fmt.Errorf("-%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func loadFile(cfg any, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	// An empty file leaves every setting as it is
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv sets each setting in v, a struct found at path, whose
+// environment variable is set. It reports every bad value at once.
+func loadEnv(v reflect.Value, path string, getenv func(string) string) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		field := v.Field(i)
+		fieldPath := join(path, key)
+		if field.Kind() == reflect.Struct && !isLeaf(field) {
+			if err := loadEnv(field, fieldPath, getenv); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		name := envName(fieldPath)
+		s := getenv(name)
+		if s == "" {
+			continue
+		}
+		if err := setValue(field, s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// envName returns the environment variable for the setting at path.
+func envName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// isLeaf reports whether the struct v is one setting rather than a section.
+func isLeaf(v reflect.Value) bool {
+	_, ok := v.Addr().Interface().(flag.Value)
+	return ok
+}
+
+// setValue parses s into v as a flag of v's type would.
+func setValue(v reflect.Value, s string) error {
+	if fv, ok := v.Addr().Interface().(flag.Value); ok {
+		return fv.Set(s)
+	}
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("want a duration such as 30s, got %q", s)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("want true or false, got %q", s)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("want an integer, got %q", s)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("want a number, got %q", s)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("settings of type %s cannot be set from the environment", v.Type())
+	}
+	return nil
+}
+
+// List is a setting holding several values: a sequence in YAML and a
+// comma-separated list in flags and the environment.
+type List []string
+
+// Set implements flag.Value, replacing the list with the comma-separated
+// values in s.
+func (l *List) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func (l *List) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+// FileMode is a setting holding file permissions, written in octal such as
+// 0660.
+type FileMode os.FileMode
+
+// Set implements flag.Value.
+func (m *FileMode) Set(s string) error {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o777 {
+		return fmt.Errorf("want octal permissions such as 0660")
+	}
+	*m = FileMode(mode)
+	return nil
+}
+
+func (m *FileMode) String() string {
+	if m == nil {
+		return "0"
+	}
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+// UnmarshalYAML reads the permissions as written, since YAML would take
+// 0660 for a decimal number.
+func (m *FileMode) UnmarshalYAML(n *yaml.Node) error {
+	if err := m.Set(n.Value); err != nil {
+		return fmt.Errorf("line %d: %w", n.Line, err)
+	}
+	return nil
+}
+
+// problems collects validation errors, each prefixed by its setting's path.
+type problems []error
+
+func (p *problems) addf(path, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// err returns every problem found, one per line, or nil.
+func (p problems) err() error {
+	return errors.Join(p...)
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a YAML config into a temporary directory and returns its
+// path.
+func writeFile(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "greeter.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadServer loads a ServerConfig the way cmd/server does.
+func loadServer(t *testing.T, args []string, path string, env map[string]string) (ServerConfig, error) {
+	t.Helper()
+	cfg := DefaultServerConfig()
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	cfg.RegisterFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("Parse(%q): %v", args, err)
+	}
+	err := Load(&cfg, flags, path, func(name string) string { return env[name] })
+	return cfg, err
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+addr: ":6000"
+drain-timeout: 5s
+tls:
+  cert: file.pem
+limits:
+  max-batch: 10
+  rate-limit: 2.5
+`)
+	env := map[string]string{
+		"GREETER_DRAIN_TIMEOUT":    "7s",
+		"GREETER_LIMITS_MAX_BATCH": "20",
+		"GREETER_REFLECTION":       "false",
+	}
+	cfg, err := loadServer(t, []string{"-max-batch=30"}, path, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := DefaultServerConfig()
+	want.Addr = ":6000"                 // file
+	want.TLS.Cert = "file.pem"          // file
+	want.Limits.RateLimit = 2.5         // file
+	want.DrainTimeout = 7 * time.Second // env over file
+	want.Reflection = false             // env over default
+	want.Limits.MaxBatch = 30           // flag over env and file
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := loadServer(t, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := DefaultServerConfig(); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v\nwant %+v", cfg, want)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("defaults failed validation: %v", err)
+	}
+}
+
+func TestLoadEmptyFile(t *testing.T) {
+	cfg, err := loadServer(t, nil, writeFile(t, ""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := DefaultServerConfig(); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	_, err := loadServer(t, nil, writeFile(t, "tls:\n  certt: file.pem\n"), nil)
+	if err == nil || !strings.Contains(err.Error(), "certt") {
+		t.Errorf("got %v, want an error naming certt", err)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	_, err := loadServer(t, nil, filepath.Join(t.TempDir(), "missing.yaml"), nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want a missing file error", err)
+	}
+}
+
+func TestLoadEnvErrors(t *testing.T) {
+	env := map[string]string{
+		"GREETER_DRAIN_TIMEOUT":     "soon",
+		"GREETER_CHANNELZ":          "maybe",
+		"GREETER_LIMITS_RATE_BURST": "ten",
+	}
+	_, err := loadServer(t, nil, "", env)
+	if err == nil {
+		t.Fatal("bad environment values were accepted")
+	}
+	for name := range env {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not name %s", err, name)
+		}
+	}
+}
+
+func TestLists(t *testing.T) {
+	path := writeFile(t, "auth:\n  tokens: [a, b]\nlogging:\n  redact: [HelloRequest.name]\n")
+	env := map[string]string{"GREETER_HTTP_GRPCWEB_ORIGINS": "https://a.example, https://b.example"}
+	cfg, err := loadServer(t, []string{"-log-redact=HelloReply.message"}, path, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (List{"a", "b"}); !reflect.DeepEqual(cfg.Auth.Tokens, want) {
+		t.Errorf("auth.tokens = %q, want %q", cfg.Auth.Tokens, want)
+	}
+	if want := (List{"https://a.example", "https://b.example"}); !reflect.DeepEqual(cfg.HTTP.GRPCWebOrigins, want) {
+		t.Errorf("http.grpcweb-origins = %q, want %q", cfg.HTTP.GRPCWebOrigins, want)
+	}
+	// A flag replaces the file's list rather than adding to it
+	if want := (List{"HelloReply.message"}); !reflect.DeepEqual(cfg.Logging.Redact, want) {
+		t.Errorf("logging.redact = %q, want %q", cfg.Logging.Redact, want)
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	cfg, err := loadServer(t, nil, writeFile(t, "socket-mode: 0600\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SocketMode != 0o600 {
+		t.Errorf("socket-mode = %v, want 0600", &cfg.SocketMode)
+	}
+
+	cfg, err = loadServer(t, []string{"-socket-mode=0640"}, "", map[string]string{"GREETER_SOCKET_MODE": "0600"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SocketMode != 0o640 {
+		t.Errorf("socket-mode = %v, want 0640", &cfg.SocketMode)
+	}
+
+	for _, s := range []string{"rw", "0999", "1777"} {
+		var m FileMode
+		if err := m.Set(s); err == nil {
+			t.Errorf("Set(%q) = %v, want an error", s, &m)
+		}
+	}
+}
+
+func TestServerValidate(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.TLS.Cert = "cert.pem"
+	cfg.Limits.MaxBatch = -1
+	cfg.Logging.Sample = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid config passed validation")
+	}
+	// Every problem is reported, each under its setting's path
+	for _, path := range []string{"tls:", "limits.max-batch:", "logging.sample:"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("error %q does not mention %s", err, path)
+		}
+	}
+	if n := strings.Count(err.Error(), "\n") + 1; n != 3 {
+		t.Errorf("got %d problems, want 3:\n%v", n, err)
+	}
+}
+
+func TestExperimentVariants(t *testing.T) {
+	path := writeFile(t, "experiment:\n  variants:\n    - {name: control, weight: 1}\n    - {name: friendly, weight: 3, templates: /etc/greeter/friendly}\n")
+	cfg, err := loadServer(t, nil, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Variants{{Name: "control", Weight: 1}, {Name: "friendly", Weight: 3, Templates: "/etc/greeter/friendly"}}
+	if !reflect.DeepEqual(cfg.Experiment.Variants, want) {
+		t.Errorf("experiment.variants = %v, want %v", &cfg.Experiment.Variants, &want)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	cfg, err = loadServer(t, []string{"-experiment-variants=control=0,friendly=0"}, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Experiment.Variants.String(); got != "control=0,friendly=0" {
+		t.Errorf("experiment.variants from the flag = %s, want control=0,friendly=0", got)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "experiment.variants: weights must sum to a positive number") {
+		t.Errorf("Validate with zero weights = %v, want an error", err)
+	}
+
+	cfg.Experiment.Variants = Variants{{Name: "control", Weight: 1}, {Name: "friendly", Weight: 1 << 32}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `variant "friendly" weight must be at most 4294967295`) {
+		t.Errorf("Validate with a weight over 32 bits = %v, want an error", err)
+	}
+
+	var vs Variants
+	for _, s := range []string{"control", "control=heavy"} {
+		if err := vs.Set(s); err == nil {
+			t.Errorf("Set(%q) = %v, want an error", s, &vs)
+		}
+	}
+}
+
+func TestClientLoad(t *testing.T) {
+	path := writeFile(t, `
+mode: batch
+names: [Ada, Grace]
+tls:
+  enabled: true
+  ca-cert: ca.pem
+backoff:
+  max-delay: 30s
+`)
+	cfg := DefaultClientConfig()
+	flags := flag.NewFlagSet("client", flag.ContinueOnError)
+	cfg.RegisterFlags(flags)
+	if err := flags.Parse([]string{"-mode=chat"}); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"GREETER_RETRY_ATTEMPTS": "2", "GREETER_KEEPALIVE_TIME": "20s"}
+	if err := Load(&cfg, flags, path, func(name string) string { return env[name] }); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := DefaultClientConfig()
+	want.Mode = "chat"
+	want.Names = List{"Ada", "Grace"}
+	want.TLS = ClientTLS{Enabled: true, CACert: "ca.pem"}
+	want.Backoff.MaxDelay = 30 * time.Second
+	want.Retry.Attempts = 2
+	want.Keepalive.Time = 20 * time.Second
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestClientValidate(t *testing.T) {
+	cfg := DefaultClientConfig()
+	cfg.Mode = "shout"
+	cfg.TLS.CACert = "ca.pem"
+	cfg.Retry.Attempts = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid config passed validation")
+	}
+	for _, want := range []string{`mode: must be hello, chat or batch, got "shout"`, "tls: ca-cert, cert and key require enabled", "retry.attempts:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/keepaliveconfig"
+)
+
+// ServerConfig holds the settings of the Greeter server.
+type ServerConfig struct {
+	// Addr is the address to listen on, host:port or unix:///path/to.sock.
+	Addr string `yaml:"addr"`
+	// SocketMode is the permissions of the Addr Unix socket file.
+	SocketMode FileMode `yaml:"socket-mode"`
+	// InstanceID names the server in replies; the hostname when empty.
+	InstanceID   string        `yaml:"instance-id"`
+	DrainTimeout time.Duration `yaml:"drain-timeout"`
+	// DrainNotice is how long the server keeps serving, NOT_SERVING and
+	// flagging responses as draining, before the drain timeout starts.
+	DrainNotice time.Duration `yaml:"drain-notice"`
+	Reflection  bool          `yaml:"reflection"`
+	Channelz    bool          `yaml:"channelz"`
+	// CompressMinSize is the smallest response gzip-compressed, in bytes.
+	CompressMinSize int `yaml:"compress-min-size"`
+	// GreetingTemplates is a directory of <locale>.tmpl files replacing the
+	// bundled greetings; see greeter.TemplateFormatter.
+	GreetingTemplates string `yaml:"greeting-templates"`
+	// Capture is a file every RPC's metadata and messages are recorded to,
+	// for greeterctl replay-capture; empty records nothing.
+	Capture string `yaml:"capture"`
+	// StrictFields rejects requests with fields the server's schema does
+	// not have, such as those of a newer or mismatched client, with
+	// InvalidArgument instead of ignoring them.
+	StrictFields bool `yaml:"strict-fields"`
+
+	TLS        ServerTLS              `yaml:"tls"`
+	Keepalive  keepaliveconfig.Server `yaml:"keepalive"`
+	Auth       Auth                   `yaml:"auth"`
+	Limits     ServerLimits           `yaml:"limits"`
+	Stream     Stream                 `yaml:"stream"`
+	Logging    Logging                `yaml:"logging"`
+	Audit      Audit                  `yaml:"audit"`
+	Quota      Quota                  `yaml:"quota"`
+	Store      Store                  `yaml:"store"`
+	HTTP       HTTP                   `yaml:"http"`
+	Experiment Experiment             `yaml:"experiment"`
+}
+
+// ServerTLS holds the server's TLS settings. TLS is off unless Cert and Key
+// are set.
+type ServerTLS struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// ClientCA, when set, requires client certificates signed by it.
+	ClientCA string `yaml:"client-ca"`
+	// ReloadInterval is how often Cert and Key are checked for a rotated
+	// key pair; zero never reloads them.
+	ReloadInterval time.Duration `yaml:"reload-interval"`
+}
+
+// Auth holds how the server authenticates callers. At most one of Tokens
+// and HMACKeyFile may be set.
+type Auth struct {
+	Tokens      List   `yaml:"tokens"`
+	HMACKeyFile string `yaml:"hmac-key-file"`
+	// AdminTokenFile holds the bearer token the KeyAdmin service requires.
+	// Setting it enables API keys, kept in store.sqlite-dsn when set.
+	AdminTokenFile string `yaml:"admin-token-file"`
+	// APIKeyRefresh is how often API keys are reloaded from the store, and
+	// so how long a key revoked through another server still works here.
+	APIKeyRefresh time.Duration `yaml:"api-key-refresh"`
+}
+
+// ServerLimits holds the limits on requests; zero means no limit unless
+// noted.
+type ServerLimits struct {
+	MaxBatch      int `yaml:"max-batch"`
+	MaxNameLength int `yaml:"max-name-length"`
+	// MaxRecvMsgSize of zero applies gRPC's default of 4MiB.
+	MaxRecvMsgSize int `yaml:"max-recv-msg-size"`
+	MaxSendMsgSize int `yaml:"max-send-msg-size"`
+	// ClientQuota caps greetings per peer host in the service itself, after
+	// RateLimit and Quota, which count calls per auth subject, admit them;
+	// see greeterserver.DefaultInterceptors.
+	ClientQuota           int           `yaml:"client-quota"`
+	ClientQuotaWindow     time.Duration `yaml:"client-quota-window"`
+	RateLimit             float64       `yaml:"rate-limit"`
+	RateBurst             int           `yaml:"rate-burst"`
+	MaxConcurrentRequests int           `yaml:"max-concurrent-requests"`
+	QueueTimeout          time.Duration `yaml:"queue-timeout"`
+	// MaxHandlerTimeout caps each handler's deadline, and is the deadline of
+	// calls sent without one.
+	MaxHandlerTimeout time.Duration `yaml:"max-handler-timeout"`
+}
+
+// Stream holds the settings of SayHelloStream and SayHelloChat.
+type Stream struct {
+	Buffer      int           `yaml:"buffer"`
+	SendTimeout time.Duration `yaml:"send-timeout"`
+	// HeartbeatInterval is how long a stream may go without a reply before a
+	// heartbeat is sent; zero sends none.
+	HeartbeatInterval time.Duration `yaml:"heartbeat-interval"`
+}
+
+// Logging holds the settings of the RPC logs.
+type Logging struct {
+	Payloads   bool `yaml:"payloads"`
+	Sample     int  `yaml:"sample"`
+	Redact     List `yaml:"redact"`
+	MaxPayload int  `yaml:"max-payload"`
+}
+
+// Audit holds the settings of the audit log, which is off unless File is
+// set.
+type Audit struct {
+	File string `yaml:"file"`
+	// MaxSize is the size in bytes File is rotated at; zero never rotates it.
+	MaxSize int `yaml:"max-size"`
+	// MaxFiles is how many rotated files are kept.
+	MaxFiles int  `yaml:"max-files"`
+	Sync     bool `yaml:"sync"`
+	// Queue is how many entries may wait to be written before more are
+	// dropped.
+	Queue int `yaml:"queue"`
+}
+
+// Quota holds the cap on each client's calls, keyed by authenticated
+// subject, which is off unless Limit is set.
+type Quota struct {
+	Limit int `yaml:"limit"`
+	// Window is the length of rolling quota windows; zero counts calendar
+	// days.
+	Window time.Duration `yaml:"window"`
+	// Timezone is the IANA time zone whose midnights start calendar days;
+	// UTC when empty.
+	Timezone string `yaml:"timezone"`
+}
+
+// Store holds where greeting counts and history are kept; in memory when
+// neither CountFile nor SQLiteDSN is set.
+type Store struct {
+	CountFile          string        `yaml:"count-file"`
+	CountFlushInterval time.Duration `yaml:"count-flush-interval"`
+	SQLiteDSN          string        `yaml:"sqlite-dsn"`
+}
+
+// HTTP holds what the server serves besides native gRPC.
+type HTTP struct {
+	GRPCWeb        bool `yaml:"grpcweb"`
+	GRPCWebOrigins List `yaml:"grpcweb-origins"`
+	// Endpoints serves /metrics and /healthz on Addr.
+	Endpoints bool `yaml:"endpoints"`
+	// Pprof serves /debug/pprof on Addr; it requires Endpoints.
+	Pprof bool `yaml:"pprof"`
+	// MetricsAddr is a separate address serving /metrics, or empty.
+	MetricsAddr string `yaml:"metrics-addr"`
+}
+
+// Experiment holds the A/B experiment on greeting wording, which is off
+// unless Variants are set.
+type Experiment struct {
+	Variants Variants `yaml:"variants"`
+}
+
+// Variant is one arm of the experiment.
+type Variant struct {
+	Name string `yaml:"name"`
+	// Weight is the variant's share of callers relative to the others';
+	// zero disables it.
+	Weight int `yaml:"weight"`
+	// Templates is a directory of <locale>.tmpl files wording the variant's
+	// greetings, as for greeting-templates; the server's greetings when
+	// empty.
+	Templates string `yaml:"templates"`
+}
+
+// Variants is a setting holding the experiment's variants: a sequence of
+// mappings in YAML, and in flags and the environment a comma-separated
+// list of name=weight, each optionally followed by :templates.
+type Variants []Variant
+
+// Set implements flag.Value, replacing the variants with those in s.
+func (vs *Variants) Set(s string) error {
+	*vs = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("want name=weight[:templates], got %q", item)
+		}
+		weight, templates, _ := strings.Cut(rest, ":")
+		w, err := strconv.Atoi(weight)
+		if err != nil {
+			return fmt.Errorf("want an integer weight for variant %q, got %q", name, weight)
+		}
+		*vs = append(*vs, Variant{Name: name, Weight: w, Templates: templates})
+	}
+	return nil
+}
+
+func (vs *Variants) String() string {
+	if vs == nil {
+		return ""
+	}
+	items := make([]string, len(*vs))
+	for i, v := range *vs {
+		items[i] = v.Name + "=" + strconv.Itoa(v.Weight)
+		if v.Templates != "" {
+			items[i] += ":" + v.Templates
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// DefaultServerConfig returns the settings the server runs with when
+// nothing overrides them.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Addr:         ":50051",
+		SocketMode:   0o660,
+		DrainTimeout: 30 * time.Second,
+		Reflection:   true,
+		Channelz:     true,
+		TLS:          ServerTLS{ReloadInterval: time.Minute},
+		Auth:         Auth{APIKeyRefresh: 30 * time.Second},
+		Limits: ServerLimits{
+			MaxBatch:          1000,
+			MaxNameLength:     256,
+			ClientQuotaWindow: time.Minute,
+			RateBurst:         10,
+			QueueTimeout:      time.Second,
+		},
+		Stream:  Stream{Buffer: 16, SendTimeout: 10 * time.Second},
+		Logging: Logging{Sample: 1},
+		Audit:   Audit{MaxSize: 100 << 20, MaxFiles: 5, Queue: 1024},
+		Store:   Store{CountFlushInterval: 5 * time.Second},
+		HTTP:    HTTP{MetricsAddr: ":9090"},
+	}
+}
+
+// RegisterFlags defines a flag on fs for each setting, defaulting to its
+// current value in c.
+func (c *ServerConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "address to listen on, either host:port or unix:///path/to.sock")
+	fs.Var(&c.SocketMode, "socket-mode", "octal permissions for the -addr Unix socket file")
+	fs.StringVar(&c.InstanceID, "instance-id", c.InstanceID, "name reported in each reply's served_by and the x-served-by header (the hostname when empty)")
+	fs.StringVar(&c.TLS.Cert, "tls-cert", c.TLS.Cert, "PEM certificate to serve TLS with")
+	fs.StringVar(&c.TLS.Key, "tls-key", c.TLS.Key, "PEM private key for -tls-cert")
+	fs.DurationVar(&c.TLS.ReloadInterval, "tls-reload-interval", c.TLS.ReloadInterval, "how often -tls-cert and -tls-key are checked for a rotated key pair, served to new connections (0 to never reload)")
+	fs.IntVar(&c.Limits.MaxBatch, "max-batch", c.Limits.MaxBatch, "maximum number of names accepted by SayHelloBatch (0 for no limit)")
+	fs.IntVar(&c.Limits.MaxNameLength, "max-name-length", c.Limits.MaxNameLength, "maximum characters in a request name, checked on every RPC (0 for no limit)")
+	fs.IntVar(&c.Limits.MaxRecvMsgSize, "max-recv-msg-size", c.Limits.MaxRecvMsgSize, "largest request in bytes the server accepts (0 uses the gRPC default of 4MiB)")
+	fs.IntVar(&c.Limits.MaxSendMsgSize, "max-send-msg-size", c.Limits.MaxSendMsgSize, "largest reply in bytes the server sends (0 for no limit)")
+	fs.IntVar(&c.Limits.ClientQuota, "client-quota", c.Limits.ClientQuota, "greetings allowed per client host each -client-quota-window, counted after -rate-limit and -quota admit the call and regardless of auth subject (0 for no limit)")
+	fs.DurationVar(&c.Limits.ClientQuotaWindow, "client-quota-window", c.Limits.ClientQuotaWindow, "window over which -client-quota is counted")
+	fs.Float64Var(&c.Limits.RateLimit, "rate-limit", c.Limits.RateLimit, "calls per second allowed per client, keyed by auth token subject or peer IP (0 for no limit)")
+	fs.IntVar(&c.Limits.RateBurst, "rate-burst", c.Limits.RateBurst, "calls a client may make at once before -rate-limit applies")
+	fs.IntVar(&c.Limits.MaxConcurrentRequests, "max-concurrent-requests", c.Limits.MaxConcurrentRequests, "handlers allowed to run at once, streams included; further calls are queued (0 for no limit)")
+	fs.DurationVar(&c.Limits.QueueTimeout, "queue-timeout", c.Limits.QueueTimeout, "how long a call over -max-concurrent-requests waits for a slot before failing with ResourceExhausted")
+	fs.DurationVar(&c.Limits.MaxHandlerTimeout, "max-handler-timeout", c.Limits.MaxHandlerTimeout, "longest a handler may run, shortening longer caller deadlines and applying to calls without one (0 for no limit)")
+	fs.IntVar(&c.Stream.Buffer, "stream-buffer", c.Stream.Buffer, "SayHelloStream replies produced ahead of a client that reads slowly")
+	fs.DurationVar(&c.Stream.SendTimeout, "stream-send-timeout", c.Stream.SendTimeout, "abort a SayHelloStream with DeadlineExceeded when sending one reply takes longer than this (0 for no limit)")
+	fs.DurationVar(&c.Stream.HeartbeatInterval, "stream-heartbeat-interval", c.Stream.HeartbeatInterval, "send a heartbeat on SayHelloStream and SayHelloChat streams idle this long, to keep proxies from closing them (0 for none)")
+	fs.Var(&c.Auth.Tokens, "auth-tokens", "comma-separated bearer tokens accepted by the Greeter service")
+	fs.StringVar(&c.Auth.HMACKeyFile, "auth-hmac-key-file", c.Auth.HMACKeyFile, "file holding the key that verifies HMAC-signed bearer tokens")
+	fs.StringVar(&c.Auth.AdminTokenFile, "auth-admin-token-file", c.Auth.AdminTokenFile, "file holding the bearer token that manages API keys; setting it accepts API keys in x-api-key metadata")
+	fs.DurationVar(&c.Auth.APIKeyRefresh, "auth-api-key-refresh", c.Auth.APIKeyRefresh, "how often API keys are reloaded from the store, bounding how long a key revoked on another server still works here")
+	fs.BoolVar(&c.HTTP.GRPCWeb, "grpcweb", c.HTTP.GRPCWeb, "also serve gRPC-Web on -addr so browsers can call the Greeter without a proxy")
+	fs.Var(&c.HTTP.GRPCWebOrigins, "grpcweb-origins", "comma-separated origins such as https://app.example.com that may make gRPC-Web calls besides the server's own, or * for any")
+	fs.BoolVar(&c.HTTP.Endpoints, "http", c.HTTP.Endpoints, "also serve HTTP /metrics and /healthz on -addr, for probes that cannot speak gRPC")
+	fs.BoolVar(&c.HTTP.Pprof, "pprof", c.HTTP.Pprof, "serve /debug/pprof on -addr; requires -http")
+	fs.BoolVar(&c.Reflection, "reflection", c.Reflection, "register the server reflection service for tools like grpcurl")
+	fs.BoolVar(&c.Channelz, "channelz", c.Channelz, "register the channelz service for greeterctl debug channelz")
+	fs.BoolVar(&c.StrictFields, "strict-fields", c.StrictFields, "reject requests with fields unknown to the server's schema with InvalidArgument instead of ignoring them")
+	fs.StringVar(&c.HTTP.MetricsAddr, "metrics-addr", c.HTTP.MetricsAddr, "HTTP address serving Prometheus /metrics (empty to disable)")
+	fs.BoolVar(&c.Logging.Payloads, "log-payloads", c.Logging.Payloads, "include request and response messages in RPC logs")
+	fs.IntVar(&c.Logging.Sample, "log-sample", c.Logging.Sample, "log only every Nth stream message when -log-payloads is set")
+	fs.Var(&c.Logging.Redact, "log-redact", "comma-separated fields such as HelloRequest.name hidden from logged payloads")
+	fs.IntVar(&c.Logging.MaxPayload, "log-max-payload", c.Logging.MaxPayload, "truncate each logged payload to this many bytes (0 for no limit)")
+	fs.StringVar(&c.Audit.File, "audit-log", c.Audit.File, "file to append a JSON audit entry to for every RPC (empty to disable)")
+	fs.IntVar(&c.Audit.MaxSize, "audit-max-size", c.Audit.MaxSize, "rotate -audit-log once it would grow past this many bytes (0 for never)")
+	fs.IntVar(&c.Audit.MaxFiles, "audit-max-files", c.Audit.MaxFiles, "number of rotated -audit-log files to keep")
+	fs.BoolVar(&c.Audit.Sync, "audit-sync", c.Audit.Sync, "fsync -audit-log after every entry")
+	fs.IntVar(&c.Audit.Queue, "audit-queue", c.Audit.Queue, "audit entries waiting to be written before further ones are dropped")
+	fs.IntVar(&c.Quota.Limit, "quota", c.Quota.Limit, "calls each client, by auth subject or else IP, may make per -quota-window (0 for no limit); kept in -sqlite-dsn when set")
+	fs.DurationVar(&c.Quota.Window, "quota-window", c.Quota.Window, "length of rolling -quota windows (0 for calendar days)")
+	fs.StringVar(&c.Quota.Timezone, "quota-timezone", c.Quota.Timezone, "IANA time zone whose midnights start -quota days (UTC when empty)")
+	fs.DurationVar(&c.DrainTimeout, "drain-timeout", c.DrainTimeout, "how long to let in-flight RPCs finish on shutdown before forcing them closed")
+	fs.DurationVar(&c.DrainNotice, "drain-notice", c.DrainNotice, "how long to keep serving on shutdown, reporting NOT_SERVING, so clients move to other servers before new RPCs are refused")
+	fs.IntVar(&c.CompressMinSize, "compress-min-size", c.CompressMinSize, "skip gzip compression of responses smaller than this many bytes")
+	fs.StringVar(&c.GreetingTemplates, "greeting-templates", c.GreetingTemplates, "directory of <locale>.tmpl greeting templates replacing the bundled ones")
+	fs.Var(&c.Experiment.Variants, "experiment-variants", "comma-separated name=weight[:templates-dir] variants of an A/B experiment on greeting wording (empty for none)")
+	fs.StringVar(&c.Capture, "capture", c.Capture, "file to record every RPC's metadata and messages to for greeterctl replay-capture, replacing it (empty to disable)")
+	fs.StringVar(&c.Store.CountFile, "count-file", c.Store.CountFile, "JSON file persisting greeting counts across restarts (in memory when empty)")
+	fs.DurationVar(&c.Store.CountFlushInterval, "count-flush-interval", c.Store.CountFlushInterval, "how often greeting counts are written to -count-file")
+	fs.StringVar(&c.Store.SQLiteDSN, "sqlite-dsn", c.Store.SQLiteDSN, "SQLite database, such as greeter.db, keeping greeting counts and history across restarts")
+	fs.DurationVar(&c.Keepalive.MinTime, "keepalive-min-time", c.Keepalive.MinTime, "minimum interval clients may send keepalive pings at (0 uses the gRPC default of 5m)")
+	fs.BoolVar(&c.Keepalive.PermitWithoutStream, "keepalive-permit-without-stream", c.Keepalive.PermitWithoutStream, "allow client keepalive pings with no active RPCs")
+	fs.DurationVar(&c.Keepalive.MaxConnectionIdle, "max-connection-idle", c.Keepalive.MaxConnectionIdle, "close connections with no active RPCs after this long (0 for never)")
+	fs.DurationVar(&c.Keepalive.MaxConnectionAge, "max-connection-age", c.Keepalive.MaxConnectionAge, "close connections after this long (0 for never)")
+	fs.DurationVar(&c.Keepalive.MaxConnectionAgeGrace, "max-connection-age-grace", c.Keepalive.MaxConnectionAgeGrace, "time in-flight RPCs get to finish after -max-connection-age (0 for unlimited)")
+	fs.DurationVar(&c.Keepalive.Time, "keepalive-time", c.Keepalive.Time, "ping clients after this much inactivity (0 uses the gRPC default of 2h; minimum 1s)")
+	fs.DurationVar(&c.Keepalive.Timeout, "keepalive-timeout", c.Keepalive.Timeout, "close the connection if a keepalive ping is not acknowledged within this time (0 uses the gRPC default)")
+	fs.StringVar(&c.TLS.ClientCA, "client-ca", c.TLS.ClientCA, "PEM CA bundle; when set, client certificates are required and verified")
+}
+
+// Validate checks the settings, reporting every problem found, one per
+// line and each prefixed by the setting's path.
+func (c *ServerConfig) Validate() error {
+	var p problems
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		p.addf("tls", "cert and key must be set together")
+	}
+	if c.TLS.ClientCA != "" && c.TLS.Cert == "" {
+		p.addf("tls.client-ca", "requires tls.cert and tls.key")
+	}
+	if c.TLS.ReloadInterval < 0 {
+		p.addf("tls.reload-interval", "must not be negative, got %v", c.TLS.ReloadInterval)
+	}
+	for _, f := range []struct {
+		path string
+		n    int
+	}{
+		{"limits.max-batch", c.Limits.MaxBatch},
+		{"limits.max-name-length", c.Limits.MaxNameLength},
+		{"limits.max-recv-msg-size", c.Limits.MaxRecvMsgSize},
+		{"limits.max-send-msg-size", c.Limits.MaxSendMsgSize},
+		{"limits.client-quota", c.Limits.ClientQuota},
+		{"quota.limit", c.Quota.Limit},
+		{"limits.max-concurrent-requests", c.Limits.MaxConcurrentRequests},
+		{"stream.buffer", c.Stream.Buffer},
+		{"logging.max-payload", c.Logging.MaxPayload},
+		{"audit.max-size", c.Audit.MaxSize},
+		{"audit.max-files", c.Audit.MaxFiles},
+		{"audit.queue", c.Audit.Queue},
+		{"compress-min-size", c.CompressMinSize},
+	} {
+		if f.n < 0 {
+			p.addf(f.path, "must not be negative, got %d", f.n)
+		}
+	}
+	if c.Limits.RateLimit < 0 {
+		p.addf("limits.rate-limit", "must not be negative, got %v", c.Limits.RateLimit)
+	}
+	if c.Limits.RateBurst < 1 {
+		p.addf("limits.rate-burst", "must be at least 1, got %d", c.Limits.RateBurst)
+	}
+	if c.Logging.Sample < 1 {
+		p.addf("logging.sample", "must be at least 1, got %d", c.Logging.Sample)
+	}
+	for _, f := range []struct {
+		path string
+		d    time.Duration
+	}{
+		{"limits.client-quota-window", c.Limits.ClientQuotaWindow},
+		{"auth.api-key-refresh", c.Auth.APIKeyRefresh},
+		{"drain-timeout", c.DrainTimeout},
+		{"store.count-flush-interval", c.Store.CountFlushInterval},
+	} {
+		if f.d <= 0 {
+			p.addf(f.path, "must be positive, got %v", f.d)
+		}
+	}
+	for _, f := range []struct {
+		path string
+		d    time.Duration
+	}{
+		{"drain-notice", c.DrainNotice},
+		{"quota.window", c.Quota.Window},
+		{"limits.queue-timeout", c.Limits.QueueTimeout},
+		{"limits.max-handler-timeout", c.Limits.MaxHandlerTimeout},
+		{"stream.send-timeout", c.Stream.SendTimeout},
+		{"stream.heartbeat-interval", c.Stream.HeartbeatInterval},
+		{"keepalive.min-time", c.Keepalive.MinTime},
+		{"keepalive.max-connection-idle", c.Keepalive.MaxConnectionIdle},
+		{"keepalive.max-connection-age", c.Keepalive.MaxConnectionAge},
+		{"keepalive.max-connection-age-grace", c.Keepalive.MaxConnectionAgeGrace},
+		{"keepalive.time", c.Keepalive.Time},
+		{"keepalive.timeout", c.Keepalive.Timeout},
+	} {
+		if f.d < 0 {
+			p.addf(f.path, "must not be negative, got %v", f.d)
+		}
+	}
+	if _, err := time.LoadLocation(c.Quota.Timezone); err != nil {
+		p.addf("quota.timezone", "%v", err)
+	}
+	if len(c.Auth.Tokens) > 0 && c.Auth.HMACKeyFile != "" {
+		p.addf("auth", "tokens and hmac-key-file are mutually exclusive")
+	}
+	if c.Store.CountFile != "" && c.Store.SQLiteDSN != "" {
+		p.addf("store", "count-file and sqlite-dsn are mutually exclusive")
+	}
+	if len(c.HTTP.GRPCWebOrigins) > 0 && !c.HTTP.GRPCWeb {
+		p.addf("http.grpcweb-origins", "requires http.grpcweb")
+	}
+	if c.HTTP.Pprof && !c.HTTP.Endpoints {
+		p.addf("http.pprof", "requires http.endpoints")
+	}
+	if len(c.Experiment.Variants) > 0 {
+		total := 0
+		seen := make(map[string]bool)
+		for i, v := range c.Experiment.Variants {
+			if v.Name == "" {
+				p.addf("experiment.variants", "variant %d has no name", i)
+			} else if seen[v.Name] {
+				p.addf("experiment.variants", "variant %q is listed twice", v.Name)
+			}
+			seen[v.Name] = true
+			if v.Weight < 0 {
+				p.addf("experiment.variants", "variant %q weight must not be negative, got %d", v.Name, v.Weight)
+			} else if int64(v.Weight) > math.MaxUint32 {
+				p.addf("experiment.variants", "variant %q weight must be at most %d, got %d", v.Name, uint32(math.MaxUint32), v.Weight)
+			} else {
+				total += v.Weight
+			}
+		}
+		if total <= 0 {
+			p.addf("experiment.variants", "weights must sum to a positive number, got %d", total)
+		}
+	}
+	return p.err()
+}
@@ -0,0 +1,128 @@
+// Package deadline provides server interceptors that bound how long each
+// handler may run, whatever deadline its caller sent, and a helper for
+// handlers to read the budget they have left.
+package deadline
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Options configures the interceptors.
+type Options struct {
+	// Max caps each handler's deadline: a call whose caller allows longer,
+	// or sets no deadline, runs until Max after it arrived. Zero leaves
+	// deadlines as the caller sent them.
+	Max time.Duration
+	// Default is the timeout given calls arriving without a deadline; Max is
+	// used when zero. Max still caps it when it is longer.
+	Default time.Duration
+	// Clamped, if set, is incremented with the method name on every call
+	// whose deadline was shortened or set; see NewClampedCounter.
+	Clamped *prometheus.CounterVec
+	// Exempt names RPCs left with the deadline their caller sent, either as
+	// full method names ("/pkg.Service/Method") or as service names
+	// ("pkg.Service") to cover every method of the service, such as
+	// long-lived health watches.
+	Exempt []string
+}
+
+// NewClampedCounter registers a counter of calls by method whose deadline
+// the interceptors shortened or set.
+func NewClampedCounter(reg prometheus.Registerer) (*prometheus.CounterVec, error) {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_deadline_clamped_total",
+		Help: "Total number of calls whose deadline was shortened to the server's maximum or set to its default, by method.",
+	}, []string{"method"})
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Remaining returns how long ctx has before its deadline, and false if it
+// has none. The result is negative once the deadline has passed.
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(d), true
+}
+
+func (opts Options) exempt(fullMethod string) bool {
+	for _, entry := range opts.Exempt {
+		if entry == fullMethod || strings.HasPrefix(fullMethod, "/"+entry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns ctx bounded by opts, or DeadlineExceeded if ctx's deadline
+// has already passed so the handler should not start.
+func (opts Options) apply(ctx context.Context, fullMethod string) (context.Context, context.CancelFunc, error) {
+	remaining, ok := Remaining(ctx)
+	if ok && remaining <= 0 {
+		return nil, nil, status.Errorf(codes.DeadlineExceeded, "deadline passed %v before the call started", -remaining)
+	}
+	if opts.exempt(fullMethod) {
+		return ctx, func() {}, nil
+	}
+	timeout := opts.Max
+	if !ok && opts.Default > 0 && (opts.Max <= 0 || opts.Default < opts.Max) {
+		timeout = opts.Default
+	}
+	if timeout <= 0 || (ok && remaining <= timeout) {
+		return ctx, func() {}, nil
+	}
+	if opts.Clamped != nil {
+		opts.Clamped.WithLabelValues(fullMethod).Inc()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// UnaryServerInterceptor runs unary handlers under the deadline opts
+// allows, rejecting calls whose deadline has already passed with
+// DeadlineExceeded. Place it early in the chain so the interceptors after
+// it spend the same budget.
+func UnaryServerInterceptor(opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, cancel, err := opts.apply(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor; the deadline covers the whole stream.
+func StreamServerInterceptor(opts Options) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel, err := opts.apply(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
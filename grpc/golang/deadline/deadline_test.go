@@ -0,0 +1,185 @@
+package deadline_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shrivatsas/exp-codegen/grpc/deadline"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// budgets serves the Greeter behind the deadline interceptors, recording
+// the budget each handler starts with.
+type budgets struct {
+	ts      *testutil.Server
+	clamped *prometheus.CounterVec
+	got     chan time.Duration
+}
+
+func start(t *testing.T, opts deadline.Options) *budgets {
+	t.Helper()
+	clamped, err := deadline.NewClampedCounter(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Clamped = clamped
+	b := &budgets{clamped: clamped, got: make(chan time.Duration, 10)}
+	record := func(ctx context.Context) {
+		remaining, ok := deadline.Remaining(ctx)
+		if !ok {
+			remaining = -1
+		}
+		b.got <- remaining
+	}
+	b.ts = testutil.Start(t, testutil.WithServerOptions(
+		grpc.ChainUnaryInterceptor(deadline.UnaryServerInterceptor(opts),
+			func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				record(ctx)
+				return handler(ctx, req)
+			}),
+		grpc.ChainStreamInterceptor(deadline.StreamServerInterceptor(opts),
+			func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				record(ss.Context())
+				return handler(srv, ss)
+			})))
+	return b
+}
+
+func (b *budgets) clampedCalls(method string) float64 {
+	return promtest.ToFloat64(b.clamped.WithLabelValues(method))
+}
+
+func TestClamp(t *testing.T) {
+	b := start(t, deadline.Options{Max: 200 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := b.ts.Client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-b.got; got <= 0 || got > 200*time.Millisecond {
+		t.Errorf("handler of a call allowing 5s had %v left, want at most the 200ms maximum", got)
+	}
+	if n := b.clampedCalls(pb.Greeter_SayHello_FullMethodName); n != 1 {
+		t.Errorf("clamped counter = %v, want 1", n)
+	}
+
+	// A caller's shorter deadline stands
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := b.ts.Client.SayHello(short, &pb.HelloRequest{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-b.got; got <= 0 || got > 100*time.Millisecond {
+		t.Errorf("handler of a call allowing 100ms had %v left, want under 100ms", got)
+	}
+	if n := b.clampedCalls(pb.Greeter_SayHello_FullMethodName); n != 1 {
+		t.Errorf("clamped counter = %v after a call within the maximum, want still 1", n)
+	}
+}
+
+func TestNoDeadline(t *testing.T) {
+	b := start(t, deadline.Options{Max: time.Second, Default: 300 * time.Millisecond})
+
+	if _, err := b.ts.Client.SayHello(context.Background(), &pb.HelloRequest{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-b.got; got <= 0 || got > 300*time.Millisecond {
+		t.Errorf("handler of a call without a deadline had %v left, want the 300ms default", got)
+	}
+
+	stream, err := b.ts.Client.SayHelloStream(context.Background(), &pb.HelloRequest{Name: "Ada", Count: proto.Int32(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := <-b.got; got <= 0 || got > 300*time.Millisecond {
+		t.Errorf("stream without a deadline had %v left, want the 300ms default", got)
+	}
+	if n := b.clampedCalls(pb.Greeter_SayHelloStream_FullMethodName); n != 1 {
+		t.Errorf("clamped counter = %v, want 1", n)
+	}
+}
+
+func TestDefaultOverMax(t *testing.T) {
+	b := start(t, deadline.Options{Max: 200 * time.Millisecond, Default: time.Minute})
+	if _, err := b.ts.Client.SayHello(context.Background(), &pb.HelloRequest{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-b.got; got <= 0 || got > 200*time.Millisecond {
+		t.Errorf("handler of a call without a deadline had %v left, want at most the 200ms maximum", got)
+	}
+}
+
+func TestExempt(t *testing.T) {
+	b := start(t, deadline.Options{Max: 200 * time.Millisecond, Exempt: []string{"example.Greeter"}})
+	if _, err := b.ts.Client.SayHello(context.Background(), &pb.HelloRequest{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-b.got; got != -1 {
+		t.Errorf("handler of an exempt call without a deadline had %v left, want no deadline", got)
+	}
+	if n := b.clampedCalls(pb.Greeter_SayHello_FullMethodName); n != 0 {
+		t.Errorf("clamped counter = %v, want 0", n)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Millisecond))
+	defer cancel()
+	intercept := deadline.UnaryServerInterceptor(deadline.Options{Max: time.Second})
+	called := false
+	_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: pb.Greeter_SayHello_FullMethodName}, func(context.Context, any) (any, error) {
+		called = true
+		return nil, nil
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("call arriving past its deadline got %v, want DeadlineExceeded", err)
+	}
+	if called {
+		t.Error("handler ran for a call arriving past its deadline")
+	}
+}
+
+func TestStreamPacing(t *testing.T) {
+	b := start(t, deadline.Options{Max: 300 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// With 200ms between replies, the third would land after the 300ms
+	// budget, so the stream ends as soon as the second is sent
+	began := time.Now()
+	stream, err := b.ts.Client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Ada", Count: proto.Int32(10), Interval: durationpb.New(200 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := 0
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+		received++
+	}
+	if status.Code(err) != codes.DeadlineExceeded || received != 2 {
+		t.Errorf("got %d replies then %v, want 2 then DeadlineExceeded", received, err)
+	}
+	if took := time.Since(began); took >= 300*time.Millisecond {
+		t.Errorf("stream ended after %v, want before its deadline", took)
+	}
+}
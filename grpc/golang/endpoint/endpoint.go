@@ -0,0 +1,107 @@
+// Package endpoint listens on and dials addresses that are either TCP
+// host:port pairs or Unix domain sockets written as unix:///path/to.sock.
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// UnixPrefix marks an address as a Unix domain socket path.
+const UnixPrefix = "unix://"
+
+// UnixPath returns the socket path of a unix:// address, or false for any
+// other address.
+func UnixPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, UnixPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, UnixPrefix), true
+}
+
+// ListenOptions controls how Unix sockets are created.
+type ListenOptions struct {
+	// SocketMode is applied to the socket file; zero leaves the mode set by
+	// the process umask.
+	SocketMode fs.FileMode
+}
+
+// Listen listens on addr. For a Unix socket, a stale socket file left by a
+// previous process is removed first; Listen fails if another process is
+// still accepting on it or if the path is not a socket.
+func Listen(addr string, opts ListenOptions) (net.Listener, error) {
+	path, ok := UnixPath(addr)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SocketMode != 0 {
+		if err := os.Chmod(path, opts.SocketMode); err != nil {
+			lis.Close()
+			return nil, err
+		}
+	}
+	return lis, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("endpoint: %s exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("endpoint: %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// Dial returns the gRPC target and dial options for addr. Unix sockets use
+// the passthrough resolver with a dialer that connects to the socket path. A
+// comma-separated list of host:port addresses uses the static resolver, with
+// the first address as the :authority since servers behind one list share a
+// name. Other addresses, such as dns:///host:port, are returned unchanged
+// with no extra options.
+func Dial(addr string) (string, []grpc.DialOption) {
+	if strings.Contains(addr, ",") {
+		opts := []grpc.DialOption{grpc.WithResolvers(StaticBuilder())}
+		if addrs := splitAddrs(addr); len(addrs) > 0 {
+			opts = append(opts, grpc.WithAuthority(addrs[0]))
+		}
+		return StaticScheme + ":///" + addr, opts
+	}
+	path, ok := UnixPath(addr)
+	if !ok {
+		return addr, nil
+	}
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	return "passthrough:///" + path, []grpc.DialOption{
+		grpc.WithContextDialer(dialer),
+		// The socket path is not a meaningful :authority
+		grpc.WithAuthority("localhost"),
+	}
+}
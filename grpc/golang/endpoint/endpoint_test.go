@@ -0,0 +1,111 @@
+package endpoint
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!"}, nil
+}
+
+func TestUnixPath(t *testing.T) {
+	if path, ok := UnixPath("unix:///run/greeter.sock"); !ok || path != "/run/greeter.sock" {
+		t.Errorf("UnixPath(unix:///run/greeter.sock) = %q, %v", path, ok)
+	}
+	if _, ok := UnixPath("localhost:50051"); ok {
+		t.Error("UnixPath accepted a TCP address")
+	}
+	if target, opts := Dial("localhost:50051"); target != "localhost:50051" || len(opts) != 0 {
+		t.Errorf("Dial(localhost:50051) = %q with %d options", target, len(opts))
+	}
+}
+
+func TestUnixRoundTrip(t *testing.T) {
+	addr := UnixPrefix + filepath.Join(t.TempDir(), "greeter.sock")
+	lis, err := Listen(addr, ListenOptions{SocketMode: 0o600})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterGreeterServer(s, greeter{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	path, _ := UnixPath(addr)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Type() != fs.ModeSocket || info.Mode().Perm() != 0o600 {
+		t.Errorf("socket has mode %v, want a socket with 0600", info.Mode())
+	}
+
+	target, opts := Dial(addr)
+	conn, err := grpc.NewClient(target, append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "socket"})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.Message != "Hello, socket!" {
+		t.Errorf("got message %q", resp.Message)
+	}
+}
+
+func TestListenRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stale.sock")
+	// Leave the socket file behind, as a crashed server would
+	old, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.SetUnlinkOnClose(false)
+	old.Close()
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatalf("stale socket missing: %v", err)
+	}
+
+	lis, err := Listen(UnixPrefix+path, ListenOptions{})
+	if err != nil {
+		t.Fatalf("Listen over stale socket: %v", err)
+	}
+	defer lis.Close()
+
+	// A live socket must not be removed
+	if _, err := Listen(UnixPrefix+path, ListenOptions{}); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Listen over live socket: got %v, want in use error", err)
+	}
+}
+
+func TestListenRefusesNonSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(UnixPrefix+path, ListenOptions{}); err == nil {
+		t.Fatal("Listen replaced a regular file")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep me" {
+		t.Errorf("regular file was modified: %q, %v", data, err)
+	}
+}
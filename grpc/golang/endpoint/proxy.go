@@ -0,0 +1,160 @@
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Dialer opens the connection a gRPC client speaks to addr over, as passed
+// to grpc.WithContextDialer.
+type Dialer func(ctx context.Context, addr string) (net.Conn, error)
+
+// ErrProxyAuth is wrapped by the errors of a ProxyDialer whose proxy turned
+// down its credentials, or asked for some when it had none.
+var ErrProxyAuth = errors.New("endpoint: proxy authentication failed")
+
+// ProxyDialer returns a Dialer reaching each address through the proxy at
+// rawURL, either socks5://host:port for a SOCKS5 proxy or http://host:port
+// for one accepting HTTP CONNECT, with user:password@ before the host for a
+// proxy requiring basic or username/password authentication. The port
+// defaults to 1080 and 80 respectively. The Dialer returns the raw tunnel,
+// so TLS credentials handshake with the server through it.
+func ProxyDialer(rawURL string) (Dialer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint: proxy URL: %w", err)
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return nil, fmt.Errorf("endpoint: proxy URL %q must be scheme://[user:password@]host[:port]", rawURL)
+	}
+	switch u.Scheme {
+	case "socks5":
+		return socks5Dialer(withPort(u.Host, "1080"), u.User)
+	case "http":
+		return connectDialer(withPort(u.Host, "80"), u.User), nil
+	}
+	return nil, fmt.Errorf("endpoint: proxy URL %q must use socks5:// or http://", rawURL)
+}
+
+func withPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+func socks5Dialer(proxyAddr string, user *url.Userinfo) (Dialer, error) {
+	var auth *proxy.Auth
+	if user != nil {
+		password, _ := user.Password()
+		auth = &proxy.Auth{User: user.Username(), Password: password}
+	}
+	d, err := proxy.SOCKS5("tcp", proxyAddr, auth, &net.Dialer{})
+	if err != nil {
+		return nil, fmt.Errorf("endpoint: %w", err)
+	}
+	cd := d.(proxy.ContextDialer)
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := cd.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			// x/net/proxy tells authentication failures apart only by their text
+			if msg := err.Error(); strings.Contains(msg, "authentication failed") || strings.Contains(msg, "no acceptable authentication methods") {
+				return nil, fmt.Errorf("%w: %v", ErrProxyAuth, err)
+			}
+			return nil, fmt.Errorf("endpoint: dialing %s through SOCKS5 proxy %s: %w", addr, proxyAddr, err)
+		}
+		return conn, nil
+	}, nil
+}
+
+func connectDialer(proxyAddr string, user *url.Userinfo) Dialer {
+	var authorization string
+	if user != nil {
+		password, _ := user.Password()
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password))
+	}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint: dialing HTTP proxy: %w", err)
+		}
+		tunnel, err := connect(ctx, conn, addr, authorization)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tunnel, nil
+	}
+}
+
+// connect asks the HTTP proxy on conn for a tunnel to addr, returning the
+// tunnel once the proxy agrees.
+func connect(ctx context.Context, conn net.Conn, addr, authorization string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock the exchange if ctx ends first
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	tunnel, err := exchange(conn, addr, authorization)
+	if !stop() {
+		return nil, fmt.Errorf("endpoint: CONNECT %s through HTTP proxy: %w", addr, ctx.Err())
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+func exchange(conn net.Conn, addr, authorization string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if authorization != "" {
+		req.Header.Set("Proxy-Authorization", authorization)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("endpoint: CONNECT %s through HTTP proxy: %w", addr, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint: CONNECT %s through HTTP proxy: %w", addr, err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return nil, fmt.Errorf("%w: %s", ErrProxyAuth, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("endpoint: HTTP proxy refused CONNECT %s: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// The server spoke first and its bytes were read with the response
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a conn whose first bytes were read into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,344 @@
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// testProxy counts the tunnels a proxy opened.
+type testProxy struct {
+	addr    string
+	tunnels atomic.Int32
+}
+
+// splice copies between a and b until either side is done, then closes
+// both.
+func splice(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+	}()
+	io.Copy(b, a)
+	b.Close()
+}
+
+// startSOCKS5 runs a SOCKS5 proxy supporting only CONNECT, requiring user
+// and password when user is set.
+func startSOCKS5(t *testing.T, user, password string) *testProxy {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	p := &testProxy{addr: lis.Addr().String()}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go p.serveSOCKS5(conn, user, password)
+		}
+	}()
+	return p
+}
+
+func (p *testProxy) serveSOCKS5(conn net.Conn, user, password string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	// Greeting: version, then the authentication methods offered
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil || head[0] != 5 {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return
+	}
+	want := byte(0)
+	if user != "" {
+		want = 2
+	}
+	if !strings.ContainsRune(string(methods), rune(want)) {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, want})
+	if user != "" {
+		// RFC 1929: version, then length-prefixed user and password
+		if _, err := r.ReadByte(); err != nil {
+			return
+		}
+		got := make([]string, 2)
+		for i := range got {
+			n, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			got[i] = string(b)
+		}
+		if got[0] != user || got[1] != password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	// Request: version, CONNECT, reserved, then the address and port
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(r, req); err != nil || req[1] != 1 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1, 4:
+		ip := make([]byte, 4)
+		if req[3] == 4 {
+			ip = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return
+		}
+		host = string(b)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	p.tunnels.Add(1)
+	splice(&bufferedConn{Conn: conn, r: r}, target)
+}
+
+// startConnect runs an HTTP proxy supporting only CONNECT, requiring basic
+// authentication as user when user is set.
+func startConnect(t *testing.T, user, password string) *testProxy {
+	t.Helper()
+	p := &testProxy{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		if user != "" {
+			req := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+			if u, pw, ok := req.BasicAuth(); !ok || u != user || pw != password {
+				w.Header().Set("Proxy-Authenticate", `Basic realm="test"`)
+				http.Error(w, "who are you", http.StatusProxyAuthRequired)
+				return
+			}
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		p.tunnels.Add(1)
+		splice(conn, target)
+	}))
+	t.Cleanup(srv.Close)
+	p.addr = srv.Listener.Addr().String()
+	return p
+}
+
+// selfSigned returns server TLS settings and matching client credentials.
+func selfSigned(t *testing.T) (*tls.Config, credentials.TransportCredentials) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	serverCfg := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return serverCfg, credentials.NewTLS(&tls.Config{RootCAs: pool})
+}
+
+// startGreeter serves greeter on a loopback port, returning its address
+// as localhost:port.
+func startGreeter(t *testing.T, opts ...grpc.ServerOption) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(opts...)
+	pb.RegisterGreeterServer(s, greeter{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	return net.JoinHostPort("localhost", port)
+}
+
+func sayHello(t *testing.T, addr string, dialer Dialer, creds credentials.TransportCredentials) (*pb.HelloReply, error) {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "Ada"})
+}
+
+func TestProxyRoundTrip(t *testing.T) {
+	serverTLS, clientCreds := selfSigned(t)
+	servers := []struct {
+		name  string
+		addr  string
+		creds credentials.TransportCredentials
+	}{
+		{"plaintext", startGreeter(t), insecure.NewCredentials()},
+		{"tls", startGreeter(t, grpc.Creds(credentials.NewTLS(serverTLS))), clientCreds},
+	}
+	proxies := []struct {
+		scheme string
+		proxy  *testProxy
+	}{
+		{"socks5", startSOCKS5(t, "alice", "s3cret")},
+		{"http", startConnect(t, "alice", "s3cret")},
+	}
+	for _, p := range proxies {
+		for _, s := range servers {
+			t.Run(p.scheme+"/"+s.name, func(t *testing.T) {
+				dialer, err := ProxyDialer(p.scheme + "://alice:s3cret@" + p.proxy.addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				before := p.proxy.tunnels.Load()
+				reply, err := sayHello(t, s.addr, dialer, s.creds)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if reply.Message != "Hello, Ada!" {
+					t.Errorf("got %q", reply.Message)
+				}
+				if p.proxy.tunnels.Load() == before {
+					t.Error("the call did not go through the proxy")
+				}
+			})
+		}
+	}
+}
+
+func TestProxyAuthFailure(t *testing.T) {
+	addr := startGreeter(t)
+	proxies := map[string]*testProxy{
+		"socks5": startSOCKS5(t, "alice", "s3cret"),
+		"http":   startConnect(t, "alice", "s3cret"),
+	}
+	for scheme, p := range proxies {
+		for _, user := range []string{"alice:wrong@", ""} {
+			t.Run(scheme+"/"+user, func(t *testing.T) {
+				dialer, err := ProxyDialer(scheme + "://" + user + p.addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				conn, err := dialer(ctx, addr)
+				if err == nil {
+					conn.Close()
+				}
+				if !errors.Is(err, ErrProxyAuth) {
+					t.Errorf("got %v, want ErrProxyAuth", err)
+				}
+
+				_, err = sayHello(t, addr, dialer, insecure.NewCredentials())
+				if st := status.Convert(err); st.Code() != codes.Unavailable || !strings.Contains(st.Message(), ErrProxyAuth.Error()) {
+					t.Errorf("SayHello got %v, want Unavailable naming the proxy authentication failure", err)
+				}
+			})
+		}
+	}
+}
+
+func TestProxyDialerURL(t *testing.T) {
+	for _, bad := range []string{"ftp://proxy:21", "socks5://", "http://proxy:3128/path", "http://proxy?x=1", "proxy:3128", "%"} {
+		if _, err := ProxyDialer(bad); err == nil {
+			t.Errorf("ProxyDialer(%q) succeeded, want an error", bad)
+		}
+	}
+	tests := []struct{ host, want string }{
+		{"proxy", "proxy:1080"},
+		{"proxy:1081", "proxy:1081"},
+		{"[::1]", "[::1]:1080"},
+		{"[::1]:9", "[::1]:9"},
+	}
+	for _, tt := range tests {
+		if got := withPort(tt.host, "1080"); got != tt.want {
+			t.Errorf("withPort(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
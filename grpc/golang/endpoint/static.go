@@ -0,0 +1,56 @@
+package endpoint
+
+import (
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// StaticScheme is the resolver scheme for a fixed list of addresses, written
+// static:///host1:port1,host2:port2.
+const StaticScheme = "static"
+
+// StaticBuilder returns a resolver for StaticScheme targets. Pass it to
+// grpc.WithResolvers; Dial does so for comma-separated addresses.
+func StaticBuilder() resolver.Builder {
+	return staticBuilder{}
+}
+
+type staticBuilder struct{}
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	list := splitAddrs(target.Endpoint())
+	if len(list) == 0 {
+		return nil, errors.New("endpoint: static target lists no addresses")
+	}
+	addrs := make([]resolver.Address, len(list))
+	for i, addr := range list {
+		addrs[i] = resolver.Address{Addr: addr}
+	}
+	if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		return nil, err
+	}
+	return staticResolver{}, nil
+}
+
+func (staticBuilder) Scheme() string { return StaticScheme }
+
+// staticResolver never changes its addresses, so it has nothing to do after
+// Build.
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (staticResolver) Close() {}
+
+// splitAddrs splits a comma-separated address list, dropping blank entries.
+func splitAddrs(list string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
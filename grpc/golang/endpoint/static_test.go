@@ -0,0 +1,79 @@
+package endpoint
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// namedGreeter replies with its own name so tests can tell servers apart.
+type namedGreeter struct {
+	pb.UnimplementedGreeterServer
+	name string
+}
+
+func (g namedGreeter) SayHello(context.Context, *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: g.name}, nil
+}
+
+// startTCP serves a namedGreeter on a loopback port until the test ends.
+func startTCP(t *testing.T, name string) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterGreeterServer(s, namedGreeter{name: name})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestDialStaticList(t *testing.T) {
+	a, b := startTCP(t, "a"), startTCP(t, "b")
+	target, opts := Dial(a + ", " + b)
+	if target != "static:///"+a+", "+b {
+		t.Errorf("got target %q", target)
+	}
+	conn, err := grpc.NewClient(target, append(opts,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"round_robin":{}}]}`))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := pb.NewGreeterClient(conn)
+	seen := map[string]bool{}
+	// round_robin only picks a backend once it is connected, so keep calling
+	// until both have answered
+	for len(seen) < 2 {
+		resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"})
+		if err != nil {
+			t.Fatalf("SayHello: %v (reached %v)", err, seen)
+		}
+		seen[resp.Message] = true
+	}
+}
+
+func TestDialStaticEmptyList(t *testing.T) {
+	target, opts := Dial(" , ")
+	conn, err := grpc.NewClient(target, append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err == nil {
+		t.Error("SayHello succeeded with no addresses")
+	}
+}
@@ -0,0 +1,163 @@
+// Package experiment assigns callers to the weighted variants of an A/B
+// experiment, deterministically by their identity, and counts what each
+// variant serves for the Experiments service.
+package experiment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	experimentpb "github.com/shrivatsas/exp-codegen/grpc/protos/experiment"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the Experiments service's full name.
+var ServiceName = experimentpb.Experiments_ServiceDesc.ServiceName
+
+// Variant is one arm of an Experiment.
+type Variant struct {
+	Name string
+	// Weight is the variant's share of callers relative to the others';
+	// zero disables it.
+	Weight uint32
+}
+
+// Options configures an Experiment.
+type Options struct {
+	// Variants must have distinct, non-empty names and weights summing to a
+	// positive number.
+	Variants []Variant
+	// Identity returns what a call is assigned a variant by. RequestID is
+	// used when nil, which keeps a caller's variant only across calls
+	// sharing an ID; return its authenticated subject, or peer address, to
+	// keep each user on one variant, as ratelimit.AuthSubject does.
+	Identity func(ctx context.Context) string
+}
+
+// Experiment splits callers between its variants in proportion to their
+// weights. It is safe for concurrent use.
+type Experiment struct {
+	variants []Variant
+	identity func(ctx context.Context) string
+	// total is the sum of the weights.
+	total uint64
+	// served counts, by index into variants, the greetings each served.
+	served []atomic.Int64
+}
+
+// New returns an Experiment over opts.Variants, or an error if they are
+// not as Options describes.
+func New(opts Options) (*Experiment, error) {
+	variants := opts.Variants
+	e := &Experiment{
+		variants: append([]Variant(nil), variants...),
+		identity: opts.Identity,
+		served:   make([]atomic.Int64, len(variants)),
+	}
+	if e.identity == nil {
+		e.identity = RequestID
+	}
+	seen := make(map[string]bool, len(variants))
+	for i, v := range variants {
+		if v.Name == "" {
+			return nil, fmt.Errorf("experiment: variant %d has no name", i)
+		}
+		if seen[v.Name] {
+			return nil, fmt.Errorf("experiment: variant %q is listed twice", v.Name)
+		}
+		seen[v.Name] = true
+		e.total += uint64(v.Weight)
+	}
+	if e.total == 0 {
+		return nil, errors.New("experiment: the variant weights must sum to a positive number")
+	}
+	return e, nil
+}
+
+// RequestID identifies calls by the ID the requestid interceptors set, so
+// callers reusing an ID keep their variant. The interceptors mint a new ID
+// for each call arriving without one, so such callers are assigned afresh
+// on every call. Calls without an ID at all share the empty identity.
+func RequestID(ctx context.Context) string {
+	id, _ := requestid.FromContext(ctx)
+	return id
+}
+
+// AssignCall returns the name of the variant the caller of ctx is assigned
+// to, identified as Options.Identity says.
+func (e *Experiment) AssignCall(ctx context.Context) string {
+	return e.Assign(e.identity(ctx))
+}
+
+// Assign returns the name of the variant identity is assigned to. An
+// identity keeps its variant for as long as the variants and weights stay
+// the same.
+func (e *Experiment) Assign(identity string) string {
+	return e.variants[e.assign(identity)].Name
+}
+
+// assign returns the index of identity's variant.
+func (e *Experiment) assign(identity string) int {
+	sum := sha256.Sum256([]byte(identity))
+	point := binary.BigEndian.Uint64(sum[:8]) % e.total
+	for i, v := range e.variants {
+		if point < uint64(v.Weight) {
+			return i
+		}
+		point -= uint64(v.Weight)
+	}
+	// Unreachable: point is less than the sum of the weights
+	return len(e.variants) - 1
+}
+
+// Served counts a greeting served by the named variant. Unknown names are
+// ignored.
+func (e *Experiment) Served(variant string) {
+	for i, v := range e.variants {
+		if v.Name == variant {
+			e.served[i].Add(1)
+			return
+		}
+	}
+}
+
+// Stat is a variant with the number of greetings it has served.
+type Stat struct {
+	Variant
+	Served int64
+}
+
+// Stats returns every variant's count, in the order New was given them.
+func (e *Experiment) Stats() []Stat {
+	stats := make([]Stat, len(e.variants))
+	for i, v := range e.variants {
+		stats[i] = Stat{Variant: v, Served: e.served[i].Load()}
+	}
+	return stats
+}
+
+// Register adds the Experiments service reporting on e to s.
+func (e *Experiment) Register(s grpc.ServiceRegistrar) {
+	experimentpb.RegisterExperimentsServer(s, statsService{e: e})
+}
+
+// statsService implements Experiments on Experiment.
+type statsService struct {
+	experimentpb.UnimplementedExperimentsServer
+	e *Experiment
+}
+
+// GetExperimentStats implements the GetExperimentStats RPC method.
+func (s statsService) GetExperimentStats(context.Context, *experimentpb.GetExperimentStatsRequest) (*experimentpb.GetExperimentStatsResponse, error) {
+	resp := &experimentpb.GetExperimentStatsResponse{}
+	for _, st := range s.e.Stats() {
+		resp.Variants = append(resp.Variants, &experimentpb.VariantStats{Name: st.Name, Weight: st.Weight, Served: st.Served})
+		resp.TotalServed += st.Served
+	}
+	return resp, nil
+}
@@ -0,0 +1,148 @@
+package experiment_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/experiment"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	experimentpb "github.com/shrivatsas/exp-codegen/grpc/protos/experiment"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// shouting greets in capitals, as a variant's templates might.
+type shouting struct{}
+
+func (shouting) Format(_ greeter.MessageKind, _ string, data greeter.MessageData) (string, bool, error) {
+	return "HELLO, " + strings.ToUpper(data.Name) + "!", true, nil
+}
+
+func newExperiment(t *testing.T, variants ...experiment.Variant) *experiment.Experiment {
+	t.Helper()
+	e, err := experiment.New(experiment.Options{Variants: variants})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		variants []experiment.Variant
+	}{
+		{"none", nil},
+		{"zero weights", []experiment.Variant{{Name: "a"}, {Name: "b"}}},
+		{"unnamed", []experiment.Variant{{Weight: 1}}},
+		{"duplicate", []experiment.Variant{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}},
+	} {
+		if _, err := experiment.New(experiment.Options{Variants: tc.variants}); err == nil {
+			t.Errorf("%s: New succeeded, want an error", tc.name)
+		}
+	}
+}
+
+func TestAssignDeterministic(t *testing.T) {
+	variants := []experiment.Variant{{Name: "control", Weight: 1}, {Name: "friendly", Weight: 1}}
+	e1, e2 := newExperiment(t, variants...), newExperiment(t, variants...)
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("user-%d", i)
+		v := e1.Assign(id)
+		if got := e1.Assign(id); got != v {
+			t.Errorf("%s assigned %s, then %s", id, v, got)
+		}
+		// Servers configured alike agree
+		if got := e2.Assign(id); got != v {
+			t.Errorf("%s assigned %s by one experiment and %s by another", id, v, got)
+		}
+	}
+}
+
+func TestAssignDistribution(t *testing.T) {
+	e := newExperiment(t,
+		experiment.Variant{Name: "control", Weight: 1},
+		experiment.Variant{Name: "disabled", Weight: 0},
+		experiment.Variant{Name: "friendly", Weight: 3},
+	)
+	const n = 20000
+	got := make(map[string]int)
+	for i := 0; i < n; i++ {
+		got[e.Assign(fmt.Sprintf("user-%d", i))]++
+	}
+	if got["disabled"] > 0 {
+		t.Errorf("zero-weight variant assigned %d identities", got["disabled"])
+	}
+	for name, share := range map[string]float64{"control": 0.25, "friendly": 0.75} {
+		if frac := float64(got[name]) / n; math.Abs(frac-share) > 0.02 {
+			t.Errorf("%s assigned %.3f of identities, want about %.2f", name, frac, share)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	e := newExperiment(t,
+		experiment.Variant{Name: "control", Weight: 1},
+		experiment.Variant{Name: "shouting", Weight: 1},
+		experiment.Variant{Name: "disabled", Weight: 0},
+	)
+	history := store.NewMemoryHistory(0)
+	ts := testutil.Start(t,
+		testutil.WithGreeterOptions(greeter.WithExperiment(e, map[string]greeter.Formatter{"shouting": shouting{}}), greeter.WithHistoryStore(history)),
+		testutil.WithServerOptions(grpc.UnaryInterceptor(requestid.UnaryServerInterceptor())),
+		testutil.WithRegister(func(s *grpc.Server) { e.Register(s) }),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	served := make(map[string]int64)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("user-%d", i%5)
+		var header metadata.MD
+		reply, err := ts.Client.SayHello(metadata.AppendToOutgoingContext(ctx, requestid.MetadataKey, id), &pb.HelloRequest{Name: "Ada"}, grpc.Header(&header))
+		if err != nil {
+			t.Fatal(err)
+		}
+		variant := strings.Join(header.Get(greeter.VariantHeader), ",")
+		if want := e.Assign(id); variant != want {
+			t.Errorf("call as %s served by variant %q, want %s", id, variant, want)
+		}
+		if shouted := reply.Message == "HELLO, ADA!"; shouted != (variant == "shouting") {
+			t.Errorf("variant %s replied %q", variant, reply.Message)
+		}
+		served[variant]++
+	}
+
+	resp, err := experimentpb.NewExperimentsClient(ts.Conn).GetExperimentStats(ctx, &experimentpb.GetExperimentStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalServed != 20 || len(resp.Variants) != 3 {
+		t.Fatalf("got stats %v, want 3 variants serving 20 greetings", resp)
+	}
+	for _, v := range resp.Variants {
+		if v.Served != served[v.Name] {
+			t.Errorf("variant %s served %d, want %d", v.Name, v.Served, served[v.Name])
+		}
+	}
+
+	greetings, _, err := history.List(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := make(map[string]int64)
+	for _, g := range greetings {
+		recorded[g.Variant]++
+	}
+	if recorded["control"] != served["control"] || recorded["shouting"] != served["shouting"] {
+		t.Errorf("history records variants %v, want %v", recorded, served)
+	}
+}
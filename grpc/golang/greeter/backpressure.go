@@ -0,0 +1,138 @@
+package greeter
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultStreamBuffer is how many SayHelloStream replies may wait to be
+	// sent unless WithStreamBuffer is used.
+	defaultStreamBuffer = 16
+	// defaultStreamSendTimeout bounds each SayHelloStream send unless
+	// WithStreamSendTimeout is used.
+	defaultStreamSendTimeout = 10 * time.Second
+)
+
+// WithStreamBuffer sets how many SayHelloStream replies may be produced
+// ahead of those sent, 16 by default. Once the buffer is full production
+// waits for the client, so a slow reader holds at most n replies in memory.
+func WithStreamBuffer(n int) Option {
+	return func(s *Service) { s.streamBuffer = max(n, 0) }
+}
+
+// WithStreamSendTimeout aborts a SayHelloStream with DeadlineExceeded when
+// sending one reply takes longer than d, e.g. because the client stopped
+// reading and flow control stalled the stream. It is 10s by default; zero
+// lets a send block for as long as the client stays connected.
+func WithStreamSendTimeout(d time.Duration) Option {
+	return func(s *Service) { s.streamSendTimeout = d }
+}
+
+// WithSlowStreamsCounter sets a counter incremented for every stream aborted
+// by the send timeout; see NewSlowStreamsCounter.
+func WithSlowStreamsCounter(c prometheus.Counter) Option {
+	return func(s *Service) { s.slowStreams = c }
+}
+
+// NewSlowStreamsCounter registers a counter of streams aborted because the
+// client read too slowly on reg.
+func NewSlowStreamsCounter(reg prometheus.Registerer) (prometheus.Counter, error) {
+	c := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "greeter_slow_streams_aborted_total",
+		Help: "Total number of SayHelloStream calls aborted because a reply could not be sent within the send timeout.",
+	})
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// sendBuffered runs produce in its own goroutine and sends the replies it
+// passes to emit with send. Up to streamBuffer replies wait between the two,
+// and emit blocks while the buffer is full, so a slow client slows
+// production down rather than piling up replies. A send taking longer than
+// streamSendTimeout aborts the stream with DeadlineExceeded.
+func (s *Service) sendBuffered(ctx context.Context, send func(*pbv2.HelloReply) error, produce func(ctx context.Context, emit func(*pbv2.HelloReply) error) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	buf := make(chan *pbv2.HelloReply, s.streamBuffer)
+	produced := make(chan error, 1)
+	go func() {
+		defer close(buf)
+		produced <- produce(ctx, func(reply *pbv2.HelloReply) error {
+			select {
+			case buf <- reply:
+				return nil
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			}
+		})
+	}()
+
+	w := newSendWorker(send)
+	defer w.stop()
+	for reply := range buf {
+		if err := w.send(ctx, reply, s.streamSendTimeout); err != nil {
+			if status.Code(err) == codes.DeadlineExceeded && s.slowStreams != nil {
+				s.slowStreams.Inc()
+			}
+			// Stop the producer before returning so it does not outlive the
+			// handler
+			cancel()
+			for range buf {
+			}
+			return err
+		}
+	}
+	return <-produced
+}
+
+// sendWorker makes sends from its own goroutine, so the handler can give up
+// on one blocked by a client that stopped reading. Returning from the
+// handler then ends the stream, which unblocks the send.
+type sendWorker struct {
+	replies chan *pbv2.HelloReply
+	// done has room for the result of a send the handler gave up on, so the
+	// worker can still exit.
+	done chan error
+}
+
+func newSendWorker(send func(*pbv2.HelloReply) error) *sendWorker {
+	w := &sendWorker{replies: make(chan *pbv2.HelloReply), done: make(chan error, 1)}
+	go func() {
+		for reply := range w.replies {
+			w.done <- send(reply)
+		}
+	}()
+	return w
+}
+
+// send sends reply, failing with DeadlineExceeded if that takes longer than
+// timeout, when positive, or with ctx's error if it ends first.
+func (w *sendWorker) send(ctx context.Context, reply *pbv2.HelloReply, timeout time.Duration) error {
+	w.replies <- reply
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err := <-w.done:
+		return err
+	case <-expired:
+		return status.Errorf(codes.DeadlineExceeded, "client is not reading: sending a reply took longer than %v", timeout)
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (w *sendWorker) stop() {
+	close(w.replies)
+}
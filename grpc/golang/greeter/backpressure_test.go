@@ -0,0 +1,116 @@
+package greeter_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	grpctest "github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSlowClientAborted(t *testing.T) {
+	const sendTimeout = 200 * time.Millisecond
+	slow, err := greeter.NewSlowStreamsCounter(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		err error
+		at  time.Time
+	}
+	handled := make(chan result, 1)
+	ts := grpctest.Start(t,
+		grpctest.WithGreeterOptions(
+			greeter.WithStreamInterval(0),
+			greeter.WithStreamBuffer(4),
+			greeter.WithStreamSendTimeout(sendTimeout),
+			greeter.WithSlowStreamsCounter(slow)),
+		grpctest.WithServerOptions(grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			err := handler(srv, ss)
+			handled <- result{err, time.Now()}
+			return err
+		})),
+		// A fixed window, without BDP growth, fills after a few replies
+		grpctest.WithDialOptions(grpc.WithInitialWindowSize(1<<16), grpc.WithInitialConnWindowSize(1<<16)))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Big names make each reply about 8KiB
+	name := strings.Repeat("a", 8<<10)
+	count := int32(1000)
+	stream, err := ts.Client.SayHelloStream(ctx, &pb.HelloRequest{Name: name, Count: &count})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// Stop reading. The server must give up once a send has been blocked
+	// for the timeout, not wait for the client.
+	stalled := time.Now()
+	select {
+	case r := <-handled:
+		if status.Code(r.err) != codes.DeadlineExceeded {
+			t.Fatalf("handler returned %v, want DeadlineExceeded", r.err)
+		}
+		if took := r.at.Sub(stalled); took > sendTimeout+time.Second {
+			t.Errorf("handler gave up %v after the client stalled, want about %v", took, sendTimeout)
+		}
+	case <-ctx.Done():
+		t.Fatal("handler still blocked on the slow client")
+	}
+	if got := testutil.ToFloat64(slow); got != 1 {
+		t.Errorf("slow streams counter = %v, want 1", got)
+	}
+
+	// Production stopped with the buffer full rather than running through
+	// the whole count
+	resp, err := ts.Client.GetGreetingCount(ctx, &pb.GetCountRequest{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count >= int64(count) {
+		t.Errorf("%d replies produced for a client that read one, want production to stop early", resp.Count)
+	}
+
+	// Reading again drains what was in flight, then reports the abort
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("client saw %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestStreamBufferKeepsOrder(t *testing.T) {
+	client := grpctest.Start(t, grpctest.WithGreeterOptions(greeter.WithStreamInterval(0), greeter.WithStreamBuffer(0))).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count := int32(20)
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice", Count: &count})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int32(1); i <= count; i++ {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv %d: %v", i, err)
+		}
+		if resp.GreetingCount != i {
+			t.Errorf("reply %d has count %d", i, resp.GreetingCount)
+		}
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Error("stream did not end after the requested count")
+	}
+}
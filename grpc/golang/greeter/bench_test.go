@@ -0,0 +1,161 @@
+package greeter_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Run with, for example,
+//
+//	go test -run=^$ -bench=. -count=10 ./greeter | tee new.txt
+//	benchstat old.txt new.txt
+//
+// Sub-benchmark names are key=value pairs so benchstat can group by
+// transport, size and method. The TCP variants are skipped with -short.
+
+// streamLength is the number of replies SayHelloStream sends per call.
+const streamLength = 5
+
+var transports = []struct {
+	name  string
+	start func(b *testing.B) pb.GreeterClient
+}{
+	{"bufconn", startBufconn},
+	{"tcp", startTCP},
+}
+
+func startBufconn(b *testing.B) pb.GreeterClient {
+	client, _ := testutil.StartTestServer(b, testutil.WithGreeterOptions(greeter.WithStreamInterval(0)))
+	return client
+}
+
+// startTCP serves the Greeter on a loopback port and dials it.
+func startTCP(b *testing.B) pb.GreeterClient {
+	if testing.Short() {
+		b.Skip("skipping TCP loopback benchmark in short mode")
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := grpc.NewServer()
+	greeter.New(greeter.WithStreamInterval(0)).Register(s)
+	go s.Serve(lis)
+	b.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	return pb.NewGreeterClient(conn)
+}
+
+// reportRate adds a per-second rate of n operations per iteration.
+func reportRate(b *testing.B, n int, unit string) {
+	b.ReportMetric(float64(b.N*n)/b.Elapsed().Seconds(), unit)
+}
+
+func BenchmarkSayHello(b *testing.B) {
+	sizes := []struct {
+		name string
+		n    int
+	}{
+		{"16B", 16},
+		{"1KB", 1 << 10},
+		{"64KB", 64 << 10},
+	}
+	for _, tr := range transports {
+		b.Run("transport="+tr.name, func(b *testing.B) {
+			client := tr.start(b)
+			for _, size := range sizes {
+				b.Run("size="+size.name, func(b *testing.B) {
+					req := &pb.HelloRequest{Name: strings.Repeat("x", size.n)}
+					ctx := context.Background()
+					b.SetBytes(int64(size.n))
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if _, err := client.SayHello(ctx, req); err != nil {
+							b.Fatal(err)
+						}
+					}
+					reportRate(b, 1, "req/s")
+				})
+			}
+		})
+	}
+}
+
+// BenchmarkGreetings fetches a number of greetings either with repeated
+// SayHello calls or with SayHelloStream. The server sends a fixed
+// streamLength replies per stream, so larger counts open several streams.
+func BenchmarkGreetings(b *testing.B) {
+	methods := []struct {
+		name  string
+		fetch func(ctx context.Context, client pb.GreeterClient, req *pb.HelloRequest, n int) error
+	}{
+		{"unary", fetchUnary},
+		{"stream", fetchStream},
+	}
+	for _, tr := range transports {
+		b.Run("transport="+tr.name, func(b *testing.B) {
+			client := tr.start(b)
+			for _, m := range methods {
+				for _, n := range []int{streamLength, 10 * streamLength, 100 * streamLength} {
+					b.Run(fmt.Sprintf("method=%s/greetings=%d", m.name, n), func(b *testing.B) {
+						req := &pb.HelloRequest{Name: "bench"}
+						ctx := context.Background()
+						b.ReportAllocs()
+						b.ResetTimer()
+						for i := 0; i < b.N; i++ {
+							if err := m.fetch(ctx, client, req, n); err != nil {
+								b.Fatal(err)
+							}
+						}
+						reportRate(b, n, "greetings/s")
+					})
+				}
+			}
+		})
+	}
+}
+
+func fetchUnary(ctx context.Context, client pb.GreeterClient, req *pb.HelloRequest, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := client.SayHello(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fetchStream(ctx context.Context, client pb.GreeterClient, req *pb.HelloRequest, n int) error {
+	for received := 0; received < n; {
+		stream, err := client.SayHelloStream(ctx, req)
+		if err != nil {
+			return err
+		}
+		for {
+			_, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			received++
+		}
+	}
+	return nil
+}
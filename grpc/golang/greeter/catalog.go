@@ -0,0 +1,208 @@
+package greeter
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// FallbackHeader is set to "true" on the response to a request whose locale
+// has no catalog entry, and which was greeted in English instead.
+const FallbackHeader = "x-locale-fallback"
+
+// defaultLocale is used for requests without a locale or with an unknown one.
+const defaultLocale = "en"
+
+// localeFS holds one template file per locale, named by its language tag,
+// e.g. locales/es.tmpl. Adding a locale only takes a new file.
+//
+//go:embed locales/*.tmpl
+var localeFS embed.FS
+
+// bundled is the Formatter built from localeFS and used unless
+// WithFormatter is. A malformed file stops the program at init time.
+var bundled = mustNewTemplateFormatter(localeFS, "locales")
+
+// MessageKind names the greetings a Formatter renders.
+type MessageKind int
+
+const (
+	// HelloMessage greets one name, for SayHello and SayHelloChat.
+	HelloMessage MessageKind = iota
+	// StreamMessage is one SayHelloStream reply.
+	StreamMessage
+	// BatchMessage greets every SayHelloBatch name at once.
+	BatchMessage
+)
+
+func (k MessageKind) String() string {
+	switch k {
+	case HelloMessage:
+		return "hello"
+	case StreamMessage:
+		return "stream"
+	case BatchMessage:
+		return "batch"
+	}
+	return fmt.Sprintf("MessageKind(%d)", int(k))
+}
+
+// MessageData is what a greeting is built from.
+type MessageData struct {
+	// Name is the greeted name, empty for a BatchMessage.
+	Name string
+	// Names are the names of a BatchMessage.
+	Names []string
+	// N numbers SayHelloStream replies from 1.
+	N int
+	// Count is how often Name has been greeted, this greeting included, or
+	// the number of Names.
+	Count int64
+	// Time is when the server produced the greeting.
+	Time time.Time
+}
+
+// Formatter builds the greetings the Greeter service sends; see
+// WithFormatter.
+type Formatter interface {
+	// Format renders the message of kind in locale. It reports false if it
+	// has no messages for locale and used its default language instead.
+	Format(kind MessageKind, locale string, data MessageData) (string, bool, error)
+}
+
+// TemplateFormatter is a Formatter of text/template definitions, one file
+// per locale named by its language tag, e.g. es.tmpl, with en.tmpl the
+// default. Each file defines "hello", "stream" and "batch" templates and
+// may define "hello.repeat", used instead of "hello" for a name greeted
+// before. Templates are executed with a MessageData, so they can use
+// {{.Name}}, {{.Count}} or {{.Time.Hour}}, and {{join .Names ", "}} joins the
+// batch names. Surrounding space is trimmed from the output.
+type TemplateFormatter struct {
+	// locales maps lower-case language tags to their templates.
+	locales map[string]*template.Template
+}
+
+// repeatTemplate is the optional template greeting a name greeted before.
+const repeatTemplate = "hello.repeat"
+
+var templateFuncs = template.FuncMap{"join": strings.Join}
+
+func mustNewTemplateFormatter(fsys fs.FS, dir string) *TemplateFormatter {
+	f, err := NewTemplateFormatter(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// NewTemplateFormatter reads every .tmpl file in dir. Each template is
+// rendered once with sample data, so a template that does not parse, is
+// missing, refers to an unknown field or leaves out the name fails here,
+// naming the file at fault, rather than later on a request.
+func NewTemplateFormatter(fsys fs.FS, dir string) (*TemplateFormatter, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("greeter: reading greeting templates: %w", err)
+	}
+	f := &TemplateFormatter{locales: map[string]*template.Template{}}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".tmpl" {
+			continue
+		}
+		file := path.Join(dir, e.Name())
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("greeter: reading greeting templates: %w", err)
+		}
+		t, err := template.New(e.Name()).Funcs(templateFuncs).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("greeter: template file %s: %w", file, err)
+		}
+		if err := checkTemplates(t); err != nil {
+			return nil, fmt.Errorf("greeter: template file %s: %w", file, err)
+		}
+		f.locales[strings.ToLower(strings.TrimSuffix(e.Name(), ".tmpl"))] = t
+	}
+	if _, ok := f.locales[defaultLocale]; !ok {
+		return nil, fmt.Errorf("greeter: greeting templates in %s have no %s.tmpl", dir, defaultLocale)
+	}
+	return f, nil
+}
+
+// checkTemplates renders each of t's templates with sample data, checking
+// that it shows the names.
+func checkTemplates(t *template.Template) error {
+	sample := MessageData{Name: "Ana", Names: []string{"Ana", "Ben"}, N: 3, Count: 2, Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	for _, check := range []struct {
+		name     string
+		optional bool
+		want     []string
+	}{
+		{HelloMessage.String(), false, []string{"Ana"}},
+		{repeatTemplate, true, []string{"Ana"}},
+		{StreamMessage.String(), false, []string{"Ana", "3"}},
+		{BatchMessage.String(), false, []string{"Ana", "Ben"}},
+	} {
+		if t.Lookup(check.name) == nil {
+			if check.optional {
+				continue
+			}
+			return fmt.Errorf("no %q template", check.name)
+		}
+		got, err := execute(t, check.name, sample)
+		if err != nil {
+			return err
+		}
+		for _, w := range check.want {
+			if !strings.Contains(got, w) {
+				return fmt.Errorf("%q renders %q, which leaves out %q", check.name, got, w)
+			}
+		}
+	}
+	return nil
+}
+
+func execute(t *template.Template, name string, data MessageData) (string, error) {
+	var b strings.Builder
+	if err := t.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// lookup returns the templates for locale, trying the full tag and then its
+// language, so "fr-CA" uses fr. It reports false if neither is known and
+// English was substituted; an empty locale is English without a fallback.
+func (f *TemplateFormatter) lookup(locale string) (*template.Template, bool) {
+	if locale == "" {
+		return f.locales[defaultLocale], true
+	}
+	tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if t, ok := f.locales[tag]; ok {
+		return t, true
+	}
+	if lang, _, ok := strings.Cut(tag, "-"); ok {
+		if t, ok := f.locales[lang]; ok {
+			return t, true
+		}
+	}
+	return f.locales[defaultLocale], false
+}
+
+// Format implements Formatter.
+func (f *TemplateFormatter) Format(kind MessageKind, locale string, data MessageData) (string, bool, error) {
+	t, known := f.lookup(locale)
+	name := kind.String()
+	if kind == HelloMessage && data.Count > 1 && t.Lookup(repeatTemplate) != nil {
+		name = repeatTemplate
+	}
+	msg, err := execute(t, name, data)
+	if err != nil {
+		return "", known, fmt.Errorf("greeter: rendering %s: %w", name, err)
+	}
+	return msg, known, nil
+}
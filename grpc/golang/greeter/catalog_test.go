@@ -0,0 +1,108 @@
+package greeter
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBundledTemplates(t *testing.T) {
+	tests := []struct {
+		locale                     string
+		hello, repeat, stream, all string
+	}{
+		{"en", "Hello, Ana!", "Hello again, Ana! That makes 3 greetings.", "Hello 2, Ana!", "Hello Ana, Ben"},
+		{"es", "¡Hola, Ana!", "¡Hola de nuevo, Ana! Ya van 3 saludos.", "¡Hola 2, Ana!", "Hola Ana, Ben"},
+		{"fr", "Bonjour, Ana !", "Rebonjour, Ana ! Cela fait 3 salutations.", "Bonjour 2, Ana !", "Bonjour Ana, Ben"},
+		{"de", "Hallo, Ana!", "Hallo nochmal, Ana! Das sind schon 3 Grüße.", "Hallo 2, Ana!", "Hallo Ana, Ben"},
+		{"hi", "नमस्ते, Ana!", "फिर से नमस्ते, Ana! यह 3वाँ अभिवादन है।", "नमस्ते 2, Ana!", "नमस्ते Ana, Ben"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			for _, r := range []struct {
+				kind MessageKind
+				data MessageData
+				want string
+			}{
+				{HelloMessage, MessageData{Name: "Ana", Count: 1}, tt.hello},
+				{HelloMessage, MessageData{Name: "Ana", Count: 3}, tt.repeat},
+				{StreamMessage, MessageData{Name: "Ana", N: 2, Count: 7}, tt.stream},
+				{BatchMessage, MessageData{Names: []string{"Ana", "Ben"}, Count: 2}, tt.all},
+			} {
+				got, known, err := bundled.Format(r.kind, tt.locale, r.data)
+				if err != nil || !known || got != r.want {
+					t.Errorf("Format(%v, %+v) = %q, %v, %v; want %q", r.kind, r.data, got, known, err, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEmptyBatch(t *testing.T) {
+	if got, _, _ := bundled.Format(BatchMessage, "", MessageData{}); got != "Hello" {
+		t.Errorf("got %q, want the bare greeting", got)
+	}
+}
+
+func TestTemplateVariables(t *testing.T) {
+	f, err := NewTemplateFormatter(fstest.MapFS{"l/en.tmpl": {Data: []byte(`
+{{define "hello"}}Good {{if lt .Time.Hour 12}}morning{{else}}afternoon{{end}}, {{.Name}}!{{end}}
+{{define "stream"}}{{.N}}: {{.Name}}{{end}}
+{{define "batch"}}{{join .Names " & "}}{{end}}`)}}, "l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hour, want := range map[int]string{9: "Good morning, Ana!", 15: "Good afternoon, Ana!"} {
+		data := MessageData{Name: "Ana", Count: 2, Time: time.Date(2024, 5, 1, hour, 0, 0, 0, time.UTC)}
+		// Without a hello.repeat template repeat visitors get hello
+		if got, _, err := f.Format(HelloMessage, "en", data); err != nil || got != want {
+			t.Errorf("at %d:00 got %q, %v; want %q", hour, got, err, want)
+		}
+	}
+}
+
+func TestNewTemplateFormatterErrors(t *testing.T) {
+	const en = `{{define "hello"}}Hello, {{.Name}}!{{end}}{{define "stream"}}Hello {{.N}}, {{.Name}}!{{end}}{{define "batch"}}Hello {{join .Names ", "}}{{end}}`
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{"malformed template", fstest.MapFS{"l/en.tmpl": {Data: []byte(en)}, "l/es.tmpl": {Data: []byte(`{{define "hello"}}Hola, {{.Name}{{end}}`)}}, "template file l/es.tmpl"},
+		{"missing template", fstest.MapFS{"l/en.tmpl": {Data: []byte(`{{define "hello"}}Hello, {{.Name}}!{{end}}`)}}, `no "stream" template`},
+		{"unknown field", fstest.MapFS{"l/en.tmpl": {Data: []byte(en + `{{define "hello.repeat"}}Hi {{.Nmae}}{{end}}`)}}, "can't evaluate field Nmae"},
+		{"name left out", fstest.MapFS{"l/en.tmpl": {Data: []byte(strings.Replace(en, "Hello, {{.Name}}!", "Hello!", 1))}}, `"hello" renders "Hello!", which leaves out "Ana"`},
+		{"unknown function", fstest.MapFS{"l/en.tmpl": {Data: []byte(en + `{{define "x"}}{{upper .Name}}{{end}}`)}}, `function "upper" not defined`},
+		{"no default locale", fstest.MapFS{"l/es.tmpl": {Data: []byte(en)}}, "have no en.tmpl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTemplateFormatter(tt.files, "l")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+		known  bool
+	}{
+		{"", "Hello, Ana!", true},
+		{"es", "¡Hola, Ana!", true},
+		{"fr-CA", "Bonjour, Ana !", true},
+		{"DE_at", "Hallo, Ana!", true},
+		{"xx", "Hello, Ana!", false},
+		{"xx-YY", "Hello, Ana!", false},
+	}
+	for _, tt := range tests {
+		got, known, err := bundled.Format(HelloMessage, tt.locale, MessageData{Name: "Ana", Count: 1})
+		if err != nil || got != tt.want || known != tt.known {
+			t.Errorf("Format in %q: got %q and %v, want %q and %v", tt.locale, got, known, tt.want, tt.known)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package greeter
+
+import (
+	"context"
+
+	"github.com/shrivatsas/exp-codegen/grpc/compat"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GetGreetingCount implements the GetGreetingCount RPC method, reading the
+// count for a name, or the total for an empty one, without greeting.
+func (s *Service) GetGreetingCount(ctx context.Context, req *pb.GetCountRequest) (*pb.GetCountResponse, error) {
+	resp, err := s.getGreetingCount(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1GetCountResponse(resp), nil
+}
+
+func (s *Service) getGreetingCount(ctx context.Context, req *pb.GetCountRequest) (*pbv2.GetCountResponse, error) {
+	s.setServedBy(ctx)
+	var (
+		count store.Count
+		err   error
+	)
+	if req.Name == "" {
+		count, err = s.counts.Total(ctx)
+	} else {
+		count, err = s.counts.Stat(ctx, req.Name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "reading greeting count: %v", err)
+	}
+	if req.Strict && req.Name != "" && count.N == 0 {
+		return nil, status.Errorf(codes.NotFound, "%q has never been greeted", req.Name)
+	}
+	resp := &pbv2.GetCountResponse{Count: count.N}
+	if !count.LastGreeted.IsZero() {
+		resp.LastGreeted = timestamppb.New(count.LastGreeted)
+	}
+	return resp, nil
+}
@@ -0,0 +1,49 @@
+package greeter
+
+import (
+	"context"
+
+	"github.com/shrivatsas/exp-codegen/grpc/experiment"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// VariantHeader is the response header naming the experiment variant that
+// worded a greeting RPC's replies, when the service runs an experiment.
+const VariantHeader = "x-experiment-variant"
+
+// WithExperiment words greetings by the variant of e each caller is
+// assigned, with the variant's formatter from formatters. Variants without
+// one use the service's formatter, as a control. The variant is sent in the
+// VariantHeader, counted in e and recorded with SayHello greetings.
+func WithExperiment(e *experiment.Experiment, formatters map[string]Formatter) Option {
+	return func(s *Service) { s.experiment, s.variantFormatters = e, formatters }
+}
+
+type variantKey struct{}
+
+// assignVariant returns ctx carrying the variant the caller is assigned,
+// for greet, and queues the VariantHeader. Without an experiment it
+// returns ctx unchanged.
+func (s *Service) assignVariant(ctx context.Context) context.Context {
+	if s.experiment == nil {
+		return ctx
+	}
+	variant := s.experiment.AssignCall(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(VariantHeader, variant))
+	return context.WithValue(ctx, variantKey{}, variant)
+}
+
+// variant returns the variant assignVariant stored in ctx, if any.
+func variant(ctx context.Context) string {
+	v, _ := ctx.Value(variantKey{}).(string)
+	return v
+}
+
+// formatterFor returns the formatter wording the greetings of variant.
+func (s *Service) formatterFor(variant string) Formatter {
+	if f := s.variantFormatters[variant]; f != nil {
+		return f
+	}
+	return s.formatter
+}
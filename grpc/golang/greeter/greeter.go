@@ -0,0 +1,525 @@
+// Package greeter implements the Greeter service, in both its v1
+// (example.Greeter) and v2 (greeter.v2.Greeter) versions, along with the
+// health status it reports.
+//
+// Both versions share one service layer: it takes v1 requests, whose shape
+// v2 kept, and produces v2 replies, whose counts are wider, and each
+// version's handlers convert with package compat. A name greeted through
+// either version is thus counted and listed in both.
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shrivatsas/exp-codegen/grpc/compat"
+	"github.com/shrivatsas/exp-codegen/grpc/deadline"
+	"github.com/shrivatsas/exp-codegen/grpc/experiment"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"github.com/shrivatsas/exp-codegen/grpc/validate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// defaultStreamCount is the number of SayHelloStream replies sent when a
+	// request does not ask for a count.
+	defaultStreamCount = 5
+	// defaultMaxStreamCount is the count cap unless WithMaxStreamCount is used.
+	defaultMaxStreamCount = 1000
+)
+
+// ServedByHeader is the response header naming the host that handled an RPC,
+// so clients balancing across replicas can tell which one replied.
+const ServedByHeader = "x-served-by"
+
+// ResumedFromHeader is the SayHelloStream response header echoing a nonzero
+// resume_from, so clients know the server skipped the replies they already
+// have.
+const ResumedFromHeader = "x-resumed-from"
+
+// DrainingHeader is set to "true" in the headers or trailers of RPCs a
+// server handles once it has begun shutting down, so clients move their
+// calls to other replicas before its connections close.
+const DrainingHeader = "x-draining"
+
+// Service implements the v1 Greeter service; V2 returns the v2 one.
+type Service struct {
+	pb.UnimplementedGreeterServer
+	counts store.CountStore
+	// history records each SayHello greeting for ListGreetings.
+	history store.HistoryStore
+	// formatter renders the greetings.
+	formatter Formatter
+	// experiment, if set, assigns callers the variant wording their
+	// greetings, with the formatter in variantFormatters.
+	experiment        *experiment.Experiment
+	variantFormatters map[string]Formatter
+	// now returns the time greetings are recorded at.
+	now func() time.Time
+	// maxBatch caps the number of names accepted by SayHelloBatch; zero means no limit.
+	maxBatch int
+	// maxNameLength caps the characters in a request name; zero means no
+	// limit.
+	maxNameLength int
+	// quota, if set, limits SayHello and SayHelloStream calls per client.
+	quota *quota
+	// streamInterval is the pause between SayHelloStream replies for
+	// requests without an interval.
+	streamInterval time.Duration
+	// maxStreamCount and maxStreamInterval cap the count and interval a
+	// SayHelloStream request may ask for.
+	maxStreamCount    int32
+	maxStreamInterval time.Duration
+	// streamBuffer and streamSendTimeout bound how far SayHelloStream
+	// production runs ahead of a slow client and how long one send may
+	// block; slowStreams, if set, counts streams aborted by the timeout.
+	streamBuffer      int
+	streamSendTimeout time.Duration
+	slowStreams       prometheus.Counter
+	// heartbeatInterval is how long SayHelloStream and SayHelloChat may go
+	// without sending before a heartbeat is sent; zero sends none. after
+	// waits out the intervals.
+	heartbeatInterval time.Duration
+	after             func(time.Duration) <-chan time.Time
+	// hostname is sent in the ServedByHeader of every RPC and in each
+	// reply's served_by, unless instanceID is set.
+	hostname   string
+	instanceID string
+	health     *health.Server
+}
+
+// Option configures a Service created by New.
+type Option func(*Service)
+
+// WithMaxBatch caps the number of names accepted by SayHelloBatch.
+func WithMaxBatch(n int) Option {
+	return func(s *Service) { s.maxBatch = n }
+}
+
+// WithCountStore sets where greeting counts are kept. An in-memory store is
+// used by default.
+func WithCountStore(cs store.CountStore) Option {
+	return func(s *Service) { s.counts = cs }
+}
+
+// WithHistoryStore sets where the greetings listed by ListGreetings are
+// kept. By default the last 10000 are kept in memory.
+func WithHistoryStore(hs store.HistoryStore) Option {
+	return func(s *Service) { s.history = hs }
+}
+
+// WithStreamInterval sets the pause between SayHelloStream replies for
+// requests that do not ask for one, one second by default.
+func WithStreamInterval(d time.Duration) Option {
+	return func(s *Service) { s.streamInterval = d }
+}
+
+// WithMaxStreamCount caps the replies a SayHelloStream request may ask for,
+// 1000 by default. Larger counts are rejected with InvalidArgument.
+func WithMaxStreamCount(n int32) Option {
+	return func(s *Service) { s.maxStreamCount = n }
+}
+
+// WithMaxStreamInterval caps the interval a SayHelloStream request may ask
+// for, one minute by default. Longer intervals are rejected with
+// InvalidArgument.
+func WithMaxStreamInterval(d time.Duration) Option {
+	return func(s *Service) { s.maxStreamInterval = d }
+}
+
+// WithMaxNameLength caps the characters accepted in the name of every
+// request, those sent on SayHelloChat and SayHelloBatch included.
+func WithMaxNameLength(n int) Option {
+	return func(s *Service) { s.maxNameLength = n }
+}
+
+// WithClientQuota limits each client to limit greetings per window: one per
+// SayHello or SayHelloStream call, and one per name sent to SayHelloChat or
+// SayHelloBatch. Clients are told apart by peer host, not by who they
+// authenticate as; see greeterserver.DefaultInterceptors for how this
+// relates to the rate limit and quota interceptors, which are keyed by
+// subject.
+func WithClientQuota(limit int, window time.Duration) Option {
+	return func(s *Service) { s.quota = newQuota(limit, window) }
+}
+
+// WithFormatter sets how greetings are worded. By default they come from
+// the templates bundled with the package, in English, German, Spanish,
+// French and Hindi; see TemplateFormatter.
+func WithFormatter(f Formatter) Option {
+	return func(s *Service) { s.formatter = f }
+}
+
+// WithHostname sets the name sent in the ServedByHeader. The OS hostname is
+// used by default.
+func WithHostname(name string) Option {
+	return func(s *Service) { s.hostname = name }
+}
+
+// WithInstanceID sets the name reported in each reply's served_by and in
+// the ServedByHeader in place of the hostname, e.g. to tell apart replicas
+// sharing a host.
+func WithInstanceID(id string) Option {
+	return func(s *Service) { s.instanceID = id }
+}
+
+// New returns a Greeter service with its health service reporting SERVING.
+func New(opts ...Option) *Service {
+	s := &Service{
+		counts:            store.NewMemoryStore(),
+		history:           store.NewMemoryHistory(defaultHistorySize),
+		formatter:         bundled,
+		now:               time.Now,
+		after:             time.After,
+		streamInterval:    time.Second,
+		maxStreamCount:    defaultMaxStreamCount,
+		maxStreamInterval: time.Minute,
+		streamBuffer:      defaultStreamBuffer,
+		streamSendTimeout: defaultStreamSendTimeout,
+		health:            health.NewServer(),
+	}
+	s.hostname, _ = os.Hostname()
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.SetServingStatus(healthpb.HealthCheckResponse_SERVING)
+	return s
+}
+
+// Register adds the v1 and v2 Greeter services and the health service to
+// gs.
+func (s *Service) Register(gs grpc.ServiceRegistrar) {
+	pb.RegisterGreeterServer(gs, s)
+	pbv2.RegisterGreeterServer(gs, s.V2())
+	healthpb.RegisterHealthServer(gs, s.health)
+}
+
+// SetServingStatus reports st for the overall server and both Greeter
+// services, e.g. NOT_SERVING while shutting down or when a dependency is down.
+// Health Watch streams are notified of the change.
+func (s *Service) SetServingStatus(st healthpb.HealthCheckResponse_ServingStatus) {
+	s.health.SetServingStatus("", st)
+	s.health.SetServingStatus(pb.Greeter_ServiceDesc.ServiceName, st)
+	s.health.SetServingStatus(pbv2.Greeter_ServiceDesc.ServiceName, st)
+}
+
+// ServingStatus returns the status last set by SetServingStatus.
+func (s *Service) ServingStatus() healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := s.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: pb.Greeter_ServiceDesc.ServiceName})
+	if err != nil {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	return resp.Status
+}
+
+// servedBy names this server in replies.
+func (s *Service) servedBy() string {
+	if s.instanceID != "" {
+		return s.instanceID
+	}
+	return s.hostname
+}
+
+// setServedBy queues the ServedByHeader to be sent with the RPC's response
+// headers.
+func (s *Service) setServedBy(ctx context.Context) {
+	if id := s.servedBy(); id != "" {
+		grpc.SetHeader(ctx, metadata.Pairs(ServedByHeader, id))
+	}
+}
+
+// greet renders the greeting of kind for data in locale, worded by the
+// caller's experiment variant if assignVariant set one, and returns it as a
+// HelloReply stamped with the current time and this server. An unknown
+// locale is flagged in the FallbackHeader.
+func (s *Service) greet(ctx context.Context, kind MessageKind, locale string, data MessageData) (*pbv2.HelloReply, error) {
+	data.Time = s.now()
+	v := variant(ctx)
+	greeting, known, err := s.formatterFor(v).Format(kind, locale, data)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "formatting greeting: %v", err)
+	}
+	if s.experiment != nil {
+		s.experiment.Served(v)
+	}
+	if !known {
+		grpc.SetHeader(ctx, metadata.Pairs(FallbackHeader, "true"))
+	}
+	return &pbv2.HelloReply{
+		Greeting:      greeting,
+		GreetingCount: data.Count,
+		ServedAt:      timestamppb.New(data.Time),
+		ServedBy:      s.servedBy(),
+	}, nil
+}
+
+// increment records a greeting for name and returns its new count.
+func (s *Service) increment(ctx context.Context, name string) (int64, error) {
+	n, err := s.counts.Increment(ctx, name)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "recording greeting: %v", err)
+	}
+	return n, nil
+}
+
+// checkRequest returns InvalidArgument with a BadRequest detail for an
+// unacceptable name, or ResourceExhausted with a QuotaFailure detail when the
+// caller has used up its quota.
+func (s *Service) checkRequest(ctx context.Context, req *pb.HelloRequest) error {
+	if err := validate.HelloRequest(req, s.maxNameLength); err != nil {
+		return err
+	}
+
+	if s.quota != nil {
+		client := clientID(ctx)
+		if !s.quota.allow(client) {
+			description := fmt.Sprintf("limit of %d greetings per %v reached", s.quota.limit, s.quota.window)
+			return statusWithDetails(codes.ResourceExhausted, "greeting quota exceeded", &errdetails.QuotaFailure{
+				Violations: []*errdetails.QuotaFailure_Violation{{Subject: "client:" + client, Description: description}},
+			})
+		}
+	}
+	return nil
+}
+
+// statusWithDetails builds a status error carrying detail.
+func statusWithDetails(c codes.Code, msg string, detail protoadapt.MessageV1) error {
+	st, err := status.New(c, msg).WithDetails(detail)
+	if err != nil {
+		return status.Errorf(codes.Internal, "attaching error details: %v", err)
+	}
+	return st.Err()
+}
+
+// SayHello implements the SayHello RPC method.
+func (s *Service) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	reply, err := s.sayHello(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1HelloReply(reply), nil
+}
+
+// SayHelloStream implements the SayHelloStream RPC method, sending the
+// requested number of replies at the requested interval. The stream
+// trailers report what was sent; see StreamMsgCountTrailer.
+func (s *Service) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	stats := s.newStreamStats()
+	defer stats.setTrailer(stream)
+	send := countSends(stats, stream.Send)
+	return s.sayHelloStream(stream.Context(), req, func(reply *pbv2.HelloReply) error {
+		return send(compat.V1HelloReply(reply))
+	})
+}
+
+// SayHelloChat implements the SayHelloChat RPC method, replying to each
+// request as soon as it is received. The stream trailers report what was
+// sent, as for SayHelloStream.
+func (s *Service) SayHelloChat(stream pb.Greeter_SayHelloChatServer) error {
+	stats := s.newStreamStats()
+	defer stats.setTrailer(stream)
+	send := countSends(stats, stream.Send)
+	return s.sayHelloChat(stream.Context(), stream.Recv, func(reply *pbv2.HelloReply) error {
+		return send(compat.V1HelloReply(reply))
+	})
+}
+
+// SayHelloBatch implements the SayHelloBatch RPC method, greeting every
+// streamed name in a single reply.
+func (s *Service) SayHelloBatch(stream pb.Greeter_SayHelloBatchServer) error {
+	reply, err := s.sayHelloBatch(stream.Context(), stream.Recv)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(compat.V1HelloReply(reply))
+}
+
+// sayHello greets req's name, counting and recording the greeting.
+func (s *Service) sayHello(ctx context.Context, req *pb.HelloRequest) (*pbv2.HelloReply, error) {
+	s.setServedBy(ctx)
+	ctx = s.assignVariant(ctx)
+	if err := s.checkRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	count, err := s.increment(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := s.greet(ctx, HelloMessage, req.Locale, MessageData{Name: req.Name, Count: count})
+	if err != nil {
+		return nil, err
+	}
+	g := store.Greeting{Name: req.Name, Message: reply.Greeting, Time: reply.ServedAt.AsTime(), Variant: variant(ctx)}
+	if _, err := s.history.Record(ctx, g); err != nil {
+		return nil, status.Errorf(codes.Internal, "recording greeting: %v", err)
+	}
+	return reply, nil
+}
+
+// sayHelloStream passes the requested number of greetings to send at the
+// requested interval, buffered as sendBuffered describes.
+func (s *Service) sayHelloStream(ctx context.Context, req *pb.HelloRequest, send func(*pbv2.HelloReply) error) error {
+	s.setServedBy(ctx)
+	ctx = s.assignVariant(ctx)
+	if err := s.checkRequest(ctx, req); err != nil {
+		return err
+	}
+	count, interval, err := s.streamShape(req)
+	if err != nil {
+		return err
+	}
+	start := req.ResumeFrom
+	if start < 0 {
+		return fieldViolation("resume_from", "must not be negative")
+	}
+	if start > 0 {
+		grpc.SetHeader(ctx, metadata.Pairs(ResumedFromHeader, strconv.Itoa(int(start))))
+	}
+	send, stop := s.withHeartbeat(ctx, send)
+	defer stop()
+	return s.sendBuffered(ctx, send, func(ctx context.Context, emit func(*pbv2.HelloReply) error) error {
+		for i := start; i < count; i++ {
+			// Stop as soon as the caller goes away rather than at the next Send
+			if err := ctx.Err(); err != nil {
+				return status.FromContextError(err).Err()
+			}
+			if i > start && interval > 0 {
+				// Give up now if the next reply would miss the deadline
+				// rather than hold the stream open until it passes
+				if remaining, ok := deadline.Remaining(ctx); ok && remaining < interval {
+					return status.Errorf(codes.DeadlineExceeded, "%d of %d replies sent; the next is due in %v but the deadline is in %v", i-start, count-start, interval, remaining.Round(time.Millisecond))
+				}
+				select {
+				case <-time.After(interval):
+				case <-ctx.Done():
+					return status.FromContextError(ctx.Err()).Err()
+				}
+			}
+			n, err := s.increment(ctx, req.Name)
+			if err != nil {
+				return err
+			}
+			reply, err := s.greet(ctx, StreamMessage, req.Locale, MessageData{Name: req.Name, N: int(i) + 1, Count: n})
+			if err != nil {
+				return err
+			}
+			if err := emit(reply); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// streamShape returns the reply count and interval req asks for, applying
+// the defaults and rejecting values over the caps with InvalidArgument.
+func (s *Service) streamShape(req *pb.HelloRequest) (int32, time.Duration, error) {
+	count := int32(defaultStreamCount)
+	if req.Count != nil {
+		count = req.GetCount()
+	}
+	interval := s.streamInterval
+	if req.Interval != nil {
+		if err := req.Interval.CheckValid(); err != nil {
+			return 0, 0, fieldViolation("interval", err.Error())
+		}
+		interval = req.Interval.AsDuration()
+	}
+	switch {
+	case count < 0:
+		return 0, 0, fieldViolation("count", "must not be negative")
+	case s.maxStreamCount > 0 && count > s.maxStreamCount:
+		return 0, 0, fieldViolation("count", fmt.Sprintf("must be at most %d", s.maxStreamCount))
+	case interval < 0:
+		return 0, 0, fieldViolation("interval", "must not be negative")
+	case s.maxStreamInterval > 0 && interval > s.maxStreamInterval:
+		return 0, 0, fieldViolation("interval", fmt.Sprintf("must be at most %v", s.maxStreamInterval))
+	}
+	return count, interval, nil
+}
+
+// fieldViolation returns InvalidArgument with a BadRequest detail for field.
+func fieldViolation(field, description string) error {
+	return statusWithDetails(codes.InvalidArgument, "invalid "+field+": "+description, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: description}},
+	})
+}
+
+// sayHelloChat greets each request recv returns as soon as it arrives.
+func (s *Service) sayHelloChat(ctx context.Context, recv func() (*pb.HelloRequest, error), send func(*pbv2.HelloReply) error) error {
+	s.setServedBy(ctx)
+	ctx = s.assignVariant(ctx)
+	send, stop := s.withHeartbeat(ctx, send)
+	defer stop()
+	for {
+		req, err := recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.checkRequest(ctx, req); err != nil {
+			return err
+		}
+		count, err := s.increment(ctx, req.Name)
+		if err != nil {
+			return err
+		}
+		reply, err := s.greet(ctx, HelloMessage, req.Locale, MessageData{Name: req.Name, Count: count})
+		if err != nil {
+			return err
+		}
+		if err := send(reply); err != nil {
+			return err
+		}
+	}
+}
+
+// sayHelloBatch greets every name recv returns in a single reply.
+func (s *Service) sayHelloBatch(ctx context.Context, recv func() (*pb.HelloRequest, error)) (*pbv2.HelloReply, error) {
+	s.setServedBy(ctx)
+	ctx = s.assignVariant(ctx)
+	var names []string
+	// The first request's locale applies to the whole batch
+	var locale string
+	for {
+		req, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s.maxBatch > 0 && len(names) == s.maxBatch {
+			return nil, status.Errorf(codes.ResourceExhausted, "batch exceeds the maximum of %d names", s.maxBatch)
+		}
+		if err := s.checkRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		if _, err := s.increment(ctx, req.Name); err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			locale = req.Locale
+		}
+		names = append(names, req.Name)
+	}
+
+	return s.greet(ctx, BatchMessage, locale, MessageData{Names: names, Count: int64(len(names))})
+}
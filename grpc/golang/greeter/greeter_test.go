@@ -0,0 +1,724 @@
+package greeter_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestSayHelloChat(t *testing.T) {
+	client := testutil.Start(t).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SayHelloChat(ctx)
+	if err != nil {
+		t.Fatalf("SayHelloChat: %v", err)
+	}
+
+	// Send several requests before reading any replies, then interleave.
+	var sent, received int
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			sent++
+			if err := stream.Send(&pb.HelloRequest{Name: fmt.Sprintf("name-%d", sent)}); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+		}
+	}
+	recv := func(n int) {
+		for i := 0; i < n; i++ {
+			received++
+			resp, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+			if want := fmt.Sprintf("Hello, name-%d!", received); resp.Message != want {
+				t.Errorf("got message %q, want %q", resp.Message, want)
+			}
+			if resp.GreetingCount != 1 {
+				t.Errorf("got count %d for a new name, want 1", resp.GreetingCount)
+			}
+		}
+	}
+	send(5)
+	recv(2)
+	send(3)
+	recv(6)
+	send(1)
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend: %v", err)
+	}
+	recv(1)
+
+	if _, err := stream.Recv(); err == nil {
+		t.Fatal("expected the stream to end after CloseSend")
+	} else if ctx.Err() != nil {
+		t.Fatalf("stream did not finish before the deadline: %v", err)
+	}
+}
+
+func sayHelloBatch(t *testing.T, client pb.GreeterClient, names ...string) (*pb.HelloReply, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SayHelloBatch(ctx)
+	if err != nil {
+		t.Fatalf("SayHelloBatch: %v", err)
+	}
+	for _, name := range names {
+		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
+			// The server may reject the batch before every name is sent;
+			// the status is reported by CloseAndRecv.
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestSayHelloBatch(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithMaxBatch(3))).Client
+
+	resp, err := sayHelloBatch(t, client, "Alice", "Bob", "Carol")
+	if err != nil {
+		t.Fatalf("SayHelloBatch: %v", err)
+	}
+	if resp.Message != "Hello Alice, Bob, Carol" || resp.GreetingCount != 3 {
+		t.Errorf("got %q (Count: %d)", resp.Message, resp.GreetingCount)
+	}
+}
+
+func TestSayHelloBatchEmpty(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithMaxBatch(3))).Client
+
+	resp, err := sayHelloBatch(t, client)
+	if err != nil {
+		t.Fatalf("SayHelloBatch: %v", err)
+	}
+	if resp.Message != "Hello" || resp.GreetingCount != 0 {
+		t.Errorf("got %q (Count: %d)", resp.Message, resp.GreetingCount)
+	}
+}
+
+func TestSayHelloBatchOverLimit(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithMaxBatch(3))).Client
+
+	_, err := sayHelloBatch(t, client, "Alice", "Bob", "Carol", "Dave")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("got %v, want ResourceExhausted", err)
+	}
+}
+
+func TestSayHelloConcurrent(t *testing.T) {
+	counts := store.NewMemoryStore()
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithCountStore(counts))).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const goroutines, calls = 50, 20
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "crowd"}); err != nil {
+					t.Errorf("SayHello: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, err := counts.Get(ctx, "crowd"); err != nil || got != goroutines*calls {
+		t.Errorf("Get(crowd) = %d, %v; want %d", got, err, goroutines*calls)
+	}
+	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "crowd"})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.GreetingCount != goroutines*calls+1 {
+		t.Errorf("got count %d, want %d", resp.GreetingCount, goroutines*calls+1)
+	}
+}
+
+// sayHelloStreamErr opens SayHelloStream and returns the first error it reports.
+func sayHelloStreamErr(ctx context.Context, client pb.GreeterClient, name string) error {
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: name})
+	if err != nil {
+		return err
+	}
+	_, err = stream.Recv()
+	return err
+}
+
+// sayHelloChatErr sends name on SayHelloChat and returns the error the
+// stream ends with, if any.
+func sayHelloChatErr(ctx context.Context, client pb.GreeterClient, name string) error {
+	stream, err := client.SayHelloChat(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil && err != io.EOF {
+		return err
+	}
+	stream.CloseSend()
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// sayHelloBatchErr sends names on SayHelloBatch and returns its error.
+func sayHelloBatchErr(ctx context.Context, client pb.GreeterClient, names ...string) error {
+	stream, err := client.SayHelloBatch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := stream.Send(&pb.HelloRequest{Name: name}); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func TestInvalidName(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithMaxNameLength(5))).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name      string
+		reqName   string
+		violation string
+	}{
+		{"empty", "", "must not be empty"},
+		{"too long", "Bartholomew", "must be at most 5 characters"},
+	}
+	calls := map[string]func(string) error{
+		"SayHello": func(name string) error {
+			_, err := client.SayHello(ctx, &pb.HelloRequest{Name: name})
+			return err
+		},
+		"SayHelloStream": func(name string) error { return sayHelloStreamErr(ctx, client, name) },
+		// Stream requests are checked without the validation interceptors
+		"SayHelloChat":  func(name string) error { return sayHelloChatErr(ctx, client, name) },
+		"SayHelloBatch": func(name string) error { return sayHelloBatchErr(ctx, client, "Alice", name) },
+	}
+	for method, call := range calls {
+		for _, tt := range tests {
+			t.Run(method+"/"+tt.name, func(t *testing.T) {
+				st := status.Convert(call(tt.reqName))
+				if st.Code() != codes.InvalidArgument {
+					t.Fatalf("got %v, want InvalidArgument", st.Err())
+				}
+				details := st.Details()
+				if len(details) != 1 {
+					t.Fatalf("got details %v, want one BadRequest", details)
+				}
+				br, ok := details[0].(*errdetails.BadRequest)
+				if !ok {
+					t.Fatalf("got detail %T, want *errdetails.BadRequest", details[0])
+				}
+				violations := br.GetFieldViolations()
+				if len(violations) != 1 || violations[0].GetField() != "name" || violations[0].GetDescription() != tt.violation {
+					t.Errorf("got violations %v, want name: %s", violations, tt.violation)
+				}
+			})
+		}
+	}
+
+	// Names at the limit are accepted, counted in characters rather than bytes
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Renée"}); err != nil {
+		t.Errorf("SayHello(Renée): %v", err)
+	}
+}
+
+func TestClientQuota(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithClientQuota(2, time.Hour))).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	_, unaryErr := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"})
+	for method, err := range map[string]error{
+		"SayHello":       unaryErr,
+		"SayHelloStream": sayHelloStreamErr(ctx, client, "Alice"),
+		"SayHelloChat":   sayHelloChatErr(ctx, client, "Alice"),
+		"SayHelloBatch":  sayHelloBatchErr(ctx, client, "Alice"),
+	} {
+		st := status.Convert(err)
+		if st.Code() != codes.ResourceExhausted {
+			t.Fatalf("%s: got %v, want ResourceExhausted", method, err)
+		}
+		details := st.Details()
+		if len(details) != 1 {
+			t.Fatalf("%s: got details %v, want one QuotaFailure", method, details)
+		}
+		qf, ok := details[0].(*errdetails.QuotaFailure)
+		if !ok {
+			t.Fatalf("%s: got detail %T, want *errdetails.QuotaFailure", method, details[0])
+		}
+		if v := qf.GetViolations(); len(v) != 1 || v[0].GetSubject() != "client:bufconn" {
+			t.Errorf("%s: got violations %v, want one for client:bufconn", method, v)
+		}
+	}
+}
+
+func TestServedByHeader(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithHostname("replica-1"))).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var header metadata.MD
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if got := header.Get(greeter.ServedByHeader); len(got) != 1 || got[0] != "replica-1" {
+		t.Errorf("SayHello header %s = %q, want replica-1", greeter.ServedByHeader, got)
+	}
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	header, err = stream.Header()
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	if got := header.Get(greeter.ServedByHeader); len(got) != 1 || got[0] != "replica-1" {
+		t.Errorf("SayHelloStream header %s = %q, want replica-1", greeter.ServedByHeader, got)
+	}
+}
+
+func TestLocales(t *testing.T) {
+	client := testutil.Start(t).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		locale   string
+		want     string
+		fallback bool
+	}{
+		{"", "Hello, Alice!", false},
+		{"en", "Hello, Alice!", false},
+		{"es", "¡Hola, Alice!", false},
+		{"fr", "Bonjour, Alice !", false},
+		{"de", "Hallo, Alice!", false},
+		{"hi", "नमस्ते, Alice!", false},
+		{"pt-BR", "Hello, Alice!", true},
+	}
+	for i, tt := range tests {
+		// A new name each time keeps the repeat greeting out of the way
+		name := fmt.Sprintf("Alice%d", i)
+		tt.want = strings.ReplaceAll(tt.want, "Alice", name)
+		var header metadata.MD
+		resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: name, Locale: tt.locale}, grpc.Header(&header))
+		if err != nil {
+			t.Fatalf("SayHello in %q: %v", tt.locale, err)
+		}
+		if resp.Message != tt.want {
+			t.Errorf("SayHello in %q: got %q, want %q", tt.locale, resp.Message, tt.want)
+		}
+		got := header.Get(greeter.FallbackHeader)
+		if tt.fallback && (len(got) != 1 || got[0] != "true") {
+			t.Errorf("SayHello in %q: header %s = %q, want true", tt.locale, greeter.FallbackHeader, got)
+		}
+		if !tt.fallback && len(got) != 0 {
+			t.Errorf("SayHello in %q: unexpected header %s = %q", tt.locale, greeter.FallbackHeader, got)
+		}
+	}
+}
+
+func TestLocaleStreams(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0))).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice", Locale: "es"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if want := "¡Hola 1, Alice!"; resp.Message != want {
+		t.Errorf("SayHelloStream: got %q, want %q", resp.Message, want)
+	}
+
+	batch, err := client.SayHelloBatch(ctx)
+	if err != nil {
+		t.Fatalf("SayHelloBatch: %v", err)
+	}
+	for _, name := range []string{"Alice", "Bob"} {
+		if err := batch.Send(&pb.HelloRequest{Name: name, Locale: "xx"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if resp, err = batch.CloseAndRecv(); err != nil {
+		t.Fatalf("CloseAndRecv: %v", err)
+	}
+	if want := "Hello Alice, Bob"; resp.Message != want {
+		t.Errorf("SayHelloBatch: got %q, want %q", resp.Message, want)
+	}
+	header, err := batch.Header()
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	if got := header.Get(greeter.FallbackHeader); len(got) != 1 || got[0] != "true" {
+		t.Errorf("SayHelloBatch header %s = %q, want true", greeter.FallbackHeader, got)
+	}
+}
+
+func TestListGreetings(t *testing.T) {
+	client := testutil.Start(t).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	names := []string{"Alice", "Bob", "Carol", "Dave", "Erin"}
+	for _, name := range names {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: name}); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+	}
+
+	var got []string
+	var sizes []int
+	req := &pb.ListGreetingsRequest{PageSize: 2}
+	for {
+		resp, err := client.ListGreetings(ctx, req)
+		if err != nil {
+			t.Fatalf("ListGreetings: %v", err)
+		}
+		sizes = append(sizes, len(resp.Greetings))
+		for _, g := range resp.Greetings {
+			if want := "Hello, " + g.Name + "!"; g.Message != want {
+				t.Errorf("greeting for %s has message %q, want %q", g.Name, g.Message, want)
+			}
+			if g.Timestamp.AsTime().IsZero() {
+				t.Errorf("greeting for %s has no timestamp", g.Name)
+			}
+			got = append(got, g.Name)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if fmt.Sprint(got) != fmt.Sprint(names) {
+		t.Errorf("listed %v, want %v", got, names)
+	}
+	if fmt.Sprint(sizes) != "[2 2 1]" {
+		t.Errorf("got page sizes %v, want [2 2 1]", sizes)
+	}
+
+	// A page that ends exactly at the last greeting has no next token
+	resp, err := client.ListGreetings(ctx, &pb.ListGreetingsRequest{PageSize: int32(len(names))})
+	if err != nil {
+		t.Fatalf("ListGreetings: %v", err)
+	}
+	if len(resp.Greetings) != len(names) || resp.NextPageToken != "" {
+		t.Errorf("got %d greetings and token %q, want %d and no token", len(resp.Greetings), resp.NextPageToken, len(names))
+	}
+}
+
+func TestListGreetingsInvalid(t *testing.T) {
+	client := testutil.Start(t).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, name := range []string{"Alice", "Bob"} {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: name}); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+	}
+	resp, err := client.ListGreetings(ctx, &pb.ListGreetingsRequest{PageSize: 1})
+	if err != nil {
+		t.Fatalf("ListGreetings: %v", err)
+	}
+	token := resp.NextPageToken
+
+	for _, req := range []*pb.ListGreetingsRequest{
+		{PageSize: -1},
+		{PageToken: "not a token"},
+		{PageToken: token[:len(token)-2]},
+		{PageToken: token + "AA"},
+		{PageToken: strings.ToUpper(token)},
+		{PageToken: base64.RawURLEncoding.EncodeToString([]byte(`{"after":-1}`))},
+	} {
+		if _, err := client.ListGreetings(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("ListGreetings(%v): got %v, want InvalidArgument", req, err)
+		}
+	}
+}
+
+func TestServedAtAndBy(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(
+		greeter.WithHostname("host-1"),
+		greeter.WithInstanceID("replica-a"),
+		greeter.WithStreamInterval(time.Millisecond),
+	)).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	before := time.Now()
+	var header metadata.MD
+	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.ServedBy != "replica-a" {
+		t.Errorf("SayHello served_by = %q, want replica-a", resp.ServedBy)
+	}
+	if got := header.Get(greeter.ServedByHeader); len(got) != 1 || got[0] != "replica-a" {
+		t.Errorf("SayHello header %s = %q, want replica-a", greeter.ServedByHeader, got)
+	}
+	if at := resp.ServedAt.AsTime(); at.Before(before.Truncate(time.Microsecond)) || at.After(time.Now()) {
+		t.Errorf("SayHello served_at %v is outside the call", at)
+	}
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	var last time.Time
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if resp.ServedBy != "replica-a" {
+			t.Errorf("SayHelloStream served_by = %q, want replica-a", resp.ServedBy)
+		}
+		if resp.ServedAt == nil {
+			t.Fatalf("SayHelloStream reply %q has no served_at", resp.Message)
+		}
+		at := resp.ServedAt.AsTime()
+		if at.Before(last) {
+			t.Errorf("SayHelloStream served_at went back from %v to %v", last, at)
+		}
+		last = at
+	}
+}
+
+// recvAll reads stream to the end, returning the replies and the error that
+// ended it, if not io.EOF.
+func recvAll(stream pb.Greeter_SayHelloStreamClient) ([]*pb.HelloReply, error) {
+	var replies []*pb.HelloReply
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return replies, nil
+		}
+		if err != nil {
+			return replies, err
+		}
+		replies = append(replies, resp)
+	}
+}
+
+func TestSayHelloStreamCountAndInterval(t *testing.T) {
+	client := testutil.Start(t, testutil.WithGreeterOptions(
+		greeter.WithMaxStreamCount(50),
+		greeter.WithMaxStreamInterval(time.Second),
+	)).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name      string
+		req       *pb.HelloRequest
+		want      int
+		violation string
+	}{
+		{"empty stream", &pb.HelloRequest{Name: "Alice", Count: proto.Int32(0)}, 0, ""},
+		{"requested count", &pb.HelloRequest{Name: "Alice", Count: proto.Int32(3), Interval: durationpb.New(0)}, 3, ""},
+		{"at the cap", &pb.HelloRequest{Name: "Alice", Count: proto.Int32(50), Interval: durationpb.New(0)}, 50, ""},
+		{"over the cap", &pb.HelloRequest{Name: "Alice", Count: proto.Int32(1_000_000)}, 0, "count: must be at most 50"},
+		{"negative count", &pb.HelloRequest{Name: "Alice", Count: proto.Int32(-1)}, 0, "count: must not be negative"},
+		{"interval over the cap", &pb.HelloRequest{Name: "Alice", Interval: durationpb.New(time.Hour)}, 0, "interval: must be at most 1s"},
+		{"negative interval", &pb.HelloRequest{Name: "Alice", Interval: durationpb.New(-time.Second)}, 0, "interval: must not be negative"},
+		{"resumed", &pb.HelloRequest{Name: "Alice", Count: proto.Int32(5), Interval: durationpb.New(0), ResumeFrom: 2}, 3, ""},
+		{"resumed past the end", &pb.HelloRequest{Name: "Alice", Count: proto.Int32(5), ResumeFrom: 7}, 0, ""},
+		{"negative resume_from", &pb.HelloRequest{Name: "Alice", ResumeFrom: -1}, 0, "resume_from: must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.SayHelloStream(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("SayHelloStream: %v", err)
+			}
+			replies, err := recvAll(stream)
+			if tt.violation != "" {
+				if status.Code(err) != codes.InvalidArgument || status.Convert(err).Message() != "invalid "+tt.violation {
+					t.Errorf("got %v, want InvalidArgument: invalid %s", err, tt.violation)
+				}
+				return
+			}
+			if err != nil || len(replies) != tt.want {
+				t.Errorf("got %d replies and %v, want %d and no error", len(replies), err, tt.want)
+			}
+		})
+	}
+
+	// The requested interval applies between replies
+	start := time.Now()
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Bob", Count: proto.Int32(3), Interval: durationpb.New(50 * time.Millisecond)})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	if replies, err := recvAll(stream); err != nil || len(replies) != 3 {
+		t.Fatalf("got %d replies and %v, want 3", len(replies), err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("3 replies 50ms apart took %v", elapsed)
+	}
+}
+
+func TestSayHelloStreamResume(t *testing.T) {
+	client := testutil.Start(t).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice", Count: proto.Int32(4), Interval: durationpb.New(0), ResumeFrom: 2})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get(greeter.ResumedFromHeader); len(got) != 1 || got[0] != "2" {
+		t.Errorf("%s header = %q, want 2", greeter.ResumedFromHeader, got)
+	}
+	replies, err := recvAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range replies {
+		got = append(got, r.Message)
+	}
+	if want := []string{"Hello 3, Alice!", "Hello 4, Alice!"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGetGreetingCount(t *testing.T) {
+	client := testutil.Start(t).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	for name, times := range map[string]int{"Alice": 3, "Bob": 2} {
+		for i := 0; i < times; i++ {
+			if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: name}); err != nil {
+				t.Fatalf("SayHello: %v", err)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		req      *pb.GetCountRequest
+		want     int64
+		wantCode codes.Code
+	}{
+		{"per name", &pb.GetCountRequest{Name: "Alice"}, 3, codes.OK},
+		{"other name", &pb.GetCountRequest{Name: "Bob", Strict: true}, 2, codes.OK},
+		{"total", &pb.GetCountRequest{}, 5, codes.OK},
+		{"never greeted", &pb.GetCountRequest{Name: "Carol"}, 0, codes.OK},
+		{"never greeted strict", &pb.GetCountRequest{Name: "Carol", Strict: true}, 0, codes.NotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.GetGreetingCount(ctx, tt.req)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("got %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if resp.Count != tt.want {
+				t.Errorf("count = %d, want %d", resp.Count, tt.want)
+			}
+			if greeted := resp.LastGreeted != nil; greeted != (tt.want > 0) {
+				t.Errorf("last_greeted = %v for a count of %d", resp.LastGreeted, tt.want)
+			} else if greeted && resp.LastGreeted.AsTime().Before(start) {
+				t.Errorf("last_greeted %v is before the greetings started at %v", resp.LastGreeted.AsTime(), start)
+			}
+		})
+	}
+
+	// Reading the count does not greet
+	if resp, _ := client.GetGreetingCount(ctx, &pb.GetCountRequest{}); resp.GetCount() != 5 {
+		t.Errorf("total after reading counts = %d, want 5", resp.GetCount())
+	}
+}
+
+func TestSayHelloStreamStopsOnCancel(t *testing.T) {
+	counts := store.NewMemoryStore()
+	client := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithCountStore(counts))).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	streamCtx, streamCancel := context.WithCancel(ctx)
+	stream, err := client.SayHelloStream(streamCtx, &pb.HelloRequest{Name: "Alice", Count: proto.Int32(1000), Interval: durationpb.New(20 * time.Millisecond)})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+	}
+	streamCancel()
+
+	// Give the server time to notice, then check it sends nothing more
+	time.Sleep(100 * time.Millisecond)
+	sent, err := counts.Get(ctx, "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent > 3 {
+		t.Errorf("server sent %d replies after a cancel following 2", sent)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if later, _ := counts.Get(ctx, "Alice"); later != sent {
+		t.Errorf("server kept sending after the cancel: %d replies, then %d", sent, later)
+	}
+}
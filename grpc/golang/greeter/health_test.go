@@ -0,0 +1,68 @@
+package greeter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthCheck(t *testing.T) {
+	ts := testutil.Start(t)
+	client := healthpb.NewHealthClient(ts.Conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, service := range []string{"", pb.Greeter_ServiceDesc.ServiceName} {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check(%q): %v", service, err)
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Check(%q) = %v, want SERVING", service, resp.Status)
+		}
+	}
+
+	ts.Service.SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: pb.Greeter_ServiceDesc.ServiceName})
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Check = %v, want NOT_SERVING", resp.Status)
+	}
+	if got := ts.Service.ServingStatus(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("ServingStatus = %v, want NOT_SERVING", got)
+	}
+}
+
+func TestHealthWatch(t *testing.T) {
+	ts := testutil.Start(t)
+	client := healthpb.NewHealthClient(ts.Conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: pb.Greeter_ServiceDesc.ServiceName})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("initial status %v, want SERVING", resp.Status)
+	}
+
+	ts.Service.SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status after transition %v, want NOT_SERVING", resp.Status)
+	}
+}
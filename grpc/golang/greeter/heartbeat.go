@@ -0,0 +1,79 @@
+package greeter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+)
+
+// WithHeartbeatInterval makes SayHelloStream and SayHelloChat send a
+// heartbeat, a reply with is_heartbeat set and nothing else, whenever no
+// reply has gone out for d, so proxies that drop idle connections keep a
+// quiet stream open. Zero, the default, sends none.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(s *Service) { s.heartbeatInterval = d }
+}
+
+// withHeartbeat returns send wrapped to record when each reply goes out,
+// sending a heartbeat between replies whenever the stream has been idle for
+// the heartbeat interval, and a func stopping the heartbeats, to be called
+// before the handler returns. Sends are serialized, so send need not be
+// safe for concurrent use. Without a heartbeat interval send is returned
+// as it is.
+func (s *Service) withHeartbeat(ctx context.Context, send func(*pbv2.HelloReply) error) (func(*pbv2.HelloReply) error, func()) {
+	interval := s.heartbeatInterval
+	if interval <= 0 {
+		return send, func() {}
+	}
+	var (
+		mu   sync.Mutex
+		last = s.now()
+	)
+	done := make(chan struct{})
+	go func() {
+		wait := interval
+		for {
+			select {
+			case <-s.after(wait):
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+			mu.Lock()
+			select {
+			case <-done:
+				mu.Unlock()
+				return
+			default:
+			}
+			// A reply may have gone out since the wait began
+			if idle := s.now().Sub(last); idle < interval {
+				wait = interval - idle
+				mu.Unlock()
+				continue
+			}
+			err := send(&pbv2.HelloReply{IsHeartbeat: true})
+			last, wait = s.now(), interval
+			mu.Unlock()
+			if err != nil {
+				// The handler's next send fails the same way
+				return
+			}
+		}
+	}()
+
+	tracked := func(reply *pbv2.HelloReply) error {
+		mu.Lock()
+		defer mu.Unlock()
+		err := send(reply)
+		last = s.now()
+		return err
+	}
+	// Closing done does not wait for a heartbeat stuck sending to a client
+	// that stopped reading; ending the stream unblocks it, as it does the
+	// sendWorker
+	return tracked, func() { close(done) }
+}
@@ -0,0 +1,152 @@
+package greeter
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+)
+
+// fakeClock stands in for time.Now and time.After, firing the channels
+// returned by After only when Advance moves past their time.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	// armed receives a value each time After is called.
+	armed chan struct{}
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0), armed: make(chan struct{}, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := waiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	c.armed <- struct{}{}
+	return w.c
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiting
+}
+
+// chat runs sayHelloChat on s with the heartbeat timed by clock, returning
+// channels to send it requests and receive its replies. The chat ends with
+// the test.
+func chat(t *testing.T, s *Service, clock *fakeClock) (chan<- *pb.HelloRequest, <-chan *pbv2.HelloReply) {
+	t.Helper()
+	s.now, s.after = clock.Now, clock.After
+	ctx, cancel := context.WithCancel(context.Background())
+	requests := make(chan *pb.HelloRequest)
+	replies := make(chan *pbv2.HelloReply, 16)
+	recv := func() (*pb.HelloRequest, error) {
+		select {
+		case req := <-requests:
+			return req, nil
+		case <-ctx.Done():
+			return nil, io.EOF
+		}
+	}
+	send := func(reply *pbv2.HelloReply) error {
+		replies <- reply
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.sayHelloChat(ctx, recv, send) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("chat: %v", err)
+		}
+	})
+	return requests, replies
+}
+
+// expectNoReply fails the test if a reply is waiting. The heartbeat
+// goroutine is known to be idle when it has just armed a wait, so nothing
+// can be on its way.
+func expectNoReply(t *testing.T, replies <-chan *pbv2.HelloReply) {
+	t.Helper()
+	select {
+	case reply := <-replies:
+		t.Fatalf("got unexpected reply %v", reply)
+	default:
+	}
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	clock := newFakeClock()
+	_, replies := chat(t, New(WithHeartbeatInterval(10*time.Second)), clock)
+	<-clock.armed
+
+	clock.Advance(9 * time.Second)
+	expectNoReply(t, replies)
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		if reply := <-replies; !reply.IsHeartbeat || reply.Greeting != "" || reply.GreetingCount != 0 {
+			t.Fatalf("got %v, want a bare heartbeat", reply)
+		}
+		<-clock.armed
+		expectNoReply(t, replies)
+		clock.Advance(9 * time.Second)
+		expectNoReply(t, replies)
+	}
+}
+
+func TestHeartbeatSuppressedByTraffic(t *testing.T) {
+	clock := newFakeClock()
+	requests, replies := chat(t, New(WithHeartbeatInterval(10*time.Second)), clock)
+	<-clock.armed
+
+	gap := 9 * time.Second
+	for i := 0; i < 3; i++ {
+		// Greet just before the wait armed runs out
+		clock.Advance(gap)
+		requests <- &pb.HelloRequest{Name: "Ada"}
+		if reply := <-replies; reply.IsHeartbeat {
+			t.Fatal("got a heartbeat, want a greeting")
+		}
+		// The wait runs out a second after the greeting and is armed again
+		// for the rest of the interval since it
+		clock.Advance(time.Second)
+		<-clock.armed
+		expectNoReply(t, replies)
+		gap = 8 * time.Second
+	}
+
+	// Once the greetings stop a heartbeat follows the interval after the last
+	clock.Advance(9 * time.Second)
+	if reply := <-replies; !reply.IsHeartbeat {
+		t.Fatalf("got %v, want a heartbeat", reply)
+	}
+}
@@ -0,0 +1,99 @@
+package greeter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/shrivatsas/exp-codegen/grpc/compat"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// defaultHistorySize is how many greetings the default history keeps.
+	defaultHistorySize = 10000
+	// defaultPageSize is used when a ListGreetings request has no page size.
+	defaultPageSize = 50
+	// maxPageSize caps the page size of ListGreetings requests.
+	maxPageSize = 1000
+)
+
+// cursor is the position encoded in a page token.
+type cursor struct {
+	// After is the Seq of the last greeting already returned.
+	After int64 `json:"after"`
+}
+
+func (c cursor) token() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// parseToken decodes a page token produced by cursor.token, reporting false
+// for anything else.
+func parseToken(token string) (cursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor{}, false
+	}
+	var c cursor
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil || dec.More() || c.After <= 0 {
+		return cursor{}, false
+	}
+	return c, true
+}
+
+// ListGreetings implements the ListGreetings RPC method, paging through the
+// recorded greetings oldest first.
+func (s *Service) ListGreetings(ctx context.Context, req *pb.ListGreetingsRequest) (*pb.ListGreetingsResponse, error) {
+	resp, err := s.listGreetings(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1ListGreetingsResponse(resp), nil
+}
+
+func (s *Service) listGreetings(ctx context.Context, req *pb.ListGreetingsRequest) (*pbv2.ListGreetingsResponse, error) {
+	s.setServedBy(ctx)
+	pageSize := int(req.PageSize)
+	switch {
+	case pageSize < 0:
+		return nil, fieldViolation("page_size", fmt.Sprintf("must not be negative, got %d", pageSize))
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+	var pos cursor
+	if req.PageToken != "" {
+		var ok bool
+		if pos, ok = parseToken(req.PageToken); !ok {
+			return nil, fieldViolation("page_token", "not one from a previous response")
+		}
+	}
+
+	greetings, more, err := s.history.List(ctx, pos.After, pageSize)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "listing greetings: %v", err)
+	}
+	resp := &pbv2.ListGreetingsResponse{}
+	for _, g := range greetings {
+		resp.Greetings = append(resp.Greetings, &pbv2.GreetingRecord{
+			Name:      g.Name,
+			Greeting:  g.Message,
+			GreetedAt: timestamppb.New(g.Time),
+		})
+	}
+	if more && len(greetings) > 0 {
+		resp.NextPageToken = cursor{After: greetings[len(greetings)-1].Seq}.token()
+	}
+	return resp, nil
+}
@@ -0,0 +1,59 @@
+package greeter
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FuzzPageToken checks that decoding page tokens never panics, that only
+// tokens for a positive position are accepted and re-encode to an
+// equivalent token, and that ListGreetings turns any other token into
+// InvalidArgument.
+func FuzzPageToken(f *testing.F) {
+	token := cursor{After: 42}.token()
+	for _, seed := range []string{
+		"",
+		token,
+		token[:len(token)-3],
+		token + "=",
+		strings.Repeat(token, 1<<10),
+		"\xff\xfe",
+		base64.RawURLEncoding.EncodeToString([]byte(`{"after":0}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"after":1}{"after":2}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"after":1e30}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"after":1,"before":2}`)),
+	} {
+		f.Add(seed)
+	}
+	s := New()
+	if _, err := s.SayHello(context.Background(), &pb.HelloRequest{Name: "Alice"}); err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, token string) {
+		c, ok := parseToken(token)
+		if ok {
+			if c.After <= 0 {
+				t.Fatalf("parseToken(%q) accepted position %d", token, c.After)
+			}
+			if again, ok := parseToken(c.token()); !ok || again != c {
+				t.Fatalf("token for %+v does not round trip: got %+v, %v", c, again, ok)
+			}
+		}
+		_, err := s.ListGreetings(context.Background(), &pb.ListGreetingsRequest{PageToken: token})
+		switch {
+		case token == "" || ok:
+			if err != nil {
+				t.Fatalf("ListGreetings rejected a valid token: %v", err)
+			}
+		case status.Code(err) != codes.InvalidArgument:
+			t.Fatalf("ListGreetings(%q): got %v, want InvalidArgument", token, err)
+		}
+	})
+}
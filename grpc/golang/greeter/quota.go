@@ -0,0 +1,77 @@
+package greeter
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/peer"
+)
+
+// quota limits each client to a number of greetings per fixed window.
+type quota struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*quotaWindow
+	// swept is when expired windows were last removed from clients.
+	swept time.Time
+}
+
+type quotaWindow struct {
+	start time.Time
+	used  int
+}
+
+func newQuota(limit int, window time.Duration) *quota {
+	return &quota{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		clients: make(map[string]*quotaWindow),
+	}
+}
+
+// allow records a request from client and reports whether it is within the quota.
+func (q *quota) allow(client string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	if now.Sub(q.swept) >= q.window {
+		for c, w := range q.clients {
+			if now.Sub(w.start) >= q.window {
+				delete(q.clients, c)
+			}
+		}
+		q.swept = now
+	}
+
+	w, ok := q.clients[client]
+	if !ok || now.Sub(w.start) >= q.window {
+		w = &quotaWindow{start: now}
+		q.clients[client] = w
+	}
+	if w.used >= q.limit {
+		return false
+	}
+	w.used++
+	return true
+}
+
+// clientID identifies the caller by peer host, so all connections from one
+// address share a quota.
+func clientID(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
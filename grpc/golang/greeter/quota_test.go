@@ -0,0 +1,29 @@
+package greeter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuotaWindow(t *testing.T) {
+	now := time.Unix(0, 0)
+	q := newQuota(2, time.Minute)
+	q.now = func() time.Time { return now }
+
+	for i, want := range []bool{true, true, false} {
+		if got := q.allow("alice"); got != want {
+			t.Errorf("call %d: allow = %v, want %v", i+1, got, want)
+		}
+	}
+	if !q.allow("bob") {
+		t.Error("bob was limited by alice's quota")
+	}
+
+	now = now.Add(time.Minute)
+	if !q.allow("alice") {
+		t.Error("alice is still limited after the window elapsed")
+	}
+	if _, ok := q.clients["bob"]; ok {
+		t.Error("bob's expired window was not swept")
+	}
+}
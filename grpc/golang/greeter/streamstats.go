@@ -0,0 +1,58 @@
+package greeter
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Trailers reporting what SayHelloStream and SayHelloChat sent, so clients
+// can tell messages lost on the way, e.g. by a proxy, from ones never sent.
+const (
+	// StreamMsgCountTrailer is the number of messages sent, heartbeats
+	// included.
+	StreamMsgCountTrailer = "x-stream-msg-count"
+	// StreamBytesTrailer is the encoded size of the messages sent.
+	StreamBytesTrailer = "x-stream-bytes"
+	// StreamDurationTrailer is how long the server spent on the stream, in
+	// milliseconds.
+	StreamDurationTrailer = "x-stream-duration-ms"
+)
+
+// streamStats counts what a stream handler sends. A send may outlive the
+// handler when it times out, so the counts are atomic.
+type streamStats struct {
+	start time.Time
+	now   func() time.Time
+	msgs  atomic.Int64
+	bytes atomic.Int64
+}
+
+func (s *Service) newStreamStats() *streamStats {
+	return &streamStats{start: s.now(), now: s.now}
+}
+
+// countSends returns send, counting each message it sends into st.
+func countSends[M proto.Message](st *streamStats, send func(M) error) func(M) error {
+	return func(m M) error {
+		if err := send(m); err != nil {
+			return err
+		}
+		st.msgs.Add(1)
+		st.bytes.Add(int64(proto.Size(m)))
+		return nil
+	}
+}
+
+// setTrailer sets the stream trailers on stream from the counts so far.
+// Call it as the handler returns, whether or not it succeeded.
+func (st *streamStats) setTrailer(stream grpc.ServerStream) {
+	stream.SetTrailer(metadata.Pairs(
+		StreamMsgCountTrailer, strconv.FormatInt(st.msgs.Load(), 10),
+		StreamBytesTrailer, strconv.FormatInt(st.bytes.Load(), 10),
+		StreamDurationTrailer, strconv.FormatInt(st.now().Sub(st.start).Milliseconds(), 10)))
+}
@@ -0,0 +1,119 @@
+package greeter_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// checkStreamStats fails the test unless trailer reports replies as sent.
+func checkStreamStats(t *testing.T, trailer metadata.MD, replies []*pb.HelloReply) {
+	t.Helper()
+	size := 0
+	for _, r := range replies {
+		size += proto.Size(r)
+	}
+	if got := trailer.Get(greeter.StreamMsgCountTrailer); len(got) != 1 || got[0] != strconv.Itoa(len(replies)) {
+		t.Errorf("%s = %q, want %d", greeter.StreamMsgCountTrailer, got, len(replies))
+	}
+	if got := trailer.Get(greeter.StreamBytesTrailer); len(got) != 1 || got[0] != strconv.Itoa(size) {
+		t.Errorf("%s = %q, want %d", greeter.StreamBytesTrailer, got, size)
+	}
+	got := trailer.Get(greeter.StreamDurationTrailer)
+	if len(got) != 1 {
+		t.Fatalf("%s = %q, want one value", greeter.StreamDurationTrailer, got)
+	}
+	if ms, err := strconv.Atoi(got[0]); err != nil || ms < 0 || ms > 5000 {
+		t.Errorf("%s = %q, want milliseconds within the test's deadline", greeter.StreamDurationTrailer, got[0])
+	}
+}
+
+func TestStreamStatsTrailer(t *testing.T) {
+	client := testutil.Start(t).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice", Count: proto.Int32(3), Interval: durationpb.New(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies, err := recvAll(stream)
+	if err != nil || len(replies) != 3 {
+		t.Fatalf("got %d replies, %v", len(replies), err)
+	}
+	checkStreamStats(t, stream.Trailer(), replies)
+
+	chat, err := client.SayHelloChat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Bob", "Carol"} {
+		if err := chat.Send(&pb.HelloRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chat.CloseSend()
+	replies = nil
+	for {
+		reply, err := chat.Recv()
+		if err != nil {
+			break
+		}
+		replies = append(replies, reply)
+	}
+	checkStreamStats(t, chat.Trailer(), replies)
+}
+
+// trailerStream records the trailer its handler sets.
+type trailerStream struct {
+	grpc.ServerStream
+	trailer chan metadata.MD
+}
+
+func (s trailerStream) SetTrailer(md metadata.MD) {
+	s.trailer <- md
+	s.ServerStream.SetTrailer(md)
+}
+
+func TestStreamStatsTrailerCancelled(t *testing.T) {
+	// A cancelled stream's trailer never reaches the client, so record it
+	// on the server
+	trailers := make(chan metadata.MD, 1)
+	record := grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, trailerStream{ss, trailers})
+	})
+	client := testutil.Start(t, testutil.WithServerOptions(record)).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	streamCtx, streamCancel := context.WithCancel(ctx)
+	stream, err := client.SayHelloStream(streamCtx, &pb.HelloRequest{Name: "Alice", Count: proto.Int32(5), Interval: durationpb.New(200 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replies []*pb.HelloReply
+	for i := 0; i < 2; i++ {
+		reply, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, reply)
+	}
+	streamCancel()
+
+	select {
+	case trailer := <-trailers:
+		checkStreamStats(t, trailer, replies)
+	case <-ctx.Done():
+		t.Fatal("the handler set no trailer after the cancel")
+	}
+}
@@ -0,0 +1,130 @@
+package greeter
+
+import (
+	"context"
+
+	"github.com/shrivatsas/exp-codegen/grpc/compat"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail on v2 errors.
+const ErrorDomain = "greeter.v2"
+
+// v2Service implements the v2 Greeter service on the layer shared with v1.
+type v2Service struct {
+	pbv2.UnimplementedGreeterServer
+	s *Service
+}
+
+// V2 returns the v2 Greeter service, sharing s's counts, history and
+// settings. Register adds it alongside v1.
+func (s *Service) V2() pbv2.GreeterServer {
+	return v2Service{s: s}
+}
+
+// SayHello implements the v2 SayHello RPC method.
+func (v v2Service) SayHello(ctx context.Context, req *pbv2.HelloRequest) (*pbv2.HelloReply, error) {
+	reply, err := v.s.sayHello(ctx, compat.V1HelloRequest(req))
+	return reply, v2Error(err)
+}
+
+// SayHelloStream implements the v2 SayHelloStream RPC method.
+func (v v2Service) SayHelloStream(req *pbv2.HelloRequest, stream pbv2.Greeter_SayHelloStreamServer) error {
+	stats := v.s.newStreamStats()
+	defer stats.setTrailer(stream)
+	return v2Error(v.s.sayHelloStream(stream.Context(), compat.V1HelloRequest(req), countSends(stats, stream.Send)))
+}
+
+// SayHelloChat implements the v2 SayHelloChat RPC method.
+func (v v2Service) SayHelloChat(stream pbv2.Greeter_SayHelloChatServer) error {
+	stats := v.s.newStreamStats()
+	defer stats.setTrailer(stream)
+	return v2Error(v.s.sayHelloChat(stream.Context(), v1Recv(stream.Recv), countSends(stats, stream.Send)))
+}
+
+// SayHelloBatch implements the v2 SayHelloBatch RPC method.
+func (v v2Service) SayHelloBatch(stream pbv2.Greeter_SayHelloBatchServer) error {
+	reply, err := v.s.sayHelloBatch(stream.Context(), v1Recv(stream.Recv))
+	if err != nil {
+		return v2Error(err)
+	}
+	return stream.SendAndClose(reply)
+}
+
+// ListGreetings implements the v2 ListGreetings RPC method.
+func (v v2Service) ListGreetings(ctx context.Context, req *pbv2.ListGreetingsRequest) (*pbv2.ListGreetingsResponse, error) {
+	resp, err := v.s.listGreetings(ctx, compat.V1ListGreetingsRequest(req))
+	return resp, v2Error(err)
+}
+
+// GetGreetingCount implements the v2 GetGreetingCount RPC method.
+func (v v2Service) GetGreetingCount(ctx context.Context, req *pbv2.GetCountRequest) (*pbv2.GetCountResponse, error) {
+	resp, err := v.s.getGreetingCount(ctx, compat.V1GetCountRequest(req))
+	return resp, v2Error(err)
+}
+
+// v1Recv adapts a v2 stream's Recv to the shared layer.
+func v1Recv(recv func() (*pbv2.HelloRequest, error)) func() (*pb.HelloRequest, error) {
+	return func() (*pb.HelloRequest, error) {
+		req, err := recv()
+		if err != nil {
+			return nil, err
+		}
+		return compat.V1HelloRequest(req), nil
+	}
+}
+
+// v2Error adds an ErrorInfo detail naming a pbv2.ErrorReason to a status
+// error from the shared layer. Other errors, such as a stream's transport
+// errors, are returned unchanged.
+func v2Error(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	reason := errorReason(st)
+	if reason == pbv2.ErrorReason_ERROR_REASON_UNSPECIFIED {
+		return err
+	}
+	withInfo, detailErr := st.WithDetails(&errdetails.ErrorInfo{Reason: reason.String(), Domain: ErrorDomain})
+	if detailErr != nil {
+		return err
+	}
+	return withInfo.Err()
+}
+
+// errorReason classifies st by the BadRequest or QuotaFailure detail it
+// carries, or else by its code.
+func errorReason(st *status.Status) pbv2.ErrorReason {
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				switch v.GetField() {
+				case "name":
+					return pbv2.ErrorReason_INVALID_NAME
+				case "count", "interval", "resume_from":
+					return pbv2.ErrorReason_INVALID_STREAM_REQUEST
+				case "page_size", "page_token":
+					return pbv2.ErrorReason_INVALID_PAGE
+				}
+			}
+		case *errdetails.QuotaFailure:
+			return pbv2.ErrorReason_QUOTA_EXCEEDED
+		}
+	}
+	switch st.Code() {
+	case codes.ResourceExhausted:
+		// Quotas carry a QuotaFailure, so this is the batch limit
+		return pbv2.ErrorReason_BATCH_TOO_LARGE
+	case codes.NotFound:
+		return pbv2.ErrorReason_NAME_NOT_GREETED
+	case codes.Internal:
+		return pbv2.ErrorReason_STORAGE_FAILURE
+	}
+	return pbv2.ErrorReason_ERROR_REASON_UNSPECIFIED
+}
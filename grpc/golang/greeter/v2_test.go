@@ -0,0 +1,133 @@
+package greeter_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestV2SharesCounts(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0)))
+	v1, v2 := ts.Client, pbv2.NewGreeterClient(ts.Conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if resp, err := v1.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err != nil || resp.GreetingCount != 1 {
+		t.Fatalf("v1 SayHello: got %v, %v; want count 1", resp, err)
+	}
+	resp, err := v2.SayHello(ctx, &pbv2.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatalf("v2 SayHello: %v", err)
+	}
+	if want := "Hello again, Alice! That makes 2 greetings."; resp.Greeting != want || resp.GreetingCount != 2 {
+		t.Errorf("v2 SayHello = %q, count %d; want %q and 2", resp.Greeting, resp.GreetingCount, want)
+	}
+
+	count := int32(2)
+	stream, err := v2.SayHelloStream(ctx, &pbv2.HelloRequest{Name: "Alice", Count: &count})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("v2 SayHelloStream: %v", err)
+		}
+	}
+	if resp, err := v1.GetGreetingCount(ctx, &pb.GetCountRequest{Name: "Alice"}); err != nil || resp.Count != 4 {
+		t.Errorf("v1 GetGreetingCount after two v2 greetings and a stream of 2: got %v, %v; want 4", resp, err)
+	}
+
+	list, err := v2.ListGreetings(ctx, &pbv2.ListGreetingsRequest{})
+	if err != nil {
+		t.Fatalf("v2 ListGreetings: %v", err)
+	}
+	if len(list.Greetings) != 2 || list.Greetings[0].Greeting != "Hello, Alice!" || list.Greetings[0].GreetedAt == nil {
+		t.Errorf("v2 ListGreetings = %v, want both SayHello greetings", list.Greetings)
+	}
+}
+
+func TestV2ErrorInfo(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithMaxBatch(1)))
+	v2 := pbv2.NewGreeterClient(ts.Conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	batch := func() error {
+		stream, err := v2.SayHelloBatch(ctx)
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"Alice", "Bob"} {
+			if err := stream.Send(&pbv2.HelloRequest{Name: name}); err != nil {
+				break
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	negative := int32(-1)
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+		want pbv2.ErrorReason
+	}{
+		{"empty name", func() error {
+			_, err := v2.SayHello(ctx, &pbv2.HelloRequest{})
+			return err
+		}, codes.InvalidArgument, pbv2.ErrorReason_INVALID_NAME},
+		{"negative count", func() error {
+			stream, err := v2.SayHelloStream(ctx, &pbv2.HelloRequest{Name: "Alice", Count: &negative})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		}, codes.InvalidArgument, pbv2.ErrorReason_INVALID_STREAM_REQUEST},
+		{"bad page token", func() error {
+			_, err := v2.ListGreetings(ctx, &pbv2.ListGreetingsRequest{PageToken: "nope"})
+			return err
+		}, codes.InvalidArgument, pbv2.ErrorReason_INVALID_PAGE},
+		{"never greeted", func() error {
+			_, err := v2.GetGreetingCount(ctx, &pbv2.GetCountRequest{Name: "Zed", Strict: true})
+			return err
+		}, codes.NotFound, pbv2.ErrorReason_NAME_NOT_GREETED},
+		{"batch too large", batch, codes.ResourceExhausted, pbv2.ErrorReason_BATCH_TOO_LARGE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(tt.call())
+			if st.Code() != tt.code {
+				t.Fatalf("got %v, want %v", st.Err(), tt.code)
+			}
+			var info *errdetails.ErrorInfo
+			for _, d := range st.Details() {
+				if d, ok := d.(*errdetails.ErrorInfo); ok {
+					info = d
+				}
+			}
+			if info == nil || info.Reason != tt.want.String() || info.Domain != greeter.ErrorDomain {
+				t.Errorf("ErrorInfo = %v, want reason %s in domain %s", info, tt.want, greeter.ErrorDomain)
+			}
+		})
+	}
+
+	// v1 errors are unchanged
+	_, err := ts.Client.SayHello(ctx, &pb.HelloRequest{})
+	for _, d := range status.Convert(err).Details() {
+		if _, ok := d.(*errdetails.ErrorInfo); ok {
+			t.Errorf("v1 error %v carries an ErrorInfo", err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package greeterclient
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"slices"
+	"sync"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultCacheEntries bounds a Cache whose CacheOptions set no MaxEntries.
+const defaultCacheEntries = 1000
+
+// CacheOptions configures a Cache.
+type CacheOptions struct {
+	// TTL is how long a response is reused after the call that fetched it;
+	// nothing is cached when it is zero or negative.
+	TTL time.Duration
+	// MaxEntries bounds the responses kept, evicting the least recently
+	// used; defaultCacheEntries applies when it is zero.
+	MaxEntries int
+	// Methods are the full names of the unary methods whose responses are
+	// cached. Only SayHello, of either Greeter version, is cached when it is
+	// nil. Streaming calls are never cached.
+	Methods []string
+}
+
+// Cache reuses the responses of repeated unary calls, for callers such as
+// batch jobs that greet the same names over and over. Calls are keyed by
+// method and request, so the same name in another locale is fetched apart,
+// but not by metadata. Failed calls are not cached. A Cache is safe for
+// concurrent use and may be shared by several Clients.
+type Cache struct {
+	ttl     time.Duration
+	max     int
+	methods []string
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	// lru orders the entries, most recently used first.
+	lru *list.List
+}
+
+type cacheKey struct {
+	method string
+	req    [sha256.Size]byte
+}
+
+type cacheEntry struct {
+	key             cacheKey
+	reply           proto.Message
+	header, trailer metadata.MD
+	expires         time.Time
+}
+
+// NewCache returns an empty Cache.
+func NewCache(opts CacheOptions) *Cache {
+	c := &Cache{
+		ttl:     opts.TTL,
+		max:     opts.MaxEntries,
+		methods: opts.Methods,
+		now:     time.Now,
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+	}
+	if c.max <= 0 {
+		c.max = defaultCacheEntries
+	}
+	if c.methods == nil {
+		c.methods = []string{pb.Greeter_SayHello_FullMethodName, pbv2.Greeter_SayHello_FullMethodName}
+	}
+	return c
+}
+
+// WithCache serves repeated calls from c instead of the server. It runs
+// where it is given among the interceptors, so those added before it see
+// only the calls it lets through.
+func WithCache(c *Cache) Option {
+	return WithUnaryInterceptors(c.UnaryClientInterceptor)
+}
+
+type noCacheKey struct{}
+
+// WithNoCache returns a context whose calls skip any Cache, going to the
+// server and leaving the cached response as it was.
+func WithNoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// cacheHitOption is a call option through which the cache reports a hit.
+type cacheHitOption struct {
+	grpc.EmptyCallOption
+	hit *bool
+}
+
+// UnaryClientInterceptor answers calls to the cached methods from the cache
+// while their response is fresh, including the response header and
+// trailer, and otherwise caches the response of a successful call.
+func (c *Cache) UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	reqMsg, ok := req.(proto.Message)
+	replyMsg, replyOK := reply.(proto.Message)
+	if c.ttl <= 0 || !ok || !replyOK || !slices.Contains(c.methods, method) || ctx.Value(noCacheKey{}) != nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	// Deterministic marshaling gives equal requests equal keys
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(reqMsg)
+	if err != nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	key := cacheKey{method: method, req: sha256.Sum256(data)}
+
+	if e := c.get(key); e != nil {
+		proto.Merge(replyMsg, e.reply)
+		for _, opt := range opts {
+			switch opt := opt.(type) {
+			case grpc.HeaderCallOption:
+				*opt.HeaderAddr = e.header.Copy()
+			case grpc.TrailerCallOption:
+				*opt.TrailerAddr = e.trailer.Copy()
+			case cacheHitOption:
+				*opt.hit = true
+			}
+		}
+		return nil
+	}
+
+	var header, trailer metadata.MD
+	if err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header), grpc.Trailer(&trailer))...); err != nil {
+		return err
+	}
+	c.put(&cacheEntry{key: key, reply: proto.Clone(replyMsg), header: header, trailer: trailer, expires: c.now().Add(c.ttl)})
+	return nil
+}
+
+// get returns the fresh entry for key, or nil.
+func (c *Cache) get(key cacheKey) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if !c.now().Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e
+}
+
+// put adds e, replacing any entry with its key, and evicts the least
+// recently used entries over the bound.
+func (c *Cache) put(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		c.lru.Remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of responses cached, fresh or not.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
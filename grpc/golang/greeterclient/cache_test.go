@@ -0,0 +1,157 @@
+package greeterclient
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+)
+
+// countingServer starts a test server and returns the number of unary and
+// streaming calls that reach it.
+func countingServer(t *testing.T) (*testutil.Server, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+	var unary, stream atomic.Int32
+	ts := testutil.Start(t,
+		testutil.WithGreeterOptions(greeter.WithStreamInterval(0)),
+		testutil.WithServerOptions(
+			grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				unary.Add(1)
+				return handler(ctx, req)
+			}),
+			grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				stream.Add(1)
+				return handler(srv, ss)
+			})))
+	return ts, &unary, &stream
+}
+
+func TestCache(t *testing.T) {
+	ts, unary, stream := countingServer(t)
+	cache := NewCache(CacheOptions{TTL: time.Minute})
+	c := newTestClient(t, ts, WithCache(cache))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, err := c.HelloWithMetadata(ctx, "Alice")
+	if err != nil || first.Cached || first.Count != 1 {
+		t.Fatalf("first call = %+v, %v; want a miss with count 1", first, err)
+	}
+	second, err := c.HelloWithMetadata(ctx, "Alice")
+	if err != nil || !second.Cached || second.Count != 1 || second.Message != first.Message {
+		t.Errorf("second call = %+v, %v; want a hit repeating the first", second, err)
+	}
+	if got := second.Header.Get(greeter.ServedByHeader); len(got) == 0 {
+		t.Error("cached result lost the response header")
+	}
+	if result, _ := c.HelloWithMetadata(ctx, "Bob"); result.Cached {
+		t.Error("another name was served from the cache")
+	}
+	if got := unary.Load(); got != 2 {
+		t.Errorf("server saw %d calls, want 2", got)
+	}
+
+	// Streams go to the server every time
+	for i := 0; i < 2; i++ {
+		if _, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error { return nil }, StreamCount(1)); err != nil {
+			t.Fatalf("HelloStream: %v", err)
+		}
+	}
+	if got := stream.Load(); got != 2 {
+		t.Errorf("server saw %d streams, want 2", got)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	ts, unary, _ := countingServer(t)
+	now := time.Unix(1_700_000_000, 0)
+	cache := NewCache(CacheOptions{TTL: time.Minute})
+	cache.now = func() time.Time { return now }
+	c := newTestClient(t, ts, WithCache(cache))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c.Hello(ctx, "Alice")
+	now = now.Add(time.Minute - time.Second)
+	if result, _ := c.HelloWithMetadata(ctx, "Alice"); !result.Cached {
+		t.Error("call within the TTL missed the cache")
+	}
+	now = now.Add(time.Second)
+	result, err := c.HelloWithMetadata(ctx, "Alice")
+	if err != nil || result.Cached || result.Count != 2 {
+		t.Errorf("call at the TTL = %+v, %v; want a fresh count of 2", result, err)
+	}
+	if got := unary.Load(); got != 2 {
+		t.Errorf("server saw %d calls, want 2", got)
+	}
+}
+
+func TestCacheZeroTTL(t *testing.T) {
+	ts, unary, _ := countingServer(t)
+	cache := NewCache(CacheOptions{})
+	c := newTestClient(t, ts, WithCache(cache))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if result, err := c.HelloWithMetadata(ctx, "Alice"); err != nil || result.Cached {
+			t.Errorf("call %d = %+v, %v; want a miss", i, result, err)
+		}
+	}
+	if got := cache.Len(); got != 0 {
+		t.Errorf("cache holds %d entries, want 0", got)
+	}
+	if got := unary.Load(); got != 2 {
+		t.Errorf("server saw %d calls, want 2", got)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	ts, unary, _ := countingServer(t)
+	cache := NewCache(CacheOptions{TTL: time.Minute, MaxEntries: 2})
+	c := newTestClient(t, ts, WithCache(cache))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c.Hello(ctx, "Alice")
+	c.Hello(ctx, "Bob")
+	c.Hello(ctx, "Alice") // Bob is now the least recently used
+	c.Hello(ctx, "Carol")
+	if got := cache.Len(); got != 2 {
+		t.Errorf("cache holds %d entries, want 2", got)
+	}
+	if result, _ := c.HelloWithMetadata(ctx, "Alice"); !result.Cached {
+		t.Error("recently used Alice was evicted")
+	}
+	if result, _ := c.HelloWithMetadata(ctx, "Bob"); result.Cached {
+		t.Error("least recently used Bob was not evicted")
+	}
+	if got := unary.Load(); got != 4 {
+		t.Errorf("server saw %d calls, want 4", got)
+	}
+}
+
+func TestCacheBypass(t *testing.T) {
+	ts, unary, _ := countingServer(t)
+	c := newTestClient(t, ts, WithCache(NewCache(CacheOptions{TTL: time.Minute})))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c.Hello(ctx, "Alice")
+	result, err := c.HelloWithMetadata(WithNoCache(ctx), "Alice")
+	if err != nil || result.Cached || result.Count != 2 {
+		t.Errorf("bypassing call = %+v, %v; want a fresh count of 2", result, err)
+	}
+	// The bypass leaves the cached response in place
+	if result, _ := c.HelloWithMetadata(ctx, "Alice"); !result.Cached || result.Count != 1 {
+		t.Errorf("call after the bypass = %+v, want the cached count of 1", result)
+	}
+	if got := unary.Load(); got != 2 {
+		t.Errorf("server saw %d calls, want 2", got)
+	}
+}
@@ -0,0 +1,72 @@
+package greeterclient
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/health" // client-side health checking
+	"google.golang.org/grpc/status"
+)
+
+// drainAwareServiceConfig is serviceConfig with each backend's health
+// watched, so round_robin skips those reporting NOT_SERVING.
+const drainAwareServiceConfig = `{"loadBalancingConfig":[{"round_robin":{}}],"healthCheckConfig":{"serviceName":""}}`
+
+// maxFailovers caps the retries of a call failing on draining servers.
+const maxFailovers = 2
+
+// WithDrainAware moves calls off servers that are shutting down. The
+// client watches the health of every address the target resolves to and
+// stops picking one as soon as it reports NOT_SERVING, as a server does
+// for its drain notice, so new calls go to the others. A call that still
+// fails with Unavailable, having raced the drain, is tried again on
+// another server, waiting up to wait for one to be ready, rather than
+// failing; streams are only retried if they fail to start. Servers must
+// serve the gRPC health service, or they are never picked.
+func WithDrainAware(wait time.Duration) Option {
+	return func(o *options) {
+		o.drainAware = true
+		o.failoverWait = wait
+	}
+}
+
+// failover returns err's replacement after retrying call, once the
+// connection is ready within wait, while it fails with Unavailable.
+func failover(ctx context.Context, cc *grpc.ClientConn, wait time.Duration, err error, call func() error) error {
+	for attempt := 0; attempt < maxFailovers && status.Code(err) == codes.Unavailable && ctx.Err() == nil; attempt++ {
+		waitCtx, cancel := context.WithTimeout(ctx, wait)
+		_, ready := waitReady(waitCtx, cc)
+		cancel()
+		if !ready {
+			return err
+		}
+		err = call()
+	}
+	return err
+}
+
+func unaryFailoverInterceptor(wait time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		return failover(ctx, cc, wait, err, func() error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+	}
+}
+
+func streamFailoverInterceptor(wait time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		err = failover(ctx, cc, wait, err, func() error {
+			var err error
+			stream, err = streamer(ctx, desc, cc, method, opts...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
+}
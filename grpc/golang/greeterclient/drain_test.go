@@ -0,0 +1,247 @@
+package greeterclient
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/concurrency"
+	"github.com/shrivatsas/exp-codegen/grpc/deadline"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"github.com/shrivatsas/exp-codegen/grpc/greeterserver"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// drainingBackend is a greeterserver.Server serving on an in-memory
+// listener until stop is called.
+type drainingBackend struct {
+	lis  *bufconn.Listener
+	stop context.CancelFunc
+	// done is closed once Serve returns err.
+	done chan struct{}
+	err  error
+}
+
+func startDrainingBackend(t *testing.T, name string, opts ...greeterserver.Option) *drainingBackend {
+	t.Helper()
+	b := &drainingBackend{lis: bufconn.Listen(1 << 20), done: make(chan struct{})}
+	s, err := greeterserver.New(append([]greeterserver.Option{greeterserver.WithListener(b.lis),
+		greeterserver.WithDrainNotice(300 * time.Millisecond),
+		greeterserver.WithGreeterOptions(greeter.WithInstanceID(name))}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	b.stop = stop
+	go func() {
+		b.err = s.Serve(ctx)
+		close(b.done)
+	}()
+	t.Cleanup(func() {
+		stop()
+		<-b.done
+	})
+	return b
+}
+
+func TestDrainAware(t *testing.T) {
+	backends := map[string]*drainingBackend{
+		"replica-a": startDrainingBackend(t, "replica-a"),
+		"replica-b": startDrainingBackend(t, "replica-b"),
+	}
+	r := manual.NewBuilderWithScheme("drain")
+	r.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: "replica-a"}, {Addr: "replica-b"}}})
+	c, err := New("drain:///greeter",
+		WithDrainAware(5*time.Second),
+		WithDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return backends[addr].lis.DialContext(ctx)
+		}),
+		WithDialOptions(grpc.WithResolvers(r)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Keep calls flowing from several callers, as in a rolling restart
+	// Calls are tallied by the replica serving them and the phase they
+	// started in
+	const (
+		before = iota
+		notice
+		after
+	)
+	var (
+		mu     sync.Mutex
+		errs   []error
+		phase  = before
+		served = []map[string]int{{}, {}, {}}
+	)
+	stopCalls := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stopCalls:
+					return
+				default:
+				}
+				mu.Lock()
+				started := phase
+				mu.Unlock()
+				_, _, servedBy, err := c.HelloServedBy(ctx, "Alice")
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					served[started][servedBy]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Drain replica-a once both replicas are taking calls
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return served[before]["replica-a"] > 0 && served[before]["replica-b"] > 0
+	})
+	backends["replica-a"].stop()
+	// Well within the 300ms notice, the client has seen replica-a go
+	// NOT_SERVING though it still serves
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	phase = notice
+	mu.Unlock()
+	select {
+	case <-backends["replica-a"].done:
+		if err := backends["replica-a"].err; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("replica-a did not finish draining")
+	}
+	mu.Lock()
+	phase = after
+	mu.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	close(stopCalls)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Errorf("callers saw %d errors during the drain, first %v", len(errs), errs[0])
+	}
+	for _, p := range []int{notice, after} {
+		if n := served[p]["replica-a"]; n > 0 {
+			t.Errorf("replica-a served %d calls started after it announced its drain", n)
+		}
+		if served[p]["replica-b"] == 0 {
+			t.Error("replica-b served no calls after replica-a announced its drain")
+		}
+	}
+}
+
+func TestDrainAwareLimits(t *testing.T) {
+	// The client's health watch lasts as long as the connection, so it must
+	// hold neither the only concurrency slot nor be cut off by the deadline
+	l := concurrency.MaxConcurrentRequests(1, 100*time.Millisecond)
+	l.Exempt = []string{auth.HealthService}
+	b := startDrainingBackend(t, "replica-a", greeterserver.WithInterceptors(
+		greeterserver.DefaultInterceptors(greeterserver.InterceptorConfig{
+			Deadline:    &deadline.Options{Max: 200 * time.Millisecond, Exempt: []string{auth.HealthService}},
+			Concurrency: l,
+		})...))
+	r := manual.NewBuilderWithScheme("limits")
+	r.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: "replica-a"}}})
+	c, err := New("limits:///greeter",
+		WithDrainAware(5*time.Second),
+		WithDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return b.lis.DialContext(ctx)
+		}),
+		WithDialOptions(grpc.WithResolvers(r)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Call again after the deadline cap would have ended the watch
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := c.HelloServedBy(ctx, "Alice"); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if got := l.InFlight(); got != 0 {
+			t.Errorf("InFlight between calls = %d, want 0", got)
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+}
+
+func TestDrainAwareFailover(t *testing.T) {
+	// replica-a reports SERVING but fails every call, as a server going
+	// away between being picked and handling the call would
+	var refused atomic.Int32
+	refuse := grpc.UnaryInterceptor(func(context.Context, any, *grpc.UnaryServerInfo, grpc.UnaryHandler) (any, error) {
+		refused.Add(1)
+		return nil, status.Error(codes.Unavailable, "transport is closing")
+	})
+	backends := map[string]*testutil.Server{
+		"replica-a": testutil.Start(t, testutil.WithServerOptions(refuse)),
+		"replica-b": testutil.Start(t, testutil.WithGreeterOptions(greeter.WithInstanceID("replica-b"))),
+	}
+	r := manual.NewBuilderWithScheme("failover")
+	r.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: "replica-a"}, {Addr: "replica-b"}}})
+	c, err := New("failover:///greeter",
+		WithDrainAware(5*time.Second),
+		WithDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return backends[addr].Dialer()(ctx, addr)
+		}),
+		WithDialOptions(grpc.WithResolvers(r)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		_, _, servedBy, err := c.HelloServedBy(ctx, "Alice")
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if servedBy != "replica-b" {
+			t.Errorf("call %d served by %q, want replica-b", i, servedBy)
+		}
+	}
+	if refused.Load() == 0 {
+		t.Error("no call reached replica-a, so none failed over")
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after five seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
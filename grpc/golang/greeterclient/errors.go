@@ -0,0 +1,114 @@
+package greeterclient
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MessageSizeError reports a request or reply larger than a message size
+// limit set on either end of the call. It carries the underlying
+// ResourceExhausted status, so status.Code still works on it.
+type MessageSizeError struct {
+	// Size is the message size in bytes and Limit the limit it exceeded.
+	Size, Limit int
+	// Send is true if the message exceeded a send limit, false for a
+	// receive limit. gRPC's errors do not say which end set the limit.
+	Send   bool
+	status *status.Status
+}
+
+func (e *MessageSizeError) Error() string {
+	kind := "receive"
+	if e.Send {
+		kind = "send"
+	}
+	return fmt.Sprintf("message of %d bytes is larger than the %d-byte %s limit", e.Size, e.Limit, kind)
+}
+
+// GRPCStatus returns the original status with the message from Error.
+func (e *MessageSizeError) GRPCStatus() *status.Status {
+	p := e.status.Proto()
+	p.Message = e.Error()
+	return status.FromProto(p)
+}
+
+// PartialStreamError reports a SayHelloStream call cancelled or timed out
+// after Received replies were passed to the callback. It carries the
+// underlying Canceled or DeadlineExceeded status, so status.Code still works
+// on it.
+type PartialStreamError struct {
+	Received int
+	status   *status.Status
+}
+
+func (e *PartialStreamError) Error() string {
+	return fmt.Sprintf("stream interrupted after %d messages: %s", e.Received, e.status.Message())
+}
+
+// GRPCStatus returns the original status with the message from Error.
+func (e *PartialStreamError) GRPCStatus() *status.Status {
+	p := e.status.Proto()
+	p.Message = e.Error()
+	return status.FromProto(p)
+}
+
+// partialStreamError wraps a cancellation or deadline error ending a stream
+// in a PartialStreamError and returns any other error unchanged.
+func partialStreamError(err error, received int) error {
+	st, ok := status.FromError(err)
+	if !ok || (st.Code() != codes.Canceled && st.Code() != codes.DeadlineExceeded) {
+		return err
+	}
+	return &PartialStreamError{Received: received, status: st}
+}
+
+// sizeLimitMessage matches the errors gRPC returns for oversize messages,
+// e.g. "grpc: received message larger than max (1048600 vs. 1048576)". The
+// "grpc: " prefix is missing from some of them.
+var sizeLimitMessage = regexp.MustCompile(`^(?:grpc: )?(received|trying to send) message larger than max \((\d+) vs\. (\d+)\)`)
+
+// sizeError turns gRPC's oversize message errors into a MessageSizeError
+// and returns any other error unchanged.
+func sizeError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return err
+	}
+	m := sizeLimitMessage.FindStringSubmatch(st.Message())
+	if m == nil {
+		return err
+	}
+	size, _ := strconv.Atoi(m[2])
+	limit, _ := strconv.Atoi(m[3])
+	return &MessageSizeError{Size: size, Limit: limit, Send: m[1] == "trying to send", status: st}
+}
+
+// DescribeError formats an RPC error for the user, listing the field
+// violations and quota failures the server attaches as status details.
+func DescribeError(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err.Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", st.Code(), st.Message())
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				fmt.Fprintf(&b, "\n  field %s: %s", v.GetField(), v.GetDescription())
+			}
+		case *errdetails.QuotaFailure:
+			for _, v := range d.GetViolations() {
+				fmt.Fprintf(&b, "\n  quota for %s: %s", v.GetSubject(), v.GetDescription())
+			}
+		}
+	}
+	return b.String()
+}
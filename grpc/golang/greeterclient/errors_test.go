@@ -0,0 +1,43 @@
+package greeterclient
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDescribeError(t *testing.T) {
+	badName, err := status.New(codes.InvalidArgument, "invalid name: must not be empty").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name", Description: "must not be empty"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota, err := status.New(codes.ResourceExhausted, "greeting quota exceeded").WithDetails(&errdetails.QuotaFailure{
+		Violations: []*errdetails.QuotaFailure_Violation{{Subject: "client:127.0.0.1", Description: "limit of 5 greetings per 1m0s reached"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"bad request", badName.Err(), "InvalidArgument: invalid name: must not be empty\n  field name: must not be empty"},
+		{"quota", quota.Err(), "ResourceExhausted: greeting quota exceeded\n  quota for client:127.0.0.1: limit of 5 greetings per 1m0s reached"},
+		{"no details", status.Error(codes.Internal, "boom"), "Internal: boom"},
+		{"not a status", errors.New("boom"), "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DescribeError(tt.err); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package greeterclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+)
+
+// FileWatchScheme is the resolver scheme for addresses listed in a JSON
+// file, written filewatch:///path/to/endpoints.json. The file holds
+//
+//	{"endpoints": [{"address": "10.0.0.1:50051"}, {"address": "10.0.0.2:50051"}]}
+//
+// and is polled for changes once a second, or as often as a poll query
+// parameter says, e.g. ?poll=250ms. A health query parameter, e.g.
+// ?health=5s, also probes each address with a health Check that often and
+// leaves out those not SERVING, unless none are. A file that cannot be
+// read or parsed is logged and the last good addresses kept.
+//
+// The resolver is registered with gRPC, so any connection can use such a
+// target. The path is not a meaningful :authority, so set one with
+// grpc.WithAuthority when the servers' TLS certificates name them.
+const FileWatchScheme = "filewatch"
+
+const defaultFileWatchPoll = time.Second
+
+func init() {
+	resolver.Register(fileWatchBuilder{})
+}
+
+// endpointFile is the contents of a FileWatchScheme file.
+type endpointFile struct {
+	Endpoints []struct {
+		Address string `json:"address"`
+	} `json:"endpoints"`
+}
+
+// readEndpoints returns the addresses listed in the file at path, and the
+// stamp of the contents they were read from.
+func readEndpoints(path string) ([]string, [sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, err
+	}
+	stamp := sha256.Sum256(data)
+	var f endpointFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, stamp, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	var addrs []string
+	for i, e := range f.Endpoints {
+		if e.Address == "" {
+			return nil, stamp, fmt.Errorf("parsing %s: endpoint %d has no address", path, i)
+		}
+		addrs = append(addrs, e.Address)
+	}
+	return addrs, stamp, nil
+}
+
+type fileWatchBuilder struct{}
+
+func (fileWatchBuilder) Scheme() string { return FileWatchScheme }
+
+func (fileWatchBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	path := target.URL.Path
+	if path == "" {
+		return nil, errors.New("greeterclient: filewatch target names no file")
+	}
+	query := target.URL.Query()
+	poll, health := defaultFileWatchPoll, time.Duration(0)
+	for _, p := range []struct {
+		name string
+		d    *time.Duration
+	}{{"poll", &poll}, {"health", &health}} {
+		if s := query.Get(p.name); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("greeterclient: filewatch %s must be a positive duration, got %q", p.name, s)
+			}
+			*p.d = d
+		}
+	}
+
+	creds := opts.DialCreds
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	probeOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if opts.Dialer != nil {
+		probeOpts = append(probeOpts, grpc.WithContextDialer(opts.Dialer))
+	}
+	r := &fileWatchResolver{
+		path:      path,
+		cc:        cc,
+		health:    health,
+		probeOpts: probeOpts,
+		probes:    make(map[string]*grpc.ClientConn),
+		logger:    slog.Default(),
+		refresh:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go r.watch(poll)
+	return r, nil
+}
+
+// fileWatchResolver sends the ClientConn the addresses in its file, less
+// those failing health checks when health is positive.
+type fileWatchResolver struct {
+	path      string
+	cc        resolver.ClientConn
+	health    time.Duration
+	probeOpts []grpc.DialOption
+	logger    *slog.Logger
+
+	// The fields below are only used by the watch goroutine.
+	stamp [sha256.Size]byte
+	// loaded reports whether addrs were read from the file.
+	loaded bool
+	addrs  []string
+	// healthy holds the addresses that passed their last health Check.
+	healthy map[string]bool
+	// probes are the connections health Checks are sent on, by address.
+	probes map[string]*grpc.ClientConn
+	// sent is the address list last sent to cc.
+	sent []string
+
+	refresh   chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// watch reads the file now and then polls it, and probes the addresses,
+// until Close.
+func (r *fileWatchResolver) watch(poll time.Duration) {
+	defer close(r.done)
+	r.reload()
+	pollTicker := time.NewTicker(poll)
+	defer pollTicker.Stop()
+	var healthTick <-chan time.Time
+	if r.health > 0 {
+		t := time.NewTicker(r.health)
+		defer t.Stop()
+		healthTick = t.C
+	}
+	for {
+		select {
+		case <-r.stop:
+			for _, conn := range r.probes {
+				conn.Close()
+			}
+			return
+		case <-pollTicker.C:
+			r.reload()
+		case <-r.refresh:
+			r.reload()
+		case <-healthTick:
+			r.probe()
+			r.update()
+		}
+	}
+}
+
+// reload reads the file if it changed since last read and updates cc.
+func (r *fileWatchResolver) reload() {
+	addrs, stamp, err := readEndpoints(r.path)
+	if r.loaded && stamp == r.stamp {
+		return
+	}
+	r.stamp = stamp
+	if err != nil {
+		if r.loaded {
+			r.logger.Error("Failed to reload endpoints, keeping the last good ones", "path", r.path, "error", err)
+		} else {
+			r.cc.ReportError(err)
+		}
+		return
+	}
+	r.loaded = true
+	r.addrs = addrs
+	for addr, conn := range r.probes {
+		if !slices.Contains(addrs, addr) {
+			conn.Close()
+			delete(r.probes, addr)
+		}
+	}
+	if r.health > 0 {
+		// Addresses are only sent once they have been checked
+		r.probe()
+	}
+	r.update()
+}
+
+// probe health checks every address at once, recording which are serving.
+func (r *fileWatchResolver) probe() {
+	type result struct {
+		addr    string
+		healthy bool
+	}
+	results := make(chan result, len(r.addrs))
+	for _, addr := range r.addrs {
+		conn := r.probes[addr]
+		if conn == nil {
+			var err error
+			conn, err = grpc.NewClient("passthrough:///"+addr, r.probeOpts...)
+			if err != nil {
+				r.logger.Error("Failed to health check endpoint", "address", addr, "error", err)
+				results <- result{addr, false}
+				continue
+			}
+			r.probes[addr] = conn
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), r.health)
+			defer cancel()
+			resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+			results <- result{addr, err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING}
+		}()
+	}
+	r.healthy = make(map[string]bool, len(r.addrs))
+	for range r.addrs {
+		res := <-results
+		r.healthy[res.addr] = res.healthy
+	}
+}
+
+// update sends cc the addresses to use, if they changed.
+func (r *fileWatchResolver) update() {
+	addrs := r.addrs
+	if r.health > 0 {
+		var healthy []string
+		for _, addr := range r.addrs {
+			if r.healthy[addr] {
+				healthy = append(healthy, addr)
+			}
+		}
+		// With none serving, trying them all beats failing every call
+		if len(healthy) > 0 {
+			addrs = healthy
+		}
+	}
+	if r.sent != nil && slices.Equal(addrs, r.sent) {
+		return
+	}
+	r.sent = addrs
+	state := resolver.State{Addresses: make([]resolver.Address, len(addrs))}
+	for i, addr := range addrs {
+		state.Addresses[i] = resolver.Address{Addr: addr}
+	}
+	if err := r.cc.UpdateState(state); err != nil {
+		r.logger.Error("Endpoints rejected", "path", r.path, "error", err)
+	}
+}
+
+// ResolveNow rereads the file without waiting for the next poll.
+func (r *fileWatchResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops watching the file and closes the health check connections.
+func (r *fileWatchResolver) Close() {
+	r.closeOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
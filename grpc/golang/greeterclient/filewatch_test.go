@@ -0,0 +1,190 @@
+package greeterclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// replicas serves a Greeter under each name, reached by dialing the name.
+type replicas map[string]*testutil.Server
+
+func startReplicas(t *testing.T, names ...string) replicas {
+	t.Helper()
+	rs := make(replicas)
+	for _, name := range names {
+		rs[name] = testutil.Start(t, testutil.WithGreeterOptions(greeter.WithInstanceID(name)))
+	}
+	return rs
+}
+
+func (rs replicas) dial(ctx context.Context, addr string) (net.Conn, error) {
+	s, ok := rs[addr]
+	if !ok {
+		return nil, fmt.Errorf("no replica %q", addr)
+	}
+	return s.Dialer()(ctx, addr)
+}
+
+// writeEndpoints replaces the endpoint file at path with one listing addrs,
+// renaming it into place as a registry would.
+func writeEndpoints(t *testing.T, path string, addrs ...string) {
+	t.Helper()
+	var entries []string
+	for _, addr := range addrs {
+		entries = append(entries, fmt.Sprintf(`{"address": %q}`, addr))
+	}
+	writeFile(t, path, `{"endpoints": [`+strings.Join(entries, ", ")+`]}`)
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedBy makes n calls and counts the replicas serving them.
+func servedBy(t *testing.T, c *Client, n int) map[string]int {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	served := make(map[string]int)
+	for i := 0; i < n; i++ {
+		_, _, by, err := c.HelloServedBy(ctx, "Alice")
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		served[by]++
+	}
+	return served
+}
+
+// waitServed calls until the calls of a round are served by exactly the
+// replicas in want.
+func waitServed(t *testing.T, c *Client, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		served := servedBy(t, c, 20)
+		ok := len(served) == len(want)
+		for _, name := range want {
+			ok = ok && served[name] > 0
+		}
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("calls served by %v, want %v", served, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// streamOn opens SayHelloStreams until one is served by name, returning it
+// with its first reply read.
+func streamOn(t *testing.T, ctx context.Context, c *Client, name string) pb.Greeter_SayHelloStreamClient {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		streamCtx, cancel := context.WithCancel(ctx)
+		stream, err := pb.NewGreeterClient(c.Conn()).SayHelloStream(streamCtx, &pb.HelloRequest{Name: "Bob", Count: proto.Int32(5), Interval: durationpb.New(100 * time.Millisecond)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.ServedBy == name {
+			t.Cleanup(cancel)
+			return stream
+		}
+		cancel()
+	}
+	t.Fatalf("no stream was served by %s", name)
+	return nil
+}
+
+func TestFileWatch(t *testing.T) {
+	rs := startReplicas(t, "replica-a", "replica-b")
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	writeEndpoints(t, path, "replica-a")
+	c, err := New(FileWatchScheme+"://"+path+"?poll=10ms", WithDialer(rs.dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitServed(t, c, "replica-a")
+
+	// A new address takes traffic
+	writeEndpoints(t, path, "replica-a", "replica-b")
+	waitServed(t, c, "replica-a", "replica-b")
+
+	// A removed one drains, finishing the stream it is serving
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := streamOn(t, ctx, c, "replica-b")
+	writeEndpoints(t, path, "replica-a")
+	waitServed(t, c, "replica-a")
+	received := 1
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("stream open while its address was removed failed after %d replies: %v", received, err)
+		}
+		received++
+	}
+	if received != 5 {
+		t.Errorf("drained stream got %d replies, want 5", received)
+	}
+
+	// A corrupt file keeps the last good addresses
+	writeFile(t, path, `{"endpoints": [{"address": "replica-b"`)
+	time.Sleep(50 * time.Millisecond)
+	if served := servedBy(t, c, 10); served["replica-a"] != 10 {
+		t.Errorf("after a corrupt update calls were served by %v, want replica-a still", served)
+	}
+	writeEndpoints(t, path, "replica-b")
+	waitServed(t, c, "replica-b")
+}
+
+func TestFileWatchHealth(t *testing.T) {
+	rs := startReplicas(t, "replica-a", "replica-b")
+	rs["replica-b"].Service.SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	writeEndpoints(t, path, "replica-a", "replica-b")
+	c, err := New(FileWatchScheme+"://"+path+"?poll=10ms&health=20ms", WithDialer(rs.dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	waitServed(t, c, "replica-a")
+	if served := servedBy(t, c, 20); served["replica-b"] > 0 {
+		t.Errorf("calls served by %v, want none by NOT_SERVING replica-b", served)
+	}
+	rs["replica-b"].Service.SetServingStatus(healthpb.HealthCheckResponse_SERVING)
+	waitServed(t, c, "replica-a", "replica-b")
+	rs["replica-a"].Service.SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	waitServed(t, c, "replica-b")
+}
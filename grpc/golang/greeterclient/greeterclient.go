@@ -0,0 +1,697 @@
+// Package greeterclient is a client library for the Greeter service that
+// wraps the generated stubs with connection setup and stream handling.
+package greeterclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/compat"
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// serviceConfig spreads calls over every address the resolver returns, such
+// as each server in a comma-separated list or each A record of a dns:///
+// target.
+const serviceConfig = `{"loadBalancingConfig":[{"round_robin":{}}]}`
+
+// Client calls the Greeter service over a single connection.
+type Client struct {
+	conn    *grpc.ClientConn
+	greeter pb.GreeterClient
+	// v2 is the v2 Greeter stub under greeter when WithV2 is used, else nil.
+	v2      pbv2.GreeterClient
+	timeout time.Duration
+	locale  string
+	// connectTimeout bounds the wait for a ready connection before each
+	// call; zero means calls do not wait.
+	connectTimeout time.Duration
+	// lastActivity is when a stream last received a reply, in Unix
+	// nanoseconds, or zero.
+	lastActivity atomic.Int64
+}
+
+// options collects the settings applied by Option values.
+type options struct {
+	creds              credentials.TransportCredentials
+	timeout            time.Duration
+	unaryInterceptors  []grpc.UnaryClientInterceptor
+	streamInterceptors []grpc.StreamClientInterceptor
+	userAgent          string
+	maxRecvMsgSize     int
+	maxSendMsgSize     int
+	locale             string
+	waitForReady       bool
+	backoff            *backoff.Config
+	connectTimeout     time.Duration
+	md                 metadata.MD
+	dialOpts           []grpc.DialOption
+	dialer             func(ctx context.Context, addr string) (net.Conn, error)
+	drainAware         bool
+	failoverWait       time.Duration
+	v2                 bool
+	rejectUnknown      bool
+}
+
+// Option configures a Client created by New.
+type Option func(*options)
+
+// WithCredentials sets the transport credentials. Connections are plaintext
+// by default.
+func WithCredentials(creds credentials.TransportCredentials) Option {
+	return func(o *options) { o.creds = creds }
+}
+
+// WithTimeout bounds each Hello call and each page fetched by List.
+// Streaming calls, including Batch, are bounded only by their context.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithUnaryInterceptors adds interceptors run, in order, around unary calls.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryClientInterceptor) Option {
+	return func(o *options) { o.unaryInterceptors = append(o.unaryInterceptors, interceptors...) }
+}
+
+// WithStreamInterceptors adds interceptors run, in order, around streaming calls.
+func WithStreamInterceptors(interceptors ...grpc.StreamClientInterceptor) Option {
+	return func(o *options) { o.streamInterceptors = append(o.streamInterceptors, interceptors...) }
+}
+
+// Interceptor pairs the unary and streaming halves of a client interceptor.
+// Either half may be nil.
+type Interceptor struct {
+	Unary  grpc.UnaryClientInterceptor
+	Stream grpc.StreamClientInterceptor
+}
+
+// WithInterceptors adds interceptors run, in order, around both unary and
+// streaming calls. They compose with WithUnaryInterceptors and
+// WithStreamInterceptors in the order the options are given.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		for _, i := range interceptors {
+			if i.Unary != nil {
+				o.unaryInterceptors = append(o.unaryInterceptors, i.Unary)
+			}
+			if i.Stream != nil {
+				o.streamInterceptors = append(o.streamInterceptors, i.Stream)
+			}
+		}
+	}
+}
+
+// WithUserAgent sets the user agent sent ahead of gRPC's own.
+func WithUserAgent(ua string) Option {
+	return func(o *options) { o.userAgent = ua }
+}
+
+// WithMaxRecvMsgSize caps the size in bytes of replies the client accepts.
+// gRPC's default of 4 MiB applies when unset.
+func WithMaxRecvMsgSize(n int) Option {
+	return func(o *options) { o.maxRecvMsgSize = n }
+}
+
+// WithMaxSendMsgSize caps the size in bytes of requests the client sends.
+// gRPC does not limit sent messages by default.
+func WithMaxSendMsgSize(n int) Option {
+	return func(o *options) { o.maxSendMsgSize = n }
+}
+
+// WithLocale sets the locale, e.g. "es" or "fr-CA", sent with every
+// request. The server greets in English when it is unset or unknown.
+func WithLocale(locale string) Option {
+	return func(o *options) { o.locale = locale }
+}
+
+// WithWaitForReady makes calls wait for the connection to become ready, for
+// as long as their context allows, instead of failing at once with
+// Unavailable while the server is down.
+func WithWaitForReady(wait bool) Option {
+	return func(o *options) { o.waitForReady = wait }
+}
+
+// WithBackoff sets how reconnection attempts are spaced. Fields left zero
+// take gRPC's defaults: a 1s base delay growing 1.6 times per attempt, with
+// 20% jitter, up to 120s.
+func WithBackoff(cfg backoff.Config) Option {
+	def := backoff.DefaultConfig
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = def.BaseDelay
+	}
+	if cfg.Multiplier <= 0 {
+		cfg.Multiplier = def.Multiplier
+	}
+	if cfg.Jitter <= 0 {
+		cfg.Jitter = def.Jitter
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = def.MaxDelay
+	}
+	return func(o *options) { o.backoff = &cfg }
+}
+
+// WithConnectTimeout makes every call first wait up to d for the
+// connection to become ready, failing with an Unavailable "server never
+// became ready" error if it does not. The wait is not counted against the
+// WithTimeout of Hello calls.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(o *options) { o.connectTimeout = d }
+}
+
+// WithMetadata adds md to the outgoing metadata of every call, ahead of the
+// interceptors so they see it too. Repeated uses accumulate.
+func WithMetadata(md metadata.MD) Option {
+	return func(o *options) { o.md = metadata.Join(o.md, md) }
+}
+
+// WithDialOptions adds raw gRPC dial options, e.g. for keepalive or stats
+// handlers, applied after those implied by the other options.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOpts = append(o.dialOpts, opts...) }
+}
+
+// WithDialer makes the client open its connections with dial, given the
+// context of the attempt and the host:port to reach, e.g. to go through the
+// proxy of an endpoint.ProxyDialer. TLS credentials handshake over the
+// connection dial returns. It replaces the dialer of unix:// addresses too,
+// which are passed as the socket path.
+func WithDialer(dial func(ctx context.Context, addr string) (net.Conn, error)) Option {
+	return func(o *options) { o.dialer = dial }
+}
+
+// dialOptions returns the gRPC dial options for o.
+func (o options) dialOptions() []grpc.DialOption {
+	creds := o.creds
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	sc := serviceConfig
+	if o.drainAware {
+		sc = drainAwareServiceConfig
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(sc),
+	}
+	if o.drainAware {
+		// Outermost, so each retry runs the whole chain again
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(unaryFailoverInterceptor(o.failoverWait)),
+			grpc.WithChainStreamInterceptor(streamFailoverInterceptor(o.failoverWait)))
+	}
+	if len(o.md) > 0 {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(unaryMetadataInterceptor(o.md)),
+			grpc.WithChainStreamInterceptor(streamMetadataInterceptor(o.md)))
+	}
+	if len(o.unaryInterceptors) > 0 {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(o.unaryInterceptors...))
+	}
+	if len(o.streamInterceptors) > 0 {
+		opts = append(opts, grpc.WithChainStreamInterceptor(o.streamInterceptors...))
+	}
+	if o.rejectUnknown {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(unaryUnknownInterceptor),
+			grpc.WithChainStreamInterceptor(streamUnknownInterceptor))
+	}
+	if o.userAgent != "" {
+		opts = append(opts, grpc.WithUserAgent(o.userAgent))
+	}
+	var callOpts []grpc.CallOption
+	if o.maxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(o.maxRecvMsgSize))
+	}
+	if o.maxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(o.maxSendMsgSize))
+	}
+	if o.waitForReady {
+		callOpts = append(callOpts, grpc.WaitForReady(true))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	if o.backoff != nil {
+		opts = append(opts, grpc.WithConnectParams(grpc.ConnectParams{Backoff: *o.backoff}))
+	}
+	if o.dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(o.dialer))
+	}
+	return append(opts, o.dialOpts...)
+}
+
+// withOutgoing appends md to the outgoing metadata of ctx.
+func withOutgoing(ctx context.Context, md metadata.MD) context.Context {
+	kv := make([]string, 0, 2*md.Len())
+	for k, vs := range md {
+		for _, v := range vs {
+			kv = append(kv, k, v)
+		}
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+func unaryMetadataInterceptor(md metadata.MD) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withOutgoing(ctx, md), method, req, reply, cc, opts...)
+	}
+}
+
+func streamMetadataInterceptor(md metadata.MD) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withOutgoing(ctx, md), desc, cc, method, opts...)
+	}
+}
+
+// New returns a Client for the server at addr, which is either host:port, a
+// comma-separated list of host:port replicas, any gRPC target such as
+// dns:///host:port or a FileWatchScheme file, or unix:///path/to.sock.
+// Calls are balanced round-robin across the addresses the target resolves
+// to. The connection is established lazily on the first call.
+func New(addr string, opts ...Option) (*Client, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	target, endpointOpts := endpoint.Dial(addr)
+	conn, err := grpc.NewClient(target, append(endpointOpts, o.dialOptions()...)...)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, greeter: pb.NewGreeterClient(conn), timeout: o.timeout, locale: o.locale, connectTimeout: o.connectTimeout}
+	if o.v2 {
+		c.v2 = pbv2.NewGreeterClient(conn)
+		c.greeter = v2Greeter{client: c.v2}
+	}
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Conn returns the underlying connection, e.g. to call other services on the
+// same server such as channelz.
+func (c *Client) Conn() *grpc.ClientConn {
+	return c.conn
+}
+
+// withTimeout applies the client timeout to ctx.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// awaitReady waits up to the connect timeout for the connection to become
+// ready. It returns at once if no connect timeout is set.
+func (c *Client) awaitReady(ctx context.Context) error {
+	if c.connectTimeout <= 0 {
+		return nil
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, c.connectTimeout)
+	defer cancel()
+	c.conn.Connect()
+	if state, ready := waitReady(waitCtx, c.conn); !ready {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		return status.Errorf(codes.Unavailable, "server never became ready within %v (connection %s)", c.connectTimeout, state)
+	}
+	return nil
+}
+
+// waitReady waits for conn to become ready until ctx ends, returning its
+// last state and whether it was ready.
+func waitReady(ctx context.Context, conn *grpc.ClientConn) (connectivity.State, bool) {
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return state, true
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return state, false
+		}
+	}
+}
+
+// request returns the request greeting name in the client's locale.
+func (c *Client) request(name string) *pb.HelloRequest {
+	return &pb.HelloRequest{Name: name, Locale: c.locale}
+}
+
+// Hello calls SayHello, returning the greeting and how many times name has
+// been greeted.
+func (c *Client) Hello(ctx context.Context, name string) (string, int64, error) {
+	message, count, _, err := c.HelloServedBy(ctx, name)
+	return message, count, err
+}
+
+// HelloReply calls SayHello and returns the whole reply, including when and
+// by which server it was produced.
+func (c *Client) HelloReply(ctx context.Context, name string) (*pb.HelloReply, error) {
+	return c.HelloRequest(ctx, c.request(name))
+}
+
+// HelloRequest calls SayHello with req as it is, e.g. a request replayed
+// from a file; the client's locale is not applied.
+func (c *Client) HelloRequest(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	if err := c.awaitReady(ctx); err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resp, err := c.greeter.SayHello(ctx, req)
+	if err != nil {
+		return nil, sizeError(err)
+	}
+	return resp, nil
+}
+
+// HelloResult is the outcome of a SayHello call with its response
+// metadata.
+type HelloResult struct {
+	Message string
+	Count   int64
+	// Header and Trailer hold the response metadata the server sent, e.g.
+	// greeter.ServedByHeader.
+	Header, Trailer metadata.MD
+	// Cached is set when the result came from a Cache rather than the
+	// server; Header and Trailer are then those of the cached call.
+	Cached bool
+}
+
+// HelloWithMetadata is Hello that also returns the response header and
+// trailer. When the call fails the result is still returned, holding
+// whatever metadata arrived, such as a ratelimit.RetryAfterKey trailer.
+func (c *Client) HelloWithMetadata(ctx context.Context, name string) (*HelloResult, error) {
+	result := &HelloResult{}
+	if err := c.awaitReady(ctx); err != nil {
+		return result, err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	callOpts := []grpc.CallOption{grpc.Header(&result.Header), grpc.Trailer(&result.Trailer), cacheHitOption{hit: &result.Cached}}
+	if c.v2 != nil {
+		// Called directly to keep the count's 64 bits
+		resp, err := c.v2.SayHello(ctx, compat.V2HelloRequest(c.request(name)), callOpts...)
+		if err != nil {
+			return result, sizeError(err)
+		}
+		result.Message, result.Count = resp.Greeting, resp.GreetingCount
+		return result, nil
+	}
+	resp, err := c.greeter.SayHello(ctx, c.request(name), callOpts...)
+	if err != nil {
+		return result, sizeError(err)
+	}
+	result.Message, result.Count = resp.Message, int64(resp.GreetingCount)
+	return result, nil
+}
+
+// HelloServedBy is Hello that also returns the host that handled the call,
+// taken from the greeter.ServedByHeader response header, or "" if the
+// server did not send one.
+func (c *Client) HelloServedBy(ctx context.Context, name string) (message string, count int64, servedBy string, err error) {
+	result, err := c.HelloWithMetadata(ctx, name)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if v := result.Header.Get(greeter.ServedByHeader); len(v) > 0 {
+		servedBy = v[0]
+	}
+	return result.Message, result.Count, servedBy, nil
+}
+
+// streamConfig is the request and metadata callbacks of a SayHelloStream call.
+type streamConfig struct {
+	req       *pb.HelloRequest
+	onHeader  func(metadata.MD)
+	onTrailer func(metadata.MD)
+}
+
+// StreamOption adjusts the stream requested by HelloStream.
+type StreamOption func(*streamConfig)
+
+// StreamCount asks for n replies, which may be zero. The server's default
+// applies otherwise.
+func StreamCount(n int32) StreamOption {
+	return func(sc *streamConfig) { sc.req.Count = &n }
+}
+
+// StreamInterval asks for d between replies. The server's default applies
+// otherwise.
+func StreamInterval(d time.Duration) StreamOption {
+	return func(sc *streamConfig) { sc.req.Interval = durationpb.New(d) }
+}
+
+// OnHeader calls fn with the stream's response header before the first
+// reply is passed on.
+func OnHeader(fn func(metadata.MD)) StreamOption {
+	return func(sc *streamConfig) { sc.onHeader = fn }
+}
+
+// OnTrailer calls fn with the stream's trailer once it ends, whether or not
+// it succeeded.
+func OnTrailer(fn func(metadata.MD)) StreamOption {
+	return func(sc *streamConfig) { sc.onTrailer = fn }
+}
+
+// streamConfig applies opts to a stream greeting name.
+func (c *Client) streamConfig(name string, opts []StreamOption) streamConfig {
+	sc := streamConfig{req: c.request(name)}
+	for _, opt := range opts {
+		opt(&sc)
+	}
+	return sc
+}
+
+// LastActivity returns when a reply last arrived on one of the client's
+// streams, heartbeats included, or the zero Time if none has. A caller can
+// watch it to tell a quiet stream from a dead one.
+func (c *Client) LastActivity() time.Time {
+	if n := c.lastActivity.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// heartbeat records that reply arrived and reports whether it is a
+// heartbeat, which the stream methods keep from their callers.
+func (c *Client) heartbeat(reply *pb.HelloReply) bool {
+	c.lastActivity.Store(time.Now().UnixNano())
+	return reply.IsHeartbeat
+}
+
+// HelloStream calls SayHelloStream and passes each reply to fn. If fn
+// returns an error the stream is cancelled and that error is returned. If
+// ctx is cancelled or its deadline passes first, the error is a
+// *PartialStreamError counting the replies fn received. Heartbeats are
+// not passed to fn. The StreamSummary compares the messages received with
+// those the server reports sending, however the stream ended.
+func (c *Client) HelloStream(ctx context.Context, name string, fn func(*pb.HelloReply) error, opts ...StreamOption) (StreamSummary, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var summary StreamSummary
+	sc := c.streamConfig(name, opts)
+	if err := c.awaitReady(ctx); err != nil {
+		return summary, partialStreamError(err, 0)
+	}
+	stream, err := c.greeter.SayHelloStream(ctx, sc.req)
+	if err != nil {
+		return summary, partialStreamError(sizeError(err), 0)
+	}
+	if sc.onTrailer != nil {
+		defer func() { sc.onTrailer(stream.Trailer()) }()
+	}
+	if sc.onHeader != nil {
+		header, err := stream.Header()
+		if err != nil {
+			return summary, partialStreamError(sizeError(err), 0)
+		}
+		sc.onHeader(header)
+	}
+	for received := 0; ; {
+		resp, err := stream.Recv()
+		if err != nil {
+			summary.report(stream.Trailer())
+			if err == io.EOF {
+				return summary, nil
+			}
+			return summary, partialStreamError(sizeError(err), received)
+		}
+		summary.Received++
+		if c.heartbeat(resp) {
+			continue
+		}
+		if err := fn(resp); err != nil {
+			return summary, err
+		}
+		received++
+	}
+}
+
+// Chat sends names over SayHelloChat and passes each reply to fn as it
+// arrives, leaving out heartbeats. If fn returns an error the stream is
+// cancelled and that error is returned.
+func (c *Client) Chat(ctx context.Context, names []string, fn func(*pb.HelloReply) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := c.awaitReady(ctx); err != nil {
+		return err
+	}
+	stream, err := c.greeter.SayHelloChat(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Send concurrently so a slow reader never stalls the server
+	sendErr := make(chan error, 1)
+	go func() {
+		for _, name := range names {
+			if err := stream.Send(c.request(name)); err != nil {
+				if errors.Is(err, io.EOF) {
+					// Recv reports the reason the stream ended
+					sendErr <- nil
+					return
+				}
+				// A request the client refused to send, e.g. one over the
+				// send limit, leaves the stream open, so end it
+				sendErr <- err
+				cancel()
+				return
+			}
+		}
+		sendErr <- stream.CloseSend()
+	}()
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return sizeError(<-sendErr)
+		}
+		if err != nil {
+			select {
+			case err := <-sendErr:
+				if err != nil {
+					return sizeError(err)
+				}
+			default:
+			}
+			return sizeError(err)
+		}
+		if c.heartbeat(resp) {
+			continue
+		}
+		if err := fn(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// Batch sends names over SayHelloBatch, returning the combined greeting and
+// the number of names greeted.
+func (c *Client) Batch(ctx context.Context, names []string) (string, int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := c.awaitReady(ctx); err != nil {
+		return "", 0, err
+	}
+	stream, err := c.greeter.SayHelloBatch(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, name := range names {
+		if err := stream.Send(c.request(name)); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The server ended the call early; CloseAndRecv reports why
+				break
+			}
+			return "", 0, sizeError(err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", 0, sizeError(err)
+	}
+	return resp.Message, int64(resp.GreetingCount), nil
+}
+
+// listPageSize is the page size List requests.
+const listPageSize = 100
+
+// List calls ListGreetings, following page tokens until every greeting has
+// been passed to fn, oldest first, or limit greetings have been if limit is
+// positive. If fn returns an error listing stops and that error is returned.
+func (c *Client) List(ctx context.Context, limit int, fn func(*pb.GreetingRecord) error) error {
+	if err := c.awaitReady(ctx); err != nil {
+		return err
+	}
+	req := &pb.ListGreetingsRequest{PageSize: listPageSize}
+	for seen := 0; ; {
+		if limit > 0 {
+			req.PageSize = int32(min(listPageSize, limit-seen))
+		}
+		resp, err := c.listPage(ctx, req)
+		if err != nil {
+			return err
+		}
+		for _, g := range resp.Greetings {
+			if err := fn(g); err != nil {
+				return err
+			}
+			seen++
+		}
+		if resp.NextPageToken == "" || (limit > 0 && seen >= limit) {
+			return nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+// listPage fetches one page, applying the client timeout to it.
+func (c *Client) listPage(ctx context.Context, req *pb.ListGreetingsRequest) (*pb.ListGreetingsResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resp, err := c.greeter.ListGreetings(ctx, req)
+	return resp, sizeError(err)
+}
+
+// Count calls GetGreetingCount, returning how many times name has been
+// greeted and the last time it was, or the totals over all names when name
+// is empty. lastGreeted is zero if the server does not know it. With strict
+// set, a name never greeted fails with NotFound instead of counting zero.
+func (c *Client) Count(ctx context.Context, name string, strict bool) (count int64, lastGreeted time.Time, err error) {
+	if err := c.awaitReady(ctx); err != nil {
+		return 0, time.Time{}, err
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resp, err := c.greeter.GetGreetingCount(ctx, &pb.GetCountRequest{Name: name, Strict: strict})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if resp.LastGreeted != nil {
+		lastGreeted = resp.LastGreeted.AsTime()
+	}
+	return resp.Count, lastGreeted, nil
+}
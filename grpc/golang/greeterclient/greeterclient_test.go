@@ -0,0 +1,795 @@
+package greeterclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+)
+
+// newTestClient returns a Client for ts.
+func newTestClient(t *testing.T, ts *testutil.Server, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(testutil.Target, append([]Option{WithDialOptions(grpc.WithContextDialer(ts.Dialer()))}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestOptions(t *testing.T) {
+	unary := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	creds := insecure.NewCredentials()
+
+	var o options
+	for _, opt := range []Option{
+		WithCredentials(creds),
+		WithTimeout(time.Second),
+		WithUnaryInterceptors(unary, unary),
+		WithStreamInterceptors(stream),
+		WithUserAgent("greeter-test/1.0"),
+		WithDialOptions(grpc.WithAuthority("greeter"), grpc.WithIdleTimeout(time.Minute)),
+	} {
+		opt(&o)
+	}
+	if o.creds != creds || o.timeout != time.Second || o.userAgent != "greeter-test/1.0" {
+		t.Errorf("got options %+v", o)
+	}
+	if len(o.unaryInterceptors) != 2 || len(o.streamInterceptors) != 1 || len(o.dialOpts) != 2 {
+		t.Errorf("got %d unary, %d stream interceptors and %d dial options, want 2, 1 and 2",
+			len(o.unaryInterceptors), len(o.streamInterceptors), len(o.dialOpts))
+	}
+	// Credentials, service config, both interceptor chains, the user agent
+	// and the two raw options
+	if got := len(o.dialOptions()); got != 7 {
+		t.Errorf("got %d dial options, want 7", got)
+	}
+	// Only the default credentials and service config when nothing is set
+	if got := len((options{}).dialOptions()); got != 2 {
+		t.Errorf("got %d default dial options, want 2", got)
+	}
+}
+
+// recordingGreeter records the user agent of each call and can stall SayHello.
+type recordingGreeter struct {
+	pb.UnimplementedGreeterServer
+	stall bool
+
+	mu         sync.Mutex
+	userAgents []string
+}
+
+func (g *recordingGreeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	g.mu.Lock()
+	g.userAgents = append(g.userAgents, md.Get("user-agent")...)
+	g.mu.Unlock()
+	if g.stall {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!", GreetingCount: 1}, nil
+}
+
+func TestUserAgentAndInterceptors(t *testing.T) {
+	g := &recordingGreeter{}
+	ts := testutil.Start(t, testutil.WithService(g))
+
+	var calls []string
+	record := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			calls = append(calls, name)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+	c := newTestClient(t, ts, WithUserAgent("greeter-test/1.0"), WithUnaryInterceptors(record("first"), record("second")))
+
+	if _, _, err := c.Hello(context.Background(), "Alice"); err != nil {
+		t.Fatalf("Hello: %v", err)
+	}
+	if !slices.Equal(calls, []string{"first", "second"}) {
+		t.Errorf("interceptors ran as %v, want first then second", calls)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.userAgents) != 1 || !strings.HasPrefix(g.userAgents[0], "greeter-test/1.0 ") {
+		t.Errorf("got user agents %q, want one starting with greeter-test/1.0", g.userAgents)
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0)))
+
+	var calls []string
+	record := func(name string) Interceptor {
+		return Interceptor{
+			Unary: func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				calls = append(calls, name)
+				return invoker(ctx, method, req, reply, cc, opts...)
+			},
+			Stream: func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				calls = append(calls, name)
+				return streamer(ctx, desc, cc, method, opts...)
+			},
+		}
+	}
+	c := newTestClient(t, ts, WithInterceptors(record("first")), WithInterceptors(record("second"), record("third")))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	want := []string{"first", "second", "third"}
+
+	if _, _, err := c.Hello(ctx, "Alice"); err != nil {
+		t.Fatalf("Hello: %v", err)
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("unary interceptors ran as %v, want %v", calls, want)
+	}
+	calls = nil
+	if _, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error { return nil }); err != nil {
+		t.Fatalf("HelloStream: %v", err)
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("stream interceptors ran as %v, want %v", calls, want)
+	}
+}
+
+func TestHelloTimeout(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithService(&recordingGreeter{stall: true}))
+	c := newTestClient(t, ts, WithTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	_, _, err := c.Hello(context.Background(), "Alice")
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Hello took %v with a 50ms timeout", elapsed)
+	}
+}
+
+func TestHello(t *testing.T) {
+	c := newTestClient(t, testutil.Start(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i, wantMessage := range []string{"Hello, Alice!", "Hello again, Alice! That makes 2 greetings."} {
+		message, count, err := c.Hello(ctx, "Alice")
+		if err != nil {
+			t.Fatalf("Hello: %v", err)
+		}
+		if want := int64(i + 1); message != wantMessage || count != want {
+			t.Errorf("got %q (Count: %d), want %q (Count: %d)", message, count, wantMessage, want)
+		}
+	}
+	if _, _, err := c.Hello(ctx, ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Hello with an empty name: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0)))
+	c := newTestClient(t, ts, WithLocale("de"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message, _, err := c.Hello(ctx, "Alice")
+	if err != nil {
+		t.Fatalf("Hello: %v", err)
+	}
+	if want := "Hallo, Alice!"; message != want {
+		t.Errorf("Hello: got %q, want %q", message, want)
+	}
+	message, _, err = c.Batch(ctx, []string{"Alice", "Bob"})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	if want := "Hallo Alice, Bob"; message != want {
+		t.Errorf("Batch: got %q, want %q", message, want)
+	}
+}
+
+func TestHelloStream(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0)))
+	c := newTestClient(t, ts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got []string
+	_, err := c.HelloStream(ctx, "Alice", func(resp *pb.HelloReply) error {
+		got = append(got, resp.Message)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("HelloStream: %v", err)
+	}
+	if len(got) != 5 || got[0] != "Hello 1, Alice!" || got[4] != "Hello 5, Alice!" {
+		t.Errorf("got %q, want five greetings", got)
+	}
+}
+
+func TestHelloStreamOptions(t *testing.T) {
+	c := newTestClient(t, testutil.Start(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got int
+	_, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error {
+		got++
+		return nil
+	}, StreamCount(2), StreamInterval(0))
+	if err != nil {
+		t.Fatalf("HelloStream: %v", err)
+	}
+	if got != 2 {
+		t.Errorf("got %d replies, want 2", got)
+	}
+}
+
+func TestHelloStreamInterrupted(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(10*time.Millisecond)))
+	c := newTestClient(t, ts)
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error {
+			cancel()
+			return nil
+		}, StreamCount(100))
+		var partial *PartialStreamError
+		if !errors.As(err, &partial) {
+			t.Fatalf("got %v, want a *PartialStreamError", err)
+		}
+		if partial.Received != 1 || status.Code(err) != codes.Canceled {
+			t.Errorf("got %d received and %v, want 1 and Canceled", partial.Received, status.Code(err))
+		}
+	})
+
+	t.Run("cancel after 3", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var got int
+		_, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error {
+			if got++; got == 3 {
+				cancel()
+			}
+			return nil
+		}, StreamCount(100))
+		var partial *PartialStreamError
+		if !errors.As(err, &partial) || partial.Received != 3 {
+			t.Errorf("got %v, want a *PartialStreamError after 3 messages", err)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error { return nil }, StreamCount(1000))
+		var partial *PartialStreamError
+		if !errors.As(err, &partial) || status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("got %v, want a DeadlineExceeded *PartialStreamError", err)
+		}
+		if partial.Received == 0 || !strings.Contains(err.Error(), fmt.Sprintf("after %d messages", partial.Received)) {
+			t.Errorf("got %q with %d received", err, partial.Received)
+		}
+	})
+}
+
+func TestHelloStreamAbort(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(10*time.Millisecond)))
+	c := newTestClient(t, ts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errStop := errors.New("stop")
+	received := 0
+	_, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error {
+		received++
+		if received == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("got %v, want the callback's error", err)
+	}
+	if received != 2 {
+		t.Errorf("callback ran %d times, want 2", received)
+	}
+}
+
+func TestChat(t *testing.T) {
+	c := newTestClient(t, testutil.Start(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got []string
+	err := c.Chat(ctx, []string{"Alice", "Bob"}, func(resp *pb.HelloReply) error {
+		got = append(got, resp.Message)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if !slices.Equal(got, []string{"Hello, Alice!", "Hello, Bob!"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+// heartbeatServer surrounds each stream reply with heartbeats.
+type heartbeatServer struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (heartbeatServer) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	heartbeat := &pb.HelloReply{IsHeartbeat: true}
+	for i := 1; i <= 2; i++ {
+		if err := stream.Send(heartbeat); err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.HelloReply{Message: fmt.Sprintf("Hello %d, %s!", i, req.Name)}); err != nil {
+			return err
+		}
+	}
+	return stream.Send(heartbeat)
+}
+
+func (heartbeatServer) SayHelloChat(stream pb.Greeter_SayHelloChatServer) error {
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		if err := stream.Send(&pb.HelloReply{IsHeartbeat: true}); err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.HelloReply{Message: "Hello, " + req.Name + "!"}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestHeartbeatsFiltered(t *testing.T) {
+	c := newTestClient(t, testutil.Start(t, testutil.WithService(heartbeatServer{})))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !c.LastActivity().IsZero() {
+		t.Errorf("got LastActivity %v before any stream, want zero", c.LastActivity())
+	}
+
+	var got []string
+	collect := func(resp *pb.HelloReply) error {
+		if resp.IsHeartbeat {
+			t.Error("heartbeat passed to the callback")
+		}
+		got = append(got, resp.Message)
+		return nil
+	}
+	start := time.Now()
+	if _, err := c.HelloStream(ctx, "Alice", collect); err != nil {
+		t.Fatalf("HelloStream: %v", err)
+	}
+	if !slices.Equal(got, []string{"Hello 1, Alice!", "Hello 2, Alice!"}) {
+		t.Errorf("HelloStream got %q", got)
+	}
+	// The stream ends with a heartbeat, so that is what LastActivity saw
+	if last := c.LastActivity(); last.Before(start) {
+		t.Errorf("got LastActivity %v, want after %v", last, start)
+	}
+
+	got = nil
+	if err := c.ResumableStream(ctx, "Alice", DefaultResumePolicy(), collect); err != nil {
+		t.Fatalf("ResumableStream: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("ResumableStream got %q, want two greetings", got)
+	}
+
+	got = nil
+	if err := c.Chat(ctx, []string{"Alice", "Bob"}, collect); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if !slices.Equal(got, []string{"Hello, Alice!", "Hello, Bob!"}) {
+		t.Errorf("Chat got %q", got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithMaxBatch(2)))
+	c := newTestClient(t, ts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message, count, err := c.Batch(ctx, []string{"Alice", "Bob"})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	if message != "Hello Alice, Bob" || count != 2 {
+		t.Errorf("got %q (Count: %d)", message, count)
+	}
+	if _, _, err := c.Batch(ctx, []string{"Alice", "Bob", "Carol"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Batch over the limit: got %v, want ResourceExhausted", err)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	backends := map[string]*testutil.Server{
+		"replica-a": testutil.Start(t, testutil.WithGreeterOptions(greeter.WithHostname("replica-a"))),
+		"replica-b": testutil.Start(t, testutil.WithGreeterOptions(greeter.WithHostname("replica-b"))),
+	}
+	r := manual.NewBuilderWithScheme("test")
+	r.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: "replica-a"}, {Addr: "replica-b"}}})
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		return backends[addr].Dialer()(ctx, addr)
+	}
+	c, err := New("test:///greeter", WithDialOptions(grpc.WithResolvers(r), grpc.WithContextDialer(dialer)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// round_robin only picks a backend once it is connected, so warm up
+	// until both have served a call
+	seen := map[string]bool{}
+	var last string
+	for len(seen) < 2 {
+		_, _, servedBy, err := c.HelloServedBy(ctx, "Alice")
+		if err != nil {
+			t.Fatalf("HelloServedBy: %v", err)
+		}
+		seen[servedBy] = true
+		last = servedBy
+	}
+	for i := 0; i < 4; i++ {
+		_, _, servedBy, err := c.HelloServedBy(ctx, "Alice")
+		if err != nil {
+			t.Fatalf("HelloServedBy: %v", err)
+		}
+		if servedBy == last {
+			t.Errorf("call %d was served by %q again, want the other replica", i, servedBy)
+		}
+		last = servedBy
+	}
+}
+
+func TestMessageSizeLimits(t *testing.T) {
+	const limit = 1 << 20
+	// A HelloRequest is its name plus 4 bytes of framing, and the reply
+	// adds "Hello, ", "!" and the count
+	tests := []struct {
+		name       string
+		serverOpts []grpc.ServerOption
+		clientOpts []Option
+		under      int
+		over       int
+		wantSend   bool
+	}{
+		{
+			name:       "server receive",
+			serverOpts: []grpc.ServerOption{grpc.MaxRecvMsgSize(limit)},
+			under:      limit - 4,
+			over:       limit - 3,
+		},
+		{
+			name:       "server send",
+			serverOpts: []grpc.ServerOption{grpc.MaxSendMsgSize(limit)},
+			under:      limit - 64,
+			over:       limit,
+			wantSend:   true,
+		},
+		{
+			name:       "client receive",
+			clientOpts: []Option{WithMaxRecvMsgSize(limit)},
+			under:      limit - 64,
+			over:       limit,
+		},
+		{
+			name:       "client send",
+			clientOpts: []Option{WithMaxSendMsgSize(limit)},
+			under:      limit - 4,
+			over:       limit - 3,
+			wantSend:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := testutil.Start(t, testutil.WithServerOptions(tt.serverOpts...))
+			c := newTestClient(t, ts, tt.clientOpts...)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if _, _, err := c.Hello(ctx, strings.Repeat("x", tt.under)); err != nil {
+				t.Fatalf("Hello just under the limit: %v", err)
+			}
+			_, _, err := c.Hello(ctx, strings.Repeat("x", tt.over))
+			var sizeErr *MessageSizeError
+			if !errors.As(err, &sizeErr) {
+				t.Fatalf("Hello just over the limit: got %v, want a MessageSizeError", err)
+			}
+			if sizeErr.Limit != limit || sizeErr.Size <= limit || sizeErr.Send != tt.wantSend {
+				t.Errorf("got %+v, want limit %d and send %v", sizeErr, limit, tt.wantSend)
+			}
+			if status.Code(err) != codes.ResourceExhausted {
+				t.Errorf("status.Code = %v, want ResourceExhausted", status.Code(err))
+			}
+			if want := fmt.Sprintf("larger than the %d-byte", limit); !strings.Contains(DescribeError(err), want) {
+				t.Errorf("DescribeError = %q, want it to contain %q", DescribeError(err), want)
+			}
+		})
+	}
+}
+
+func TestChatOverSendLimit(t *testing.T) {
+	const limit = 1 << 10
+	c := newTestClient(t, testutil.Start(t), WithMaxSendMsgSize(limit))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.Chat(ctx, []string{"Alice", strings.Repeat("x", limit)}, func(*pb.HelloReply) error { return nil })
+	var sizeErr *MessageSizeError
+	if !errors.As(err, &sizeErr) || !sizeErr.Send {
+		t.Errorf("got %v, want a send MessageSizeError", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	c := newTestClient(t, testutil.Start(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// More than one page
+	var names []string
+	for i := 0; i < listPageSize+5; i++ {
+		name := fmt.Sprintf("name-%d", i)
+		if _, _, err := c.Hello(ctx, name); err != nil {
+			t.Fatalf("Hello: %v", err)
+		}
+		names = append(names, name)
+	}
+
+	list := func(limit int) []string {
+		var got []string
+		err := c.List(ctx, limit, func(g *pb.GreetingRecord) error {
+			got = append(got, g.Name)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("List(%d): %v", limit, err)
+		}
+		return got
+	}
+	if got := list(0); !slices.Equal(got, names) {
+		t.Errorf("List(0) returned %d greetings, want all %d in order", len(got), len(names))
+	}
+	if got := list(listPageSize + 2); !slices.Equal(got, names[:listPageSize+2]) {
+		t.Errorf("List(%d) returned %d greetings, want the first %d", listPageSize+2, len(got), listPageSize+2)
+	}
+	if got := list(3); !slices.Equal(got, names[:3]) {
+		t.Errorf("List(3) = %v, want %v", got, names[:3])
+	}
+}
+
+func TestHelloReply(t *testing.T) {
+	c := newTestClient(t, testutil.Start(t, testutil.WithGreeterOptions(greeter.WithInstanceID("replica-a"))))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.HelloReply(ctx, "Alice")
+	if err != nil {
+		t.Fatalf("HelloReply: %v", err)
+	}
+	if resp.Message != "Hello, Alice!" || resp.ServedBy != "replica-a" || resp.ServedAt == nil {
+		t.Errorf("got %v, want a greeting served by replica-a with a timestamp", resp)
+	}
+}
+
+// freeAddr returns a loopback address nothing is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	return addr
+}
+
+func TestWaitForReady(t *testing.T) {
+	addr := freeAddr(t)
+	c, err := New(addr,
+		WithWaitForReady(true),
+		WithConnectTimeout(5*time.Second),
+		WithBackoff(backoff.Config{BaseDelay: 50 * time.Millisecond, MaxDelay: 100 * time.Millisecond}),
+		// Shorter than the server's delay, since the connect wait is not
+		// counted against it
+		WithTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Start the server only after the client is already trying to connect
+	gs := grpc.NewServer()
+	greeter.New().Register(gs)
+	defer gs.Stop()
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("Listen: %v", err)
+			return
+		}
+		gs.Serve(lis)
+	}()
+
+	start := time.Now()
+	message, _, err := c.Hello(context.Background(), "Alice")
+	if err != nil {
+		t.Fatalf("Hello: %v", err)
+	}
+	if message != "Hello, Alice!" {
+		t.Errorf("got %q", message)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Hello returned after %v, want between the server start and the connect timeout", elapsed)
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	c, err := New(freeAddr(t),
+		WithConnectTimeout(200*time.Millisecond),
+		WithBackoff(backoff.Config{BaseDelay: 50 * time.Millisecond, MaxDelay: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	_, _, err = c.Hello(context.Background(), "Alice")
+	if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), "server never became ready within 200ms") {
+		t.Errorf("got %v, want Unavailable: server never became ready", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up after %v with a 200ms connect timeout", elapsed)
+	}
+
+	// The caller's own deadline still wins
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error { return nil }); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("HelloStream: got %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestWithDialer(t *testing.T) {
+	ts := testutil.Start(t)
+	var dialed atomic.Int32
+	dial := ts.Dialer()
+	c, err := New(testutil.Target, WithDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed.Add(1)
+		return dial(ctx, addr)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, _, err := c.Hello(context.Background(), "Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if dialed.Load() == 0 {
+		t.Error("the client did not dial through WithDialer")
+	}
+}
+
+// echoMetadata returns server options whose interceptors copy the incoming
+// x-client-tag into an x-echo header and set an x-done trailer.
+func echoMetadata() []grpc.ServerOption {
+	md := func(ctx context.Context) (metadata.MD, metadata.MD) {
+		in, _ := metadata.FromIncomingContext(ctx)
+		return metadata.MD{"x-echo": in.Get("x-client-tag")}, metadata.Pairs("x-done", "yes")
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			header, trailer := md(ctx)
+			grpc.SetHeader(ctx, header)
+			grpc.SetTrailer(ctx, trailer)
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			header, trailer := md(ss.Context())
+			ss.SetHeader(header)
+			ss.SetTrailer(trailer)
+			return handler(srv, ss)
+		}),
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithServerOptions(echoMetadata()...), testutil.WithGreeterOptions(greeter.WithInstanceID("replica-1")))
+	c := newTestClient(t, ts,
+		WithMetadata(metadata.Pairs("x-client-tag", "a")),
+		WithMetadata(metadata.Pairs("x-client-tag", "b")))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := c.HelloWithMetadata(ctx, "Alice")
+	if err != nil {
+		t.Fatalf("HelloWithMetadata: %v", err)
+	}
+	if result.Message != "Hello, Alice!" || result.Count != 1 {
+		t.Errorf("got %q (Count: %d)", result.Message, result.Count)
+	}
+	if got := result.Header.Get("x-echo"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("unary x-echo header = %q, want [a b]", got)
+	}
+	if got := result.Header.Get(greeter.ServedByHeader); !slices.Equal(got, []string{"replica-1"}) {
+		t.Errorf("unary %s header = %q", greeter.ServedByHeader, got)
+	}
+	if got := result.Trailer.Get("x-done"); !slices.Equal(got, []string{"yes"}) {
+		t.Errorf("unary x-done trailer = %q, want [yes]", got)
+	}
+
+	var header, trailer metadata.MD
+	replies := 0
+	_, err = c.HelloStream(ctx, "Bob", func(*pb.HelloReply) error {
+		if header == nil {
+			t.Error("reply arrived before the header callback")
+		}
+		replies++
+		return nil
+	}, StreamCount(2), StreamInterval(0),
+		OnHeader(func(md metadata.MD) { header = md }),
+		OnTrailer(func(md metadata.MD) { trailer = md }))
+	if err != nil || replies != 2 {
+		t.Fatalf("HelloStream: %d replies, %v", replies, err)
+	}
+	if got := header.Get("x-echo"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("stream x-echo header = %q, want [a b]", got)
+	}
+	if got := trailer.Get("x-done"); !slices.Equal(got, []string{"yes"}) {
+		t.Errorf("stream x-done trailer = %q, want [yes]", got)
+	}
+}
+
+func TestHelloWithMetadataError(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithServerOptions(echoMetadata()...))
+	c := newTestClient(t, ts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The trailer set before the handler rejects the name still arrives
+	result, err := c.HelloWithMetadata(ctx, "")
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument", err)
+	}
+	if got := result.Trailer.Get("x-done"); !slices.Equal(got, []string{"yes"}) {
+		t.Errorf("x-done trailer = %q, want [yes]", got)
+	}
+}
@@ -0,0 +1,106 @@
+package greeterclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// PingFailure classifies why Ping failed.
+type PingFailure string
+
+// The reasons Ping reports.
+const (
+	// PingDNS means the server's name did not resolve.
+	PingDNS PingFailure = "dns"
+	// PingConnectionRefused means nothing listens at the address.
+	PingConnectionRefused PingFailure = "connection_refused"
+	// PingTLSHandshake means the TLS handshake failed, e.g. over a bad
+	// certificate or a server without TLS.
+	PingTLSHandshake PingFailure = "tls_handshake"
+	// PingNotServing means the health check reported anything but SERVING.
+	PingNotServing PingFailure = "not_serving"
+	// PingTimeout means the connection was not ready before the deadline.
+	PingTimeout PingFailure = "timeout"
+	// PingUnavailable covers any other failure to connect or to check health.
+	PingUnavailable PingFailure = "unavailable"
+)
+
+// PingError reports a failed Ping.
+type PingError struct {
+	Reason PingFailure
+	Err    error
+}
+
+func (e *PingError) Error() string {
+	return fmt.Sprintf("ping failed (%s): %s", e.Reason, status.Convert(e.Err).Message())
+}
+
+func (e *PingError) Unwrap() error {
+	return e.Err
+}
+
+// Ping checks the server is reachable without greeting anyone. It waits for
+// the connection to become ready, for as long as ctx allows, and with deep
+// set also requires the health check of the Greeter version it calls to
+// report SERVING. Failures are a *PingError.
+func (c *Client) Ping(ctx context.Context, deep bool) error {
+	c.conn.Connect()
+	for state := c.conn.GetState(); state != connectivity.Ready; state = c.conn.GetState() {
+		if state == connectivity.TransientFailure {
+			if err := c.probe(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if !c.conn.WaitForStateChange(ctx, state) {
+			return &PingError{Reason: PingTimeout, Err: status.FromContextError(ctx.Err()).Err()}
+		}
+	}
+	if !deep {
+		return nil
+	}
+	resp, err := healthpb.NewHealthClient(c.conn).Check(ctx, &healthpb.HealthCheckRequest{Service: c.serviceName()})
+	if err != nil {
+		return &PingError{Reason: pingFailure(err), Err: err}
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return &PingError{Reason: PingNotServing, Err: fmt.Errorf("health status %s", resp.Status)}
+	}
+	return nil
+}
+
+// probe finds out why the connection failed: gRPC keeps the cause to
+// itself, except in the error failing an RPC attempted meanwhile. It returns
+// nil if the RPC went through because the connection recovered.
+func (c *Client) probe(ctx context.Context) error {
+	_, err := healthpb.NewHealthClient(c.conn).Check(ctx, &healthpb.HealthCheckRequest{Service: c.serviceName()},
+		grpc.WaitForReady(false))
+	if err != nil {
+		return &PingError{Reason: pingFailure(err), Err: err}
+	}
+	return nil
+}
+
+// pingFailure classifies a connection error from the text gRPC gives it.
+func pingFailure(err error) PingFailure {
+	msg := status.Convert(err).Message()
+	switch {
+	case strings.Contains(msg, "lookup ") || strings.Contains(msg, "no such host") ||
+		strings.Contains(msg, "produced zero addresses") || strings.Contains(msg, "name resolver error"):
+		return PingDNS
+	case strings.Contains(msg, "connection refused"):
+		return PingConnectionRefused
+	case strings.Contains(msg, "handshake") || strings.Contains(msg, "tls: ") || strings.Contains(msg, "x509: "):
+		return PingTLSHandshake
+	case status.Code(err) == codes.DeadlineExceeded:
+		return PingTimeout
+	}
+	return PingUnavailable
+}
@@ -0,0 +1,104 @@
+package greeterclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestPing(t *testing.T) {
+	ts := testutil.Start(t)
+	notServing := testutil.Start(t)
+	notServing.Service.SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	tests := []struct {
+		name   string
+		client func(t *testing.T) *Client
+		deep   bool
+		want   PingFailure // empty for success
+	}{
+		{name: "ready", client: func(t *testing.T) *Client { return newTestClient(t, ts) }},
+		{name: "serving", client: func(t *testing.T) *Client { return newTestClient(t, ts) }, deep: true},
+		{name: "not serving, shallow", client: func(t *testing.T) *Client { return newTestClient(t, notServing) }},
+		{name: "not serving", client: func(t *testing.T) *Client { return newTestClient(t, notServing) }, deep: true, want: PingNotServing},
+		{
+			name: "connection refused",
+			client: func(t *testing.T) *Client {
+				c, err := New(freeAddr(t))
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { c.Close() })
+				return c
+			},
+			want: PingConnectionRefused,
+		},
+		{
+			name: "TLS to a plaintext server",
+			client: func(t *testing.T) *Client {
+				return newTestClient(t, ts, WithCredentials(credentials.NewTLS(&tls.Config{ServerName: "greeter.test"})))
+			},
+			want: PingTLSHandshake,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := tt.client(t).Ping(ctx, tt.deep)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Ping: %v", err)
+				}
+				return
+			}
+			var pe *PingError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Ping: got %v, want a *PingError", err)
+			}
+			if pe.Reason != tt.want {
+				t.Errorf("Ping: reason %s, want %s (%v)", pe.Reason, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	c, err := New(freeAddr(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var pe *PingError
+	if err := c.Ping(ctx, false); !errors.As(err, &pe) || pe.Reason != PingTimeout {
+		t.Errorf("Ping with a done context: got %v, want a %s failure", err, PingTimeout)
+	}
+}
+
+func TestPingFailure(t *testing.T) {
+	for msg, want := range map[string]PingFailure{
+		`name resolver error: produced zero addresses`:                                                                                PingDNS,
+		`dns: A record lookup error: lookup greeter.invalid on 127.0.0.53:53: no such host`:                                           PingDNS,
+		`connection error: desc = "transport: Error while dialing: dial tcp 127.0.0.1:1: connect: connection refused"`:                PingConnectionRefused,
+		`connection error: desc = "transport: authentication handshake failed: tls: first record does not look like a TLS handshake"`: PingTLSHandshake,
+		`connection error: desc = "transport: authentication handshake failed: x509: certificate signed by unknown authority"`:        PingTLSHandshake,
+		`connection error: desc = "transport: Error while dialing: dial tcp: i/o timeout"`:                                            PingUnavailable,
+	} {
+		if got := pingFailure(status.Error(codes.Unavailable, msg)); got != want {
+			t.Errorf("pingFailure(%q) = %s, want %s", msg, got, want)
+		}
+	}
+	if got := pingFailure(status.Error(codes.DeadlineExceeded, "context deadline exceeded")); got != PingTimeout {
+		t.Errorf("pingFailure(DeadlineExceeded) = %s, want %s", got, PingTimeout)
+	}
+}
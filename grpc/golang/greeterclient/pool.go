@@ -0,0 +1,349 @@
+package greeterclient
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultPoolSize is the connections a Pool keeps when PoolOptions set no
+// Size.
+const defaultPoolSize = 4
+
+// PoolPolicy is how a Pool picks the connection for each call.
+type PoolPolicy int
+
+const (
+	// PoolRoundRobin hands calls to the connections in turn.
+	PoolRoundRobin PoolPolicy = iota
+	// PoolLeastInFlight hands each call to the connection carrying the
+	// fewest calls, taking tied connections in turn.
+	PoolLeastInFlight
+)
+
+// PoolOptions configures a Pool.
+type PoolOptions struct {
+	// Size is how many connections the pool keeps to its target;
+	// defaultPoolSize applies when it is zero.
+	Size   int
+	Policy PoolPolicy
+	// IdleTimeout closes connections that have carried no call for this
+	// long. A closed connection is opened again by the next call picking
+	// it. Connections are never closed for idleness when it is zero.
+	IdleTimeout time.Duration
+}
+
+// errPoolClosed fails calls made once Close has been called, as a closed
+// grpc.ClientConn does.
+var errPoolClosed = status.Error(codes.Canceled, "greeterclient: pool is closed")
+
+// Pool spreads calls over several connections to one target, for callers
+// whose call rate a single connection's HTTP/2 stream limit would cap. It
+// is a grpc.ClientConnInterface, so generated stubs can call through it,
+// e.g. pb.NewGreeterClient(pool). A Pool is safe for concurrent use.
+type Pool struct {
+	target      string
+	dialOpts    []grpc.DialOption
+	policy      PoolPolicy
+	idleTimeout time.Duration
+	// now returns the time connections are last used at, for idle reaping.
+	now func() time.Time
+
+	mu    sync.Mutex
+	conns []poolConn
+	// next is where the next pick starts among conns.
+	next   int
+	closed bool
+	// calls tracks the calls in flight, for Close to wait on.
+	calls sync.WaitGroup
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// poolConn is one of a Pool's connections. Its fields are guarded by the
+// Pool's mu.
+type poolConn struct {
+	// conn is nil until the first call on it, and again once reaped.
+	conn     *grpc.ClientConn
+	inFlight int
+	lastUsed time.Time
+}
+
+// NewPool returns a Pool of connections to addr, given as to New and set
+// up by opts as a Client's connection would be. Only the options applying
+// to connections take effect; those such as WithTimeout and WithLocale
+// apply to Client calls and are ignored. Connections are opened lazily by
+// the first call on each, or all at once by Warmup.
+func NewPool(addr string, popts PoolOptions, opts ...Option) (*Pool, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	target, endpointOpts := endpoint.Dial(addr)
+	size := popts.Size
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+	p := &Pool{
+		target:      target,
+		dialOpts:    append(endpointOpts, o.dialOptions()...),
+		policy:      popts.Policy,
+		idleTimeout: popts.IdleTimeout,
+		now:         time.Now,
+		conns:       make([]poolConn, size),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	// Fail on a bad target or option now rather than on the first call
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	p.conns[0] = poolConn{conn: conn, lastUsed: p.now()}
+	go p.reapIdle()
+	return p, nil
+}
+
+func (p *Pool) dial() (*grpc.ClientConn, error) {
+	return grpc.NewClient(p.target, p.dialOpts...)
+}
+
+// Warmup opens every connection and waits until ctx ends for all of them
+// to become ready, returning an Unavailable error naming those that did
+// not.
+func (p *Pool) Warmup(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errPoolClosed
+	}
+	conns := make([]*grpc.ClientConn, len(p.conns))
+	for i := range p.conns {
+		pc := &p.conns[i]
+		if pc.conn == nil {
+			conn, err := p.dial()
+			if err != nil {
+				p.mu.Unlock()
+				return err
+			}
+			pc.conn = conn
+		}
+		pc.lastUsed = p.now()
+		conns[i] = pc.conn
+	}
+	p.mu.Unlock()
+
+	errs := make([]error, len(conns))
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.Connect()
+			if state, ready := waitReady(ctx, conn); !ready {
+				errs[i] = status.Errorf(codes.Unavailable, "connection %d never became ready (%s)", i, state)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// pick returns the connection for a call, opening it if need be, and the
+// function to call when the call is done.
+func (p *Pool) pick() (*grpc.ClientConn, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, nil, errPoolClosed
+	}
+	i := p.next % len(p.conns)
+	if p.policy == PoolLeastInFlight {
+		for n := 1; n < len(p.conns); n++ {
+			j := (p.next + n) % len(p.conns)
+			if p.conns[j].inFlight < p.conns[i].inFlight {
+				i = j
+			}
+		}
+	}
+	p.next = i + 1
+	pc := &p.conns[i]
+	if pc.conn == nil {
+		conn, err := p.dial()
+		if err != nil {
+			return nil, nil, err
+		}
+		pc.conn = conn
+	}
+	pc.inFlight++
+	pc.lastUsed = p.now()
+	p.calls.Add(1)
+	var once sync.Once
+	return pc.conn, func() {
+		once.Do(func() {
+			p.mu.Lock()
+			pc.inFlight--
+			pc.lastUsed = p.now()
+			p.mu.Unlock()
+			p.calls.Done()
+		})
+	}, nil
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (p *Pool) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	conn, done, err := p.pick()
+	if err != nil {
+		return err
+	}
+	defer done()
+	return conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream implements grpc.ClientConnInterface. The stream counts as in
+// flight until RecvMsg returns its end or an error, or ctx ends, so read
+// streams to the end or cancel them.
+func (p *Pool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	conn, done, err := p.pick()
+	if err != nil {
+		return nil, err
+	}
+	cs, err := conn.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	s := &poolStream{ClientStream: cs, serverStreams: desc.ServerStreams, done: done, finished: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.finish()
+		case <-s.finished:
+		}
+	}()
+	return s, nil
+}
+
+// poolStream is a stream on a Pool connection that reports when it ends.
+type poolStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	done          func()
+	once          sync.Once
+	finished      chan struct{}
+}
+
+func (s *poolStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	// A client-streaming call ends with its only response
+	if err != nil || !s.serverStreams {
+		s.finish()
+	}
+	return err
+}
+
+func (s *poolStream) finish() {
+	s.once.Do(func() {
+		close(s.finished)
+		s.done()
+	})
+}
+
+// InFlight returns the number of calls in flight on each connection.
+func (p *Pool) InFlight() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := make([]int, len(p.conns))
+	for i, pc := range p.conns {
+		n[i] = pc.inFlight
+	}
+	return n
+}
+
+// RegisterMetrics registers a gauge of the calls in flight on each
+// connection on reg, labeled by the connection's index.
+func (p *Pool) RegisterMetrics(reg prometheus.Registerer) error {
+	for i := range p.conns {
+		g := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "grpc_client_pool_in_flight",
+			Help:        "Number of calls in flight on a connection of a client pool.",
+			ConstLabels: prometheus.Labels{"conn": strconv.Itoa(i)},
+		}, func() float64 { return float64(p.InFlight()[i]) })
+		if err := reg.Register(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reapIdle closes idle connections until Close, checking twice per idle
+// timeout.
+func (p *Pool) reapIdle() {
+	defer close(p.done)
+	if p.idleTimeout <= 0 {
+		<-p.stop
+		return
+	}
+	t := time.NewTicker(p.idleTimeout / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			p.reap()
+		}
+	}
+}
+
+// reap closes the connections without calls in flight that were last used
+// an idle timeout or more ago.
+func (p *Pool) reap() {
+	var idle []*grpc.ClientConn
+	p.mu.Lock()
+	now := p.now()
+	for i := range p.conns {
+		pc := &p.conns[i]
+		if pc.conn != nil && pc.inFlight == 0 && now.Sub(pc.lastUsed) >= p.idleTimeout {
+			idle = append(idle, pc.conn)
+			pc.conn = nil
+		}
+	}
+	p.mu.Unlock()
+	for _, conn := range idle {
+		conn.Close()
+	}
+}
+
+// Close stops the pool taking calls, waits for those in flight to finish
+// and then closes the connections.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+	close(p.stop)
+	<-p.done
+	p.calls.Wait()
+
+	var errs []error
+	for i := range p.conns {
+		if conn := p.conns[i].conn; conn != nil {
+			errs = append(errs, conn.Close())
+			p.conns[i].conn = nil
+		}
+	}
+	return errors.Join(errs...)
+}
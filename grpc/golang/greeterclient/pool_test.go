@@ -0,0 +1,265 @@
+package greeterclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// peerLog records the client address of each unary call, which tells the
+// connections of a pool apart by their port.
+type peerLog struct {
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (l *peerLog) interceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		l.mu.Lock()
+		l.addrs = append(l.addrs, p.Addr.String())
+		l.mu.Unlock()
+	}
+	return handler(ctx, req)
+}
+
+// since returns the calls on each client address after the first n logged.
+func (l *peerLog) since(n int) map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	calls := make(map[string]int)
+	for _, addr := range l.addrs[n:] {
+		calls[addr]++
+	}
+	return calls
+}
+
+func (l *peerLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.addrs)
+}
+
+// startTCP serves a Greeter on a loopback port, returning its address, the
+// log of its callers and a function stopping it.
+func startTCP(t *testing.T) (string, *peerLog, func()) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := &peerLog{}
+	gs := grpc.NewServer(grpc.UnaryInterceptor(peers.interceptor))
+	greeter.New(greeter.WithStreamInterval(0)).Register(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	return lis.Addr().String(), peers, gs.Stop
+}
+
+func newPool(t *testing.T, addr string, opts PoolOptions) *Pool {
+	t.Helper()
+	p, err := NewPool(addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func hello(t *testing.T, ctx context.Context, p *Pool, n int) {
+	t.Helper()
+	client := pb.NewGreeterClient(p)
+	for i := 0; i < n; i++ {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+}
+
+// holdStream opens a SayHelloStream of three replies interval apart and
+// reads the first. ctx should have no deadline, which the server would
+// find too short for the stream.
+func holdStream(t *testing.T, ctx context.Context, p *Pool, interval time.Duration) pb.Greeter_SayHelloStreamClient {
+	t.Helper()
+	stream, err := pb.NewGreeterClient(p).SayHelloStream(ctx, &pb.HelloRequest{Name: "Bob", Count: proto.Int32(3), Interval: durationpb.New(interval)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func TestPoolSpreadsCalls(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, policy := range []PoolPolicy{PoolRoundRobin, PoolLeastInFlight} {
+		addr, peers, _ := startTCP(t)
+		p := newPool(t, addr, PoolOptions{Size: 3, Policy: policy})
+		hello(t, ctx, p, 30)
+		calls := peers.since(0)
+		if len(calls) != 3 {
+			t.Errorf("policy %d: calls came from %v, want 3 connections", policy, calls)
+		}
+		for addr, n := range calls {
+			if n != 10 {
+				t.Errorf("policy %d: connection %s carried %d of 30 calls, want 10", policy, addr, n)
+			}
+		}
+	}
+}
+
+func TestPoolLeastInFlight(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr, peers, _ := startTCP(t)
+	p := newPool(t, addr, PoolOptions{Size: 3, Policy: PoolLeastInFlight})
+	hello(t, ctx, p, 3)
+
+	streamCtx, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+	holdStream(t, streamCtx, p, time.Minute)
+	holdStream(t, streamCtx, p, time.Minute)
+	inFlight := p.InFlight()
+	if got := inFlight[0] + inFlight[1] + inFlight[2]; got != 2 {
+		t.Fatalf("in flight %v, want the 2 streams", inFlight)
+	}
+	// Every call goes to the one connection without a stream
+	n := peers.len()
+	hello(t, ctx, p, 6)
+	if calls := peers.since(n); len(calls) != 1 {
+		t.Errorf("with two connections busy, calls came from %v, want one connection", calls)
+	}
+
+	stopStreams()
+	deadline := time.Now().Add(5 * time.Second)
+	for inFlight := p.InFlight(); inFlight[0]+inFlight[1]+inFlight[2] > 0; inFlight = p.InFlight() {
+		if time.Now().After(deadline) {
+			t.Fatalf("in flight %v after the streams were cancelled, want none", inFlight)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolWarmup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr, _, _ := startTCP(t)
+	p := newPool(t, addr, PoolOptions{Size: 3})
+	if err := p.Warmup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i, pc := range p.conns {
+		if state := pc.conn.GetState(); state != connectivity.Ready {
+			t.Errorf("connection %d is %s after warmup, want READY", i, state)
+		}
+	}
+
+	down := newPool(t, freeAddr(t), PoolOptions{Size: 2})
+	warmCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := down.Warmup(warmCtx); status.Code(err) != codes.Unavailable {
+		t.Errorf("warmup with no server = %v, want Unavailable", err)
+	}
+}
+
+func TestPoolIdleReaping(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr, peers, _ := startTCP(t)
+	// An idle timeout long enough that only reap calls close connections
+	p := newPool(t, addr, PoolOptions{Size: 3, IdleTimeout: time.Hour})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	hello(t, ctx, p, 3)
+	before := peers.since(0)
+
+	// A connection busy with a stream is kept however long it has been
+	now = now.Add(30 * time.Minute)
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	defer stopStream()
+	stream := holdStream(t, streamCtx, p, 100*time.Millisecond)
+	now = now.Add(2 * time.Hour)
+	p.reap()
+	open := 0
+	for _, pc := range p.conns {
+		if pc.conn != nil {
+			open++
+		}
+	}
+	if open != 1 {
+		t.Fatalf("%d connections open after reaping, want only the stream's", open)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Errorf("stream on a connection kept by reaping failed: %v", err)
+	}
+
+	// The two reaped connections are opened again, from new ports
+	n := peers.len()
+	hello(t, ctx, p, 3)
+	after := peers.since(n)
+	reopened := 0
+	for addr := range after {
+		if before[addr] == 0 {
+			reopened++
+		}
+	}
+	if len(after) != 3 || reopened != 2 {
+		t.Errorf("after reaping calls came from %v, before from %v; want the kept connection and 2 new ones", after, before)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr, _, stop := startTCP(t)
+	defer stop()
+	p, err := NewPool(addr, PoolOptions{Size: 2, IdleTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello(t, ctx, p, 2)
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	defer stopStream()
+	stream := holdStream(t, streamCtx, p, 100*time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- p.Close() }()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v with a stream in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := pb.NewGreeterClient(p).SayHello(ctx, &pb.HelloRequest{Name: "Ada"}); status.Code(err) != codes.Canceled {
+		t.Errorf("call on a closing pool = %v, want Canceled", err)
+	}
+
+	// The stream drains, so Close can finish
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("stream in flight during Close failed: %v", err)
+		}
+	}
+	if err := <-closed; err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package greeterclient
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ResumePolicy controls how ResumableStream recovers a broken stream.
+type ResumePolicy struct {
+	// MaxAttempts is how many times in a row the stream is re-issued
+	// without receiving a new reply before the error is returned.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first attempt; each further
+	// wait doubles, capped at MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultResumePolicy returns a policy of 5 attempts backing off from 100ms
+// to 2s, riding out a server restart of a few seconds.
+func DefaultResumePolicy() ResumePolicy {
+	return ResumePolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}
+}
+
+// backoff returns the wait before attempt n, counting from 1.
+func (p ResumePolicy) backoff(n int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < n && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// ResumableStream calls SayHelloStream like HelloStream, but when the stream
+// breaks with Unavailable, e.g. because the server restarted, it re-issues
+// the request with resume_from set to the number of replies already passed
+// to fn, so fn sees each reply once and in order. Should the server not
+// acknowledge resume_from and send the stream from the start, the replies fn
+// already saw are dropped. OnHeader and OnTrailer callbacks run for every
+// attempt.
+func (c *Client) ResumableStream(ctx context.Context, name string, p ResumePolicy, fn func(*pb.HelloReply) error, opts ...StreamOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sc := c.streamConfig(name, opts)
+	if err := c.awaitReady(ctx); err != nil {
+		return partialStreamError(err, 0)
+	}
+	received, attempts := 0, 0
+	for {
+		n, resumable, err := c.streamFrom(ctx, sc, received, fn)
+		received += n
+		if err == nil || !resumable {
+			return err
+		}
+		if n > 0 {
+			attempts = 0
+		}
+		if attempts++; attempts > p.MaxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(p.backoff(attempts)):
+		case <-ctx.Done():
+			return partialStreamError(status.FromContextError(ctx.Err()).Err(), received)
+		}
+	}
+}
+
+// streamFrom issues the stream request to resume after received replies and passes each new
+// reply to fn. It returns how many fn got and whether err is a broken
+// connection worth resuming after.
+func (c *Client) streamFrom(ctx context.Context, sc streamConfig, received int, fn func(*pb.HelloReply) error) (int, bool, error) {
+	sc.req.ResumeFrom = int32(received)
+	stream, err := c.greeter.SayHelloStream(ctx, sc.req)
+	if err != nil {
+		return 0, resumable(err), partialStreamError(sizeError(err), received)
+	}
+	if sc.onTrailer != nil {
+		defer func() { sc.onTrailer(stream.Trailer()) }()
+	}
+	header, err := stream.Header()
+	if err != nil {
+		return 0, resumable(err), partialStreamError(err, received)
+	}
+	if sc.onHeader != nil {
+		sc.onHeader(header)
+	}
+	skip := received
+	if v := header.Get(greeter.ResumedFromHeader); len(v) > 0 {
+		if from, err := strconv.Atoi(v[0]); err == nil {
+			skip = received - from
+		}
+	}
+	n := 0
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return n, false, nil
+		}
+		if err != nil {
+			return n, resumable(err), partialStreamError(sizeError(err), received+n)
+		}
+		if c.heartbeat(resp) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if err := fn(resp); err != nil {
+			return n, false, err
+		}
+		n++
+	}
+}
+
+// resumable reports whether err means the connection broke rather than the
+// server refusing the call.
+func resumable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
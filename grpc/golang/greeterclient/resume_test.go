@@ -0,0 +1,140 @@
+package greeterclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// restartableServer serves a Greeter on a fixed TCP address and can be
+// stopped and started again on it.
+type restartableServer struct {
+	t    *testing.T
+	addr string
+	svc  pb.GreeterServer
+
+	mu sync.Mutex
+	gs *grpc.Server
+}
+
+func newRestartableServer(t *testing.T, svc pb.GreeterServer) *restartableServer {
+	s := &restartableServer{t: t, addr: freeAddr(t), svc: svc}
+	s.start()
+	t.Cleanup(s.stop)
+	return s
+}
+
+func (s *restartableServer) start() {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		s.t.Errorf("Listen: %v", err)
+		return
+	}
+	gs := grpc.NewServer()
+	pb.RegisterGreeterServer(gs, s.svc)
+	s.mu.Lock()
+	s.gs = gs
+	s.mu.Unlock()
+	go gs.Serve(lis)
+}
+
+func (s *restartableServer) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gs.Stop()
+}
+
+// forgetfulGreeter ignores resume_from, like a server predating it.
+type forgetfulGreeter struct {
+	*greeter.Service
+}
+
+func (g forgetfulGreeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	req.ResumeFrom = 0
+	return g.Service.SayHelloStream(req, stream)
+}
+
+func TestResumableStream(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		svc  pb.GreeterServer
+	}{
+		{"server skips delivered replies", greeter.New()},
+		{"client drops resent replies", forgetfulGreeter{greeter.New()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newRestartableServer(t, tt.svc)
+			c, err := New(srv.addr, WithBackoff(backoff.Config{BaseDelay: 50 * time.Millisecond, MaxDelay: 100 * time.Millisecond}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var got []string
+			policy := ResumePolicy{MaxAttempts: 10, InitialBackoff: 50 * time.Millisecond, MaxBackoff: 200 * time.Millisecond}
+			err = c.ResumableStream(ctx, "Alice", policy, func(resp *pb.HelloReply) error {
+				got = append(got, resp.Message)
+				if len(got) == 3 {
+					// Kill the server mid-stream and bring it back shortly
+					srv.stop()
+					time.AfterFunc(200*time.Millisecond, srv.start)
+				}
+				return nil
+			}, StreamCount(6), StreamInterval(50*time.Millisecond))
+			if err != nil {
+				t.Fatalf("ResumableStream: %v", err)
+			}
+			var want []string
+			for i := 1; i <= 6; i++ {
+				want = append(want, fmt.Sprintf("Hello %d, Alice!", i))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestResumableStreamGivesUp(t *testing.T) {
+	srv := newRestartableServer(t, greeter.New())
+	c, err := New(srv.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := 0
+	policy := ResumePolicy{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond}
+	err = c.ResumableStream(ctx, "Alice", policy, func(*pb.HelloReply) error {
+		if received++; received == 2 {
+			srv.stop()
+		}
+		return nil
+	}, StreamCount(5), StreamInterval(20*time.Millisecond))
+	if status.Code(err) != codes.Unavailable || received != 2 {
+		t.Errorf("got %v after %d replies, want Unavailable after 2", err, received)
+	}
+}
+
+func TestResumeBackoff(t *testing.T) {
+	p := ResumePolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 10: 300 * time.Millisecond} {
+		if got := p.backoff(n); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
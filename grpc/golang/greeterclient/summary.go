@@ -0,0 +1,52 @@
+package greeterclient
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"google.golang.org/grpc/metadata"
+)
+
+// StreamSummary compares what the server reports sending on a HelloStream
+// with what the client received, to catch messages lost on the way.
+type StreamSummary struct {
+	// Received is the number of messages the client received, heartbeats
+	// included.
+	Received int64
+	// Reported is whether the stream trailers carried the server's counts.
+	// They do not when the stream is cancelled, which ends it before the
+	// trailers arrive, or when the server predates them.
+	Reported bool
+	// Sent, SentBytes and Duration are the server's count of the messages
+	// it sent, heartbeats included, their encoded size and how long it
+	// spent on the stream.
+	Sent      int64
+	SentBytes int64
+	Duration  time.Duration
+}
+
+// Mismatch reports whether the server reported sending a different number
+// of messages than the client received.
+func (s StreamSummary) Mismatch() bool {
+	return s.Reported && s.Sent != s.Received
+}
+
+// report fills in the server's counts from the stream trailer md, leaving
+// Reported false unless all of them parse.
+func (s *StreamSummary) report(md metadata.MD) {
+	var counts [3]int64
+	for i, key := range []string{greeter.StreamMsgCountTrailer, greeter.StreamBytesTrailer, greeter.StreamDurationTrailer} {
+		v := md.Get(key)
+		if len(v) != 1 {
+			return
+		}
+		n, err := strconv.ParseInt(v[0], 10, 64)
+		if err != nil {
+			return
+		}
+		counts[i] = n
+	}
+	s.Reported = true
+	s.Sent, s.SentBytes, s.Duration = counts[0], counts[1], time.Duration(counts[2])*time.Millisecond
+}
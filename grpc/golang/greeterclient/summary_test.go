@@ -0,0 +1,72 @@
+package greeterclient
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+)
+
+// droppingStream reports its second message as sent without sending it, as
+// a lossy proxy would.
+type droppingStream struct {
+	grpc.ServerStream
+	sent *atomic.Int32
+}
+
+func (s droppingStream) SendMsg(m any) error {
+	if s.sent.Add(1) == 2 {
+		return nil
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func TestStreamSummary(t *testing.T) {
+	c := newTestClient(t, testutil.Start(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	summary, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error { return nil }, StreamCount(3), StreamInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.Reported || summary.Sent != 3 || summary.Received != 3 || summary.SentBytes == 0 || summary.Mismatch() {
+		t.Errorf("got %+v, want 3 messages sent and received", summary)
+	}
+
+	// Cancelling the stream ends it before the trailers arrive
+	errStop := errors.New("stop")
+	summary, err = c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error { return errStop }, StreamCount(3), StreamInterval(0))
+	if !errors.Is(err, errStop) {
+		t.Fatalf("got %v, want the callback's error", err)
+	}
+	if summary.Reported || summary.Received != 1 || summary.Mismatch() {
+		t.Errorf("cancelled stream got %+v, want 1 received and nothing reported", summary)
+	}
+}
+
+func TestStreamSummaryMismatch(t *testing.T) {
+	drop := grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, droppingStream{ss, new(atomic.Int32)})
+	})
+	c := newTestClient(t, testutil.Start(t, testutil.WithServerOptions(drop)))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	replies := 0
+	summary, err := c.HelloStream(ctx, "Alice", func(*pb.HelloReply) error {
+		replies++
+		return nil
+	}, StreamCount(3), StreamInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replies != 2 || summary.Sent != 3 || summary.Received != 2 || !summary.Mismatch() {
+		t.Errorf("got %d replies and %+v, want the dropped message flagged", replies, summary)
+	}
+}
@@ -0,0 +1,61 @@
+package greeterclient
+
+import (
+	"context"
+	"strings"
+
+	"github.com/shrivatsas/exp-codegen/grpc/validate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// WithRejectUnknownFields fails calls whose replies carry fields the
+// client's schema does not know, as a server with a newer or mismatched
+// schema sends them, with Internal naming their tag numbers. By default
+// they are ignored, so servers can add fields without breaking clients;
+// this is for catching schema drift in testing.
+func WithRejectUnknownFields(reject bool) Option {
+	return func(o *options) { o.rejectUnknown = reject }
+}
+
+// checkReply returns an error naming reply's unknown fields, if it has any.
+func checkReply(reply any) error {
+	m, ok := reply.(proto.Message)
+	if !ok {
+		return nil
+	}
+	paths := validate.UnknownFields(m)
+	if len(paths) == 0 {
+		return nil
+	}
+	return status.Errorf(codes.Internal, "greeterclient: unknown fields in %s: %s", m.ProtoReflect().Descriptor().FullName(), strings.Join(paths, ", "))
+}
+
+func unaryUnknownInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+		return err
+	}
+	return checkReply(reply)
+}
+
+func streamUnknownInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &unknownStream{ClientStream: stream}, nil
+}
+
+// unknownStream checks every reply of a stream, not just the first.
+type unknownStream struct {
+	grpc.ClientStream
+}
+
+func (s *unknownStream) RecvMsg(m any) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return checkReply(m)
+}
@@ -0,0 +1,60 @@
+package greeterclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// newerServer replies as a server with a newer schema would, with a string
+// field 9 the client's HelloReply lacks.
+type newerServer struct {
+	pb.UnimplementedGreeterServer
+}
+
+func newerReply(msg string) *pb.HelloReply {
+	reply := &pb.HelloReply{Message: msg}
+	reply.ProtoReflect().SetUnknown(protowire.AppendString(protowire.AppendTag(nil, 9, protowire.BytesType), "extra"))
+	return reply
+}
+
+func (newerServer) SayHello(_ context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return newerReply("Hello, " + req.Name + "!"), nil
+}
+
+func (newerServer) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	return stream.Send(newerReply("Hello, " + req.Name + "!"))
+}
+
+func TestRejectUnknownFields(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithService(newerServer{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const want = "greeterclient: unknown fields in example.HelloReply: 9"
+
+	c := newTestClient(t, ts)
+	if msg, _, err := c.Hello(ctx, "Ada"); err != nil || msg != "Hello, Ada!" {
+		t.Errorf("Hello by default = %q, %v; want the reply", msg, err)
+	}
+	if _, err := c.HelloStream(ctx, "Ada", func(*pb.HelloReply) error { return nil }); err != nil {
+		t.Errorf("HelloStream by default: %v", err)
+	}
+
+	strict := newTestClient(t, ts, WithRejectUnknownFields(true))
+	if _, _, err := strict.Hello(ctx, "Ada"); status.Code(err) != codes.Internal || status.Convert(err).Message() != want {
+		t.Errorf("Hello = %v, want Internal: %s", err, want)
+	}
+	_, err := strict.HelloStream(ctx, "Ada", func(*pb.HelloReply) error {
+		t.Error("reply with unknown fields passed to the callback")
+		return nil
+	})
+	if status.Code(err) != codes.Internal || status.Convert(err).Message() != want {
+		t.Errorf("HelloStream = %v, want Internal: %s", err, want)
+	}
+}
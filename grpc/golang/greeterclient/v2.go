@@ -0,0 +1,123 @@
+package greeterclient
+
+import (
+	"context"
+
+	"github.com/shrivatsas/exp-codegen/grpc/compat"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/grpc"
+)
+
+// WithV2 makes the client call the greeter.v2.Greeter service instead of
+// example.Greeter. The methods and their types stay the same: requests and
+// replies are converted with package compat, so counts only reach 64 bits
+// through the methods returning an int64.
+func WithV2(use bool) Option {
+	return func(o *options) { o.v2 = use }
+}
+
+// serviceName is the Greeter service the client calls.
+func (c *Client) serviceName() string {
+	if c.v2 != nil {
+		return pbv2.Greeter_ServiceDesc.ServiceName
+	}
+	return pb.Greeter_ServiceDesc.ServiceName
+}
+
+// v2Greeter calls the v2 Greeter service through the v1 client interface.
+type v2Greeter struct {
+	client pbv2.GreeterClient
+}
+
+func (g v2Greeter) SayHello(ctx context.Context, in *pb.HelloRequest, opts ...grpc.CallOption) (*pb.HelloReply, error) {
+	resp, err := g.client.SayHello(ctx, compat.V2HelloRequest(in), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1HelloReply(resp), nil
+}
+
+func (g v2Greeter) SayHelloStream(ctx context.Context, in *pb.HelloRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[pb.HelloReply], error) {
+	stream, err := g.client.SayHelloStream(ctx, compat.V2HelloRequest(in), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return v2ServerStream{stream}, nil
+}
+
+func (g v2Greeter) SayHelloChat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[pb.HelloRequest, pb.HelloReply], error) {
+	stream, err := g.client.SayHelloChat(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return v2BidiStream{stream}, nil
+}
+
+func (g v2Greeter) SayHelloBatch(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[pb.HelloRequest, pb.HelloReply], error) {
+	stream, err := g.client.SayHelloBatch(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return v2ClientStream{stream}, nil
+}
+
+func (g v2Greeter) ListGreetings(ctx context.Context, in *pb.ListGreetingsRequest, opts ...grpc.CallOption) (*pb.ListGreetingsResponse, error) {
+	resp, err := g.client.ListGreetings(ctx, compat.V2ListGreetingsRequest(in), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1ListGreetingsResponse(resp), nil
+}
+
+func (g v2Greeter) GetGreetingCount(ctx context.Context, in *pb.GetCountRequest, opts ...grpc.CallOption) (*pb.GetCountResponse, error) {
+	resp, err := g.client.GetGreetingCount(ctx, compat.V2GetCountRequest(in), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1GetCountResponse(resp), nil
+}
+
+type v2ServerStream struct {
+	grpc.ServerStreamingClient[pbv2.HelloReply]
+}
+
+func (s v2ServerStream) Recv() (*pb.HelloReply, error) {
+	resp, err := s.ServerStreamingClient.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1HelloReply(resp), nil
+}
+
+type v2BidiStream struct {
+	grpc.BidiStreamingClient[pbv2.HelloRequest, pbv2.HelloReply]
+}
+
+func (s v2BidiStream) Send(req *pb.HelloRequest) error {
+	return s.BidiStreamingClient.Send(compat.V2HelloRequest(req))
+}
+
+func (s v2BidiStream) Recv() (*pb.HelloReply, error) {
+	resp, err := s.BidiStreamingClient.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1HelloReply(resp), nil
+}
+
+type v2ClientStream struct {
+	grpc.ClientStreamingClient[pbv2.HelloRequest, pbv2.HelloReply]
+}
+
+func (s v2ClientStream) Send(req *pb.HelloRequest) error {
+	return s.ClientStreamingClient.Send(compat.V2HelloRequest(req))
+}
+
+func (s v2ClientStream) CloseAndRecv() (*pb.HelloReply, error) {
+	resp, err := s.ClientStreamingClient.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	return compat.V1HelloReply(resp), nil
+}
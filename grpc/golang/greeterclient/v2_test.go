@@ -0,0 +1,83 @@
+package greeterclient
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestV2SharesCounts(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0)))
+	v1 := newTestClient(t, ts)
+	v2 := newTestClient(t, ts, WithV2(true))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i, c := range []*Client{v1, v2, v1, v2} {
+		message, count, err := c.Hello(ctx, "Alice")
+		if err != nil {
+			t.Fatalf("Hello %d: %v", i, err)
+		}
+		if !strings.Contains(message, "Alice!") || count != int64(i+1) {
+			t.Errorf("Hello %d = %q, count %d; want Alice greeted and %d", i, message, count, i+1)
+		}
+	}
+
+	var replies []*pb.HelloReply
+	if _, err := v2.HelloStream(ctx, "Alice", func(r *pb.HelloReply) error {
+		replies = append(replies, r)
+		return nil
+	}, StreamCount(2)); err != nil {
+		t.Fatalf("v2 HelloStream: %v", err)
+	}
+	if len(replies) != 2 || replies[1].GreetingCount != 6 || replies[1].Message == "" {
+		t.Errorf("v2 HelloStream = %v, want 2 replies ending at count 6", replies)
+	}
+	if _, count, err := v2.Batch(ctx, []string{"Alice", "Bob"}); err != nil || count != 2 {
+		t.Errorf("v2 Batch: got count %d, %v; want 2", count, err)
+	}
+	for _, c := range []*Client{v1, v2} {
+		if count, _, err := c.Count(ctx, "Alice", true); err != nil || count != 7 {
+			t.Errorf("Count (v2 %t): got %d, %v; want 7", c.v2 != nil, count, err)
+		}
+	}
+	var listed int
+	if err := v2.List(ctx, 0, func(g *pb.GreetingRecord) error {
+		if g.Name != "Alice" || !strings.Contains(g.Message, "Alice!") {
+			t.Errorf("v2 List returned %v", g)
+		}
+		listed++
+		return nil
+	}); err != nil || listed != 4 {
+		t.Errorf("v2 List: got %d greetings, %v; want the 4 from Hello", listed, err)
+	}
+}
+
+func TestV2Ping(t *testing.T) {
+	ts := testutil.Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := newTestClient(t, ts, WithV2(true)).Ping(ctx, true); err != nil {
+		t.Errorf("deep Ping of the v2 service: %v", err)
+	}
+}
+
+func TestV2NeedsV2Server(t *testing.T) {
+	// WithService registers the v1 service alone
+	ts := testutil.Start(t, testutil.WithService(greeter.New()))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, err := newTestClient(t, ts, WithV2(true)).Hello(ctx, "Alice"); status.Code(err) != codes.Unimplemented {
+		t.Errorf("v2 Hello against a v1-only server: got %v, want Unimplemented", err)
+	}
+	if _, _, err := newTestClient(t, ts).Hello(ctx, "Alice"); err != nil {
+		t.Errorf("v1 Hello: %v", err)
+	}
+}
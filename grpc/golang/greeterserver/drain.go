@@ -0,0 +1,63 @@
+package greeterserver
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// WithDrainNotice makes Serve announce its shutdown for d before it starts
+// refusing new RPCs: the server turns NOT_SERVING and flags its responses
+// with the greeter.DrainingHeader while still handling calls, giving
+// clients watching its health time to move to other replicas. The drain
+// timeout starts after the notice. There is no notice by default.
+func WithDrainNotice(d time.Duration) Option {
+	return func(o *options) { o.drainNotice = d }
+}
+
+// announceDrain marks the server draining and NOT_SERVING, then waits out
+// the drain notice.
+func (s *Server) announceDrain() {
+	s.draining.Store(true)
+	s.service.SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	if s.drainNotice > 0 {
+		time.Sleep(s.drainNotice)
+	}
+}
+
+var drainingMD = metadata.Pairs(greeter.DrainingHeader, "true")
+
+// drainInterceptors flag the calls handled while draining is set: in their
+// headers if it was set when they started, else in their trailers if it was
+// by the time they ended.
+func drainInterceptors(draining *atomic.Bool) Interceptor {
+	return Interceptor{
+		Unary: func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			flagged := draining.Load()
+			if flagged {
+				grpc.SetHeader(ctx, drainingMD)
+			}
+			resp, err := handler(ctx, req)
+			if !flagged && draining.Load() {
+				grpc.SetTrailer(ctx, drainingMD)
+			}
+			return resp, err
+		},
+		Stream: func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			flagged := draining.Load()
+			if flagged {
+				ss.SetHeader(drainingMD)
+			}
+			err := handler(srv, ss)
+			if !flagged && draining.Load() {
+				ss.SetTrailer(drainingMD)
+			}
+			return err
+		},
+	}
+}
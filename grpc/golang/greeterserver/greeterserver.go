@@ -0,0 +1,275 @@
+// Package greeterserver runs the Greeter service on a gRPC server so other
+// programs can embed it. The greeter package holds the service itself; this
+// package adds listening, server options and graceful shutdown.
+package greeterserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/endpoint"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"google.golang.org/grpc"
+	channelzsvc "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+)
+
+// ErrForcedStop is returned by Serve when in-flight RPCs did not finish
+// within the drain timeout and were closed.
+var ErrForcedStop = errors.New("greeterserver: drain timeout elapsed, forced remaining RPCs closed")
+
+// Server is a gRPC server hosting the Greeter and health services.
+type Server struct {
+	grpc         *grpc.Server
+	service      *greeter.Service
+	lis          net.Listener
+	drainTimeout time.Duration
+	drainNotice  time.Duration
+	// draining is set once Serve begins shutting down.
+	draining atomic.Bool
+	// httpServer serves HTTP on lis when WithHTTPEndpoints or WithGRPCWeb
+	// is used, else it is nil.
+	httpServer *http.Server
+}
+
+// options collects the settings applied by Option values.
+type options struct {
+	addr               string
+	socketMode         os.FileMode
+	lis                net.Listener
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+	tls                *tls.Config
+	maxRecvMsgSize     int
+	maxSendMsgSize     int
+	counts             store.CountStore
+	greeterOpts        []greeter.Option
+	serverOpts         []grpc.ServerOption
+	reflection         bool
+	channelz           bool
+	drainTimeout       time.Duration
+	drainNotice        time.Duration
+	httpEndpoints      *HTTPEndpoints
+	grpcWeb            bool
+	webOrigins         []string
+	register           []func(grpc.ServiceRegistrar)
+}
+
+// Option configures a Server created by New.
+type Option func(*options)
+
+// WithAddress sets the address to listen on, either host:port or
+// unix:///path/to.sock. The default is ":50051".
+func WithAddress(addr string) Option {
+	return func(o *options) { o.addr = addr }
+}
+
+// WithSocketMode sets the permissions of a Unix socket address.
+func WithSocketMode(mode os.FileMode) Option {
+	return func(o *options) { o.socketMode = mode }
+}
+
+// WithListener serves on lis instead of listening on an address.
+func WithListener(lis net.Listener) Option {
+	return func(o *options) { o.lis = lis }
+}
+
+// WithUnaryInterceptors adds interceptors run, in order, around unary calls.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(o *options) { o.unaryInterceptors = append(o.unaryInterceptors, interceptors...) }
+}
+
+// WithStreamInterceptors adds interceptors run, in order, around streaming calls.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(o *options) { o.streamInterceptors = append(o.streamInterceptors, interceptors...) }
+}
+
+// WithTLS serves TLS using cfg, for example one from tlsconfig.NewServerConfig.
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) { o.tls = cfg }
+}
+
+// WithMaxMessageSize caps the size in bytes of messages received and sent;
+// it is shorthand for WithMaxRecvMsgSize and WithMaxSendMsgSize.
+func WithMaxMessageSize(n int) Option {
+	return func(o *options) { o.maxRecvMsgSize, o.maxSendMsgSize = n, n }
+}
+
+// WithMaxRecvMsgSize caps the size in bytes of requests the server accepts.
+// Larger requests fail with ResourceExhausted, in a message stating both
+// sizes. gRPC's default of 4 MiB applies when unset.
+func WithMaxRecvMsgSize(n int) Option {
+	return func(o *options) { o.maxRecvMsgSize = n }
+}
+
+// WithMaxSendMsgSize caps the size in bytes of replies the server sends.
+// Larger replies fail the call with ResourceExhausted. gRPC does not limit
+// sent messages by default.
+func WithMaxSendMsgSize(n int) Option {
+	return func(o *options) { o.maxSendMsgSize = n }
+}
+
+// WithCountStore sets where greeting counts are kept. An in-memory store is
+// used by default.
+func WithCountStore(cs store.CountStore) Option {
+	return func(o *options) { o.counts = cs }
+}
+
+// WithGreeterOptions configures the Greeter service.
+func WithGreeterOptions(opts ...greeter.Option) Option {
+	return func(o *options) { o.greeterOpts = append(o.greeterOpts, opts...) }
+}
+
+// WithServerOptions adds raw gRPC server options, e.g. keepalive settings or
+// stats handlers.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(o *options) { o.serverOpts = append(o.serverOpts, opts...) }
+}
+
+// WithReflection registers the server reflection service for tools like grpcurl.
+func WithReflection() Option {
+	return func(o *options) { o.reflection = true }
+}
+
+// WithChannelz registers the channelz service, which reports the state of the
+// server's channels, subchannels and sockets to tools like greeterctl debug.
+func WithChannelz() Option {
+	return func(o *options) { o.channelz = true }
+}
+
+// WithRegister registers additional services on the gRPC server, such as
+// the KeyAdmin service of an apikey.Keys.
+func WithRegister(register func(grpc.ServiceRegistrar)) Option {
+	return func(o *options) { o.register = append(o.register, register) }
+}
+
+// WithDrainTimeout sets how long Serve lets in-flight RPCs finish after its
+// context is cancelled. The default is 30 seconds.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(o *options) { o.drainTimeout = d }
+}
+
+// serverOptions returns the gRPC server options for o.
+func (o options) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if o.tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(o.tls)))
+	}
+	if len(o.unaryInterceptors) > 0 {
+		opts = append(opts, grpc.ChainUnaryInterceptor(o.unaryInterceptors...))
+	}
+	if len(o.streamInterceptors) > 0 {
+		opts = append(opts, grpc.ChainStreamInterceptor(o.streamInterceptors...))
+	}
+	if o.maxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(o.maxRecvMsgSize))
+	}
+	if o.maxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(o.maxSendMsgSize))
+	}
+	return append(opts, o.serverOpts...)
+}
+
+// New returns a Server listening on its configured address. Call Serve to
+// start handling RPCs, or Close to release the listener without serving.
+func New(opts ...Option) (*Server, error) {
+	o := options{addr: ":50051", drainTimeout: 30 * time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	lis := o.lis
+	if lis == nil {
+		var err error
+		lis, err = endpoint.Listen(o.addr, endpoint.ListenOptions{SocketMode: o.socketMode})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	greeterOpts := o.greeterOpts
+	if o.counts != nil {
+		greeterOpts = append(greeterOpts, greeter.WithCountStore(o.counts))
+	}
+	s := &Server{
+		service:      greeter.New(greeterOpts...),
+		lis:          lis,
+		drainTimeout: o.drainTimeout,
+		drainNotice:  o.drainNotice,
+	}
+	// Flag draining outermost, so responses carry it whatever the other
+	// interceptors return
+	drain := drainInterceptors(&s.draining)
+	o.unaryInterceptors = append([]grpc.UnaryServerInterceptor{drain.Unary}, o.unaryInterceptors...)
+	o.streamInterceptors = append([]grpc.StreamServerInterceptor{drain.Stream}, o.streamInterceptors...)
+	s.grpc = grpc.NewServer(o.serverOptions()...)
+	s.service.Register(s.grpc)
+	for _, register := range o.register {
+		register(s.grpc)
+	}
+	if o.reflection {
+		reflection.Register(s.grpc)
+	}
+	if o.channelz {
+		channelzsvc.RegisterChannelzServiceToServer(s.grpc)
+	}
+	if o.httpEndpoints != nil || o.grpcWeb {
+		s.httpServer = s.newHTTPServer(o)
+	}
+	return s, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.lis.Addr()
+}
+
+// Service returns the Greeter service, e.g. to change its health status.
+func (s *Server) Service() *greeter.Service {
+	return s.service
+}
+
+// Serve handles RPCs until ctx is cancelled, then marks the server
+// NOT_SERVING, keeps serving for the drain notice, and drains in-flight
+// RPCs for up to the drain timeout. It returns nil after a clean drain,
+// ErrForcedStop if RPCs had to be closed, or the error that made serving
+// fail.
+func (s *Server) Serve(ctx context.Context) error {
+	if s.httpServer != nil {
+		return s.serveHTTP(ctx)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.grpc.Serve(s.lis) }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	s.announceDrain()
+	drained := gracefulStop(s.grpc, s.service, s.drainTimeout)
+	// Serve returns once the server has stopped
+	<-serveErr
+	if !drained {
+		return ErrForcedStop
+	}
+	return nil
+}
+
+// Close stops the server immediately, closing the listener and any
+// connections.
+func (s *Server) Close() {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+	s.grpc.Stop()
+	s.lis.Close()
+}
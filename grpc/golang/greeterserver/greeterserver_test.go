@@ -0,0 +1,307 @@
+package greeterserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestMain(m *testing.M) {
+	// The timer package used by grpcweb starts its goroutine on import
+	goleak.VerifyTestMain(m, goleak.IgnoreTopFunction("github.com/desertbit/timer.timerRoutine"))
+}
+
+// startServer runs a Server built from opts on an in-memory listener until
+// the test ends, and returns a connection to it.
+func startServer(t *testing.T, creds credentials.TransportCredentials, opts ...Option) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s, err := New(append([]Option{WithListener(lis)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return conn
+}
+
+// selfSigned returns server TLS settings and matching client credentials.
+func selfSigned(t *testing.T) (*tls.Config, credentials.TransportCredentials) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	serverCfg := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return serverCfg, credentials.NewTLS(&tls.Config{RootCAs: pool, ServerName: "localhost"})
+}
+
+func TestOptions(t *testing.T) {
+	var unaryCalls, streamCalls atomic.Int32
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		unaryCalls.Add(1)
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		streamCalls.Add(1)
+		return handler(srv, ss)
+	}
+	counts := store.NewMemoryStore()
+	serverTLS, clientCreds := selfSigned(t)
+
+	tests := []struct {
+		name  string
+		creds credentials.TransportCredentials
+		opts  []Option
+		check func(t *testing.T, client pb.GreeterClient)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, client pb.GreeterClient) {
+				sayHello(t, client, "Alice", 1)
+			},
+		},
+		{
+			name: "interceptors",
+			opts: []Option{WithUnaryInterceptors(unary), WithStreamInterceptors(stream)},
+			check: func(t *testing.T, client pb.GreeterClient) {
+				sayHello(t, client, "Alice", 1)
+				stream, err := client.SayHelloBatch(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := stream.CloseAndRecv(); err != nil {
+					t.Fatal(err)
+				}
+				if unaryCalls.Load() != 1 || streamCalls.Load() != 1 {
+					t.Errorf("interceptors saw %d unary and %d stream calls, want 1 each", unaryCalls.Load(), streamCalls.Load())
+				}
+			},
+		},
+		{
+			name:  "tls",
+			creds: clientCreds,
+			opts:  []Option{WithTLS(serverTLS)},
+			check: func(t *testing.T, client pb.GreeterClient) {
+				sayHello(t, client, "Alice", 1)
+			},
+		},
+		{
+			name: "max message size",
+			opts: []Option{WithMaxMessageSize(1024)},
+			check: func(t *testing.T, client pb.GreeterClient) {
+				sayHello(t, client, "Alice", 1)
+				_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: strings.Repeat("x", 2048)})
+				if status.Code(err) != codes.ResourceExhausted {
+					t.Errorf("oversize request got %v, want ResourceExhausted", err)
+				}
+			},
+		},
+		{
+			name: "max receive size",
+			opts: []Option{WithMaxRecvMsgSize(1 << 20)},
+			check: func(t *testing.T, client pb.GreeterClient) {
+				// The name plus 4 bytes of framing fills the limit exactly
+				if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: strings.Repeat("x", 1<<20-4)}); err != nil {
+					t.Fatalf("request at the limit: %v", err)
+				}
+				_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: strings.Repeat("x", 1<<20-3)})
+				if status.Code(err) != codes.ResourceExhausted || !strings.Contains(status.Convert(err).Message(), "1048576") {
+					t.Errorf("request over the limit got %v, want ResourceExhausted stating the limit", err)
+				}
+			},
+		},
+		{
+			name: "max send size",
+			opts: []Option{WithMaxSendMsgSize(64)},
+			check: func(t *testing.T, client pb.GreeterClient) {
+				sayHello(t, client, "Alice", 1)
+				_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: strings.Repeat("x", 64)})
+				if status.Code(err) != codes.ResourceExhausted {
+					t.Errorf("oversize reply got %v, want ResourceExhausted", err)
+				}
+			},
+		},
+		{
+			name: "count store and greeter options",
+			opts: []Option{WithCountStore(counts), WithGreeterOptions(greeter.WithMaxNameLength(3))},
+			check: func(t *testing.T, client pb.GreeterClient) {
+				if _, err := counts.Increment(context.Background(), "Bob"); err != nil {
+					t.Fatal(err)
+				}
+				sayHello(t, client, "Bob", 2)
+				if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "Alice"}); status.Code(err) != codes.InvalidArgument {
+					t.Errorf("long name got %v, want InvalidArgument", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := startServer(t, tt.creds, tt.opts...)
+			tt.check(t, pb.NewGreeterClient(conn))
+		})
+	}
+}
+
+func sayHello(t *testing.T, client pb.GreeterClient, name string, wantCount int32) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: name})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.GreetingCount != wantCount {
+		t.Errorf("got count %d, want %d", resp.GreetingCount, wantCount)
+	}
+}
+
+func TestServeReturnsAfterCancel(t *testing.T) {
+	s, err := New(WithAddress("127.0.0.1:0"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	conn, err := grpc.NewClient(s.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sayHello(t, pb.NewGreeterClient(conn), "Alice", 1)
+	conn.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return within 1s of cancellation")
+	}
+}
+
+func TestServeForcedStop(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	s, err := New(WithListener(lis), WithDrainTimeout(50*time.Millisecond),
+		WithGreeterOptions(greeter.WithStreamInterval(time.Minute)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := pb.NewGreeterClient(conn).SayHelloStream(context.Background(), &pb.HelloRequest{Name: "stuck"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrForcedStop) {
+			t.Errorf("Serve: got %v, want ErrForcedStop", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after the drain timeout")
+	}
+}
+
+func TestNewListenError(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	if _, err := New(WithAddress(lis.Addr().String())); err == nil {
+		t.Error("New succeeded on an address already in use")
+	}
+}
+
+func TestClose(t *testing.T) {
+	s, err := New(WithAddress("127.0.0.1:0"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	addr := s.Addr().String()
+	s.Close()
+	// The port is free again once Close returns
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Listen after Close: %v", err)
+	}
+	lis.Close()
+}
@@ -0,0 +1,51 @@
+package greeterserver
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+)
+
+// WithGRPCWeb also serves gRPC-Web, including server streaming, on the same
+// address, so browsers can call the services without a proxy. Browsers may
+// call from the page's own origin and from allowedOrigins, each a
+// scheme://host[:port] origin such as "https://app.example.com", or "*" for
+// any; requests from other origins fail with 403.
+//
+// Connections are shared with HTTP as described for WithHTTPEndpoints.
+func WithGRPCWeb(allowedOrigins ...string) Option {
+	return func(o *options) {
+		o.grpcWeb = true
+		o.webOrigins = append(o.webOrigins, allowedOrigins...)
+	}
+}
+
+// webHandler serves gRPC-Web requests and CORS preflights with the gRPC
+// server s, after checking their origin, and other requests with next.
+func (s *Server) webHandler(allowedOrigins []string, next http.Handler) http.Handler {
+	web := grpcweb.WrapServer(s.grpc,
+		grpcweb.WithOriginFunc(func(string) bool { return true }), // checked below
+		grpcweb.WithAllowedRequestHeaders([]string{"*"}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !web.IsGrpcWebRequest(r) && !web.IsAcceptableGrpcCorsRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !originAllowed(origin, r.Host, allowedOrigins) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		web.ServeHTTP(w, r)
+	})
+}
+
+// originAllowed reports whether a browser may call from origin: the page
+// was served by host, or origin is in allowed, which may hold "*".
+func originAllowed(origin, host string, allowed []string) bool {
+	if u, err := url.Parse(origin); err == nil && u.Host == host {
+		return true
+	}
+	return slices.Contains(allowed, "*") || slices.Contains(allowed, origin)
+}
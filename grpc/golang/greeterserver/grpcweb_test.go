@@ -0,0 +1,217 @@
+package greeterserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+const webOrigin = "https://app.example.com"
+
+// webFrame is one gRPC-Web frame: a message, or the trailers when trailer
+// is set.
+type webFrame struct {
+	trailer bool
+	data    []byte
+}
+
+// webRequest returns a gRPC-Web request calling method with req from
+// origin.
+func webRequest(t *testing.T, url, method, origin string, req proto.Message) *http.Request {
+	t.Helper()
+	msg, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	r, err := http.NewRequest(http.MethodPost, url+method, bytes.NewReader(append(body, msg...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/grpc-web+proto")
+	r.Header.Set("X-Grpc-Web", "1")
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	return r
+}
+
+// readFrames splits a gRPC-Web response body into its frames.
+func readFrames(t *testing.T, body io.Reader) []webFrame {
+	t.Helper()
+	var frames []webFrame
+	r := bufio.NewReader(body)
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return frames
+		} else if err != nil {
+			t.Fatalf("reading frame header: %v", err)
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatalf("reading frame: %v", err)
+		}
+		frames = append(frames, webFrame{trailer: header[0]&0x80 != 0, data: data})
+	}
+}
+
+// newWebTestServer returns an httptest server running the gRPC-Web handler
+// of a Server built from opts.
+func newWebTestServer(t *testing.T, opts ...Option) *httptest.Server {
+	t.Helper()
+	s, err := New(append([]Option{WithListener(bufconn.Listen(1 << 20)), WithGRPCWeb(webOrigin)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.httpServer.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+func TestGRPCWebUnary(t *testing.T) {
+	ts := newWebTestServer(t)
+	resp, err := ts.Client().Do(webRequest(t, ts.URL, pb.Greeter_SayHello_FullMethodName, webOrigin, &pb.HelloRequest{Name: "Alice"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc-web") {
+		t.Fatalf("got status %d and content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != webOrigin {
+		t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, webOrigin)
+	}
+
+	frames := readFrames(t, resp.Body)
+	if len(frames) != 2 || frames[0].trailer || !frames[1].trailer {
+		t.Fatalf("got %d frames, want a message then trailers", len(frames))
+	}
+	var reply pb.HelloReply
+	if err := proto.Unmarshal(frames[0].data, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Message != "Hello, Alice!" || reply.GreetingCount != 1 {
+		t.Errorf("got reply %v", &reply)
+	}
+	if trailers := strings.ToLower(string(frames[1].data)); !strings.Contains(trailers, "grpc-status: 0") {
+		t.Errorf("trailers %q do not report OK", trailers)
+	}
+}
+
+func TestGRPCWebStream(t *testing.T) {
+	ts := newWebTestServer(t, WithGreeterOptions(greeter.WithStreamInterval(0)))
+	count := int32(3)
+	resp, err := ts.Client().Do(webRequest(t, ts.URL, pb.Greeter_SayHelloStream_FullMethodName, "", &pb.HelloRequest{Name: "Bob", Count: &count}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	frames := readFrames(t, resp.Body)
+	if len(frames) != 4 || !frames[3].trailer {
+		t.Fatalf("got %d frames, want 3 messages then trailers", len(frames))
+	}
+	for i, f := range frames[:3] {
+		var reply pb.HelloReply
+		if err := proto.Unmarshal(f.data, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.GreetingCount != int32(i+1) {
+			t.Errorf("reply %d has count %d", i, reply.GreetingCount)
+		}
+	}
+}
+
+func TestGRPCWebCORS(t *testing.T) {
+	ts := newWebTestServer(t)
+	preflight := func(origin string) *http.Response {
+		r, err := http.NewRequest(http.MethodOptions, ts.URL+pb.Greeter_SayHello_FullMethodName, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		r.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+		resp, err := ts.Client().Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := preflight(webOrigin); resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != webOrigin {
+		t.Errorf("allowed preflight: got status %d, Access-Control-Allow-Origin %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	const evil = "https://evil.example.com"
+	if resp := preflight(evil); resp.StatusCode != http.StatusForbidden || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed preflight: got status %d, Access-Control-Allow-Origin %q; want 403 and none", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	resp, err := ts.Client().Do(webRequest(t, ts.URL, pb.Greeter_SayHello_FullMethodName, evil, &pb.HelloRequest{Name: "Mallory"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("call from a disallowed origin: got status %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestGRPCWebSamePort(t *testing.T) {
+	serverTLS, clientCreds := selfSigned(t)
+	tests := []struct {
+		name      string
+		opts      []Option
+		creds     credentials.TransportCredentials
+		baseURL   string
+		wantProto int
+	}{
+		{"plaintext", nil, nil, "http://bufnet", 1},
+		// Over TLS the HTTP client negotiates HTTP/2, as browsers do
+		{"tls", []Option{WithTLS(serverTLS)}, clientCreds, "https://localhost", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, web, stop := startShared(t, tt.creds, append([]Option{WithGRPCWeb()}, tt.opts...)...)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err != nil {
+				t.Fatalf("native SayHello: %v", err)
+			}
+			resp, err := web.Do(webRequest(t, tt.baseURL, pb.Greeter_SayHello_FullMethodName, "", &pb.HelloRequest{Name: "Alice"}).WithContext(ctx))
+			if err != nil {
+				t.Fatalf("gRPC-Web SayHello: %v", err)
+			}
+			if resp.ProtoMajor != tt.wantProto {
+				t.Errorf("gRPC-Web call used HTTP/%d, want HTTP/%d", resp.ProtoMajor, tt.wantProto)
+			}
+			frames := readFrames(t, resp.Body)
+			resp.Body.Close()
+			var reply pb.HelloReply
+			if len(frames) != 2 || proto.Unmarshal(frames[0].data, &reply) != nil || reply.GreetingCount != 2 {
+				t.Errorf("gRPC-Web SayHello: got %d frames and reply %v, want the second greeting", len(frames), &reply)
+			}
+			if err := stop(); err != nil {
+				t.Errorf("Serve: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package greeterserver
+
+import (
+	"log/slog"
+
+	"github.com/shrivatsas/exp-codegen/grpc/audit"
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/capture"
+	"github.com/shrivatsas/exp-codegen/grpc/concurrency"
+	"github.com/shrivatsas/exp-codegen/grpc/deadline"
+	"github.com/shrivatsas/exp-codegen/grpc/logging"
+	"github.com/shrivatsas/exp-codegen/grpc/metrics"
+	"github.com/shrivatsas/exp-codegen/grpc/quota"
+	"github.com/shrivatsas/exp-codegen/grpc/ratelimit"
+	"github.com/shrivatsas/exp-codegen/grpc/recovery"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"github.com/shrivatsas/exp-codegen/grpc/validate"
+	"google.golang.org/grpc"
+)
+
+// Interceptor pairs the unary and streaming halves of a server interceptor,
+// so both kinds of call pass through it at the same place in the chain.
+// Either half may be nil.
+type Interceptor struct {
+	Unary  grpc.UnaryServerInterceptor
+	Stream grpc.StreamServerInterceptor
+}
+
+// WithInterceptors adds interceptors run, in order, around both unary and
+// streaming calls. They compose with WithUnaryInterceptors and
+// WithStreamInterceptors in the order the options are given.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		for _, i := range interceptors {
+			if i.Unary != nil {
+				o.unaryInterceptors = append(o.unaryInterceptors, i.Unary)
+			}
+			if i.Stream != nil {
+				o.streamInterceptors = append(o.streamInterceptors, i.Stream)
+			}
+		}
+	}
+}
+
+// InterceptorConfig selects the interceptors DefaultInterceptors returns.
+// Zero fields leave their interceptor out.
+type InterceptorConfig struct {
+	// Recovery, if set, turns handler panics into Internal errors.
+	Recovery *recovery.Options
+	// RequestID propagates or assigns an ID to every call.
+	RequestID bool
+	// Capture, if set, records every call's metadata and messages.
+	Capture *capture.Recorder
+	// Deadline, if set, caps how long each handler may run.
+	Deadline *deadline.Options
+	// Auth, if set, rejects calls without a valid token, skipping those
+	// AuthOptions allowlists.
+	Auth        auth.TokenValidator
+	AuthOptions auth.Options
+	// Audit, if set, records every call, naming the caller auth admitted.
+	Audit *audit.Log
+	// RateLimit, if set, throttles each client.
+	RateLimit *ratelimit.Limiter
+	// Quota, if set, caps each client's calls per day or window.
+	Quota *quota.Quota
+	// Concurrency, if set, caps the handlers running at once.
+	Concurrency *concurrency.Limiter
+	// Logger, if set, logs every call with LogOptions.
+	Logger     *slog.Logger
+	LogOptions logging.Options
+	// Metrics, if set, records every call.
+	Metrics *metrics.ServerMetrics
+	// Validate, if set, checks every request message.
+	Validate *validate.Options
+}
+
+// DefaultInterceptors returns the interceptors cfg selects in the canonical
+// order, outermost first:
+//
+//	recovery     so a panic anywhere in the chain becomes an Internal error
+//	request ID   so everything below can log it
+//	capture      so calls are recorded as the client saw them, rejections too
+//	deadline     so the rest of the chain spends the handler's budget
+//	audit        recording calls auth rejects as well as those it admits
+//	auth         so unauthenticated calls cost nothing further
+//	rate limit   keyed by the authenticated subject
+//	quota        also keyed by subject, counting only calls under the rate limit
+//	concurrency
+//	logging
+//	metrics      so only admitted calls are logged and measured
+//	validation   just before the handler
+//
+// Three throttles can apply to a call. The rate limit smooths bursts and
+// the quota caps calls per window, both per authenticated subject, and both
+// count calls rather than greetings; a call the rate limit rejects is not
+// counted against the quota. greeter.WithClientQuota, set by -client-quota,
+// is the third: it runs in the service, after the whole chain, and counts
+// greetings per peer host whoever is authenticated, including each name of
+// a chat or batch. Calls rejected here never reach it, and greetings it
+// rejects have still been counted by the rate limit and quota. Servers with
+// auth usually want only the quota.
+//
+// Pass the result to WithInterceptors.
+func DefaultInterceptors(cfg InterceptorConfig) []Interceptor {
+	var chain []Interceptor
+	if cfg.Recovery != nil {
+		chain = append(chain, Interceptor{recovery.UnaryServerInterceptor(*cfg.Recovery), recovery.StreamServerInterceptor(*cfg.Recovery)})
+	}
+	if cfg.RequestID {
+		chain = append(chain, Interceptor{requestid.UnaryServerInterceptor(), requestid.StreamServerInterceptor()})
+	}
+	if cfg.Capture != nil {
+		chain = append(chain, Interceptor{cfg.Capture.UnaryServerInterceptor(), cfg.Capture.StreamServerInterceptor()})
+	}
+	if cfg.Deadline != nil {
+		chain = append(chain, Interceptor{deadline.UnaryServerInterceptor(*cfg.Deadline), deadline.StreamServerInterceptor(*cfg.Deadline)})
+	}
+	if cfg.Audit != nil {
+		chain = append(chain, Interceptor{cfg.Audit.UnaryServerInterceptor(), cfg.Audit.StreamServerInterceptor()})
+	}
+	if cfg.Auth != nil {
+		chain = append(chain, Interceptor{auth.UnaryServerInterceptor(cfg.Auth, cfg.AuthOptions), auth.StreamServerInterceptor(cfg.Auth, cfg.AuthOptions)})
+	}
+	if cfg.RateLimit != nil {
+		chain = append(chain, Interceptor{cfg.RateLimit.UnaryServerInterceptor(), cfg.RateLimit.StreamServerInterceptor()})
+	}
+	if cfg.Quota != nil {
+		chain = append(chain, Interceptor{cfg.Quota.UnaryServerInterceptor(), cfg.Quota.StreamServerInterceptor()})
+	}
+	if cfg.Concurrency != nil {
+		chain = append(chain, Interceptor{cfg.Concurrency.UnaryServerInterceptor(), cfg.Concurrency.StreamServerInterceptor()})
+	}
+	if cfg.Logger != nil {
+		chain = append(chain, Interceptor{logging.UnaryServerInterceptor(cfg.Logger, cfg.LogOptions), logging.StreamServerInterceptor(cfg.Logger, cfg.LogOptions)})
+	}
+	if cfg.Metrics != nil {
+		chain = append(chain, Interceptor{cfg.Metrics.UnaryServerInterceptor(), cfg.Metrics.StreamServerInterceptor()})
+	}
+	if cfg.Validate != nil {
+		chain = append(chain, Interceptor{validate.UnaryServerInterceptor(*cfg.Validate), validate.StreamServerInterceptor(*cfg.Validate)})
+	}
+	return chain
+}
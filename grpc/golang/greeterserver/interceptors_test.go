@@ -0,0 +1,156 @@
+package greeterserver
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"github.com/shrivatsas/exp-codegen/grpc/metrics"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// callLog records the tags of the interceptors a call passed through.
+type callLog struct {
+	mu   sync.Mutex
+	tags []string
+}
+
+func (l *callLog) add(tag string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tags = append(l.tags, tag)
+}
+
+func (l *callLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tags := l.tags
+	l.tags = nil
+	return tags
+}
+
+// tagged returns an interceptor recording tag before calling the rest of the
+// chain, or failing with Unauthenticated without calling it when reject is
+// set.
+func (l *callLog) tagged(tag string, reject bool) Interceptor {
+	return Interceptor{
+		Unary: func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			l.add(tag)
+			if reject {
+				return nil, status.Error(codes.Unauthenticated, tag)
+			}
+			return handler(ctx, req)
+		},
+		Stream: func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			l.add(tag)
+			if reject {
+				return status.Error(codes.Unauthenticated, tag)
+			}
+			return handler(srv, ss)
+		},
+	}
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	var log callLog
+	conn := startServer(t, nil,
+		WithGreeterOptions(greeter.WithStreamInterval(0)),
+		WithInterceptors(log.tagged("recovery", false)),
+		WithInterceptors(log.tagged("auth", false), log.tagged("logging", false)))
+	client := pb.NewGreeterClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	want := []string{"recovery", "auth", "logging"}
+
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := log.take(); !slices.Equal(got, want) {
+		t.Errorf("unary call ran %v, want %v", got, want)
+	}
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := log.take(); !slices.Equal(got, want) {
+		t.Errorf("streaming call ran %v, want %v", got, want)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	var log callLog
+	conn := startServer(t, nil,
+		WithInterceptors(log.tagged("recovery", false), log.tagged("auth", true), log.tagged("logging", false)))
+	client := pb.NewGreeterClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	want := []string{"recovery", "auth"}
+
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("SayHello: got %v, want Unauthenticated", err)
+	}
+	if got := log.take(); !slices.Equal(got, want) {
+		t.Errorf("rejected unary call ran %v, want %v", got, want)
+	}
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("SayHelloStream: got %v, want Unauthenticated", err)
+	}
+	if got := log.take(); !slices.Equal(got, want) {
+		t.Errorf("rejected streaming call ran %v, want %v", got, want)
+	}
+}
+
+func TestDefaultInterceptors(t *testing.T) {
+	if chain := DefaultInterceptors(InterceptorConfig{}); len(chain) != 0 {
+		t.Errorf("empty config gave %d interceptors, want none", len(chain))
+	}
+
+	reg := prometheus.NewRegistry()
+	m, err := metrics.NewServerMetrics(reg, metrics.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Metrics sit inside auth, so a rejected call is not measured
+	var log callLog
+	conn := startServer(t, nil, WithInterceptors(append(DefaultInterceptors(InterceptorConfig{
+		Metrics:     m,
+		Auth:        auth.NewStaticValidator("secret"),
+		AuthOptions: auth.DefaultOptions(),
+	}), log.tagged("handler", false))...))
+	client := pb.NewGreeterClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("SayHello without a token: got %v, want Unauthenticated", err)
+	}
+	if got := log.take(); len(got) != 0 {
+		t.Errorf("rejected call reached %v", got)
+	}
+	if n := testutil.CollectAndCount(reg, "grpc_server_handled_total"); n != 0 {
+		t.Errorf("rejected call was measured: %d series", n)
+	}
+}
@@ -0,0 +1,257 @@
+package greeterserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// sniffTimeout bounds the wait for a new connection's first bytes, which
+// tell gRPC and HTTP connections apart.
+const sniffTimeout = 10 * time.Second
+
+// http2Preface opens every HTTP/2 connection made without TLS, as native
+// gRPC clients make them.
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// HTTPEndpoints selects the HTTP endpoints served by WithHTTPEndpoints.
+type HTTPEndpoints struct {
+	// Metrics, if set, serves /metrics, e.g. promhttp.Handler().
+	Metrics http.Handler
+	// Pprof serves the net/http/pprof profiles under /debug/pprof/.
+	Pprof bool
+}
+
+// WithHTTPEndpoints also serves plain HTTP on the same address: /healthz,
+// which reports the Greeter's health status as JSON and fails with 503
+// unless it is SERVING, and the endpoints e selects.
+//
+// Without TLS, connections opening with the HTTP/2 preface are native gRPC
+// and are served as usual, and the rest are HTTP/1.1. With TLS, browsers
+// negotiate HTTP/2 like native clients, so every connection is served by
+// net/http and requests are told apart by content type; native gRPC then
+// runs on the gRPC server's http.Handler, which does not support the
+// keepalive and connection age settings or channelz socket data.
+func WithHTTPEndpoints(e HTTPEndpoints) Option {
+	return func(o *options) { o.httpEndpoints = &e }
+}
+
+// newHTTPServer returns the HTTP server for WithHTTPEndpoints and
+// WithGRPCWeb.
+func (s *Server) newHTTPServer(o options) *http.Server {
+	var next http.Handler = http.NotFoundHandler()
+	if o.httpEndpoints != nil {
+		next = s.endpoints(*o.httpEndpoints)
+	}
+	h := s.grpcHandler(next)
+	if o.grpcWeb {
+		h = s.webHandler(o.webOrigins, h)
+	}
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: sniffTimeout}
+	if o.tls != nil {
+		srv.TLSConfig = o.tls.Clone()
+	}
+	return srv
+}
+
+// grpcHandler serves native gRPC requests with the gRPC server, and other
+// requests with next.
+func (s *Server) grpcHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			s.grpc.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// endpoints returns the mux serving e.
+func (s *Server) endpoints(e HTTPEndpoints) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	if e.Metrics != nil {
+		mux.Handle("/metrics", e.Metrics)
+	}
+	if e.Pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// healthzResponse is the body of /healthz.
+type healthzResponse struct {
+	Status string `json:"status"`
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	st := s.service.ServingStatus()
+	w.Header().Set("Content-Type", "application/json")
+	if st != healthpb.HealthCheckResponse_SERVING {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(healthzResponse{Status: st.String()})
+}
+
+// serveHTTP is Serve for a server sharing its address with HTTP.
+func (s *Server) serveHTTP(ctx context.Context) error {
+	httpErr := make(chan error, 1)
+	// grpcErr stays nil when native gRPC is served over HTTP as well
+	var grpcErr chan error
+	if s.httpServer.TLSConfig != nil {
+		go func() { httpErr <- s.httpServer.ServeTLS(s.lis, "", "") }()
+	} else {
+		split := newSplitListener(s.lis)
+		grpcErr = make(chan error, 1)
+		go split.serve()
+		go func() { grpcErr <- s.grpc.Serve(split.grpc) }()
+		go func() { httpErr <- s.httpServer.Serve(split.http) }()
+	}
+
+	select {
+	case err := <-grpcErr:
+		s.Close()
+		<-httpErr
+		return err
+	case err := <-httpErr:
+		s.Close()
+		if grpcErr != nil {
+			<-grpcErr
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	// Drain the HTTP server first: the gRPC server cannot drain the calls
+	// made through its http.Handler, only those on its own connections.
+	s.announceDrain()
+	deadline := time.Now().Add(s.drainTimeout)
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	drained := s.httpServer.Shutdown(shutdownCtx) == nil
+	if drained {
+		drained = gracefulStop(s.grpc, s.service, max(time.Until(deadline), 0))
+	} else {
+		s.httpServer.Close()
+		s.grpc.Stop()
+	}
+	<-httpErr
+	if grpcErr != nil {
+		<-grpcErr
+	}
+	s.lis.Close()
+	if !drained {
+		return ErrForcedStop
+	}
+	return nil
+}
+
+// splitListener hands the connections accepted by lis to one of two
+// listeners, grpc for those opening with the HTTP/2 preface and http for
+// the rest.
+type splitListener struct {
+	lis        net.Listener
+	grpc, http *chanListener
+}
+
+func newSplitListener(lis net.Listener) *splitListener {
+	return &splitListener{lis: lis, grpc: newChanListener(lis.Addr()), http: newChanListener(lis.Addr())}
+}
+
+// serve accepts connections until lis is closed.
+func (l *splitListener) serve() {
+	for {
+		conn, err := l.lis.Accept()
+		if err != nil {
+			l.grpc.Close()
+			l.http.Close()
+			return
+		}
+		go l.route(conn)
+	}
+}
+
+// route reads enough of conn to tell which listener it belongs to.
+func (l *splitListener) route(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	r := bufio.NewReader(conn)
+	to := l.http
+	if hasPrefix(r, http2Preface) {
+		to = l.grpc
+	}
+	conn.SetReadDeadline(time.Time{})
+	to.deliver(&peekedConn{Conn: conn, r: r})
+}
+
+// hasPrefix reports whether r starts with prefix, reading no further than
+// the first byte that differs.
+func hasPrefix(r *bufio.Reader, prefix string) bool {
+	for i := 1; i <= len(prefix); i++ {
+		b, err := r.Peek(i)
+		if err != nil || b[i-1] != prefix[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// peekedConn is a connection whose first bytes were read into r.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// chanListener is a net.Listener accepting the connections delivered to it.
+type chanListener struct {
+	addr   net.Addr
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newChanListener(addr net.Addr) *chanListener {
+	return &chanListener{addr: addr, conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+// deliver passes conn to Accept, or closes it if the listener is closed.
+func (l *chanListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+func (l *chanListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *chanListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *chanListener) Addr() net.Addr {
+	return l.addr
+}
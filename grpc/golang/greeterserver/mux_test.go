@@ -0,0 +1,181 @@
+package greeterserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startShared runs a Server built from opts on an in-memory listener and
+// returns a gRPC connection and an HTTP client for it, and a function that
+// stops the server and returns the error from Serve. Plaintext is used when
+// creds is nil; the HTTP client does not verify certificates.
+func startShared(t *testing.T, creds credentials.TransportCredentials, opts ...Option) (*grpc.ClientConn, *http.Client, func() error) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s, err := New(append([]Option{WithListener(lis)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	dial := func(ctx context.Context) (net.Conn, error) { return lis.DialContext(ctx) }
+	conn, err := grpc.NewClient("passthrough:///localhost",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return dial(ctx) }),
+		grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &http.Transport{
+		DialContext:       func(ctx context.Context, _, _ string) (net.Conn, error) { return dial(ctx) },
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}
+
+	var once sync.Once
+	var serveErr error
+	stop := func() error {
+		once.Do(func() {
+			cancel()
+			select {
+			case serveErr = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Serve did not return after cancel")
+			}
+			conn.Close()
+			transport.CloseIdleConnections()
+		})
+		return serveErr
+	}
+	t.Cleanup(func() { stop() })
+	return conn, &http.Client{Transport: transport}, stop
+}
+
+// get fetches path from the server web reaches, returning the status code
+// and body.
+func get(t *testing.T, web *http.Client, path string) (int, string) {
+	t.Helper()
+	resp, err := web.Get("http://localhost" + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestHTTPEndpoints(t *testing.T) {
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { io.WriteString(w, "greeter_up 1\n") })
+	conn, web, _ := startShared(t, nil,
+		WithGreeterOptions(greeter.WithStreamInterval(0)),
+		WithHTTPEndpoints(HTTPEndpoints{Metrics: metrics, Pprof: true}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	code, body := get(t, web, "/healthz")
+	var health healthzResponse
+	if err := json.Unmarshal([]byte(body), &health); err != nil || code != http.StatusOK || health.Status != "SERVING" {
+		t.Errorf("GET /healthz = %d %q, want 200 and SERVING", code, body)
+	}
+	if code, body := get(t, web, "/metrics"); code != http.StatusOK || body != "greeter_up 1\n" {
+		t.Errorf("GET /metrics = %d %q", code, body)
+	}
+	if code, _ := get(t, web, "/debug/pprof/"); code != http.StatusOK {
+		t.Errorf("GET /debug/pprof/ = %d, want 200", code)
+	}
+	if code, _ := get(t, web, "/nope"); code != http.StatusNotFound {
+		t.Errorf("GET /nope = %d, want 404", code)
+	}
+}
+
+func TestHealthzNotServing(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	s, err := New(WithListener(lis), WithHTTPEndpoints(HTTPEndpoints{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Service().SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	if rec := get("/healthz"); rec.Code != http.StatusServiceUnavailable || rec.Body.String() != `{"status":"NOT_SERVING"}`+"\n" {
+		t.Errorf("GET /healthz = %d %q, want 503 and NOT_SERVING", rec.Code, rec.Body)
+	}
+	if rec := get("/debug/pprof/"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /debug/pprof/ without Pprof = %d, want 404", rec.Code)
+	}
+}
+
+func TestHTTPEndpointsShutdown(t *testing.T) {
+	conn, web, stop := startShared(t, nil,
+		WithGreeterOptions(greeter.WithStreamInterval(50*time.Millisecond)),
+		WithHTTPEndpoints(HTTPEndpoints{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := pb.NewGreeterClient(conn)
+	if code, _ := get(t, web, "/healthz"); code != http.StatusOK {
+		t.Fatalf("GET /healthz = %d, want 200", code)
+	}
+
+	// A stream in flight when shutdown starts is drained, not cut off
+	count := int32(3)
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice", Count: &count})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan error, 1)
+	go func() { stopped <- stop() }()
+	for received := 1; ; received++ {
+		if _, err := stream.Recv(); err == io.EOF {
+			if received != int(count) {
+				t.Errorf("stream ended after %d replies, want %d", received, count)
+			}
+			break
+		} else if err != nil {
+			t.Fatalf("stream cut off by shutdown: %v", err)
+		}
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+
+	if _, err := web.Get("http://localhost/healthz"); err == nil {
+		t.Error("GET /healthz succeeded after shutdown")
+	}
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err == nil {
+		t.Error("SayHello succeeded after shutdown")
+	}
+}
@@ -0,0 +1,39 @@
+package greeterserver
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/grpcreflect"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+)
+
+func TestReflection(t *testing.T) {
+	conn := startServer(t, nil, WithReflection())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := grpcreflect.NewClientAuto(ctx, conn)
+	defer client.Reset()
+
+	services, err := client.ListServices()
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	greeter := pb.Greeter_ServiceDesc.ServiceName
+	if !slices.Contains(services, greeter) {
+		t.Fatalf("ListServices = %v, want it to include %s", services, greeter)
+	}
+
+	desc, err := client.ResolveService(greeter)
+	if err != nil {
+		t.Fatalf("ResolveService: %v", err)
+	}
+	for _, method := range []string{"SayHello", "SayHelloStream"} {
+		if desc.FindMethodByName(method) == nil {
+			t.Errorf("method %s not found in %s", method, greeter)
+		}
+	}
+}
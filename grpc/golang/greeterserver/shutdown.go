@@ -0,0 +1,33 @@
+package greeterserver
+
+import (
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// gracefulStop marks srv NOT_SERVING so load balancers stop routing to it,
+// then lets in-flight RPCs on gs finish for up to timeout before forcing them
+// closed. It reports whether the drain completed within the timeout.
+func gracefulStop(gs *grpc.Server, srv *greeter.Service, timeout time.Duration) bool {
+	srv.SetServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	done := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		gs.Stop()
+		<-done
+		return false
+	}
+}
@@ -0,0 +1,189 @@
+package greeterserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGracefulStopDrainsStreams(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(100*time.Millisecond)))
+	client := ts.Client
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "drain"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+
+	// Watch health over a stream opened before the drain, since new calls
+	// are refused once it begins.
+	watchCtx, watchCancel := context.WithCancel(ctx)
+	defer watchCancel()
+	watch, err := healthpb.NewHealthClient(ts.Conn).Watch(watchCtx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if resp, err := watch.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("initial health %v, %v; want SERVING", resp, err)
+	}
+
+	drained := make(chan bool, 1)
+	go func() { drained <- gracefulStop(ts.GRPC, ts.Service, 5*time.Second) }()
+
+	// Wait for the drain to begin before issuing a new call.
+	if resp, err := watch.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("health during drain %v, %v; want NOT_SERVING", resp, err)
+	}
+	watchCancel()
+
+	callCtx, callCancel := context.WithTimeout(ctx, time.Second)
+	defer callCancel()
+	start := time.Now()
+	_, err = client.SayHello(callCtx, &pb.HelloRequest{Name: "late"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("new call during drain got %v, want Unavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("new call during drain took %v, want it to fail fast", elapsed)
+	}
+
+	received := 1
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("in-flight stream failed after %d messages: %v", received, err)
+		}
+		received++
+	}
+	if received != 5 {
+		t.Errorf("got %d messages, want 5", received)
+	}
+	if !<-drained {
+		t.Error("gracefulStop reported a forced stop")
+	}
+}
+
+func TestGracefulStopForcesAfterTimeout(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(3*time.Second)))
+	client := ts.Client
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "stuck"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+
+	start := time.Now()
+	if gracefulStop(ts.GRPC, ts.Service, 100*time.Millisecond) {
+		t.Error("gracefulStop reported a clean drain for a stuck stream")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gracefulStop took %v, want about the 100ms drain timeout", elapsed)
+	}
+	if _, err := stream.Recv(); err == nil || err == io.EOF {
+		t.Errorf("got %v from a forcibly stopped stream, want an error", err)
+	}
+}
+
+func TestDrainNotice(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	s, err := New(WithListener(lis), WithDrainNotice(300*time.Millisecond),
+		WithGreeterOptions(greeter.WithStreamInterval(100*time.Millisecond)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	serveCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(serveCtx) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewGreeterClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var header metadata.MD
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "early"}, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get(greeter.DrainingHeader); len(got) != 0 {
+		t.Errorf("got %s %q before the drain, want none", greeter.DrainingHeader, got)
+	}
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "drain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchCtx, watchCancel := context.WithCancel(ctx)
+	defer watchCancel()
+	watch, err := healthpb.NewHealthClient(conn).Watch(watchCtx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := watch.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("initial health %v, %v; want SERVING", resp, err)
+	}
+
+	stop()
+	if resp, err := watch.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("health during the notice %v, %v; want NOT_SERVING", resp, err)
+	}
+	// The watch would hold up the drain
+	watchCancel()
+	// New calls are still served during the notice, flagged as draining
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "late"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("call during the notice: %v", err)
+	}
+	if got := header.Get(greeter.DrainingHeader); len(got) != 1 || got[0] != "true" {
+		t.Errorf("got %s %q during the notice, want true", greeter.DrainingHeader, got)
+	}
+
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("stream started before the drain failed: %v", err)
+		}
+	}
+	if got := stream.Trailer().Get(greeter.DrainingHeader); len(got) != 1 || got[0] != "true" {
+		t.Errorf("got %s %q in the trailer of a stream ending during the drain, want true", greeter.DrainingHeader, got)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after the notice and drain")
+	}
+}
@@ -0,0 +1,98 @@
+// Package keepaliveconfig turns keepalive settings into gRPC dial and server
+// options. Zero-valued settings leave gRPC's defaults untouched.
+package keepaliveconfig
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Client holds client-side keepalive settings.
+type Client struct {
+	// Time is how long the connection may be idle before the client pings
+	// the server. gRPC enforces a minimum of 10s.
+	Time time.Duration `yaml:"time"`
+	// Timeout is how long to wait for a ping ack before closing the connection.
+	Timeout time.Duration `yaml:"timeout"`
+	// PermitWithoutStream sends pings even when there are no active RPCs.
+	PermitWithoutStream bool `yaml:"permit-without-stream"`
+}
+
+// Params returns the keepalive parameters and whether any were configured.
+func (c Client) Params() (keepalive.ClientParameters, bool) {
+	if c == (Client{}) {
+		return keepalive.ClientParameters{}, false
+	}
+	return keepalive.ClientParameters{
+		Time:                c.Time,
+		Timeout:             c.Timeout,
+		PermitWithoutStream: c.PermitWithoutStream,
+	}, true
+}
+
+// DialOptions returns the dial options for c, or none when c is unset.
+func (c Client) DialOptions() []grpc.DialOption {
+	params, ok := c.Params()
+	if !ok {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithKeepaliveParams(params)}
+}
+
+// Server holds server-side keepalive settings.
+type Server struct {
+	// MinTime is the minimum interval clients may ping at; faster clients
+	// are disconnected. gRPC defaults to 5 minutes.
+	MinTime time.Duration `yaml:"min-time"`
+	// PermitWithoutStream allows client pings when there are no active RPCs.
+	PermitWithoutStream bool `yaml:"permit-without-stream"`
+
+	// MaxConnectionIdle closes connections with no active RPCs for this long.
+	MaxConnectionIdle time.Duration `yaml:"max-connection-idle"`
+	// MaxConnectionAge closes connections after this long, regardless of activity.
+	MaxConnectionAge time.Duration `yaml:"max-connection-age"`
+	// MaxConnectionAgeGrace is how long in-flight RPCs may run after MaxConnectionAge.
+	MaxConnectionAgeGrace time.Duration `yaml:"max-connection-age-grace"`
+	// Time is how long the connection may be idle before the server pings
+	// the client. gRPC enforces a minimum of 1s.
+	Time time.Duration `yaml:"time"`
+	// Timeout is how long to wait for a ping ack before closing the connection.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// EnforcementPolicy returns the client ping policy and whether it was configured.
+func (s Server) EnforcementPolicy() (keepalive.EnforcementPolicy, bool) {
+	if s.MinTime == 0 && !s.PermitWithoutStream {
+		return keepalive.EnforcementPolicy{}, false
+	}
+	return keepalive.EnforcementPolicy{
+		MinTime:             s.MinTime,
+		PermitWithoutStream: s.PermitWithoutStream,
+	}, true
+}
+
+// Params returns the server keepalive parameters and whether any were configured.
+func (s Server) Params() (keepalive.ServerParameters, bool) {
+	params := keepalive.ServerParameters{
+		MaxConnectionIdle:     s.MaxConnectionIdle,
+		MaxConnectionAge:      s.MaxConnectionAge,
+		MaxConnectionAgeGrace: s.MaxConnectionAgeGrace,
+		Time:                  s.Time,
+		Timeout:               s.Timeout,
+	}
+	return params, params != (keepalive.ServerParameters{})
+}
+
+// ServerOptions returns the server options for s, omitting unset groups.
+func (s Server) ServerOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if policy, ok := s.EnforcementPolicy(); ok {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(policy))
+	}
+	if params, ok := s.Params(); ok {
+		opts = append(opts, grpc.KeepaliveParams(params))
+	}
+	return opts
+}
@@ -0,0 +1,149 @@
+package keepaliveconfig
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+func TestClientUnset(t *testing.T) {
+	if _, ok := (Client{}).Params(); ok {
+		t.Error("zero Client reported configured params")
+	}
+	if opts := (Client{}).DialOptions(); len(opts) != 0 {
+		t.Errorf("zero Client returned %d dial options, want 0", len(opts))
+	}
+}
+
+func TestClientParams(t *testing.T) {
+	c := Client{Time: 30 * time.Second, Timeout: 5 * time.Second, PermitWithoutStream: true}
+	params, ok := c.Params()
+	if !ok {
+		t.Fatal("Params reported no configuration")
+	}
+	want := keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 5 * time.Second, PermitWithoutStream: true}
+	if params != want {
+		t.Errorf("got %+v, want %+v", params, want)
+	}
+	if opts := c.DialOptions(); len(opts) != 1 {
+		t.Errorf("got %d dial options, want 1", len(opts))
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Server
+		wantPolicy bool
+		wantParams bool
+	}{
+		{"unset", Server{}, false, false},
+		{"policy only", Server{MinTime: time.Minute}, true, false},
+		{"permit only", Server{PermitWithoutStream: true}, true, false},
+		{"params only", Server{MaxConnectionIdle: time.Minute}, false, true},
+		{"both", Server{MinTime: time.Minute, MaxConnectionAge: time.Hour, MaxConnectionAgeGrace: time.Minute}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, gotPolicy := tt.cfg.EnforcementPolicy()
+			params, gotParams := tt.cfg.Params()
+			if gotPolicy != tt.wantPolicy || gotParams != tt.wantParams {
+				t.Fatalf("configured policy=%v params=%v, want %v and %v", gotPolicy, gotParams, tt.wantPolicy, tt.wantParams)
+			}
+			if policy.MinTime != tt.cfg.MinTime || policy.PermitWithoutStream != tt.cfg.PermitWithoutStream {
+				t.Errorf("got policy %+v from %+v", policy, tt.cfg)
+			}
+			if params.MaxConnectionIdle != tt.cfg.MaxConnectionIdle || params.MaxConnectionAge != tt.cfg.MaxConnectionAge ||
+				params.MaxConnectionAgeGrace != tt.cfg.MaxConnectionAgeGrace {
+				t.Errorf("got params %+v from %+v", params, tt.cfg)
+			}
+
+			want := 0
+			if tt.wantPolicy {
+				want++
+			}
+			if tt.wantParams {
+				want++
+			}
+			if got := len(tt.cfg.ServerOptions()); got != want {
+				t.Errorf("got %d server options, want %d", got, want)
+			}
+		})
+	}
+}
+
+// slowGreeter sends two replies separated by pause.
+type slowGreeter struct {
+	pb.UnimplementedGreeterServer
+	pause time.Duration
+}
+
+func (g slowGreeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	if err := stream.Send(&pb.HelloReply{Message: "first"}); err != nil {
+		return err
+	}
+	select {
+	case <-time.After(g.pause):
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+	return stream.Send(&pb.HelloReply{Message: "second"})
+}
+
+func TestStreamOutlivesIdleThreshold(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for keepalive pings")
+	}
+	server := Server{
+		MinTime:             time.Second,
+		PermitWithoutStream: true,
+		MaxConnectionIdle:   200 * time.Millisecond,
+		Time:                time.Second,
+		Timeout:             time.Second,
+	}
+	client := Client{Time: 10 * time.Second, Timeout: time.Second, PermitWithoutStream: true}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(server.ServerOptions()...)
+	pb.RegisterGreeterServer(s, slowGreeter{pause: 1500 * time.Millisecond})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, client.DialOptions()...)
+	conn, err := grpc.NewClient(lis.Addr().String(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := pb.NewGreeterClient(conn).SayHelloStream(ctx, &pb.HelloRequest{Name: "idle"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	var got []string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("stream failed after %v: %v", got, err)
+		}
+		got = append(got, resp.Message)
+	}
+	if len(got) != 2 {
+		t.Errorf("got messages %v, want first and second", got)
+	}
+}
@@ -0,0 +1,159 @@
+// Package logging provides server interceptors that emit one structured
+// slog record per RPC, optionally including request and response payloads.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Options controls what the interceptors log.
+type Options struct {
+	// LogPayloads adds request and response messages to the records.
+	LogPayloads bool
+	// Redact, if set, sanitizes each payload before it is logged; see
+	// FieldRedactor.
+	Redact Redactor
+	// MaxPayloadBytes, if positive, truncates each logged payload to that
+	// many bytes followed by "...[truncated]".
+	MaxPayloadBytes int
+	// SampleEvery logs only every Nth message of a stream when payload
+	// logging is enabled. Values below 2 log every message.
+	SampleEvery int
+}
+
+// UnaryServerInterceptor logs each unary RPC once it completes.
+func UnaryServerInterceptor(logger *slog.Logger, opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		attrs := callAttrs(ctx, info.FullMethod, start, err)
+		if opts.LogPayloads {
+			attrs = append(attrs, opts.payload("request", req))
+			if err == nil {
+				attrs = append(attrs, opts.payload("response", resp))
+			}
+		}
+		logger.LogAttrs(ctx, level(err), "finished unary call", attrs...)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs each streaming RPC once it completes and,
+// when payload logging is enabled, each sampled message as it is sent or
+// received.
+func StreamServerInterceptor(logger *slog.Logger, opts Options) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ls := &loggingServerStream{ServerStream: ss, logger: logger, opts: opts, method: info.FullMethod}
+		err := handler(srv, ls)
+
+		attrs := append(callAttrs(ss.Context(), info.FullMethod, start, err),
+			slog.Int("grpc.sent", ls.sent),
+			slog.Int("grpc.received", ls.received))
+		logger.LogAttrs(ss.Context(), level(err), "finished streaming call", attrs...)
+		return err
+	}
+}
+
+type loggingServerStream struct {
+	grpc.ServerStream
+	logger         *slog.Logger
+	opts           Options
+	method         string
+	sent, received int
+}
+
+func (s *loggingServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+		s.logMessage("sent", s.sent, m)
+	}
+	return err
+}
+
+func (s *loggingServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received++
+		s.logMessage("received", s.received, m)
+	}
+	return err
+}
+
+// logMessage logs the n-th message in direction if it falls in the sample.
+func (s *loggingServerStream) logMessage(direction string, n int, m any) {
+	if !s.opts.LogPayloads || (s.opts.SampleEvery > 1 && n%s.opts.SampleEvery != 0) {
+		return
+	}
+	s.logger.LogAttrs(s.Context(), slog.LevelInfo, "stream message "+direction,
+		slog.String("grpc.method", s.method),
+		slog.Int("grpc.message_index", n),
+		s.opts.payload("payload", m))
+}
+
+// truncated marks a payload cut short by MaxPayloadBytes.
+const truncated = "...[truncated]"
+
+// payload renders m as protojson under key, after redaction and truncation.
+func (o Options) payload(key string, m any) slog.Attr {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return slog.Any(key, m)
+	}
+	if o.Redact != nil {
+		msg = o.Redact.Redact(msg)
+	}
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return slog.String(key, "<unmarshalable: "+err.Error()+">")
+	}
+	if o.MaxPayloadBytes > 0 && len(data) > o.MaxPayloadBytes {
+		// Cut on a rune boundary so the log stays valid UTF-8
+		n := o.MaxPayloadBytes
+		for n > 0 && !utf8.RuneStart(data[n]) {
+			n--
+		}
+		return slog.String(key, string(data[:n])+truncated)
+	}
+	return slog.String(key, string(data))
+}
+
+func callAttrs(ctx context.Context, method string, start time.Time, err error) []slog.Attr {
+	addr := "unknown"
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	attrs := []slog.Attr{
+		slog.String("grpc.method", method),
+		slog.String("peer.address", addr),
+		slog.Duration("grpc.duration", time.Since(start)),
+		slog.String("grpc.code", status.Code(err).String()),
+	}
+	if id, ok := requestid.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("request.id", id))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("grpc.error", status.Convert(err).Message()))
+	}
+	return attrs
+}
+
+func level(err error) slog.Level {
+	if status.Code(err) == codes.OK {
+		return slog.LevelInfo
+	}
+	return slog.LevelError
+}
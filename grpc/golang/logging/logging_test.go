@@ -0,0 +1,237 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// captureHandler records every slog record as a flat attribute map.
+type captureHandler struct {
+	mu      sync.Mutex
+	records []map[string]string
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *captureHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := map[string]string{"msg": r.Message, "level": r.Level.String()}
+	r.Attrs(func(a slog.Attr) bool {
+		rec[a.Key] = a.Value.String()
+		return true
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, rec)
+	return nil
+}
+
+// withMessage returns the records logged with msg.
+func (h *captureHandler) withMessage(msg string) []map[string]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []map[string]string
+	for _, rec := range h.records {
+		if rec["msg"] == msg {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+	names chan string
+}
+
+func (g greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	if g.names != nil {
+		g.names <- req.Name
+	}
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name must not be empty")
+	}
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!", GreetingCount: 1}, nil
+}
+
+func (greeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	for i := 1; i <= 5; i++ {
+		if err := stream.Send(&pb.HelloReply{Message: fmt.Sprintf("Hello %d, %s!", i, req.Name)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newClient(t *testing.T, srv pb.GreeterServer, h *captureHandler, opts Options) pb.GreeterClient {
+	t.Helper()
+	logger := slog.New(h)
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(logger, opts)),
+		grpc.StreamInterceptor(StreamServerInterceptor(logger, opts)))
+	pb.RegisterGreeterServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewGreeterClient(conn)
+}
+
+func redactName(m proto.Message) proto.Message {
+	req, ok := m.(*pb.HelloRequest)
+	if !ok {
+		return m
+	}
+	req = proto.Clone(req).(*pb.HelloRequest)
+	req.Name = "***"
+	return req
+}
+
+func TestUnarySuccess(t *testing.T) {
+	h := &captureHandler{}
+	srv := greeter{names: make(chan string, 1)}
+	client := newClient(t, srv, h, Options{LogPayloads: true, Redact: RedactorFunc(redactName)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "alice@example.com"}); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if got := <-srv.names; got != "alice@example.com" {
+		t.Errorf("handler saw name %q, want the unredacted name", got)
+	}
+
+	records := h.withMessage("finished unary call")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec["grpc.method"] != pb.Greeter_SayHello_FullMethodName || rec["grpc.code"] != "OK" || rec["level"] != "INFO" {
+		t.Errorf("unexpected record %v", rec)
+	}
+	if rec["peer.address"] == "" || rec["grpc.duration"] == "" {
+		t.Errorf("record is missing peer or duration: %v", rec)
+	}
+	if strings.Contains(rec["request"], "alice") || !strings.Contains(rec["request"], `"***"`) {
+		t.Errorf("request payload %q was not redacted", rec["request"])
+	}
+	if !strings.Contains(rec["response"], "Hello, alice@example.com!") {
+		t.Errorf("response payload %q", rec["response"])
+	}
+}
+
+func TestUnaryFailure(t *testing.T) {
+	h := &captureHandler{}
+	client := newClient(t, greeter{}, h, Options{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument", err)
+	}
+
+	records := h.withMessage("finished unary call")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec["grpc.code"] != "InvalidArgument" || rec["level"] != "ERROR" || rec["grpc.error"] != "name must not be empty" {
+		t.Errorf("unexpected record %v", rec)
+	}
+	if _, ok := rec["request"]; ok {
+		t.Errorf("payload logged without LogPayloads: %v", rec)
+	}
+}
+
+func TestStreamSampling(t *testing.T) {
+	h := &captureHandler{}
+	client := newClient(t, greeter{}, h, Options{LogPayloads: true, SampleEvery: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "stream"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+	}
+
+	// Five replies sampled every 2nd message log the 2nd and 4th.
+	sent := h.withMessage("stream message sent")
+	if len(sent) != 2 {
+		t.Fatalf("got %d sent records, want 2: %v", len(sent), sent)
+	}
+	for i, rec := range sent {
+		if want := fmt.Sprint(2 * (i + 1)); rec["grpc.message_index"] != want {
+			t.Errorf("record %d has index %s, want %s", i, rec["grpc.message_index"], want)
+		}
+		if want := fmt.Sprintf("Hello %d, stream!", 2*(i+1)); !strings.Contains(rec["payload"], want) {
+			t.Errorf("record %d payload %q does not contain %q", i, rec["payload"], want)
+		}
+	}
+
+	finished := h.withMessage("finished streaming call")
+	if len(finished) != 1 {
+		t.Fatalf("got %d finished records, want 1", len(finished))
+	}
+	if rec := finished[0]; rec["grpc.code"] != "OK" || rec["grpc.sent"] != "5" || rec["grpc.received"] != "1" {
+		t.Errorf("unexpected record %v", rec)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	h := &captureHandler{}
+	interceptor := UnaryServerInterceptor(slog.New(h), Options{})
+	handler := func(ctx context.Context, req any) (any, error) { return &pb.HelloReply{}, nil }
+
+	ctx := requestid.NewContext(context.Background(), "req-123")
+	info := &grpc.UnaryServerInfo{FullMethod: pb.Greeter_SayHello_FullMethodName}
+	if _, err := interceptor(ctx, &pb.HelloRequest{}, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := interceptor(context.Background(), &pb.HelloRequest{}, info, handler); err != nil {
+		t.Fatal(err)
+	}
+
+	records := h.withMessage("finished unary call")
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if got := records[0]["request.id"]; got != "req-123" {
+		t.Errorf("got request.id %q, want req-123", got)
+	}
+	if _, ok := records[1]["request.id"]; ok {
+		t.Errorf("record without a request ID has request.id %q", records[1]["request.id"])
+	}
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Redacted replaces the value of string fields removed by FieldRedactor.
+const Redacted = "[REDACTED]"
+
+// Redactor sanitizes payloads before they are logged.
+type Redactor interface {
+	// Redact returns the message to log in place of m. It must not modify
+	// m, which is the message seen by the handler or the client.
+	Redact(m proto.Message) proto.Message
+}
+
+// RedactorFunc adapts a function to a Redactor.
+type RedactorFunc func(proto.Message) proto.Message
+
+// Redact calls f(m).
+func (f RedactorFunc) Redact(m proto.Message) proto.Message { return f(m) }
+
+// FieldRedactor returns a Redactor hiding the fields named by fields, each
+// a message name and a field name such as "HelloRequest.name". The message
+// may also be given by its full name, e.g. "example.HelloRequest.name".
+// Matching fields are found in nested messages too. String fields are set
+// to Redacted and other fields cleared, on a copy of the message.
+func FieldRedactor(fields ...string) Redactor {
+	r := fieldRedactor{}
+	for _, f := range fields {
+		i := strings.LastIndexByte(f, '.')
+		if i <= 0 || i == len(f)-1 {
+			continue
+		}
+		msg, field := f[:i], protoreflect.Name(f[i+1:])
+		if r[msg] == nil {
+			r[msg] = map[protoreflect.Name]bool{}
+		}
+		r[msg][field] = true
+	}
+	return r
+}
+
+// fieldRedactor maps message names, short or full, to the fields to hide.
+type fieldRedactor map[string]map[protoreflect.Name]bool
+
+func (r fieldRedactor) Redact(m proto.Message) proto.Message {
+	if len(r) == 0 {
+		return m
+	}
+	clone := proto.Clone(m)
+	if !r.redact(clone.ProtoReflect()) {
+		return m
+	}
+	return clone
+}
+
+// redact hides the matching fields of m and of the messages it holds, and
+// reports whether it changed anything.
+func (r fieldRedactor) redact(m protoreflect.Message) bool {
+	desc := m.Descriptor()
+	full, short := r[string(desc.FullName())], r[string(desc.Name())]
+	// Collect the fields first: m must not change while it is ranged over
+	var hidden, nested []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		switch {
+		case full[fd.Name()] || short[fd.Name()]:
+			hidden = append(hidden, fd)
+		case fd.Message() != nil:
+			nested = append(nested, fd)
+		}
+		return true
+	})
+
+	changed := len(hidden) > 0
+	for _, fd := range hidden {
+		switch {
+		case fd.Kind() == protoreflect.StringKind && fd.IsList():
+			list := m.Mutable(fd).List()
+			for i := range list.Len() {
+				list.Set(i, protoreflect.ValueOfString(Redacted))
+			}
+		case fd.Kind() == protoreflect.StringKind:
+			m.Set(fd, protoreflect.ValueOfString(Redacted))
+		default:
+			m.Clear(fd)
+		}
+	}
+	for _, fd := range nested {
+		v := m.Get(fd)
+		switch {
+		case fd.IsList():
+			list := v.List()
+			for i := range list.Len() {
+				changed = r.redact(list.Get(i).Message()) || changed
+			}
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				changed = r.redact(v.Message()) || changed
+				return true
+			})
+		default:
+			changed = r.redact(v.Message()) || changed
+		}
+	}
+	return changed
+}
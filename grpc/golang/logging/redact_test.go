@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestFieldRedactor(t *testing.T) {
+	h := &captureHandler{}
+	srv := greeter{names: make(chan string, 1)}
+	client := newClient(t, srv, h, Options{LogPayloads: true, Redact: FieldRedactor("HelloRequest.name")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "alice@example.com"}); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if got := <-srv.names; got != "alice@example.com" {
+		t.Errorf("handler saw name %q, want the unredacted name", got)
+	}
+	records := h.withMessage("finished unary call")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if req := records[0]["request"]; strings.Contains(req, "alice") || !strings.Contains(req, `"`+Redacted+`"`) {
+		t.Errorf("request payload %q was not redacted", req)
+	}
+}
+
+func TestFieldRedactorNested(t *testing.T) {
+	resp := &pb.ListGreetingsResponse{Greetings: []*pb.GreetingRecord{
+		{Name: "alice@example.com", Message: "Hello, alice@example.com!", Timestamp: timestamppb.Now()},
+		{Name: "bob@example.com", Message: "Hello, bob@example.com!"},
+	}}
+	orig := proto.Clone(resp)
+	r := FieldRedactor("example.GreetingRecord.name", "GreetingRecord.message", "GreetingRecord.timestamp")
+
+	got := r.Redact(resp).(*pb.ListGreetingsResponse)
+	if !proto.Equal(resp, orig) {
+		t.Errorf("Redact modified its argument: %v", resp)
+	}
+	for i, g := range got.Greetings {
+		if g.Name != Redacted || g.Message != Redacted || g.Timestamp != nil {
+			t.Errorf("greeting %d = %v, want name and message redacted and no timestamp", i, g)
+		}
+	}
+
+	// Messages without matching fields are returned as they are
+	req := &pb.HelloRequest{Name: "alice"}
+	if r.Redact(req) != proto.Message(req) {
+		t.Error("Redact copied a message it had nothing to hide in")
+	}
+}
+
+func TestMaxPayloadBytes(t *testing.T) {
+	const limit = 256
+	h := &captureHandler{}
+	client := newClient(t, greeter{}, h, Options{LogPayloads: true, MaxPayloadBytes: limit})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	name := strings.Repeat("é", 5<<10) // 10KB
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: name}); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	records := h.withMessage("finished unary call")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	for _, key := range []string{"request", "response"} {
+		p := records[0][key]
+		body, ok := strings.CutSuffix(p, truncated)
+		if !ok || len(body) > limit || len(body) < limit-1 {
+			t.Errorf("%s payload is %d bytes ending %q, want %d bytes then %q", key, len(p), p[max(len(p)-20, 0):], limit, truncated)
+		}
+		if !strings.HasPrefix(body, `{"name":"éé`) && !strings.HasPrefix(body, `{"message":"Hello, éé`) {
+			t.Errorf("%s payload starts %q", key, body[:min(len(body), 20)])
+		}
+	}
+}
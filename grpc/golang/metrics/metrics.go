@@ -0,0 +1,170 @@
+// Package metrics provides Prometheus interceptors that record RPC counts,
+// latencies and in-flight calls for gRPC clients and servers.
+package metrics
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Options configures the collectors registered by NewServerMetrics and NewClientMetrics.
+type Options struct {
+	// Buckets are the latency histogram buckets in seconds.
+	// prometheus.DefBuckets is used when empty.
+	Buckets []float64
+}
+
+// collectors holds the metrics shared by the client and server sides.
+type collectors struct {
+	handled  *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+func newCollectors(reg prometheus.Registerer, side string, opts Options) (*collectors, error) {
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	c := &collectors{
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_" + side + "_handled_total",
+			Help: "Total number of RPCs completed, by method and status code.",
+		}, []string{"method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_" + side + "_handling_seconds",
+			Help:    "RPC latency in seconds, by method.",
+			Buckets: buckets,
+		}, []string{"method"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_" + side + "_in_flight",
+			Help: "Number of RPCs currently in flight, by method.",
+		}, []string{"method"}),
+	}
+	for _, collector := range []prometheus.Collector{c.handled, c.latency, c.inFlight} {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// start records the beginning of an RPC and returns a function that records its end.
+func (c *collectors) start(method string) func(err error) {
+	start := time.Now()
+	c.inFlight.WithLabelValues(method).Inc()
+	return func(err error) {
+		c.inFlight.WithLabelValues(method).Dec()
+		c.latency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		c.handled.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+}
+
+// ServerMetrics records metrics for RPCs handled by a server.
+type ServerMetrics struct {
+	c *collectors
+}
+
+// NewServerMetrics registers the server collectors on reg.
+func NewServerMetrics(reg prometheus.Registerer, opts Options) (*ServerMetrics, error) {
+	c, err := newCollectors(reg, "server", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerMetrics{c: c}, nil
+}
+
+// UnaryServerInterceptor records metrics for unary RPCs.
+func (m *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done := m.c.start(info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records metrics for streaming RPCs.
+func (m *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := m.c.start(info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
+
+// ClientMetrics records metrics for RPCs issued by a client. No client in
+// this module exposes metrics, so callers install its interceptors on their
+// own connections, e.g. with
+//
+//	greeterclient.WithUnaryInterceptors(m.UnaryClientInterceptor())
+//	greeterclient.WithStreamInterceptors(m.StreamClientInterceptor())
+//
+// or the equivalent grpc.WithChainUnaryInterceptor and
+// grpc.WithChainStreamInterceptor dial options.
+type ClientMetrics struct {
+	c *collectors
+}
+
+// NewClientMetrics registers the client collectors on reg.
+func NewClientMetrics(reg prometheus.Registerer, opts Options) (*ClientMetrics, error) {
+	c, err := newCollectors(reg, "client", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientMetrics{c: c}, nil
+}
+
+// UnaryClientInterceptor records metrics for unary RPCs.
+func (m *ClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done := m.c.start(method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		done(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor records metrics for streaming RPCs. A stream is
+// complete once RecvMsg returns an error, with io.EOF counted as OK, or
+// once it returns the only response of a client-streaming call.
+func (m *ClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done := m.c.start(method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			done(err)
+			return nil, err
+		}
+		return &monitoredClientStream{ClientStream: cs, serverStreams: desc.ServerStreams, done: done}, nil
+	}
+}
+
+type monitoredClientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	done          func(error)
+}
+
+func (s *monitoredClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	// A client-streaming call ends with its only response
+	if err != nil || !s.serverStreams {
+		s.once.Do(func() {
+			if err == io.EOF {
+				s.done(nil)
+			} else {
+				s.done(err)
+			}
+		})
+	}
+	return err
+}
@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name must not be empty")
+	}
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!"}, nil
+}
+
+func (greeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	for i := 0; i < 3; i++ {
+		if err := stream.Send(&pb.HelloReply{Message: "Hello, " + req.Name + "!"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (greeter) SayHelloBatch(stream pb.Greeter_SayHelloBatchServer) error {
+	n := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.HelloReply{Message: "Hello, everyone!", GreetingCount: int32(n)})
+		}
+		if err != nil {
+			return err
+		}
+		n++
+	}
+}
+
+// newClient connects a client and server, both instrumented against reg.
+func newClient(t *testing.T, reg *prometheus.Registry) pb.GreeterClient {
+	t.Helper()
+	opts := Options{Buckets: []float64{0.01, 0.1, 1}}
+	sm, err := NewServerMetrics(reg, opts)
+	if err != nil {
+		t.Fatalf("NewServerMetrics: %v", err)
+	}
+	cm, err := NewClientMetrics(reg, opts)
+	if err != nil {
+		t.Fatalf("NewClientMetrics: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(sm.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(sm.StreamServerInterceptor()))
+	pb.RegisterGreeterServer(s, greeter{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(cm.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(cm.StreamClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewGreeterClient(conn)
+}
+
+// find returns the metric in family name whose labels include want.
+func find(t *testing.T, reg *prometheus.Registry, name string, want map[string]string) *dto.Metric {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			for k, v := range want {
+				if labels[k] != v {
+					continue metrics
+				}
+			}
+			return m
+		}
+	}
+	t.Fatalf("no %s metric with labels %v", name, want)
+	return nil
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	client := newClient(t, reg)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "metrics"}); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+	}
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument", err)
+	}
+	for i := 0; i < 2; i++ {
+		stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "metrics"})
+		if err != nil {
+			t.Fatalf("SayHelloStream: %v", err)
+		}
+		for {
+			if _, err := stream.Recv(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+		}
+	}
+
+	hello := pb.Greeter_SayHello_FullMethodName
+	helloStream := pb.Greeter_SayHelloStream_FullMethodName
+	for _, side := range []string{"server", "client"} {
+		counters := []struct {
+			method, code string
+			want         float64
+		}{
+			{hello, "OK", 3},
+			{hello, "InvalidArgument", 1},
+			{helloStream, "OK", 2},
+		}
+		for _, c := range counters {
+			m := find(t, reg, "grpc_"+side+"_handled_total", map[string]string{"method": c.method, "code": c.code})
+			if got := m.GetCounter().GetValue(); got != c.want {
+				t.Errorf("%s handled_total{%s,%s} = %v, want %v", side, c.method, c.code, got, c.want)
+			}
+		}
+
+		histograms := map[string]uint64{hello: 4, helloStream: 2}
+		for method, want := range histograms {
+			m := find(t, reg, "grpc_"+side+"_handling_seconds", map[string]string{"method": method})
+			if got := m.GetHistogram().GetSampleCount(); got != want {
+				t.Errorf("%s handling_seconds{%s} sample count = %d, want %d", side, method, got, want)
+			}
+			if got := len(m.GetHistogram().GetBucket()); got != 3 {
+				t.Errorf("%s handling_seconds{%s} has %d buckets, want 3", side, method, got)
+			}
+		}
+
+		for _, method := range []string{hello, helloStream} {
+			m := find(t, reg, "grpc_"+side+"_in_flight", map[string]string{"method": method})
+			if got := m.GetGauge().GetValue(); got != 0 {
+				t.Errorf("%s in_flight{%s} = %v, want 0", side, method, got)
+			}
+		}
+	}
+}
+
+// TestClientStreamMetrics checks that a client-streaming call, whose
+// CloseAndRecv succeeds without RecvMsg ever returning io.EOF, is counted
+// as done.
+func TestClientStreamMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	client := newClient(t, reg)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		batch, err := client.SayHelloBatch(ctx)
+		if err != nil {
+			t.Fatalf("SayHelloBatch: %v", err)
+		}
+		for _, name := range []string{"Alice", "Bob"} {
+			if err := batch.Send(&pb.HelloRequest{Name: name}); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+		}
+		if _, err := batch.CloseAndRecv(); err != nil {
+			t.Fatalf("CloseAndRecv: %v", err)
+		}
+	}
+
+	batch := pb.Greeter_SayHelloBatch_FullMethodName
+	for _, side := range []string{"server", "client"} {
+		m := find(t, reg, "grpc_"+side+"_handled_total", map[string]string{"method": batch, "code": "OK"})
+		if got := m.GetCounter().GetValue(); got != 2 {
+			t.Errorf("%s handled_total{%s,OK} = %v, want 2", side, batch, got)
+		}
+		m = find(t, reg, "grpc_"+side+"_in_flight", map[string]string{"method": batch})
+		if got := m.GetGauge().GetValue(); got != 0 {
+			t.Errorf("%s in_flight{%s} = %v, want 0", side, batch, got)
+		}
+	}
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := NewServerMetrics(reg, Options{}); err != nil {
+		t.Fatalf("NewServerMetrics: %v", err)
+	}
+	if _, err := NewServerMetrics(reg, Options{}); err == nil {
+		t.Fatal("expected registering the server collectors twice to fail")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Values accepted by -output.
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+)
+
+// printer writes replies and errors in the format selected by -output. In
+// the JSON formats every reply and error is a standalone object: json indents
+// each one, jsonl puts each on its own line.
+type printer struct {
+	format string
+	out    io.Writer
+	errOut io.Writer
+}
+
+// reply writes resp. label names the RPC in text output, e.g. "stream".
+func (p printer) reply(label string, resp *pb.HelloReply) error {
+	switch p.format {
+	case outputJSON, outputJSONL:
+		b, err := protojson.MarshalOptions{Multiline: p.format == outputJSON}.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.out, "%s\n", b)
+		return err
+	}
+	if label != "" {
+		label = " " + label
+	}
+	_, err := fmt.Fprintf(p.out, "Greeter client received%s: %s (Count: %d)\n", label, resp.Message, resp.GreetingCount)
+	return err
+}
+
+// note writes an informational line that only appears in text output.
+func (p printer) note(s string) {
+	if p.format == outputText {
+		fmt.Fprintln(p.out, s)
+	}
+}
+
+// fail reports err from the step described by what and returns it. The JSON
+// formats write {"code": ..., "message": ...} to the regular output so
+// scripts read errors from the same stream as replies.
+func (p printer) fail(what string, err error) error {
+	if p.format == outputText {
+		fmt.Fprintf(p.errOut, "%s: %s\n", what, greeterclient.DescribeError(err))
+		return err
+	}
+	s := status.Convert(err)
+	b, jsonErr := json.Marshal(struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{s.Code().String(), s.Message()})
+	if jsonErr != nil {
+		return jsonErr
+	}
+	fmt.Fprintf(p.out, "%s\n", b)
+	return err
+}
+
+// interrupted summarizes a stream cut short by cancellation or its deadline
+// and returns err. The JSON formats report it like any other error.
+func (p printer) interrupted(err *greeterclient.PartialStreamError) error {
+	if p.format != outputText {
+		return p.fail("", err)
+	}
+	fmt.Fprintf(p.errOut, "Stream interrupted (%s) after %d messages\n", status.Code(err), err.Received)
+	return err
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/config"
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	"github.com/shrivatsas/exp-codegen/grpc/greeterclient"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// newTestClient returns a greeterclient.Client for a fresh test server.
+func newTestClient(t *testing.T) *greeterclient.Client {
+	t.Helper()
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(0), greeter.WithHostname("replica-1")))
+	c, err := greeterclient.New(testutil.Target, greeterclient.WithDialOptions(grpc.WithContextDialer(ts.Dialer())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// testConfig is the default config with the given name and output format.
+func testConfig(name, output string) config.ClientConfig {
+	return config.ClientConfig{Name: name, Output: output, StreamTimeout: 5 * time.Second, Count: -1, Interval: -1}
+}
+
+// decodeReplies unmarshals each JSON value in b into a HelloReply.
+func decodeReplies(t *testing.T, b []byte) []*pb.HelloReply {
+	t.Helper()
+	var replies []*pb.HelloReply
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); errors.Is(err, io.EOF) {
+			return replies
+		} else if err != nil {
+			t.Fatalf("output %q is not JSON: %v", b, err)
+		}
+		var reply pb.HelloReply
+		if err := protojson.Unmarshal(raw, &reply); err != nil {
+			t.Fatalf("%s does not unmarshal into HelloReply: %v", raw, err)
+		}
+		replies = append(replies, &reply)
+	}
+}
+
+func TestOutputText(t *testing.T) {
+	var out bytes.Buffer
+	p := printer{format: outputText, out: &out, errOut: io.Discard}
+	if err := runHello(context.Background(), newTestClient(t), testConfig("Alice", outputText), p); err != nil {
+		t.Fatalf("runHello: %v", err)
+	}
+	// The Served at line varies, so check around it
+	want := "Greeter client received: Hello, Alice! (Count: 1)\nServed by: replica-1\nServed at: "
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("got %q, want it to start with %q", out.String(), want)
+	}
+	want = ")\n\nStreaming responses:\n" +
+		"Greeter client received stream: Hello 1, Streaming Alice! (Count: 1)\n"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("got %q, want it to contain %q", out.String(), want)
+	}
+	if !regexp.MustCompile(`Served at: \S+ \(round trip [0-9.]+[µm]?s\)`).MatchString(out.String()) {
+		t.Errorf("got %q, want the server timestamp and round trip", out.String())
+	}
+}
+
+func TestOutputJSON(t *testing.T) {
+	var out bytes.Buffer
+	p := printer{format: outputJSON, out: &out, errOut: io.Discard}
+	if err := runBatch(context.Background(), newTestClient(t), config.ClientConfig{Names: config.List{"Alice", "Bob"}, Output: outputJSON, StreamTimeout: 5 * time.Second}, nil, p); err != nil {
+		t.Fatalf("runBatch: %v", err)
+	}
+	replies := decodeReplies(t, out.Bytes())
+	if len(replies) != 1 || replies[0].Message != "Hello Alice, Bob" || replies[0].GreetingCount != 2 {
+		t.Errorf("got %v, want one batch reply", replies)
+	}
+	// protojson uses the proto's JSON names
+	if !strings.Contains(out.String(), `"greetingCount"`) {
+		t.Errorf("output %q does not use the proto field names", out.String())
+	}
+}
+
+func TestOutputJSONLStream(t *testing.T) {
+	var out bytes.Buffer
+	p := printer{format: outputJSONL, out: &out, errOut: io.Discard}
+	if err := runHello(context.Background(), newTestClient(t), testConfig("Alice", outputJSONL), p); err != nil {
+		t.Fatalf("runHello: %v", err)
+	}
+
+	// One SayHello reply followed by five stream replies, one per line
+	scanner := bufio.NewScanner(&out)
+	var lines int
+	for scanner.Scan() {
+		lines++
+		var reply pb.HelloReply
+		if err := protojson.Unmarshal(scanner.Bytes(), &reply); err != nil {
+			t.Fatalf("line %d %q does not unmarshal into HelloReply: %v", lines, scanner.Text(), err)
+		}
+		if lines == 6 && reply.Message != "Hello 5, Streaming Alice!" {
+			t.Errorf("last line has message %q", reply.Message)
+		}
+	}
+	if lines != 6 {
+		t.Errorf("got %d lines, want 6", lines)
+	}
+}
+
+func TestOutputJSONError(t *testing.T) {
+	for _, format := range []string{outputJSON, outputJSONL} {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			p := printer{format: format, out: &out, errOut: io.Discard}
+			if err := runHello(context.Background(), newTestClient(t), testConfig("", format), p); err == nil {
+				t.Fatal("runHello succeeded with an empty name")
+			}
+			var got struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("output %q is not a JSON object: %v", out.String(), err)
+			}
+			if got.Code != "InvalidArgument" || got.Message == "" {
+				t.Errorf("got %+v, want an InvalidArgument error", got)
+			}
+		})
+	}
+}
+
+func TestOutputTextError(t *testing.T) {
+	var out, errOut bytes.Buffer
+	p := printer{format: outputText, out: &out, errOut: &errOut}
+	if err := runHello(context.Background(), newTestClient(t), testConfig("", outputText), p); err == nil {
+		t.Fatal("runHello succeeded with an empty name")
+	}
+	if out.Len() != 0 || !strings.HasPrefix(errOut.String(), "Could not greet: InvalidArgument") {
+		t.Errorf("got stdout %q and stderr %q", out.String(), errOut.String())
+	}
+}
+
+// cancelAfter is a writer that calls cancel once it has seen n lines
+// containing marker.
+type cancelAfter struct {
+	bytes.Buffer
+	marker string
+	n      int
+	cancel context.CancelFunc
+}
+
+func (w *cancelAfter) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), w.marker) {
+		if w.n--; w.n == 0 {
+			w.cancel()
+		}
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestOutputInterrupted(t *testing.T) {
+	ts := testutil.Start(t, testutil.WithGreeterOptions(greeter.WithStreamInterval(10*time.Millisecond)))
+	client, err := greeterclient.New(testutil.Target, greeterclient.WithDialOptions(grpc.WithContextDialer(ts.Dialer())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &cancelAfter{marker: "received stream", n: 2, cancel: cancel}
+	var errOut bytes.Buffer
+	cfg := testConfig("Alice", outputText)
+	cfg.Count = 100
+	err = runHello(ctx, client, cfg, printer{format: outputText, out: out, errOut: &errOut})
+	if status.Code(err) != codes.Canceled {
+		t.Fatalf("runHello: got %v, want Canceled", err)
+	}
+	if want := "Stream interrupted (Canceled) after 2 messages\n"; errOut.String() != want {
+		t.Errorf("got %q on stderr, want %q", errOut.String(), want)
+	}
+}
@@ -0,0 +1,133 @@
+// protos/experiment/experiment.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: protos/experiment/experiment.proto
+
+package experimentpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Experiments_GetExperimentStats_FullMethodName = "/greeter.experiment.v1.Experiments/GetExperimentStats"
+)
+
+// ExperimentsClient is the client API for Experiments service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Reports on the server's greeting experiment, which assigns each caller
+// one of several weighted variants of the greetings.
+type ExperimentsClient interface {
+	// Returns how many greetings each variant has served since the server
+	// started.
+	GetExperimentStats(ctx context.Context, in *GetExperimentStatsRequest, opts ...grpc.CallOption) (*GetExperimentStatsResponse, error)
+}
+
+type experimentsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewExperimentsClient(cc grpc.ClientConnInterface) ExperimentsClient {
+	return &experimentsClient{cc}
+}
+
+func (c *experimentsClient) GetExperimentStats(ctx context.Context, in *GetExperimentStatsRequest, opts ...grpc.CallOption) (*GetExperimentStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetExperimentStatsResponse)
+	err := c.cc.Invoke(ctx, Experiments_GetExperimentStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ExperimentsServer is the server API for Experiments service.
+// All implementations must embed UnimplementedExperimentsServer
+// for forward compatibility.
+//
+// Reports on the server's greeting experiment, which assigns each caller
+// one of several weighted variants of the greetings.
+type ExperimentsServer interface {
+	// Returns how many greetings each variant has served since the server
+	// started.
+	GetExperimentStats(context.Context, *GetExperimentStatsRequest) (*GetExperimentStatsResponse, error)
+	mustEmbedUnimplementedExperimentsServer()
+}
+
+// UnimplementedExperimentsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedExperimentsServer struct{}
+
+func (UnimplementedExperimentsServer) GetExperimentStats(context.Context, *GetExperimentStatsRequest) (*GetExperimentStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetExperimentStats not implemented")
+}
+func (UnimplementedExperimentsServer) mustEmbedUnimplementedExperimentsServer() {}
+func (UnimplementedExperimentsServer) testEmbeddedByValue()                     {}
+
+// UnsafeExperimentsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ExperimentsServer will
+// result in compilation errors.
+type UnsafeExperimentsServer interface {
+	mustEmbedUnimplementedExperimentsServer()
+}
+
+func RegisterExperimentsServer(s grpc.ServiceRegistrar, srv ExperimentsServer) {
+	// If the following call pancis, it indicates UnimplementedExperimentsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Experiments_ServiceDesc, srv)
+}
+
+func _Experiments_GetExperimentStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetExperimentStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExperimentsServer).GetExperimentStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Experiments_GetExperimentStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExperimentsServer).GetExperimentStats(ctx, req.(*GetExperimentStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Experiments_ServiceDesc is the grpc.ServiceDesc for Experiments service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Experiments_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "greeter.experiment.v1.Experiments",
+	HandlerType: (*ExperimentsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetExperimentStats",
+			Handler:    _Experiments_GetExperimentStats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "protos/experiment/experiment.proto",
+}
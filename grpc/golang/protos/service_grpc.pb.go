@@ -3,7 +3,7 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
 // versions:
 // - protoc-gen-go-grpc v1.5.1
-// - protoc             v5.29.3
+// - protoc             (unknown)
 // source: protos/service.proto
 
 package proto
@@ -21,8 +21,12 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Greeter_SayHello_FullMethodName       = "/example.Greeter/SayHello"
-	Greeter_SayHelloStream_FullMethodName = "/example.Greeter/SayHelloStream"
+	Greeter_SayHello_FullMethodName         = "/example.Greeter/SayHello"
+	Greeter_SayHelloStream_FullMethodName   = "/example.Greeter/SayHelloStream"
+	Greeter_SayHelloChat_FullMethodName     = "/example.Greeter/SayHelloChat"
+	Greeter_SayHelloBatch_FullMethodName    = "/example.Greeter/SayHelloBatch"
+	Greeter_ListGreetings_FullMethodName    = "/example.Greeter/ListGreetings"
+	Greeter_GetGreetingCount_FullMethodName = "/example.Greeter/GetGreetingCount"
 )
 
 // GreeterClient is the client API for Greeter service.
@@ -35,6 +39,14 @@ type GreeterClient interface {
 	SayHello(ctx context.Context, in *HelloRequest, opts ...grpc.CallOption) (*HelloReply, error)
 	// Sends multiple greetings
 	SayHelloStream(ctx context.Context, in *HelloRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[HelloReply], error)
+	// Replies to each greeting as it arrives
+	SayHelloChat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[HelloRequest, HelloReply], error)
+	// Greets a batch of names with a single summary reply
+	SayHelloBatch(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[HelloRequest, HelloReply], error)
+	// Lists the greetings SayHello has produced, oldest first
+	ListGreetings(ctx context.Context, in *ListGreetingsRequest, opts ...grpc.CallOption) (*ListGreetingsResponse, error)
+	// Reports how often a name, or anyone, has been greeted without greeting
+	GetGreetingCount(ctx context.Context, in *GetCountRequest, opts ...grpc.CallOption) (*GetCountResponse, error)
 }
 
 type greeterClient struct {
@@ -74,6 +86,52 @@ func (c *greeterClient) SayHelloStream(ctx context.Context, in *HelloRequest, op
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Greeter_SayHelloStreamClient = grpc.ServerStreamingClient[HelloReply]
 
+func (c *greeterClient) SayHelloChat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[HelloRequest, HelloReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Greeter_ServiceDesc.Streams[1], Greeter_SayHelloChat_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[HelloRequest, HelloReply]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Greeter_SayHelloChatClient = grpc.BidiStreamingClient[HelloRequest, HelloReply]
+
+func (c *greeterClient) SayHelloBatch(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[HelloRequest, HelloReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Greeter_ServiceDesc.Streams[2], Greeter_SayHelloBatch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[HelloRequest, HelloReply]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Greeter_SayHelloBatchClient = grpc.ClientStreamingClient[HelloRequest, HelloReply]
+
+func (c *greeterClient) ListGreetings(ctx context.Context, in *ListGreetingsRequest, opts ...grpc.CallOption) (*ListGreetingsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListGreetingsResponse)
+	err := c.cc.Invoke(ctx, Greeter_ListGreetings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *greeterClient) GetGreetingCount(ctx context.Context, in *GetCountRequest, opts ...grpc.CallOption) (*GetCountResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetCountResponse)
+	err := c.cc.Invoke(ctx, Greeter_GetGreetingCount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GreeterServer is the server API for Greeter service.
 // All implementations must embed UnimplementedGreeterServer
 // for forward compatibility.
@@ -84,6 +142,14 @@ type GreeterServer interface {
 	SayHello(context.Context, *HelloRequest) (*HelloReply, error)
 	// Sends multiple greetings
 	SayHelloStream(*HelloRequest, grpc.ServerStreamingServer[HelloReply]) error
+	// Replies to each greeting as it arrives
+	SayHelloChat(grpc.BidiStreamingServer[HelloRequest, HelloReply]) error
+	// Greets a batch of names with a single summary reply
+	SayHelloBatch(grpc.ClientStreamingServer[HelloRequest, HelloReply]) error
+	// Lists the greetings SayHello has produced, oldest first
+	ListGreetings(context.Context, *ListGreetingsRequest) (*ListGreetingsResponse, error)
+	// Reports how often a name, or anyone, has been greeted without greeting
+	GetGreetingCount(context.Context, *GetCountRequest) (*GetCountResponse, error)
 	mustEmbedUnimplementedGreeterServer()
 }
 
@@ -100,6 +166,18 @@ func (UnimplementedGreeterServer) SayHello(context.Context, *HelloRequest) (*Hel
 func (UnimplementedGreeterServer) SayHelloStream(*HelloRequest, grpc.ServerStreamingServer[HelloReply]) error {
 	return status.Errorf(codes.Unimplemented, "method SayHelloStream not implemented")
 }
+func (UnimplementedGreeterServer) SayHelloChat(grpc.BidiStreamingServer[HelloRequest, HelloReply]) error {
+	return status.Errorf(codes.Unimplemented, "method SayHelloChat not implemented")
+}
+func (UnimplementedGreeterServer) SayHelloBatch(grpc.ClientStreamingServer[HelloRequest, HelloReply]) error {
+	return status.Errorf(codes.Unimplemented, "method SayHelloBatch not implemented")
+}
+func (UnimplementedGreeterServer) ListGreetings(context.Context, *ListGreetingsRequest) (*ListGreetingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGreetings not implemented")
+}
+func (UnimplementedGreeterServer) GetGreetingCount(context.Context, *GetCountRequest) (*GetCountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGreetingCount not implemented")
+}
 func (UnimplementedGreeterServer) mustEmbedUnimplementedGreeterServer() {}
 func (UnimplementedGreeterServer) testEmbeddedByValue()                 {}
 
@@ -150,6 +228,56 @@ func _Greeter_SayHelloStream_Handler(srv interface{}, stream grpc.ServerStream)
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Greeter_SayHelloStreamServer = grpc.ServerStreamingServer[HelloReply]
 
+func _Greeter_SayHelloChat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GreeterServer).SayHelloChat(&grpc.GenericServerStream[HelloRequest, HelloReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Greeter_SayHelloChatServer = grpc.BidiStreamingServer[HelloRequest, HelloReply]
+
+func _Greeter_SayHelloBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GreeterServer).SayHelloBatch(&grpc.GenericServerStream[HelloRequest, HelloReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Greeter_SayHelloBatchServer = grpc.ClientStreamingServer[HelloRequest, HelloReply]
+
+func _Greeter_ListGreetings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGreetingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GreeterServer).ListGreetings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Greeter_ListGreetings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GreeterServer).ListGreetings(ctx, req.(*ListGreetingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Greeter_GetGreetingCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GreeterServer).GetGreetingCount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Greeter_GetGreetingCount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GreeterServer).GetGreetingCount(ctx, req.(*GetCountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Greeter_ServiceDesc is the grpc.ServiceDesc for Greeter service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -161,6 +289,14 @@ var Greeter_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SayHello",
 			Handler:    _Greeter_SayHello_Handler,
 		},
+		{
+			MethodName: "ListGreetings",
+			Handler:    _Greeter_ListGreetings_Handler,
+		},
+		{
+			MethodName: "GetGreetingCount",
+			Handler:    _Greeter_GetGreetingCount_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -168,6 +304,17 @@ var Greeter_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Greeter_SayHelloStream_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "SayHelloChat",
+			Handler:       _Greeter_SayHelloChat_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SayHelloBatch",
+			Handler:       _Greeter_SayHelloBatch_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "protos/service.proto",
 }
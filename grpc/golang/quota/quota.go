@@ -0,0 +1,175 @@
+// Package quota provides server interceptors that cap how many calls each
+// client, keyed by its authenticated identity, may make per day or other
+// window, counting them in a store.QuotaStore.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/ratelimit"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// RemainingKey is the response header carrying how many more calls the
+	// client may make in its current window.
+	RemainingKey = "x-quota-remaining"
+	// ResetKey is the response header carrying when the client's current
+	// window ends, in RFC 3339 format.
+	ResetKey = "x-quota-reset"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail on quota errors.
+const ErrorDomain = "greeter.quota"
+
+// Options configures a Quota.
+type Options struct {
+	// Limit is how many calls each client may make per window.
+	Limit int64
+	// Window, if positive, makes windows rolling: each starts with a
+	// client's first call after its previous window ended and lasts this
+	// long. Otherwise windows are calendar days.
+	Window time.Duration
+	// Location is the time zone whose midnights start calendar days. UTC is
+	// used when nil.
+	Location *time.Location
+	// Key identifies the client of each call. ratelimit.AuthSubject is used
+	// when nil, so run the auth interceptors first.
+	Key ratelimit.KeyFunc
+	// Store counts the calls. A store.MemoryQuotas is used when nil.
+	Store store.QuotaStore
+	// Exempt names RPCs that are not counted, either as full method names
+	// ("/pkg.Service/Method") or as service names ("pkg.Service") to cover
+	// every method of the service.
+	Exempt []string
+}
+
+// Quota counts each client's calls and rejects those over its limit.
+// Streaming RPCs count once when the stream is established, however many
+// messages it carries.
+type Quota struct {
+	opts Options
+	now  func() time.Time
+}
+
+// New returns a Quota applying opts.
+func New(opts Options) *Quota {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Key == nil {
+		opts.Key = ratelimit.AuthSubject
+	}
+	if opts.Store == nil {
+		opts.Store = store.NewMemoryQuotas()
+	}
+	return &Quota{opts: opts, now: time.Now}
+}
+
+// window returns the start and end of the window a call made at now counts
+// in, were the client to start a new one.
+func (q *Quota) window(now time.Time) (time.Time, time.Time) {
+	if q.opts.Window > 0 {
+		return now, now.Add(q.opts.Window)
+	}
+	t := now.In(q.opts.Location)
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, q.opts.Location)
+	return start, start.AddDate(0, 0, 1)
+}
+
+func (q *Quota) exempt(fullMethod string) bool {
+	for _, entry := range q.opts.Exempt {
+		if entry == fullMethod || strings.HasPrefix(fullMethod, "/"+entry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// per describes the window length in errors.
+func (q *Quota) per() string {
+	if q.opts.Window > 0 {
+		return q.opts.Window.String()
+	}
+	return "day"
+}
+
+// check counts the call to fullMethod in ctx. It returns the headers
+// reporting the client's remaining quota and, if the call is over it,
+// ResourceExhausted with QuotaFailure, ErrorInfo and RetryInfo details.
+func (q *Quota) check(ctx context.Context, fullMethod string) (metadata.MD, error) {
+	if q.exempt(fullMethod) {
+		return nil, nil
+	}
+	key := q.opts.Key(ctx)
+	now := q.now()
+	start, end := q.window(now)
+	u, ok, err := q.opts.Store.Take(ctx, key, start, end, q.opts.Limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "checking quota: %v", err)
+	}
+	remaining := strconv.FormatInt(max(q.opts.Limit-u.Used, 0), 10)
+	reset := u.Reset.UTC().Format(time.RFC3339)
+	header := metadata.Pairs(RemainingKey, remaining, ResetKey, reset)
+	if ok {
+		return header, nil
+	}
+
+	st, detailErr := status.New(codes.ResourceExhausted, fmt.Sprintf("quota of %d calls per %s exceeded for %s, resets at %s", q.opts.Limit, q.per(), key, reset)).WithDetails(
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     key,
+			Description: fmt.Sprintf("limit of %d calls per %s reached", q.opts.Limit, q.per()),
+		}}},
+		&errdetails.ErrorInfo{
+			Reason:   "QUOTA_EXCEEDED",
+			Domain:   ErrorDomain,
+			Metadata: map[string]string{"limit": strconv.FormatInt(q.opts.Limit, 10), "remaining": remaining, "reset": reset},
+		},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(u.Reset.Sub(now))})
+	if detailErr != nil {
+		return header, status.Errorf(codes.Internal, "attaching error details: %v", detailErr)
+	}
+	return header, st.Err()
+}
+
+// UnaryServerInterceptor counts unary calls, rejecting those over the
+// caller's quota with ResourceExhausted. Every counted call, rejected or
+// not, gets RemainingKey and ResetKey headers.
+func (q *Quota) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		header, err := q.check(ctx, info.FullMethod)
+		if header != nil {
+			grpc.SetHeader(ctx, header)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor counts new streams, rejecting those over the
+// caller's quota with ResourceExhausted. Every counted stream, rejected or
+// not, gets RemainingKey and ResetKey headers.
+func (q *Quota) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		header, err := q.check(ss.Context(), info.FullMethod)
+		if header != nil {
+			ss.SetHeader(header)
+		}
+		if err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
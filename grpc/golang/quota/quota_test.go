@@ -0,0 +1,183 @@
+package quota
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var key = []byte("quota-test-key")
+
+// clock is a settable time source for Quota.now.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+// start serves the Greeter behind HMAC auth and q, with q's clock set to c.
+func start(t *testing.T, q *Quota, c *clock) *testutil.Server {
+	t.Helper()
+	q.now = c.now
+	v := auth.NewHMACValidator(key)
+	opts := auth.DefaultOptions()
+	return testutil.Start(t, testutil.WithServerOptions(
+		grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(v, opts), q.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(auth.StreamServerInterceptor(v, opts), q.StreamServerInterceptor())))
+}
+
+// as returns a call option authenticating the call as subject.
+func as(subject string) grpc.CallOption {
+	token := auth.SignToken(key, subject, time.Now().Add(time.Hour))
+	return grpc.PerRPCCredentials(auth.TokenCredentials{Token: token, AllowInsecure: true})
+}
+
+// hello calls SayHello as subject, returning its error and the quota
+// headers sent with the response.
+func hello(t *testing.T, ts *testutil.Server, subject string) (remaining, reset string, err error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var header metadata.MD
+	_, err = ts.Client.SayHello(ctx, &pb.HelloRequest{Name: "Ada"}, as(subject), grpc.Header(&header))
+	return first(header, RemainingKey), first(header, ResetKey), err
+}
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func TestQuota(t *testing.T) {
+	c := &clock{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	ts := start(t, New(Options{Limit: 3}), c)
+
+	for _, want := range []string{"2", "1", "0"} {
+		remaining, reset, err := hello(t, ts, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remaining != want || reset != "2024-05-02T00:00:00Z" {
+			t.Errorf("got %s %q and %s %q, want %q left until midnight", RemainingKey, remaining, ResetKey, reset, want)
+		}
+	}
+
+	remaining, reset, err := hello(t, ts, "alice")
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("call over the quota got %v, want ResourceExhausted", err)
+	}
+	if remaining != "0" || reset != "2024-05-02T00:00:00Z" {
+		t.Errorf("rejected call got %s %q and %s %q, want 0 left until midnight", RemainingKey, remaining, ResetKey, reset)
+	}
+	var sawQuota, sawInfo, sawRetry bool
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.QuotaFailure:
+			sawQuota = len(d.Violations) == 1 && d.Violations[0].Subject == "subject:alice"
+		case *errdetails.ErrorInfo:
+			sawInfo = d.Reason == "QUOTA_EXCEEDED" && d.Domain == ErrorDomain &&
+				d.Metadata["remaining"] == "0" && d.Metadata["reset"] == "2024-05-02T00:00:00Z" && d.Metadata["limit"] == "3"
+		case *errdetails.RetryInfo:
+			sawRetry = d.RetryDelay.AsDuration() == 14*time.Hour
+		}
+	}
+	if !sawQuota || !sawInfo || !sawRetry {
+		t.Errorf("got details %v, want QuotaFailure for alice, ErrorInfo with the reset and RetryInfo of 14h", st.Details())
+	}
+
+	// bob's quota is separate, and a stream counts once
+	if remaining, _, err := hello(t, ts, "bob"); err != nil || remaining != "2" {
+		t.Errorf("bob's first call got %q, %v; want 2 left", remaining, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := ts.Client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Ada", Count: proto.Int32(3), Interval: durationpb.New(0)}, as("bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	header, _ := stream.Header()
+	if got := first(header, RemainingKey); got != "1" {
+		t.Errorf("bob's stream got %s %q, want 1", RemainingKey, got)
+	}
+}
+
+func TestCalendarDayBoundary(t *testing.T) {
+	// Days start at midnight in UTC-5, 05:00 UTC
+	zone := time.FixedZone("UTC-5", -5*60*60)
+	c := &clock{time.Date(2024, 5, 1, 4, 59, 59, 0, time.UTC)}
+	ts := start(t, New(Options{Limit: 1, Location: zone}), c)
+
+	if _, reset, err := hello(t, ts, "alice"); err != nil || reset != "2024-05-01T05:00:00Z" {
+		t.Fatalf("got reset %q, %v; want the coming midnight in UTC-5", reset, err)
+	}
+	if _, _, err := hello(t, ts, "alice"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second call got %v, want ResourceExhausted", err)
+	}
+	c.t = c.t.Add(time.Second)
+	remaining, reset, err := hello(t, ts, "alice")
+	if err != nil || remaining != "0" || reset != "2024-05-02T05:00:00Z" {
+		t.Errorf("first call of the new day got %q until %q, %v; want it counted against a new day", remaining, reset, err)
+	}
+}
+
+func TestRollingWindow(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 17, 0, 0, time.UTC)
+	c := &clock{t0}
+	ts := start(t, New(Options{Limit: 2, Window: time.Hour}), c)
+
+	if _, reset, err := hello(t, ts, "alice"); err != nil || reset != "2024-05-01T11:17:00Z" {
+		t.Fatalf("got reset %q, %v; want an hour after the first call", reset, err)
+	}
+	c.t = t0.Add(59 * time.Minute)
+	hello(t, ts, "alice")
+	if _, _, err := hello(t, ts, "alice"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("third call within the hour got %v, want ResourceExhausted", err)
+	}
+	c.t = t0.Add(time.Hour)
+	if remaining, reset, err := hello(t, ts, "alice"); err != nil || remaining != "1" || reset != "2024-05-01T12:17:00Z" {
+		t.Errorf("call after the window got %q until %q, %v; want a new window from now", remaining, reset, err)
+	}
+}
+
+func TestExempt(t *testing.T) {
+	c := &clock{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	q := New(Options{Limit: 1, Exempt: []string{healthpb.Health_ServiceDesc.ServiceName}})
+	ts := start(t, q, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	health := healthpb.NewHealthClient(ts.Conn)
+	for i := 0; i < 3; i++ {
+		var header metadata.MD
+		if _, err := health.Check(ctx, &healthpb.HealthCheckRequest{}, as("alice"), grpc.Header(&header)); err != nil {
+			t.Fatalf("health check %d: %v", i, err)
+		}
+		if got := first(header, RemainingKey); got != "" {
+			t.Errorf("exempt call got %s %q, want no header", RemainingKey, got)
+		}
+	}
+	if _, _, err := hello(t, ts, "alice"); err != nil {
+		t.Errorf("first counted call: %v", err)
+	}
+}
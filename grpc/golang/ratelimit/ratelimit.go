@@ -0,0 +1,183 @@
+// Package ratelimit provides server interceptors that throttle each client
+// with its own token bucket.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RetryAfterKey is the trailing metadata key carrying the number of seconds
+// a rejected client should wait before its next call is allowed.
+const RetryAfterKey = "retry-after"
+
+// KeyFunc names the client making a call; calls with the same key share a
+// bucket.
+type KeyFunc func(ctx context.Context) string
+
+// PeerIP keys calls by the client's IP address, or by its full address when
+// it has no host part, e.g. a Unix socket.
+func PeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// AuthSubject keys calls by the subject of their auth token, falling back to
+// PeerIP for calls without one. Run the auth interceptors first.
+func AuthSubject(ctx context.Context) string {
+	if subject, ok := auth.SubjectFromContext(ctx); ok {
+		return "subject:" + subject
+	}
+	return PeerIP(ctx)
+}
+
+// Limit is a token bucket refilled at Rate calls per second up to Burst.
+// A Limit with a non-positive Rate does not throttle, and a Burst below 1 is
+// treated as 1.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Options configures a Limiter.
+type Options struct {
+	// Key identifies the client of each call. PeerIP is used when nil.
+	Key KeyFunc
+	// Default is the fallback limit for every key without a PerKey entry.
+	Default Limit
+	// PerKey overrides Default for specific keys, as returned by Key.
+	PerKey map[string]Limit
+}
+
+// Limiter throttles calls per client. Streaming RPCs take one token when
+// the stream is established, however many messages it carries.
+type Limiter struct {
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// swept is when idle buckets were last removed.
+	swept time.Time
+}
+
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// sweepInterval is how often buckets that have refilled completely, and so
+// behave like new ones, are dropped.
+const sweepInterval = time.Minute
+
+// New returns a Limiter applying opts.
+func New(opts Options) *Limiter {
+	if opts.Key == nil {
+		opts.Key = PeerIP
+	}
+	return &Limiter{opts: opts, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// limitFor returns the limit applied to key.
+func (l *Limiter) limitFor(key string) Limit {
+	if limit, ok := l.opts.PerKey[key]; ok {
+		return limit
+	}
+	return l.opts.Default
+}
+
+// allow takes a token from key's bucket. If none is available it returns
+// false and how long until one is.
+func (l *Limiter) allow(key string) (bool, time.Duration) {
+	limit := l.limitFor(key)
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+	limit.Burst = max(limit.Burst, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.swept) >= sweepInterval {
+		for k, b := range l.buckets {
+			if b.refill(now) >= float64(b.limit.Burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	if b.refill(now) >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// refill adds the tokens earned since the last refill and returns the total.
+func (b *bucket) refill(now time.Time) float64 {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+	return b.tokens
+}
+
+// check returns ResourceExhausted if the caller in ctx is over its limit,
+// along with the trailer telling it when to retry.
+func (l *Limiter) check(ctx context.Context) (metadata.MD, error) {
+	key := l.opts.Key(ctx)
+	ok, wait := l.allow(key)
+	if ok {
+		return nil, nil
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	return metadata.Pairs(RetryAfterKey, strconv.Itoa(seconds)),
+		status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s, retry in %ds", key, seconds)
+}
+
+// UnaryServerInterceptor rejects unary calls over the caller's limit with
+// ResourceExhausted and a RetryAfterKey trailer.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if trailer, err := l.check(ctx); err != nil {
+			grpc.SetTrailer(ctx, trailer)
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects new streams over the caller's limit with
+// ResourceExhausted and a RetryAfterKey trailer.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if trailer, err := l.check(ss.Context()); err != nil {
+			ss.SetTrailer(trailer)
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
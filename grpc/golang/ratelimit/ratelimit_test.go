@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := New(Options{Default: Limit{Rate: 2, Burst: 2}})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("call %d within the burst was rejected", i+1)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("call over the burst: got %v with wait %v, want rejected with 500ms", ok, wait)
+	}
+	now = now.Add(250 * time.Millisecond)
+	if ok, wait := l.allow("a"); ok || wait != 250*time.Millisecond {
+		t.Errorf("after 250ms: got %v with wait %v, want rejected with 250ms", ok, wait)
+	}
+	now = now.Add(250 * time.Millisecond)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("call after the refill was rejected")
+	}
+}
+
+func TestLimitFor(t *testing.T) {
+	l := New(Options{
+		Default: Limit{Rate: 1, Burst: 1},
+		PerKey:  map[string]Limit{"batch-job": {Rate: 1, Burst: 3}, "trusted": {}},
+	})
+	l.now = func() time.Time { return time.Unix(1_700_000_000, 0) }
+
+	allowed := func(key string, calls int) int {
+		n := 0
+		for i := 0; i < calls; i++ {
+			if ok, _ := l.allow(key); ok {
+				n++
+			}
+		}
+		return n
+	}
+	if got := allowed("anyone", 5); got != 1 {
+		t.Errorf("default key allowed %d of 5 calls, want 1", got)
+	}
+	if got := allowed("batch-job", 5); got != 3 {
+		t.Errorf("overridden key allowed %d of 5 calls, want 3", got)
+	}
+	if got := allowed("trusted", 5); got != 5 {
+		t.Errorf("unlimited key allowed %d of 5 calls, want 5", got)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := New(Options{Default: Limit{Rate: 1, Burst: 1}})
+	l.now = func() time.Time { return now }
+
+	l.allow("a")
+	now = now.Add(sweepInterval)
+	l.allow("b")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("bucket in use was swept")
+	}
+}
+
+// clientKey identifies test clients by an x-client metadata entry, since
+// every bufconn connection has the same peer address.
+func clientKey(ctx context.Context) string {
+	if ids := metadata.ValueFromIncomingContext(ctx, "x-client"); len(ids) > 0 {
+		return ids[0]
+	}
+	return PeerIP(ctx)
+}
+
+// start serves the Greeter behind a Limiter for opts.
+func start(t *testing.T, opts Options) pb.GreeterClient {
+	t.Helper()
+	opts.Key = clientKey
+	l := New(opts)
+	return testutil.Start(t,
+		testutil.WithGreeterOptions(greeter.WithStreamInterval(0)),
+		testutil.WithServerOptions(
+			grpc.ChainUnaryInterceptor(l.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(l.StreamServerInterceptor())),
+	).Client
+}
+
+func asClient(ctx context.Context, id string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-client", id)
+}
+
+func TestUnaryBurst(t *testing.T) {
+	// Effectively no refill during the test
+	client := start(t, Options{Default: Limit{Rate: 0.01, Burst: 3}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rejected int
+	var trailer metadata.MD
+	for i := 0; i < 5; i++ {
+		_, err := client.SayHello(asClient(ctx, "noisy"), &pb.HelloRequest{Name: "Alice"}, grpc.Trailer(&trailer))
+		switch status.Code(err) {
+		case codes.OK:
+		case codes.ResourceExhausted:
+			rejected++
+		default:
+			t.Fatalf("SayHello: %v", err)
+		}
+	}
+	if rejected != 2 {
+		t.Errorf("rejected %d of 5 calls with a burst of 3, want 2", rejected)
+	}
+	// One token takes 100s at 0.01/s
+	if got := trailer.Get(RetryAfterKey); len(got) != 1 || got[0] != "100" {
+		t.Errorf("got %s trailer %q, want 100", RetryAfterKey, got)
+	}
+
+	// Another identity has its own bucket
+	if _, err := client.SayHello(asClient(ctx, "quiet"), &pb.HelloRequest{Name: "Bob"}); err != nil {
+		t.Errorf("SayHello from a second client: %v", err)
+	}
+}
+
+func TestStreamCountsEstablishment(t *testing.T) {
+	client := start(t, Options{Default: Limit{Rate: 0.01, Burst: 1}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	recvAll := func() (int, error) {
+		stream, err := client.SayHelloStream(asClient(ctx, "streamer"), &pb.HelloRequest{Name: "Alice"})
+		if err != nil {
+			return 0, err
+		}
+		for n := 0; ; n++ {
+			if _, err := stream.Recv(); err == io.EOF {
+				return n, nil
+			} else if err != nil {
+				return n, err
+			}
+		}
+	}
+	// Five replies on one stream use a single token
+	if n, err := recvAll(); err != nil || n != 5 {
+		t.Fatalf("first stream got %d replies and %v, want 5 and no error", n, err)
+	}
+	if _, err := recvAll(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second stream got %v, want ResourceExhausted", err)
+	}
+}
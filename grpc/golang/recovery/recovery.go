@@ -0,0 +1,91 @@
+// Package recovery provides server interceptors that turn a panicking
+// handler into a codes.Internal error instead of crashing the process.
+package recovery
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RecoveryHandler returns the error sent to the caller after a handler
+// panicked with p.
+type RecoveryHandler func(ctx context.Context, p any) error
+
+// Options configures the interceptors.
+type Options struct {
+	// Logger receives one error record per panic, including the stack.
+	// slog.Default() is used when nil.
+	Logger *slog.Logger
+	// Handler chooses the returned status. By default callers get
+	// codes.Internal without the panic value, which may hold internal
+	// details; that default also applies if Handler returns nil.
+	Handler RecoveryHandler
+	// Panics, if set, is incremented with the method name on every panic;
+	// see NewPanicsCounter.
+	Panics *prometheus.CounterVec
+}
+
+// NewPanicsCounter registers a counter of recovered panics by method on reg.
+func NewPanicsCounter(reg prometheus.Registerer) (*prometheus.CounterVec, error) {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_panics_recovered_total",
+		Help: "Total number of handler panics recovered, by method.",
+	}, []string{"method"})
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UnaryServerInterceptor recovers panics in unary handlers. Place it last in
+// the chain so the interceptors before it see the returned error.
+func UnaryServerInterceptor(opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = opts.recovered(ctx, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor recovers panics in streaming handlers. Place it
+// last in the chain so the interceptors before it see the returned error.
+func StreamServerInterceptor(opts Options) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = opts.recovered(ss.Context(), info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// recovered logs and counts a panic in method and returns the caller's error.
+func (o Options) recovered(ctx context.Context, method string, p any) error {
+	logger := o.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.LogAttrs(ctx, slog.LevelError, "recovered from panic",
+		slog.String("grpc.method", method),
+		slog.Any("panic", p),
+		slog.String("stack", string(debug.Stack())))
+	if o.Panics != nil {
+		o.Panics.WithLabelValues(method).Inc()
+	}
+	if o.Handler != nil {
+		if err := o.Handler(ctx, p); err != nil {
+			return err
+		}
+	}
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,160 @@
+package recovery_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/recovery"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// panicName makes panickyGreeter panic.
+const panicName = "panic-now"
+
+type panickyGreeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (panickyGreeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	if req.Name == panicName {
+		panic("asked to panic")
+	}
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!"}, nil
+}
+
+func (panickyGreeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	if err := stream.Send(&pb.HelloReply{Message: "Hello, " + req.Name + "!"}); err != nil {
+		return err
+	}
+	if req.Name == panicName {
+		panic("asked to panic mid-stream")
+	}
+	return nil
+}
+
+// syncBuffer is a bytes.Buffer safe for the server's goroutines to log to.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// start runs panickyGreeter behind the recovery interceptors configured by opts.
+func start(t *testing.T, opts recovery.Options) pb.GreeterClient {
+	t.Helper()
+	return testutil.Start(t,
+		testutil.WithService(panickyGreeter{}),
+		testutil.WithServerOptions(
+			grpc.ChainUnaryInterceptor(recovery.UnaryServerInterceptor(opts)),
+			grpc.ChainStreamInterceptor(recovery.StreamServerInterceptor(opts))),
+	).Client
+}
+
+func TestUnaryPanic(t *testing.T) {
+	var logs syncBuffer
+	reg := prometheus.NewRegistry()
+	panics, err := recovery.NewPanicsCounter(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := start(t, recovery.Options{Logger: slog.New(slog.NewTextHandler(&logs, nil)), Panics: panics})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = client.SayHello(ctx, &pb.HelloRequest{Name: panicName})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("got %v, want Internal", err)
+	}
+	if strings.Contains(status.Convert(err).Message(), "asked to panic") {
+		t.Errorf("panic value leaked to the caller: %v", err)
+	}
+
+	// The server is still serving
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Fatalf("SayHello after a panic: %v", err)
+	}
+
+	out := logs.String()
+	for _, want := range []string{"recovered from panic", "asked to panic", "panickyGreeter.SayHello", pb.Greeter_SayHello_FullMethodName} {
+		if !strings.Contains(out, want) {
+			t.Errorf("logs do not contain %q:\n%s", want, out)
+		}
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got float64
+	for _, f := range families {
+		if f.GetName() == "grpc_server_panics_recovered_total" {
+			for _, m := range f.Metric {
+				got += m.GetCounter().GetValue()
+			}
+		}
+	}
+	if got != 1 {
+		t.Errorf("panics counter is %v, want 1", got)
+	}
+}
+
+func TestStreamPanic(t *testing.T) {
+	var logs syncBuffer
+	client := start(t, recovery.Options{Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: panicName})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("first Recv: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Internal {
+		t.Errorf("got %v after the panic, want Internal", err)
+	}
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Fatalf("SayHello after a panic: %v", err)
+	}
+	if !strings.Contains(logs.String(), "panickyGreeter.SayHelloStream") {
+		t.Errorf("logs do not contain the stack:\n%s", logs.String())
+	}
+}
+
+func TestRecoveryHandler(t *testing.T) {
+	client := start(t, recovery.Options{
+		Logger: slog.New(slog.NewTextHandler(&syncBuffer{}, nil)),
+		Handler: func(_ context.Context, p any) error {
+			return status.Errorf(codes.Unavailable, "try again: %v", p)
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: panicName})
+	if status.Code(err) != codes.Unavailable || status.Convert(err).Message() != "try again: asked to panic" {
+		t.Errorf("got %v, want the handler's status", err)
+	}
+}
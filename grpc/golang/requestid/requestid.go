@@ -0,0 +1,103 @@
+// Package requestid tags each RPC with an ID that is sent from client to
+// server in metadata and echoed back in a response header, so log lines on
+// both sides can be correlated. A streaming RPC carries one ID for its whole
+// lifetime.
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataKey is the request metadata key and response header carrying the ID.
+const MetadataKey = "x-request-id"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id. The client interceptors send
+// it instead of generating a new one; the server interceptors set it on the
+// handler's context.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// outgoing returns ctx with the request ID in its outgoing metadata. An ID
+// already in the metadata wins, then one from NewContext, and otherwise a
+// new UUID is generated.
+func outgoing(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(MetadataKey)) > 0 {
+		return ctx
+	}
+	id, ok := FromContext(ctx)
+	if !ok {
+		id = uuid.NewString()
+	}
+	return metadata.AppendToOutgoingContext(NewContext(ctx, id), MetadataKey, id)
+}
+
+// UnaryClientInterceptor sends a request ID with each unary call. Place it
+// before any retry interceptor so every attempt shares the ID.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor sends a request ID with each streaming call.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+// incoming returns the request ID sent by the client, or a new UUID if it
+// sent none.
+func incoming(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(MetadataKey); len(ids) > 0 && ids[0] != "" {
+			return ids[0]
+		}
+	}
+	return uuid.NewString()
+}
+
+// UnaryServerInterceptor puts the call's request ID in the handler context
+// and echoes it in the response header. Place it before the logging
+// interceptors so their records include the ID.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id := incoming(ctx)
+		ctx = NewContext(ctx, id)
+		grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, id))
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id := incoming(ss.Context())
+		ss.SetHeader(metadata.Pairs(MetadataKey, id))
+		return handler(srv, &serverStream{ServerStream: ss, ctx: NewContext(ss.Context(), id)})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,166 @@
+package requestid_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/requestid"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// recordingGreeter records the request ID seen by each handler.
+type recordingGreeter struct {
+	pb.UnimplementedGreeterServer
+
+	mu  sync.Mutex
+	ids []string
+}
+
+func (g *recordingGreeter) record(ctx context.Context) {
+	id, _ := requestid.FromContext(ctx)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ids = append(g.ids, id)
+}
+
+func (g *recordingGreeter) seen() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.ids...)
+}
+
+func (g *recordingGreeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	g.record(ctx)
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!"}, nil
+}
+
+func (g *recordingGreeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	for i := 0; i < 3; i++ {
+		g.record(stream.Context())
+		if err := stream.Send(&pb.HelloReply{Message: "Hello, " + req.Name + "!"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start runs g behind the requestid interceptors on both sides.
+func start(t *testing.T, g *recordingGreeter) pb.GreeterClient {
+	t.Helper()
+	return testutil.Start(t,
+		testutil.WithService(g),
+		testutil.WithServerOptions(
+			grpc.ChainUnaryInterceptor(requestid.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(requestid.StreamServerInterceptor())),
+		testutil.WithDialOptions(
+			grpc.WithChainUnaryInterceptor(requestid.UnaryClientInterceptor()),
+			grpc.WithChainStreamInterceptor(requestid.StreamClientInterceptor())),
+	).Client
+}
+
+func sayHello(t *testing.T, ctx context.Context, client pb.GreeterClient) string {
+	t.Helper()
+	var header metadata.MD
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Alice"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	ids := header.Get(requestid.MetadataKey)
+	if len(ids) != 1 {
+		t.Fatalf("got response IDs %q, want one", ids)
+	}
+	return ids[0]
+}
+
+func TestUnaryRoundTrip(t *testing.T) {
+	g := &recordingGreeter{}
+	client := start(t, g)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first := sayHello(t, ctx, client)
+	second := sayHello(t, ctx, client)
+	if first == "" || first == second {
+		t.Errorf("got IDs %q and %q, want a distinct ID per call", first, second)
+	}
+	if seen := g.seen(); len(seen) != 2 || seen[0] != first || seen[1] != second {
+		t.Errorf("server saw %q, client got %q and %q", seen, first, second)
+	}
+}
+
+func TestCallerSuppliedID(t *testing.T) {
+	g := &recordingGreeter{}
+	client := start(t, g)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if got := sayHello(t, requestid.NewContext(ctx, "from-context"), client); got != "from-context" {
+		t.Errorf("NewContext: got ID %q", got)
+	}
+	md := metadata.AppendToOutgoingContext(ctx, requestid.MetadataKey, "from-metadata")
+	if got := sayHello(t, md, client); got != "from-metadata" {
+		t.Errorf("outgoing metadata: got ID %q", got)
+	}
+	if seen := g.seen(); len(seen) != 2 || seen[0] != "from-context" || seen[1] != "from-metadata" {
+		t.Errorf("server saw %q", seen)
+	}
+}
+
+func TestStreamSharesOneID(t *testing.T) {
+	g := &recordingGreeter{}
+	client := start(t, g)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "Alice"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+	}
+
+	ids := header.Get(requestid.MetadataKey)
+	if len(ids) != 1 || ids[0] == "" {
+		t.Fatalf("got response IDs %q, want one", ids)
+	}
+	seen := g.seen()
+	if len(seen) != 3 {
+		t.Fatalf("server recorded %d IDs, want 3", len(seen))
+	}
+	for _, id := range seen {
+		if id != ids[0] {
+			t.Errorf("server saw %q during a stream with ID %q", seen, ids[0])
+			break
+		}
+	}
+}
+
+func TestServerGeneratesMissingID(t *testing.T) {
+	g := &recordingGreeter{}
+	// Only the server interceptor, as for a client that sends no ID
+	client := testutil.Start(t,
+		testutil.WithService(g),
+		testutil.WithServerOptions(grpc.ChainUnaryInterceptor(requestid.UnaryServerInterceptor())),
+	).Client
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id := sayHello(t, ctx, client)
+	if seen := g.seen(); len(seen) != 1 || seen[0] != id || id == "" {
+		t.Errorf("server saw %q, client got %q", seen, id)
+	}
+}
@@ -0,0 +1,87 @@
+// Package retry provides a unary client interceptor that retries transient
+// failures with exponential backoff and jitter.
+package retry
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy controls which failures are retried and how long to wait between attempts.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// MaxElapsed bounds the total time spent retrying. Zero means no bound
+	// beyond the call's own deadline.
+	MaxElapsed time.Duration
+	// InitialBackoff is the wait before the first retry; each subsequent
+	// wait is multiplied by Multiplier and capped at MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes each wait by up to this fraction in either direction.
+	Jitter float64
+	// Codes lists the status codes that are retried.
+	Codes []codes.Code
+}
+
+// DefaultPolicy returns a policy that retries Unavailable and
+// ResourceExhausted up to four attempts.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    4,
+		MaxElapsed:     10 * time.Second,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Codes:          []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+	}
+}
+
+// backoff returns the jittered wait before retry number n, starting at 1.
+func (p Policy) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < n; i++ {
+		d *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// UnaryClientInterceptor retries unary calls that fail with one of the
+// policy's codes. Other errors are returned immediately.
+func UnaryClientInterceptor(p Policy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= p.MaxAttempts || !slices.Contains(p.Codes, status.Code(err)) {
+				return err
+			}
+
+			wait := p.backoff(attempt)
+			if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+				return err
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return status.FromContextError(ctx.Err()).Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
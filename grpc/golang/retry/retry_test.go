@@ -0,0 +1,164 @@
+package retry
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// flakyServer fails the first failures calls with code and succeeds afterwards.
+type flakyServer struct {
+	pb.UnimplementedGreeterServer
+	failures int32
+	code     codes.Code
+	calls    atomic.Int32
+}
+
+func (s *flakyServer) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	n := s.calls.Add(1)
+	if n <= s.failures {
+		return nil, status.Errorf(s.code, "attempt %d failed", n)
+	}
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!", GreetingCount: n}, nil
+}
+
+func newClient(t *testing.T, srv pb.GreeterServer, p Policy) pb.GreeterClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pb.RegisterGreeterServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(p)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewGreeterClient(conn)
+}
+
+func testPolicy() Policy {
+	p := DefaultPolicy()
+	p.InitialBackoff = 50 * time.Millisecond
+	p.Jitter = 0.2
+	return p
+}
+
+func TestRetrySucceedsAfterTransientFailures(t *testing.T) {
+	srv := &flakyServer{failures: 2, code: codes.Unavailable}
+	client := newClient(t, srv, testPolicy())
+
+	start := time.Now()
+	resp, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "retry"})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if got := srv.calls.Load(); got != 3 {
+		t.Errorf("got %d calls, want 3", got)
+	}
+	if resp.GreetingCount != 3 {
+		t.Errorf("got count %d, want 3", resp.GreetingCount)
+	}
+
+	// Backoffs are 50ms and 100ms, each jittered by up to 20%.
+	if min := 120 * time.Millisecond; elapsed < min {
+		t.Errorf("retried after %v, want at least %v of backoff", elapsed, min)
+	}
+	if max := time.Second; elapsed > max {
+		t.Errorf("retried after %v, want at most %v", elapsed, max)
+	}
+}
+
+func TestRetryResourceExhausted(t *testing.T) {
+	srv := &flakyServer{failures: 1, code: codes.ResourceExhausted}
+	client := newClient(t, srv, testPolicy())
+
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "retry"}); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if got := srv.calls.Load(); got != 2 {
+		t.Errorf("got %d calls, want 2", got)
+	}
+}
+
+func TestRetryNonRetryableFailsImmediately(t *testing.T) {
+	srv := &flakyServer{failures: 5, code: codes.InvalidArgument}
+	client := newClient(t, srv, testPolicy())
+
+	_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "retry"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument", err)
+	}
+	if got := srv.calls.Load(); got != 1 {
+		t.Errorf("got %d calls, want 1", got)
+	}
+}
+
+func TestRetryStopsAtMaxAttempts(t *testing.T) {
+	srv := &flakyServer{failures: 10, code: codes.Unavailable}
+	p := testPolicy()
+	p.MaxAttempts = 3
+	client := newClient(t, srv, p)
+
+	_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "retry"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("got %v, want Unavailable", err)
+	}
+	if got := srv.calls.Load(); got != 3 {
+		t.Errorf("got %d calls, want 3", got)
+	}
+}
+
+func TestRetryStopsAtMaxElapsed(t *testing.T) {
+	srv := &flakyServer{failures: 10, code: codes.Unavailable}
+	p := testPolicy()
+	p.MaxAttempts = 10
+	p.MaxElapsed = 100 * time.Millisecond
+	client := newClient(t, srv, p)
+
+	_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "retry"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("got %v, want Unavailable", err)
+	}
+	// 50ms fits within the budget, but the following 100ms wait does not.
+	if got := srv.calls.Load(); got != 2 {
+		t.Errorf("got %d calls, want 2", got)
+	}
+}
+
+func TestRetryRespectsCancellation(t *testing.T) {
+	srv := &flakyServer{failures: 10, code: codes.Unavailable}
+	p := testPolicy()
+	p.InitialBackoff = time.Minute
+	client := newClient(t, srv, p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "retry"})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %v despite the context expiring", elapsed)
+	}
+	if got := srv.calls.Load(); got != 1 {
+		t.Errorf("got %d calls, want 1", got)
+	}
+}
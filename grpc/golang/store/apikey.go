@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrAPIKeyNotFound is returned for an API key ID that was never issued.
+var ErrAPIKeyNotFound = errors.New("store: API key not found")
+
+// APIKey is an issued API key. Only a salted hash of the key's secret is
+// kept, so it cannot be recovered from the store.
+type APIKey struct {
+	ID       string
+	Identity string
+	Salt     []byte
+	Hash     []byte
+	Created  time.Time
+	// Revoked is when the key was revoked, or the zero Time while it is
+	// valid.
+	Revoked time.Time
+}
+
+// APIKeyStore keeps issued API keys. Implementations must be safe for
+// concurrent use.
+type APIKeyStore interface {
+	// CreateAPIKey stores k, whose ID must be new.
+	CreateAPIKey(ctx context.Context, k APIKey) error
+	// APIKey returns the key with id, or ErrAPIKeyNotFound.
+	APIKey(ctx context.Context, id string) (APIKey, error)
+	// APIKeys returns every key, revoked ones included, oldest first.
+	APIKeys(ctx context.Context) ([]APIKey, error)
+	// RevokeAPIKey marks the key with id revoked at at, unless it already
+	// is, and returns it. It returns ErrAPIKeyNotFound for an unknown id.
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) (APIKey, error)
+}
+
+// MemoryAPIKeys is an APIKeyStore held in memory, so keys are lost on
+// restart and not shared between servers.
+type MemoryAPIKeys struct {
+	mu   sync.Mutex
+	keys map[string]APIKey
+}
+
+// NewMemoryAPIKeys returns an empty MemoryAPIKeys.
+func NewMemoryAPIKeys() *MemoryAPIKeys {
+	return &MemoryAPIKeys{keys: make(map[string]APIKey)}
+}
+
+// CreateAPIKey implements APIKeyStore.
+func (m *MemoryAPIKeys) CreateAPIKey(ctx context.Context, k APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[k.ID]; ok {
+		return errors.New("store: API key ID already in use")
+	}
+	m.keys[k.ID] = k
+	return nil
+}
+
+// APIKey implements APIKeyStore.
+func (m *MemoryAPIKeys) APIKey(ctx context.Context, id string) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return k, nil
+}
+
+// APIKeys implements APIKeyStore.
+func (m *MemoryAPIKeys) APIKeys(ctx context.Context) ([]APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]APIKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].Created.Equal(keys[j].Created) {
+			return keys[i].Created.Before(keys[j].Created)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey implements APIKeyStore.
+func (m *MemoryAPIKeys) RevokeAPIKey(ctx context.Context, id string, at time.Time) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if k.Revoked.IsZero() {
+		k.Revoked = at
+		m.keys[id] = k
+	}
+	return k, nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testAPIKeyStore exercises behavior every APIKeyStore must share.
+func testAPIKeyStore(t *testing.T, s APIKeyStore) {
+	t.Helper()
+	ctx := context.Background()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	alice := APIKey{ID: "k1", Identity: "alice", Salt: []byte("salt-1"), Hash: []byte("hash-1"), Created: created}
+	bob := APIKey{ID: "k2", Identity: "bob", Salt: []byte("salt-2"), Hash: []byte("hash-2"), Created: created.Add(time.Minute)}
+	for _, k := range []APIKey{bob, alice} {
+		if err := s.CreateAPIKey(ctx, k); err != nil {
+			t.Fatalf("CreateAPIKey(%s): %v", k.ID, err)
+		}
+	}
+	if err := s.CreateAPIKey(ctx, APIKey{ID: "k1", Identity: "mallory", Created: created}); err == nil {
+		t.Error("CreateAPIKey with an ID in use succeeded")
+	}
+
+	got, err := s.APIKey(ctx, "k1")
+	if err != nil || got.Identity != "alice" || !bytes.Equal(got.Salt, alice.Salt) || !bytes.Equal(got.Hash, alice.Hash) ||
+		!got.Created.Equal(created) || !got.Revoked.IsZero() {
+		t.Errorf("APIKey(k1) = %+v, %v; want alice's valid key", got, err)
+	}
+	if _, err := s.APIKey(ctx, "k9"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("APIKey(k9) got %v, want ErrAPIKeyNotFound", err)
+	}
+
+	revoked := created.Add(time.Hour)
+	if got, err := s.RevokeAPIKey(ctx, "k1", revoked); err != nil || !got.Revoked.Equal(revoked) {
+		t.Errorf("RevokeAPIKey(k1) = %+v, %v; want it revoked at %v", got, err, revoked)
+	}
+	// Revoking again keeps the first time
+	if got, err := s.RevokeAPIKey(ctx, "k1", revoked.Add(time.Hour)); err != nil || !got.Revoked.Equal(revoked) {
+		t.Errorf("second RevokeAPIKey(k1) = %+v, %v; want the first revocation kept", got, err)
+	}
+	if _, err := s.RevokeAPIKey(ctx, "k9", revoked); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey(k9) got %v, want ErrAPIKeyNotFound", err)
+	}
+
+	keys, err := s.APIKeys(ctx)
+	if err != nil || len(keys) != 2 || keys[0].ID != "k1" || keys[1].ID != "k2" {
+		t.Fatalf("APIKeys = %+v, %v; want k1 then k2", keys, err)
+	}
+	if !keys[0].Revoked.Equal(revoked) || !keys[1].Revoked.IsZero() {
+		t.Errorf("APIKeys = %+v, want only k1 revoked", keys)
+	}
+}
+
+func TestMemoryAPIKeys(t *testing.T) {
+	testAPIKeyStore(t, NewMemoryAPIKeys())
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore is a CountStore that keeps counts in memory and periodically
+// persists them to a JSON file. The file maps each name to its count and
+// last greeting time; files holding bare counts per name, as written before
+// greeting times were kept, are still read.
+type FileStore struct {
+	path string
+	// flushMu serializes flushes so an older snapshot never overwrites a newer one.
+	flushMu sync.Mutex
+
+	now    func() time.Time
+	mu     sync.Mutex
+	counts counts
+	dirty  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFileStore loads counts from path, if it exists, and flushes changes back
+// to it every flushInterval. Call Close to stop flushing and write any
+// remaining changes.
+func NewFileStore(path string, flushInterval time.Duration) (*FileStore, error) {
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("store: flush interval must be positive, got %v", flushInterval)
+	}
+	s := &FileStore{
+		path:   path,
+		now:    time.Now,
+		counts: make(counts),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("store: reading %s: %w", path, err)
+	default:
+		if s.counts, err = decodeCounts(data); err != nil {
+			return nil, fmt.Errorf("store: parsing %s: %w", path, err)
+		}
+	}
+	go s.flushLoop(flushInterval)
+	return s, nil
+}
+
+// Increment implements CountStore.
+func (s *FileStore) Increment(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty = true
+	return s.counts.increment(name, s.now()), nil
+}
+
+// Get implements CountStore.
+func (s *FileStore) Get(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[name].N, nil
+}
+
+// Stat implements CountStore.
+func (s *FileStore) Stat(ctx context.Context, name string) (Count, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[name], nil
+}
+
+// Total implements CountStore.
+func (s *FileStore) Total(ctx context.Context) (Count, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts.total(), nil
+}
+
+// fileCount is how a Count is stored in the file.
+type fileCount struct {
+	Count       int64      `json:"count"`
+	LastGreeted *time.Time `json:"last_greeted,omitempty"`
+}
+
+func encodeCounts(c counts) ([]byte, error) {
+	out := make(map[string]fileCount, len(c))
+	for name, count := range c {
+		fc := fileCount{Count: count.N}
+		if !count.LastGreeted.IsZero() {
+			fc.LastGreeted = &count.LastGreeted
+		}
+		out[name] = fc
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// decodeCounts parses a counts file, where each name maps to a fileCount or,
+// in older files, to a bare count.
+func decodeCounts(data []byte) (counts, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	c := make(counts, len(raw))
+	for name, value := range raw {
+		var n int64
+		if err := json.Unmarshal(value, &n); err == nil {
+			c[name] = Count{N: n}
+			continue
+		}
+		var fc fileCount
+		if err := json.Unmarshal(value, &fc); err != nil {
+			return nil, fmt.Errorf("count for %q: %w", name, err)
+		}
+		count := Count{N: fc.Count}
+		if fc.LastGreeted != nil {
+			count.LastGreeted = *fc.LastGreeted
+		}
+		c[name] = count
+	}
+	return c, nil
+}
+
+// Flush writes the counts to disk if they changed since the last flush.
+func (s *FileStore) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := encodeCounts(s.counts)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return s.flushFailed(err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return s.flushFailed(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return s.flushFailed(err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return s.flushFailed(err)
+	}
+	return nil
+}
+
+// flushFailed marks the counts dirty again so the next flush retries.
+func (s *FileStore) flushFailed(err error) error {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+	return fmt.Errorf("store: writing %s: %w", s.path, err)
+}
+
+// Close stops the periodic flush and writes any remaining changes.
+func (s *FileStore) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.Flush()
+}
+
+func (s *FileStore) flushLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Printf("Failed to flush greeting counts: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Greeting is one greeting recorded in a HistoryStore.
+type Greeting struct {
+	// Seq orders greetings; it increases with every greeting recorded.
+	Seq     int64
+	Name    string
+	Message string
+	Time    time.Time
+	// Variant is the experiment variant that worded Message, if any.
+	Variant string
+}
+
+// HistoryStore keeps the greetings the server has produced, oldest first.
+// Implementations must be safe for concurrent use.
+type HistoryStore interface {
+	// Record appends a greeting and returns it with its Seq set.
+	Record(ctx context.Context, g Greeting) (Greeting, error)
+	// List returns up to limit greetings with a Seq greater than after,
+	// oldest first, and whether more follow them.
+	List(ctx context.Context, after int64, limit int) ([]Greeting, bool, error)
+}
+
+// MemoryHistory is a HistoryStore held in memory that keeps only the most
+// recent greetings.
+type MemoryHistory struct {
+	max int
+
+	mu        sync.Mutex
+	greetings []Greeting
+	seq       int64
+}
+
+// NewMemoryHistory returns an empty MemoryHistory that keeps the last max
+// greetings. A max of zero or less keeps them all.
+func NewMemoryHistory(max int) *MemoryHistory {
+	return &MemoryHistory{max: max}
+}
+
+// Record implements HistoryStore.
+func (h *MemoryHistory) Record(ctx context.Context, g Greeting) (Greeting, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	g.Seq = h.seq
+	h.greetings = append(h.greetings, g)
+	if h.max > 0 && len(h.greetings) > h.max {
+		// Copy rather than reslice so the dropped greetings can be collected
+		h.greetings = append([]Greeting(nil), h.greetings[len(h.greetings)-h.max:]...)
+	}
+	return g, nil
+}
+
+// List implements HistoryStore.
+func (h *MemoryHistory) List(ctx context.Context, after int64, limit int) ([]Greeting, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := sort.Search(len(h.greetings), func(i int) bool { return h.greetings[i].Seq > after })
+	end := len(h.greetings)
+	if limit > 0 {
+		end = min(end, i+limit)
+	}
+	return append([]Greeting(nil), h.greetings[i:end]...), end < len(h.greetings), nil
+}
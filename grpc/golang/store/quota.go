@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// QuotaStore counts the calls each key makes per quota window.
+// Implementations must be safe for concurrent use.
+type QuotaStore interface {
+	// Take counts one use for key unless limit uses are already counted in
+	// its window. The window is key's current one if it ends after start,
+	// else a new one from start to end. Take returns the usage after the
+	// attempt and whether the use was counted.
+	Take(ctx context.Context, key string, start, end time.Time, limit int64) (QuotaUsage, bool, error)
+}
+
+// QuotaUsage is how many uses a key has counted in its window and when
+// that window ends.
+type QuotaUsage struct {
+	Used  int64
+	Reset time.Time
+}
+
+// take applies QuotaStore.Take's rule to u, returning the new usage and
+// whether the use was counted.
+func (u QuotaUsage) take(start, end time.Time, limit int64) (QuotaUsage, bool) {
+	if !u.Reset.After(start) {
+		u = QuotaUsage{Reset: end}
+	}
+	if u.Used >= limit {
+		return u, false
+	}
+	u.Used++
+	return u, true
+}
+
+// MemoryQuotas is a QuotaStore held in memory, so usage is lost on restart
+// and not shared between servers.
+type MemoryQuotas struct {
+	mu    sync.Mutex
+	usage map[string]QuotaUsage
+	// swept is when ended windows were last removed from usage.
+	swept time.Time
+}
+
+// NewMemoryQuotas returns an empty MemoryQuotas.
+func NewMemoryQuotas() *MemoryQuotas {
+	return &MemoryQuotas{usage: make(map[string]QuotaUsage)}
+}
+
+// Take implements QuotaStore.
+func (q *MemoryQuotas) Take(ctx context.Context, key string, start, end time.Time, limit int64) (QuotaUsage, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Drop ended windows about once per window length
+	if start.Sub(q.swept) >= end.Sub(start) {
+		for k, u := range q.usage {
+			if !u.Reset.After(start) {
+				delete(q.usage, k)
+			}
+		}
+		q.swept = start
+	}
+	u, ok := q.usage[key].take(start, end, limit)
+	q.usage[key] = u
+	return u, ok, nil
+}
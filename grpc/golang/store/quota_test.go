@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testQuotaStore exercises behavior every QuotaStore must share.
+func testQuotaStore(t *testing.T, q QuotaStore) {
+	t.Helper()
+	ctx := context.Background()
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	next := day.AddDate(0, 0, 1)
+
+	for want := int64(1); want <= 3; want++ {
+		u, ok, err := q.Take(ctx, "alice", day, next, 3)
+		if err != nil || !ok || u.Used != want || !u.Reset.Equal(next) {
+			t.Errorf("Take(alice) %d = %+v, %v, %v; want %d used until %v", want, u, ok, err, want, next)
+		}
+	}
+	if u, ok, err := q.Take(ctx, "alice", day, next, 3); err != nil || ok || u.Used != 3 || !u.Reset.Equal(next) {
+		t.Errorf("Take(alice) over the limit = %+v, %v, %v; want 3 used and refused", u, ok, err)
+	}
+	if u, ok, err := q.Take(ctx, "bob", day, next, 3); err != nil || !ok || u.Used != 1 {
+		t.Errorf("Take(bob) = %+v, %v, %v; want bob's first use counted", u, ok, err)
+	}
+
+	// A window ending after start is kept, one ending at start replaced
+	later := day.Add(time.Hour)
+	if _, ok, _ := q.Take(ctx, "alice", later, later.Add(24*time.Hour), 3); ok {
+		t.Error("Take(alice) in a later window overlapping the current one was counted")
+	}
+	u, ok, err := q.Take(ctx, "alice", next, next.AddDate(0, 0, 1), 3)
+	if err != nil || !ok || u.Used != 1 || !u.Reset.Equal(next.AddDate(0, 0, 1)) {
+		t.Errorf("Take(alice) the next day = %+v, %v, %v; want a new window", u, ok, err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		counted atomic.Int64
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, ok, err := q.Take(ctx, "carol", day, next, 150)
+				if err != nil {
+					t.Errorf("Take(carol): %v", err)
+				}
+				if ok {
+					counted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := counted.Load(); got != 150 {
+		t.Errorf("counted %d of 200 concurrent uses, want the limit of 150", got)
+	}
+	if u, _, _ := q.Take(ctx, "carol", day, next, 150); u.Used != 150 {
+		t.Errorf("carol used %d, want 150", u.Used)
+	}
+}
+
+func TestMemoryQuotas(t *testing.T) {
+	testQuotaStore(t, NewMemoryQuotas())
+}
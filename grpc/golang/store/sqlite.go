@@ -0,0 +1,371 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// busyTimeout bounds how long an SQLiteStore write retries while another
+// connection holds the database lock.
+const busyTimeout = 5 * time.Second
+
+// migrations are the schema changes applied in order by NewSQLiteStore. The
+// database's user_version records how many have been applied; append new
+// ones rather than editing these.
+var migrations = []string{
+	`CREATE TABLE counts (
+		name TEXT PRIMARY KEY,
+		n INTEGER NOT NULL,
+		-- Unix nanoseconds, NULL when not known
+		last_greeted INTEGER
+	);
+	CREATE TABLE greetings (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		message TEXT NOT NULL,
+		greeted_at INTEGER NOT NULL
+	);`,
+	`CREATE TABLE quotas (
+		key TEXT PRIMARY KEY,
+		used INTEGER NOT NULL,
+		-- Unix nanoseconds
+		reset INTEGER NOT NULL
+	);`,
+	`CREATE TABLE api_keys (
+		id TEXT PRIMARY KEY,
+		identity TEXT NOT NULL,
+		salt BLOB NOT NULL,
+		hash BLOB NOT NULL,
+		-- Unix nanoseconds, revoked NULL while the key is valid
+		created INTEGER NOT NULL,
+		revoked INTEGER
+	);`,
+	`ALTER TABLE greetings ADD COLUMN variant TEXT NOT NULL DEFAULT '';`,
+}
+
+// SQLiteStore is a CountStore, HistoryStore, QuotaStore and APIKeyStore
+// kept in a SQLite database, so counts, history, quota usage and API keys
+// survive restarts and can be shared by servers on one host.
+type SQLiteStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewSQLiteStore opens the SQLite database named by dsn, such as
+// "greeter.db" or "file:greeter.db?_pragma=busy_timeout(1000)", and brings
+// its schema up to date. An in-memory database ":memory:" is private to
+// each pooled connection, so use a file. Call Close when done.
+func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("store: opening %s: %w", dsn, err)
+	}
+	s := &SQLiteStore{db: db, now: time.Now}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("store: migrating %s: %w", dsn, err)
+	}
+	return s, nil
+}
+
+// migrate applies the migrations the database has not seen yet.
+func (s *SQLiteStore) migrate(ctx context.Context) error {
+	// WAL lets readers run alongside the writer; the mode is kept in the file
+	if _, err := s.db.ExecContext(ctx, "PRAGMA journal_mode = WAL"); err != nil {
+		return err
+	}
+	return s.write(ctx, func(tx *sql.Tx) error {
+		var version int
+		if err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+			return err
+		}
+		if version > len(migrations) {
+			return fmt.Errorf("schema version %d is newer than this server's %d", version, len(migrations))
+		}
+		for i, m := range migrations[version:] {
+			if _, err := tx.ExecContext(ctx, m); err != nil {
+				return fmt.Errorf("migration %d: %w", version+i+1, err)
+			}
+		}
+		// PRAGMA does not take parameters
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", len(migrations)))
+		return err
+	})
+}
+
+// write runs fn in a transaction and commits it, starting over while the
+// database is locked by another connection, for up to busyTimeout.
+func (s *SQLiteStore) write(ctx context.Context, fn func(*sql.Tx) error) error {
+	deadline := time.Now().Add(busyTimeout)
+	backoff := time.Millisecond
+	for {
+		err := s.tryWrite(ctx, fn)
+		if !isBusy(err) || time.Now().After(deadline) {
+			return err
+		}
+		// Jitter keeps writers that collided from colliding again
+		select {
+		case <-time.After(backoff/2 + rand.N(backoff)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(2*backoff, 50*time.Millisecond)
+	}
+}
+
+func (s *SQLiteStore) tryWrite(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// isBusy reports whether err is SQLite reporting the database locked.
+func isBusy(err error) bool {
+	var serr *sqlite.Error
+	if !errors.As(err, &serr) {
+		return false
+	}
+	// Extended codes such as SQLITE_BUSY_SNAPSHOT keep the primary code in
+	// the low byte
+	code := serr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// Increment implements CountStore.
+func (s *SQLiteStore) Increment(ctx context.Context, name string) (int64, error) {
+	var n int64
+	err := s.write(ctx, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, `INSERT INTO counts (name, n, last_greeted) VALUES (?, 1, ?)
+			ON CONFLICT (name) DO UPDATE SET n = n + 1, last_greeted = excluded.last_greeted
+			RETURNING n`, name, s.now().UnixNano()).Scan(&n)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("store: incrementing %q: %w", name, err)
+	}
+	return n, nil
+}
+
+// Get implements CountStore.
+func (s *SQLiteStore) Get(ctx context.Context, name string) (int64, error) {
+	count, err := s.Stat(ctx, name)
+	return count.N, err
+}
+
+// Stat implements CountStore.
+func (s *SQLiteStore) Stat(ctx context.Context, name string) (Count, error) {
+	var (
+		n    int64
+		last sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx, "SELECT n, last_greeted FROM counts WHERE name = ?", name).Scan(&n, &last)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Count{}, nil
+	case err != nil:
+		return Count{}, fmt.Errorf("store: reading %q: %w", name, err)
+	}
+	return Count{N: n, LastGreeted: fromUnixNano(last)}, nil
+}
+
+// Total implements CountStore.
+func (s *SQLiteStore) Total(ctx context.Context) (Count, error) {
+	var (
+		n    int64
+		last sql.NullInt64
+	)
+	if err := s.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(n), 0), MAX(last_greeted) FROM counts").Scan(&n, &last); err != nil {
+		return Count{}, fmt.Errorf("store: reading total: %w", err)
+	}
+	return Count{N: n, LastGreeted: fromUnixNano(last)}, nil
+}
+
+// Record implements HistoryStore.
+func (s *SQLiteStore) Record(ctx context.Context, g Greeting) (Greeting, error) {
+	err := s.write(ctx, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, "INSERT INTO greetings (name, message, greeted_at, variant) VALUES (?, ?, ?, ?) RETURNING seq",
+			g.Name, g.Message, g.Time.UnixNano(), g.Variant).Scan(&g.Seq)
+	})
+	if err != nil {
+		return Greeting{}, fmt.Errorf("store: recording greeting: %w", err)
+	}
+	return g, nil
+}
+
+// List implements HistoryStore. Pages are read through the seq primary
+// key, so their cost does not grow with the history.
+func (s *SQLiteStore) List(ctx context.Context, after int64, limit int) ([]Greeting, bool, error) {
+	fetch := -1 // no limit
+	if limit > 0 {
+		// One more than asked for shows whether more follow
+		fetch = limit + 1
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT seq, name, message, greeted_at, variant FROM greetings WHERE seq > ? ORDER BY seq LIMIT ?", after, fetch)
+	if err != nil {
+		return nil, false, fmt.Errorf("store: listing greetings: %w", err)
+	}
+	defer rows.Close()
+	var greetings []Greeting
+	for rows.Next() {
+		var (
+			g  Greeting
+			at int64
+		)
+		if err := rows.Scan(&g.Seq, &g.Name, &g.Message, &at, &g.Variant); err != nil {
+			return nil, false, fmt.Errorf("store: listing greetings: %w", err)
+		}
+		g.Time = time.Unix(0, at)
+		greetings = append(greetings, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("store: listing greetings: %w", err)
+	}
+	if limit > 0 && len(greetings) > limit {
+		return greetings[:limit], true, nil
+	}
+	return greetings, false, nil
+}
+
+// Take implements QuotaStore. The usage is read and written in one
+// transaction, so concurrent calls from any connection count correctly.
+func (s *SQLiteStore) Take(ctx context.Context, key string, start, end time.Time, limit int64) (QuotaUsage, bool, error) {
+	var (
+		u  QuotaUsage
+		ok bool
+	)
+	err := s.write(ctx, func(tx *sql.Tx) error {
+		var (
+			used  int64
+			reset sql.NullInt64
+		)
+		err := tx.QueryRowContext(ctx, "SELECT used, reset FROM quotas WHERE key = ?", key).Scan(&used, &reset)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		u, ok = QuotaUsage{Used: used, Reset: fromUnixNano(reset)}.take(start, end, limit)
+		if !ok {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO quotas (key, used, reset) VALUES (?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET used = excluded.used, reset = excluded.reset`, key, u.Used, u.Reset.UnixNano())
+		return err
+	})
+	if err != nil {
+		return QuotaUsage{}, false, fmt.Errorf("store: taking quota for %q: %w", key, err)
+	}
+	return u, ok, nil
+}
+
+// CreateAPIKey implements APIKeyStore.
+func (s *SQLiteStore) CreateAPIKey(ctx context.Context, k APIKey) error {
+	err := s.write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO api_keys (id, identity, salt, hash, created, revoked) VALUES (?, ?, ?, ?, ?, ?)",
+			k.ID, k.Identity, k.Salt, k.Hash, k.Created.UnixNano(), toUnixNano(k.Revoked))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("store: creating API key: %w", err)
+	}
+	return nil
+}
+
+// APIKey implements APIKeyStore.
+func (s *SQLiteStore) APIKey(ctx context.Context, id string) (APIKey, error) {
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx, "SELECT id, identity, salt, hash, created, revoked FROM api_keys WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("store: reading API key: %w", err)
+	}
+	return k, nil
+}
+
+// APIKeys implements APIKeyStore.
+func (s *SQLiteStore) APIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, identity, salt, hash, created, revoked FROM api_keys ORDER BY created, id")
+	if err != nil {
+		return nil, fmt.Errorf("store: listing API keys: %w", err)
+	}
+	defer rows.Close()
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("store: listing API keys: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: listing API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey implements APIKeyStore.
+func (s *SQLiteStore) RevokeAPIKey(ctx context.Context, id string, at time.Time) (APIKey, error) {
+	var k APIKey
+	err := s.write(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE api_keys SET revoked = ? WHERE id = ? AND revoked IS NULL", at.UnixNano(), id); err != nil {
+			return err
+		}
+		var err error
+		k, err = scanAPIKey(tx.QueryRowContext(ctx, "SELECT id, identity, salt, hash, created, revoked FROM api_keys WHERE id = ?", id))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("store: revoking API key: %w", err)
+	}
+	return k, nil
+}
+
+// scanAPIKey reads an api_keys row selected in column order.
+func scanAPIKey(row interface{ Scan(...any) error }) (APIKey, error) {
+	var (
+		k       APIKey
+		created int64
+		revoked sql.NullInt64
+	)
+	if err := row.Scan(&k.ID, &k.Identity, &k.Salt, &k.Hash, &created, &revoked); err != nil {
+		return APIKey{}, err
+	}
+	k.Created = time.Unix(0, created)
+	k.Revoked = fromUnixNano(revoked)
+	return k, nil
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// fromUnixNano converts a stored time, returning the zero Time for NULL.
+func fromUnixNano(v sql.NullInt64) time.Time {
+	if !v.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, v.Int64)
+}
+
+// toUnixNano converts a time to store, returning NULL for the zero Time.
+func toUnixNano(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
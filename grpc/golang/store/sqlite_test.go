@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openSQLite(t *testing.T, path string) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	return s
+}
+
+func TestSQLiteStore(t *testing.T) {
+	s := openSQLite(t, filepath.Join(t.TempDir(), "greeter.db"))
+	defer s.Close()
+	testCountStore(t, s)
+	testHistoryStore(t, s)
+	testQuotaStore(t, s)
+	testAPIKeyStore(t, s)
+}
+
+func TestSQLiteStoreParallelIncrement(t *testing.T) {
+	s := openSQLite(t, filepath.Join(t.TempDir(), "greeter.db"))
+	defer s.Close()
+	ctx := context.Background()
+
+	const goroutines = 100
+	seen := make([]bool, goroutines+1)
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := s.Increment(ctx, "alice")
+			if err != nil {
+				t.Errorf("Increment: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if n < 1 || n > goroutines || seen[n] {
+				t.Errorf("Increment returned %d twice or out of range", n)
+				return
+			}
+			seen[n] = true
+		}()
+	}
+	wg.Wait()
+	if got, err := s.Get(ctx, "alice"); err != nil || got != goroutines {
+		t.Errorf("Get(alice) = %d, %v; want %d", got, err, goroutines)
+	}
+}
+
+func TestSQLiteStorePersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "greeter.db")
+
+	s := openSQLite(t, path)
+	for i := 0; i < 3; i++ {
+		s.Increment(ctx, "alice")
+	}
+	greetedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := s.Record(ctx, Greeting{Name: "alice", Message: "Hello, alice!", Time: greetedAt, Variant: "control"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Reopening finds the schema current and keeps the data
+	s = openSQLite(t, path)
+	defer s.Close()
+	if got, _ := s.Stat(ctx, "alice"); got.N != 3 || got.LastGreeted.IsZero() {
+		t.Errorf("Stat(alice) after restart = %+v, want 3 with a greeting time", got)
+	}
+	if got, _ := s.Increment(ctx, "alice"); got != 4 {
+		t.Errorf("Increment(alice) after restart = %d, want 4", got)
+	}
+	page, _, err := s.List(ctx, 0, 0)
+	if err != nil || len(page) != 1 || page[0].Message != "Hello, alice!" || page[0].Variant != "control" || !page[0].Time.Equal(greetedAt) {
+		t.Fatalf("List after restart = %+v, %v; want the recorded greeting", page, err)
+	}
+	if g, _ := s.Record(ctx, Greeting{Name: "bob"}); g.Seq != page[0].Seq+1 {
+		t.Errorf("Record after restart got seq %d, want %d", g.Seq, page[0].Seq+1)
+	}
+}
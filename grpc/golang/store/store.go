@@ -0,0 +1,92 @@
+// Package store provides storage for per-name greeting counts and for the
+// history of greetings.
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CountStore tracks how many times each name has been greeted.
+// Implementations must be safe for concurrent use.
+type CountStore interface {
+	// Increment adds one greeting for name and returns the new count.
+	Increment(ctx context.Context, name string) (int64, error)
+	// Get returns the current count for name, or zero if it was never greeted.
+	Get(ctx context.Context, name string) (int64, error)
+	// Stat returns the count for name and when it was last greeted, or the
+	// zero Count if it was never greeted.
+	Stat(ctx context.Context, name string) (Count, error)
+	// Total returns the count over all names and the latest greeting.
+	Total(ctx context.Context) (Count, error)
+}
+
+// Count is how many times a name was greeted and when it last was.
+// LastGreeted is zero for counts kept before it was recorded.
+type Count struct {
+	N           int64
+	LastGreeted time.Time
+}
+
+// counts holds the Count of each name for MemoryStore and FileStore, which
+// guard it with their own lock.
+type counts map[string]Count
+
+func (c counts) increment(name string, now time.Time) int64 {
+	n := c[name].N + 1
+	c[name] = Count{N: n, LastGreeted: now}
+	return n
+}
+
+func (c counts) total() Count {
+	var total Count
+	for _, count := range c {
+		total.N += count.N
+		if count.LastGreeted.After(total.LastGreeted) {
+			total.LastGreeted = count.LastGreeted
+		}
+	}
+	return total
+}
+
+// MemoryStore is a CountStore held in memory.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	counts counts
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now, counts: make(counts)}
+}
+
+// Increment implements CountStore.
+func (s *MemoryStore) Increment(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts.increment(name, s.now()), nil
+}
+
+// Get implements CountStore.
+func (s *MemoryStore) Get(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[name].N, nil
+}
+
+// Stat implements CountStore.
+func (s *MemoryStore) Stat(ctx context.Context, name string) (Count, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[name], nil
+}
+
+// Total implements CountStore.
+func (s *MemoryStore) Total(ctx context.Context) (Count, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts.total(), nil
+}
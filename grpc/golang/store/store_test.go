@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCountStore exercises behavior every CountStore must share.
+func testCountStore(t *testing.T, s CountStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if got, err := s.Get(ctx, "nobody"); err != nil || got != 0 {
+		t.Errorf("Get(nobody) = %d, %v; want 0, nil", got, err)
+	}
+	for want := int64(1); want <= 3; want++ {
+		got, err := s.Increment(ctx, "alice")
+		if err != nil || got != want {
+			t.Errorf("Increment(alice) = %d, %v; want %d, nil", got, err, want)
+		}
+	}
+	if _, err := s.Increment(ctx, "bob"); err != nil {
+		t.Fatalf("Increment(bob): %v", err)
+	}
+	if got, err := s.Get(ctx, "alice"); err != nil || got != 3 {
+		t.Errorf("Get(alice) = %d, %v; want 3, nil", got, err)
+	}
+	if got, err := s.Get(ctx, "bob"); err != nil || got != 1 {
+		t.Errorf("Get(bob) = %d, %v; want 1, nil", got, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := s.Increment(ctx, "carol"); err != nil {
+					t.Errorf("Increment(carol): %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, err := s.Get(ctx, "carol"); err != nil || got != 1000 {
+		t.Errorf("Get(carol) = %d, %v; want 1000, nil", got, err)
+	}
+
+	if got, err := s.Stat(ctx, "nobody"); err != nil || got != (Count{}) {
+		t.Errorf("Stat(nobody) = %+v, %v; want the zero Count", got, err)
+	}
+	alice, err := s.Stat(ctx, "alice")
+	if err != nil || alice.N != 3 || alice.LastGreeted.IsZero() {
+		t.Errorf("Stat(alice) = %+v, %v; want 3 with a greeting time", alice, err)
+	}
+	carol, _ := s.Stat(ctx, "carol")
+	total, err := s.Total(ctx)
+	if err != nil || total.N != 1004 || !total.LastGreeted.Equal(carol.LastGreeted) {
+		t.Errorf("Total = %+v, %v; want 1004 last greeted with carol at %v", total, err, carol.LastGreeted)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testCountStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "counts.json"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	defer s.Close()
+	testCountStore(t, s)
+}
+
+func TestFileStorePersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "counts.json")
+
+	s, err := NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		s.Increment(ctx, "alice")
+	}
+	s.Increment(ctx, "bob")
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer s.Close()
+	if got, _ := s.Get(ctx, "alice"); got != 3 {
+		t.Errorf("Get(alice) after restart = %d, want 3", got)
+	}
+	if got, _ := s.Increment(ctx, "bob"); got != 2 {
+		t.Errorf("Increment(bob) after restart = %d, want 2", got)
+	}
+	if got, _ := s.Stat(ctx, "alice"); got.LastGreeted.IsZero() {
+		t.Error("Stat(alice) after restart lost the greeting time")
+	}
+}
+
+func TestFileStoreBareCounts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "counts.json")
+	if err := os.WriteFile(path, []byte(`{"alice": 3, "bob": {"count": 2, "last_greeted": "2024-05-01T12:00:00Z"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	defer s.Close()
+	if got, _ := s.Stat(ctx, "alice"); got != (Count{N: 3}) {
+		t.Errorf("Stat(alice) = %+v, want 3 with no greeting time", got)
+	}
+	want := Count{N: 2, LastGreeted: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	if got, _ := s.Stat(ctx, "bob"); got.N != want.N || !got.LastGreeted.Equal(want.LastGreeted) {
+		t.Errorf("Stat(bob) = %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStoreFlushesOnInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counts.json")
+	s, err := NewFileStore(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	defer s.Close()
+	s.Increment(context.Background(), "alice")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("counts were not flushed within the interval")
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counts.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path, time.Hour); err == nil {
+		t.Fatal("expected an error for a corrupt counts file")
+	}
+}
+
+// testHistoryStore exercises behavior every HistoryStore must share. h
+// must be empty.
+func testHistoryStore(t *testing.T, h HistoryStore) {
+	t.Helper()
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := h.Record(ctx, Greeting{Name: name}); err != nil {
+			t.Fatalf("Record(%s): %v", name, err)
+		}
+	}
+
+	page, more, err := h.List(ctx, 0, 2)
+	if err != nil || len(page) != 2 || !more || page[0].Name != "alice" || page[1].Seq != 2 {
+		t.Fatalf("first page = %+v, %v, %v; want alice and bob with more", page, more, err)
+	}
+	page, more, err = h.List(ctx, page[1].Seq, 2)
+	if err != nil || len(page) != 1 || more || page[0].Name != "carol" {
+		t.Fatalf("second page = %+v, %v, %v; want carol and no more", page, more, err)
+	}
+	if page, more, _ := h.List(ctx, 3, 2); len(page) != 0 || more {
+		t.Errorf("List past the end = %+v, %v; want nothing", page, more)
+	}
+	if page, more, _ := h.List(ctx, 0, 0); len(page) != 3 || more {
+		t.Errorf("List with no limit = %+v, %v; want all three", page, more)
+	}
+}
+
+func TestMemoryHistory(t *testing.T) {
+	testHistoryStore(t, NewMemoryHistory(0))
+}
+
+func TestMemoryHistoryMax(t *testing.T) {
+	ctx := context.Background()
+	h := NewMemoryHistory(2)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		h.Record(ctx, Greeting{Name: name})
+	}
+	page, _, _ := h.List(ctx, 0, 0)
+	if len(page) != 2 || page[0].Name != "bob" || page[0].Seq != 2 {
+		t.Errorf("List = %+v, want bob and carol", page)
+	}
+}
@@ -0,0 +1,111 @@
+package testutil_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/shrivatsas/exp-codegen/grpc/greeter"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"github.com/shrivatsas/exp-codegen/grpc/store"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSayHello(t *testing.T) {
+	client, cleanup := testutil.StartTestServer(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i, wantMessage := range []string{"Hello, World!", "Hello again, World! That makes 2 greetings."} {
+		resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+		if err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+		if want := int32(i + 1); resp.Message != wantMessage || resp.GreetingCount != want {
+			t.Errorf("got %q (Count: %d), want %q (Count: %d)", resp.Message, resp.GreetingCount, wantMessage, want)
+		}
+	}
+}
+
+func TestSayHelloEmptyName(t *testing.T) {
+	client, cleanup := testutil.StartTestServer(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, want InvalidArgument", err)
+	}
+}
+
+func TestSayHelloStream(t *testing.T) {
+	client, cleanup := testutil.StartTestServer(t,
+		testutil.WithGreeterOptions(greeter.WithStreamInterval(time.Millisecond)))
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	var got []string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv after %d messages: %v", len(got), err)
+		}
+		if resp.GreetingCount != int32(len(got)+1) {
+			t.Errorf("message %d has count %d", len(got)+1, resp.GreetingCount)
+		}
+		got = append(got, resp.Message)
+	}
+	if len(got) != 5 {
+		t.Fatalf("got %d messages, want 5", len(got))
+	}
+	for i, msg := range got {
+		if want := fmt.Sprintf("Hello %d, World!", i+1); msg != want {
+			t.Errorf("message %d is %q, want %q", i+1, msg, want)
+		}
+	}
+}
+
+func TestSayHelloStreamCancel(t *testing.T) {
+	counts := store.NewMemoryStore()
+	client, cleanup := testutil.StartTestServer(t, testutil.WithGreeterOptions(
+		greeter.WithCountStore(counts),
+		greeter.WithStreamInterval(200*time.Millisecond)))
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	streamCtx, streamCancel := context.WithCancel(ctx)
+	stream, err := client.SayHelloStream(streamCtx, &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+	}
+	streamCancel()
+
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("Recv after cancel: got %v, want Canceled", err)
+	}
+
+	// The handler stops instead of greeting the remaining three times
+	time.Sleep(600 * time.Millisecond)
+	if n, err := counts.Get(ctx, "World"); err != nil || n != 2 {
+		t.Errorf("Get(World) = %d, %v; want 2", n, err)
+	}
+}
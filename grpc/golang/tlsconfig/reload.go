@@ -0,0 +1,129 @@
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertReloader serves a key pair loaded from PEM files and reloads it when
+// the files change, so certificates can be rotated without a restart. Each
+// new connection gets the latest pair; open connections keep theirs. A pair
+// that fails to load is logged and the previous one kept.
+type CertReloader struct {
+	certFile, keyFile string
+	logger            *slog.Logger
+
+	cert atomic.Pointer[tls.Certificate]
+
+	mu sync.Mutex
+	// seen is the state of the files when they were last loaded, or last
+	// failed to load.
+	seen [2]fileStamp
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// fileStamp identifies a version of a file by its contents, which unlike
+// modification times cannot miss two writes in quick succession.
+type fileStamp [sha256.Size]byte
+
+// NewCertReloader loads the key pair in certFile and keyFile and, if
+// interval is positive, polls the files for changes that often. Reload
+// failures are logged to logger, or slog.Default when it is nil. Call Close
+// to stop watching.
+func NewCertReloader(certFile, keyFile string, interval time.Duration, logger *slog.Logger) (*CertReloader, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go r.watch(interval)
+	} else {
+		close(r.done)
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current key pair; it is meant for
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Reload loads the key pair from the files now. On failure the previous pair
+// stays in use.
+func (r *CertReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen = r.stamps()
+	cert, err := loadKeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert.Store(&cert)
+	return nil
+}
+
+// Close stops watching the files.
+func (r *CertReloader) Close() {
+	r.closeOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+func (r *CertReloader) watch(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.reloadIfChanged()
+		}
+	}
+}
+
+// reloadIfChanged reloads the key pair if either file changed since it was
+// last loaded.
+func (r *CertReloader) reloadIfChanged() {
+	r.mu.Lock()
+	changed := r.stamps() != r.seen
+	r.mu.Unlock()
+	if !changed {
+		return
+	}
+	if err := r.Reload(); err != nil {
+		r.logger.Error("Failed to reload TLS certificate, keeping the previous one", "cert", r.certFile, "key", r.keyFile, "error", err)
+		return
+	}
+	r.logger.Info("Reloaded TLS certificate", "cert", r.certFile)
+}
+
+// stamps returns the current state of the certificate and key files. A file
+// that cannot be read has the zero stamp; Reload reports why.
+func (r *CertReloader) stamps() [2]fileStamp {
+	var s [2]fileStamp
+	for i, file := range []string{r.certFile, r.keyFile} {
+		if data, err := os.ReadFile(file); err == nil {
+			s[i] = sha256.Sum256(data)
+		}
+	}
+	return s
+}
@@ -0,0 +1,173 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// serverSerial calls SayHello on conn and returns the serial number of the
+// certificate the server presented on the connection.
+func serverSerial(t *testing.T, conn *grpc.ClientConn) *big.Int {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var p peer.Peer
+	if _, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "TLS"}, grpc.Peer(&p)); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		t.Fatalf("no server certificate in %v", p.AuthInfo)
+	}
+	return info.State.PeerCertificates[0].SerialNumber
+}
+
+func dialTLS(t *testing.T, addr, caFile string) *grpc.ClientConn {
+	t.Helper()
+	creds, err := Client(ClientOptions{CACertFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func fileSerial(t *testing.T, certFile string) *big.Int {
+	t.Helper()
+	cert, err := loadKeyPair(certFile, strings.TrimSuffix(certFile, ".pem")+"-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir, "ca")
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	first := fileSerial(t, certFile)
+
+	reloader, err := NewCertReloader(certFile, keyFile, 20*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+	defer reloader.Close()
+	creds, err := Server(ServerOptions{Reloader: reloader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(creds))
+	pb.RegisterGreeterServer(s, greeter{})
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.Serve(lis) }()
+	defer s.Stop()
+	addr := lis.Addr().String()
+
+	existing := dialTLS(t, addr, ca.file)
+	if got := serverSerial(t, existing); got.Cmp(first) != 0 {
+		t.Fatalf("server presented serial %v, want %v", got, first)
+	}
+
+	// Rotate the key pair in place
+	ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	second := fileSerial(t, certFile)
+	if second.Cmp(first) == 0 {
+		t.Fatal("the rotated certificate has the same serial")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got := serverSerial(t, dialTLS(t, addr, ca.file)); got.Cmp(second) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("new connections never saw the rotated certificate")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// The connection made before the rotation keeps its session
+	if got := serverSerial(t, existing); got.Cmp(first) != 0 {
+		t.Errorf("existing connection now reports serial %v, want %v", got, first)
+	}
+	select {
+	case err := <-serveErr:
+		t.Fatalf("server stopped during the rotation: %v", err)
+	default:
+	}
+}
+
+func TestCertReloaderKeepsPreviousOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir, "ca")
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	first := fileSerial(t, certFile)
+	var logs bytes.Buffer
+	reloader, err := NewCertReloader(certFile, keyFile, 0, slog.New(slog.NewTextHandler(&logs, nil)))
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+	defer reloader.Close()
+
+	// A certificate paired with another pair's key, then unparsable PEM
+	other := t.TempDir()
+	_, otherKey := ca.issue(t, other, "server", x509.ExtKeyUsageServerAuth)
+	otherKeyPEM, err := os.ReadFile(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, write := range map[string]func(){
+		"mismatched key": func() { os.WriteFile(keyFile, otherKeyPEM, 0o600) },
+		"garbage":        func() { os.WriteFile(certFile, []byte("not a certificate"), 0o600) },
+	} {
+		logs.Reset()
+		write()
+		reloader.reloadIfChanged()
+		if !strings.Contains(logs.String(), "Failed to reload TLS certificate") {
+			t.Errorf("%s: logs %q do not report the failure", name, logs.String())
+		}
+		cert, _ := reloader.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil || leaf.SerialNumber.Cmp(first) != 0 {
+			t.Errorf("%s: serving serial %v, want the previous %v", name, leaf.SerialNumber, first)
+		}
+	}
+
+	// Files that have not changed again are not retried
+	logs.Reset()
+	reloader.reloadIfChanged()
+	if logs.Len() != 0 {
+		t.Errorf("unchanged files were reloaded: %q", logs.String())
+	}
+}
+
+func TestNewCertReloaderError(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewCertReloader(dir+"/missing.pem", dir+"/missing-key.pem", time.Second, nil); err == nil {
+		t.Fatal("expected an error for missing files")
+	}
+}
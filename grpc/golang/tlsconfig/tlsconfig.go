@@ -0,0 +1,132 @@
+// Package tlsconfig builds gRPC transport credentials from PEM files so the
+// Greeter client and server share one implementation.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ClientOptions describes the PEM files used by a client.
+type ClientOptions struct {
+	// CACertFile verifies the server certificate. The system roots are used when empty.
+	CACertFile string
+	// CertFile and KeyFile hold the client certificate presented for mTLS.
+	// Both must be set or both left empty.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string
+}
+
+// ServerOptions describes the PEM files used by a server.
+type ServerOptions struct {
+	CertFile string
+	KeyFile  string
+	// Reloader, when set, supplies the server certificate in place of
+	// CertFile and KeyFile, picking up rotated key pairs without a restart.
+	Reloader *CertReloader
+	// ClientCAFile, when set, makes the server require client certificates
+	// signed by one of the CAs in the file.
+	ClientCAFile string
+}
+
+// NewClientConfig returns a tls.Config for dialing a server.
+func NewClientConfig(opts ClientOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: opts.ServerName,
+	}
+	if opts.CACertFile != "" {
+		pool, err := loadCertPool(opts.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := loadKeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// NewServerConfig returns a tls.Config for serving with the configured key pair.
+func NewServerConfig(opts ServerOptions) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.Reloader != nil {
+		cfg.GetCertificate = opts.Reloader.GetCertificate
+	} else {
+		cert, err := loadKeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if opts.ClientCAFile != "" {
+		pool, err := loadCertPool(opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// Client returns transport credentials for dialing a server.
+func Client(opts ClientOptions) (credentials.TransportCredentials, error) {
+	cfg, err := NewClientConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// Server returns transport credentials for serving.
+func Server(opts ServerOptions) (credentials.TransportCredentials, error) {
+	cfg, err := NewServerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+func loadKeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return tls.Certificate{}, errors.New("tlsconfig: certificate and key files must be set together")
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("tlsconfig: reading certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("tlsconfig: reading key: %w", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("tlsconfig: parsing key pair %s/%s: %w", certFile, keyFile, err)
+	}
+	return cert, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("tlsconfig: reading CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("tlsconfig: no PEM certificates found in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,222 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	"google.golang.org/grpc"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+// newCA writes a self-signed CA certificate into dir.
+func newCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, name+".pem")
+	writePEM(t, file, "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue writes a leaf certificate and key signed by ca and returns their paths.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!", GreetingCount: 1}, nil
+}
+
+// startServer serves the Greeter over TLS on a loopback listener.
+func startServer(t *testing.T, opts ServerOptions) string {
+	t.Helper()
+	creds, err := Server(opts)
+	if err != nil {
+		t.Fatalf("Server: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(creds))
+	pb.RegisterGreeterServer(s, greeter{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func sayHello(t *testing.T, addr string, opts ClientOptions) error {
+	t.Helper()
+	creds, err := Client(opts)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "TLS"})
+	if err != nil {
+		return err
+	}
+	if resp.Message != "Hello, TLS!" {
+		t.Errorf("got message %q", resp.Message)
+	}
+	return nil
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir, "ca")
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	addr := startServer(t, ServerOptions{CertFile: serverCert, KeyFile: serverKey})
+	if err := sayHello(t, addr, ClientOptions{CACertFile: ca.file}); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir, "ca")
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "client", x509.ExtKeyUsageClientAuth)
+
+	addr := startServer(t, ServerOptions{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: ca.file})
+	err := sayHello(t, addr, ClientOptions{CACertFile: ca.file, CertFile: clientCert, KeyFile: clientKey})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+}
+
+func TestMutualTLSRejectsUntrustedClient(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir, "ca")
+	rogue := newCA(t, dir, "rogue-ca")
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := rogue.issue(t, dir, "client", x509.ExtKeyUsageClientAuth)
+
+	addr := startServer(t, ServerOptions{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: ca.file})
+	if err := sayHello(t, addr, ClientOptions{CACertFile: ca.file, CertFile: clientCert, KeyFile: clientKey}); err == nil {
+		t.Fatal("expected the server to reject a client certificate from an untrusted CA")
+	}
+	if err := sayHello(t, addr, ClientOptions{CACertFile: ca.file}); err == nil {
+		t.Fatal("expected the server to reject a client without a certificate")
+	}
+}
+
+func TestOptionErrors(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ca := newCA(t, dir, "ca")
+	cert, key := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name string
+		err  func() error
+		want string
+	}{
+		{"missing CA", func() error { _, err := Client(ClientOptions{CACertFile: missing}); return err }, "reading CA certificate"},
+		{"unparsable CA", func() error { _, err := Client(ClientOptions{CACertFile: garbage}); return err }, "no PEM certificates found"},
+		{"cert without key", func() error { _, err := Client(ClientOptions{CertFile: cert}); return err }, "must be set together"},
+		{"missing cert", func() error { _, err := Server(ServerOptions{CertFile: missing, KeyFile: key}); return err }, "reading certificate"},
+		{"missing key", func() error { _, err := Server(ServerOptions{CertFile: cert, KeyFile: missing}); return err }, "reading key"},
+		{"unparsable key", func() error { _, err := Server(ServerOptions{CertFile: cert, KeyFile: garbage}); return err }, "parsing key pair"},
+		{"unparsable client CA", func() error {
+			_, err := Server(ServerOptions{CertFile: cert, KeyFile: key, ClientCAFile: garbage})
+			return err
+		}, "no PEM certificates found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
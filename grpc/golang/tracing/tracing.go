@@ -0,0 +1,174 @@
+// Package tracing wires OpenTelemetry tracing into gRPC clients and servers.
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+)
+
+// Attribute keys recorded on server spans for streaming RPCs.
+const (
+	MessagesSentKey     = attribute.Key("rpc.stream.messages_sent")
+	MessagesReceivedKey = attribute.Key("rpc.stream.messages_received")
+)
+
+// Options configures the tracer created by InitTracer.
+type Options struct {
+	// Enabled turns on export; a no-op tracer is used otherwise.
+	Enabled bool
+	// Endpoint is the OTLP gRPC collector address, e.g. "localhost:4317".
+	Endpoint string
+	// Insecure disables TLS to the collector.
+	Insecure bool
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+	// SampleRatio is the fraction of new traces that are sampled.
+	SampleRatio float64
+}
+
+// OptionsFromEnv reads Options from the standard OTEL_* variables using
+// getenv. Tracing is enabled when OTEL_EXPORTER_OTLP_ENDPOINT is set and
+// OTEL_SDK_DISABLED is not "true". The endpoint is usually a URL, such as
+// http://collector:4317, whose scheme decides Insecure as the OTel spec
+// has it; OTEL_EXPORTER_OTLP_INSECURE only applies to a bare host:port.
+func OptionsFromEnv(getenv func(string) string, serviceName string) Options {
+	opts := Options{
+		Endpoint:    getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName: serviceName,
+		SampleRatio: 1,
+	}
+	opts.Enabled = opts.Endpoint != "" && getenv("OTEL_SDK_DISABLED") != "true"
+	if name := getenv("OTEL_SERVICE_NAME"); name != "" {
+		opts.ServiceName = name
+	}
+	if u, err := url.Parse(opts.Endpoint); err == nil && strings.Contains(opts.Endpoint, "://") && u.Host != "" {
+		opts.Endpoint, opts.Insecure = u.Host, u.Scheme == "http"
+	} else if insecure, err := strconv.ParseBool(getenv("OTEL_EXPORTER_OTLP_INSECURE")); err == nil {
+		opts.Insecure = insecure
+	}
+	if ratio, err := strconv.ParseFloat(getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil {
+		opts.SampleRatio = ratio
+	}
+	return opts
+}
+
+// Tracer holds the provider and propagator used to instrument gRPC.
+type Tracer struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	shutdown   func(context.Context) error
+}
+
+// New returns a Tracer that records spans with provider and propagates
+// W3C trace context through gRPC metadata.
+func New(provider trace.TracerProvider) *Tracer {
+	return &Tracer{
+		provider:   provider,
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		shutdown:   func(context.Context) error { return nil },
+	}
+}
+
+// InitTracer returns a Tracer exporting to an OTLP collector, or a no-op
+// Tracer when opts.Enabled is false. Call Shutdown to flush pending spans.
+func InitTracer(ctx context.Context, opts Options) (*Tracer, error) {
+	if !opts.Enabled {
+		return New(noop.NewTracerProvider()), nil
+	}
+
+	exporterOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+
+	t := New(provider)
+	t.shutdown = provider.Shutdown
+	return t, nil
+}
+
+// Shutdown flushes and stops the exporter, if any.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
+
+func (t *Tracer) otelOptions() []otelgrpc.Option {
+	return []otelgrpc.Option{
+		otelgrpc.WithTracerProvider(t.provider),
+		otelgrpc.WithPropagators(t.propagator),
+	}
+}
+
+// DialOptions instruments a client connection.
+func (t *Tracer) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{grpc.WithStatsHandler(otelgrpc.NewClientHandler(t.otelOptions()...))}
+}
+
+// ServerOptions instruments a server and records message counts on the
+// spans of streaming RPCs.
+func (t *Tracer) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler(t.otelOptions()...)),
+		grpc.ChainStreamInterceptor(streamCountInterceptor),
+	}
+}
+
+// streamCountInterceptor records how many messages a stream sent and received
+// on the span started by the stats handler.
+func streamCountInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	cs := &countingServerStream{ServerStream: ss}
+	err := handler(srv, cs)
+	trace.SpanFromContext(ss.Context()).SetAttributes(
+		MessagesSentKey.Int64(cs.sent.Load()),
+		MessagesReceivedKey.Int64(cs.received.Load()),
+	)
+	return err
+}
+
+type countingServerStream struct {
+	grpc.ServerStream
+	sent, received atomic.Int64
+}
+
+func (s *countingServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
+
+func (s *countingServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Add(1)
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: "Hello, " + req.Name + "!"}, nil
+}
+
+func (greeter) SayHelloStream(req *pb.HelloRequest, stream pb.Greeter_SayHelloStreamServer) error {
+	for i := 0; i < 3; i++ {
+		if err := stream.Send(&pb.HelloReply{Message: "Hello, " + req.Name + "!"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newClient connects a client and server that both record spans into exporter.
+func newClient(t *testing.T, exporter *tracetest.InMemoryExporter) pb.GreeterClient {
+	t.Helper()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := New(provider)
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(tracer.ServerOptions()...)
+	pb.RegisterGreeterServer(s, greeter{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	opts := append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, tracer.DialOptions()...)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewGreeterClient(conn)
+}
+
+func spansByKind(spans tracetest.SpanStubs) map[trace.SpanKind][]tracetest.SpanStub {
+	byKind := map[trace.SpanKind][]tracetest.SpanStub{}
+	for _, span := range spans {
+		byKind[span.SpanKind] = append(byKind[span.SpanKind], span)
+	}
+	return byKind
+}
+
+func TestUnarySpansShareTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	client := newClient(t, exporter)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "trace"}); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+
+	byKind := spansByKind(exporter.GetSpans())
+	clientSpans, serverSpans := byKind[trace.SpanKindClient], byKind[trace.SpanKindServer]
+	if len(clientSpans) != 1 || len(serverSpans) != 1 {
+		t.Fatalf("got %d client and %d server spans, want 1 each", len(clientSpans), len(serverSpans))
+	}
+	clientSpan, serverSpan := clientSpans[0], serverSpans[0]
+	if clientSpan.Name != "example.Greeter/SayHello" {
+		t.Errorf("got client span %q", clientSpan.Name)
+	}
+	if clientSpan.SpanContext.TraceID() != serverSpan.SpanContext.TraceID() {
+		t.Errorf("client trace %s and server trace %s differ",
+			clientSpan.SpanContext.TraceID(), serverSpan.SpanContext.TraceID())
+	}
+	if serverSpan.Parent.SpanID() != clientSpan.SpanContext.SpanID() {
+		t.Errorf("server span parent %s, want client span %s", serverSpan.Parent.SpanID(), clientSpan.SpanContext.SpanID())
+	}
+}
+
+func TestStreamSpanRecordsMessageCount(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	client := newClient(t, exporter)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.SayHelloStream(ctx, &pb.HelloRequest{Name: "trace"})
+	if err != nil {
+		t.Fatalf("SayHelloStream: %v", err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+	}
+
+	serverSpans := spansByKind(exporter.GetSpans())[trace.SpanKindServer]
+	if len(serverSpans) != 1 {
+		t.Fatalf("got %d server spans, want 1", len(serverSpans))
+	}
+	var found bool
+	for _, attr := range serverSpans[0].Attributes {
+		if attr.Key == MessagesSentKey {
+			found = true
+			if got := attr.Value.AsInt64(); got != 3 {
+				t.Errorf("%s = %d, want 3", MessagesSentKey, got)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("server span has no %s attribute: %v", MessagesSentKey, serverSpans[0].Attributes)
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4317",
+		"OTEL_EXPORTER_OTLP_INSECURE": "true",
+		"OTEL_SERVICE_NAME":           "greeter-staging",
+		"OTEL_TRACES_SAMPLER_ARG":     "0.25",
+	}
+	opts := OptionsFromEnv(func(k string) string { return env[k] }, "greeter")
+	want := Options{Enabled: true, Endpoint: "collector:4317", Insecure: true, ServiceName: "greeter-staging", SampleRatio: 0.25}
+	if opts != want {
+		t.Errorf("got %+v, want %+v", opts, want)
+	}
+
+	// A URL's scheme, not OTEL_EXPORTER_OTLP_INSECURE, decides TLS
+	for endpoint, insecure := range map[string]bool{"http://collector:4317": true, "https://collector:4317/": false} {
+		env["OTEL_EXPORTER_OTLP_ENDPOINT"] = endpoint
+		env["OTEL_EXPORTER_OTLP_INSECURE"] = strconv.FormatBool(!insecure)
+		opts := OptionsFromEnv(func(k string) string { return env[k] }, "greeter")
+		if opts.Endpoint != "collector:4317" || opts.Insecure != insecure {
+			t.Errorf("%s gave endpoint %q, insecure %v; want collector:4317, %v", endpoint, opts.Endpoint, opts.Insecure, insecure)
+		}
+	}
+
+	env["OTEL_SDK_DISABLED"] = "true"
+	if opts := OptionsFromEnv(func(k string) string { return env[k] }, "greeter"); opts.Enabled {
+		t.Error("expected OTEL_SDK_DISABLED to disable tracing")
+	}
+	if opts := OptionsFromEnv(func(string) string { return "" }, "greeter"); opts.Enabled || opts.ServiceName != "greeter" {
+		t.Errorf("got %+v with an empty environment", opts)
+	}
+}
+
+func TestInitTracerDisabled(t *testing.T) {
+	tracer, err := InitTracer(context.Background(), Options{})
+	if err != nil {
+		t.Fatalf("InitTracer: %v", err)
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
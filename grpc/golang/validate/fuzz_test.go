@@ -0,0 +1,77 @@
+package validate_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"github.com/shrivatsas/exp-codegen/grpc/validate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// FuzzValidateHelloRequest checks that validation never panics and that it
+// rejects requests only with InvalidArgument and a BadRequest detail, both
+// for names given directly and for requests decoded from arbitrary bytes.
+func FuzzValidateHelloRequest(f *testing.F) {
+	encoded, _ := proto.Marshal(&pb.HelloRequest{Name: "Alice", Locale: "fr"})
+	for _, seed := range []struct {
+		data []byte
+		name string
+		max  int
+	}{
+		{nil, "", 0},
+		{encoded, "Alice", 5},
+		{encoded[:len(encoded)-1], "Renée", 4},
+		{[]byte{0x0a, 0xff}, strings.Repeat("x", 1<<16), validate.DefaultMaxNameLength},
+		{[]byte("\x0a\x02\xff\xfe"), "Al\xffce", -1},
+		{[]byte("\x0a\x01\x00"), "Al\x00ce\n", 1},
+	} {
+		f.Add(seed.data, seed.name, seed.max)
+	}
+	unary := validate.UnaryServerInterceptor(validate.Options{})
+	handler := func(ctx context.Context, req any) (any, error) { return req, nil }
+
+	f.Fuzz(func(t *testing.T, data []byte, name string, max int) {
+		err := validate.HelloRequest(&pb.HelloRequest{Name: name}, max)
+		checkRejection(t, err)
+		if err == nil && (name == "" || !utf8.ValidString(name)) {
+			t.Errorf("HelloRequest accepted name %q", name)
+		}
+
+		var v1 pb.HelloRequest
+		if proto.Unmarshal(data, &v1) == nil {
+			_, err := unary(context.Background(), &v1, &grpc.UnaryServerInfo{}, handler)
+			checkRejection(t, err)
+		}
+		var v2 pbv2.HelloRequest
+		if proto.Unmarshal(data, &v2) == nil {
+			_, err := unary(context.Background(), &v2, &grpc.UnaryServerInfo{}, handler)
+			checkRejection(t, err)
+		}
+	})
+}
+
+// checkRejection fails t unless err is nil or an InvalidArgument status
+// naming the field at fault in a BadRequest detail.
+func checkRejection(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		return
+	}
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument", err)
+	}
+	if details := st.Details(); len(details) != 1 {
+		t.Fatalf("got details %v, want one BadRequest", details)
+	} else if br, ok := details[0].(*errdetails.BadRequest); !ok || len(br.GetFieldViolations()) != 1 {
+		t.Fatalf("got details %v, want one field violation", details)
+	}
+}
@@ -0,0 +1,87 @@
+package validate
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// UnknownFields returns the fields of msg, and of the messages it holds,
+// that were decoded without being in its schema, as a sender with a newer
+// or mistaken schema would send them. Each is written as its tag number,
+// following the path of the message holding it, e.g. "7" or
+// "greetings[2].4".
+func UnknownFields(msg proto.Message) []string {
+	var paths []string
+	unknownFields(msg.ProtoReflect(), "", &paths)
+	return paths
+}
+
+func unknownFields(m protoreflect.Message, path string, paths *[]string) {
+	// Encoders may write unknown fields in any order, and a repeated one
+	// several times, so each number is given once, in order
+	var nums []int
+	for b := m.GetUnknown(); len(b) > 0; {
+		num, _, n := protowire.ConsumeField(b)
+		if n < 0 {
+			// Unparseable bytes would not have decoded; count them once
+			*paths = append(*paths, join(path, "?"))
+			break
+		}
+		nums = append(nums, int(num))
+		b = b[n:]
+	}
+	slices.Sort(nums)
+	for _, num := range slices.Compact(nums) {
+		*paths = append(*paths, join(path, strconv.Itoa(num)))
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			for i := 0; i < v.List().Len(); i++ {
+				unknownFields(v.List().Get(i).Message(), join(path, string(fd.Name()))+"["+strconv.Itoa(i)+"]", paths)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				unknownFields(mv.Message(), join(path, string(fd.Name()))+"["+k.String()+"]", paths)
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			unknownFields(v.Message(), join(path, string(fd.Name())), paths)
+		}
+		return true
+	})
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// RejectUnknown returns InvalidArgument with a BadRequest detail naming
+// each of msg's UnknownFields, or nil if it has none.
+func RejectUnknown(msg proto.Message) error {
+	paths := UnknownFields(msg)
+	if len(paths) == 0 {
+		return nil
+	}
+	br := &errdetails.BadRequest{}
+	for _, path := range paths {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: path, Description: "not in the schema"})
+	}
+	name := msg.ProtoReflect().Descriptor().FullName()
+	st, err := status.New(codes.InvalidArgument, "unknown fields in "+string(name)+": "+strings.Join(paths, ", ")).WithDetails(br)
+	if err != nil {
+		return status.Errorf(codes.Internal, "attaching error details: %v", err)
+	}
+	return st.Err()
+}
@@ -0,0 +1,126 @@
+package validate_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"github.com/shrivatsas/exp-codegen/grpc/validate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newerHelloRequest returns a HelloRequest as a client with a newer schema
+// would send it: named Ada, with a string field 20 and an int64 field 21
+// the server's schema lacks.
+func newerHelloRequest(t *testing.T) proto.Message {
+	t.Helper()
+	fdp := protodesc.ToFileDescriptorProto((&pb.HelloRequest{}).ProtoReflect().Descriptor().ParentFile())
+	fdp.Name = proto.String("newer/" + fdp.GetName())
+	for _, mdp := range fdp.MessageType {
+		if mdp.GetName() == "HelloRequest" {
+			mdp.Field = append(mdp.Field,
+				&descriptorpb.FieldDescriptorProto{Name: proto.String("nickname"), JsonName: proto.String("nickname"), Number: proto.Int32(20), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				&descriptorpb.FieldDescriptorProto{Name: proto.String("visits"), JsonName: proto.String("visits"), Number: proto.Int32(21), Type: descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			)
+		}
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("HelloRequest")
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("name"), protoreflect.ValueOfString("Ada"))
+	msg.Set(md.Fields().ByNumber(20), protoreflect.ValueOfString("Ade"))
+	msg.Set(md.Fields().ByNumber(21), protoreflect.ValueOfInt64(3))
+	return msg
+}
+
+// checkUnknown fails t unless err rejects fields 20 and 21 of a
+// HelloRequest.
+func checkUnknown(t *testing.T, err error) {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || st.Message() != "unknown fields in example.HelloRequest: 20, 21" {
+		t.Fatalf("got %v, want InvalidArgument naming fields 20 and 21", err)
+	}
+	if len(st.Details()) != 1 {
+		t.Fatalf("got details %v, want a BadRequest", st.Details())
+	}
+	br, ok := st.Details()[0].(*errdetails.BadRequest)
+	if !ok {
+		t.Fatalf("got details %v, want a BadRequest", st.Details())
+	}
+	v := br.GetFieldViolations()
+	if len(v) != 2 || v[0].GetField() != "20" || v[1].GetField() != "21" || v[0].GetDescription() != "not in the schema" {
+		t.Errorf("got violations %v, want fields 20 and 21", v)
+	}
+}
+
+func TestRejectUnknown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := newerHelloRequest(t)
+	chat := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+
+	for _, reject := range []bool{false, true} {
+		opts := validate.Options{RejectUnknown: reject}
+		ts := testutil.Start(t, testutil.WithServerOptions(
+			grpc.ChainUnaryInterceptor(validate.UnaryServerInterceptor(opts)),
+			grpc.ChainStreamInterceptor(validate.StreamServerInterceptor(opts))),
+		)
+
+		err := ts.Conn.Invoke(ctx, pb.Greeter_SayHello_FullMethodName, req, &pb.HelloReply{})
+		if !reject {
+			if err != nil {
+				t.Errorf("SayHello with unknown fields by default: %v", err)
+			}
+		} else {
+			checkUnknown(t, err)
+		}
+
+		stream, err := ts.Conn.NewStream(ctx, chat, pb.Greeter_SayHelloChat_FullMethodName)
+		if err != nil {
+			t.Fatalf("SayHelloChat: %v", err)
+		}
+		if err := stream.SendMsg(req); err != nil && err != io.EOF {
+			t.Fatalf("Send: %v", err)
+		}
+		err = stream.RecvMsg(&pb.HelloReply{})
+		if !reject {
+			if err != nil {
+				t.Errorf("SayHelloChat with unknown fields by default: %v", err)
+			}
+		} else {
+			checkUnknown(t, err)
+		}
+		stream.CloseSend()
+	}
+}
+
+func TestUnknownFieldsNested(t *testing.T) {
+	resp := &pbv2.ListGreetingsResponse{Greetings: []*pbv2.GreetingRecord{{}, {}}}
+	resp.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 9, protowire.VarintType), 1))
+	resp.Greetings[1].ProtoReflect().SetUnknown(protowire.AppendString(protowire.AppendTag(nil, 12, protowire.BytesType), "x"))
+	got := validate.UnknownFields(resp)
+	if len(got) != 2 || got[0] != "9" || got[1] != "greetings[1].12" {
+		t.Errorf("UnknownFields = %q, want [9 greetings[1].12]", got)
+	}
+	if got := validate.UnknownFields(&pbv2.ListGreetingsResponse{Greetings: []*pbv2.GreetingRecord{{}}}); len(got) != 0 {
+		t.Errorf("UnknownFields of a message without any = %q", got)
+	}
+}
@@ -0,0 +1,147 @@
+// Package validate provides server interceptors that check each request
+// message before the handler sees it, rejecting malformed ones with
+// InvalidArgument and a BadRequest detail naming the field at fault. Checks
+// are looked up by message type, so a new RPC taking an existing message is
+// validated without further wiring.
+package validate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shrivatsas/exp-codegen/grpc/compat"
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DefaultMaxNameLength is the name limit, in characters, the server applies
+// unless configured otherwise.
+const DefaultMaxNameLength = 256
+
+// Func checks one request message, returning an InvalidArgument status
+// error if it is unacceptable.
+type Func func(msg proto.Message) error
+
+// Options configures the interceptors.
+type Options struct {
+	// MaxNameLength caps HelloRequest names in characters; zero means no
+	// limit, as for greeter.WithMaxNameLength.
+	MaxNameLength int
+	// Funcs adds or replaces checks, keyed by message full name, e.g.
+	// "example.HelloRequest".
+	Funcs map[protoreflect.FullName]Func
+	// RejectUnknown also rejects every request carrying fields this
+	// server's schema does not know, as RejectUnknown does, ahead of the
+	// other checks. By default they are ignored, as proto3 intends, so
+	// clients with newer schemas keep working.
+	RejectUnknown bool
+}
+
+// funcs returns the checks for each message type.
+func (o Options) funcs() map[protoreflect.FullName]Func {
+	maxName := o.MaxNameLength
+	funcs := map[protoreflect.FullName]Func{
+		(*pb.HelloRequest)(nil).ProtoReflect().Descriptor().FullName(): func(msg proto.Message) error {
+			return HelloRequest(msg.(*pb.HelloRequest), maxName)
+		},
+		(*pbv2.HelloRequest)(nil).ProtoReflect().Descriptor().FullName(): func(msg proto.Message) error {
+			return HelloRequest(compat.V1HelloRequest(msg.(*pbv2.HelloRequest)), maxName)
+		},
+	}
+	for name, fn := range o.Funcs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// HelloRequest checks that req has a non-empty name of valid UTF-8 without
+// control characters and, if maxNameLength is positive, at most that many
+// characters.
+func HelloRequest(req *pb.HelloRequest, maxNameLength int) error {
+	var violation string
+	switch {
+	case req.Name == "":
+		violation = "must not be empty"
+	case !utf8.ValidString(req.Name):
+		violation = "must be valid UTF-8"
+	case maxNameLength > 0 && utf8.RuneCountInString(req.Name) > maxNameLength:
+		violation = fmt.Sprintf("must be at most %d characters", maxNameLength)
+	case strings.IndexFunc(req.Name, unicode.IsControl) >= 0:
+		violation = "must not contain control characters"
+	default:
+		return nil
+	}
+	return fieldError("name", violation)
+}
+
+// fieldError returns InvalidArgument with a BadRequest detail for field.
+func fieldError(field, violation string) error {
+	st, err := status.New(codes.InvalidArgument, "invalid "+field+": "+violation).WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: violation}},
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "attaching error details: %v", err)
+	}
+	return st.Err()
+}
+
+// check rejects msg's unknown fields if rejectUnknown is set, then runs the
+// check registered for msg's type, if any.
+func check(funcs map[protoreflect.FullName]Func, rejectUnknown bool, msg any) error {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+	if rejectUnknown {
+		if err := RejectUnknown(m); err != nil {
+			return err
+		}
+	}
+	if fn, ok := funcs[m.ProtoReflect().Descriptor().FullName()]; ok {
+		return fn(m)
+	}
+	return nil
+}
+
+// UnaryServerInterceptor rejects invalid requests before calling the handler.
+func UnaryServerInterceptor(opts Options) grpc.UnaryServerInterceptor {
+	funcs := opts.funcs()
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := check(funcs, opts.RejectUnknown, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor checks every message the handler receives; an
+// invalid one is returned to the handler as a RecvMsg error, which ends the
+// stream when the handler returns it.
+func StreamServerInterceptor(opts Options) grpc.StreamServerInterceptor {
+	funcs := opts.funcs()
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, funcs: funcs, rejectUnknown: opts.RejectUnknown})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	funcs         map[protoreflect.FullName]Func
+	rejectUnknown bool
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return check(s.funcs, s.rejectUnknown, m)
+}
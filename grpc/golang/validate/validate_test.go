@@ -0,0 +1,170 @@
+package validate_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	pb "github.com/shrivatsas/exp-codegen/grpc/protos"
+	pbv2 "github.com/shrivatsas/exp-codegen/grpc/protos/v2"
+	"github.com/shrivatsas/exp-codegen/grpc/testutil"
+	"github.com/shrivatsas/exp-codegen/grpc/validate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestHelloRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		reqName   string
+		max       int
+		violation string
+	}{
+		{"valid", "Alice", 5, ""},
+		{"at the limit in characters", "Renée", 5, ""},
+		{"no limit", strings.Repeat("x", 10000), 0, ""},
+		{"empty", "", 5, "must not be empty"},
+		{"too long", "Bartholomew", 5, "must be at most 5 characters"},
+		{"invalid UTF-8", "Al\xffce", 5, "must be valid UTF-8"},
+		{"control character", "Al\nce", 5, "must not contain control characters"},
+		{"NUL", "Al\x00ce", 5, "must not contain control characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate.HelloRequest(&pb.HelloRequest{Name: tt.reqName}, tt.max)
+			if tt.violation == "" {
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+				return
+			}
+			st := status.Convert(err)
+			if st.Code() != codes.InvalidArgument || st.Message() != "invalid name: "+tt.violation {
+				t.Fatalf("got %v, want InvalidArgument: invalid name: %s", err, tt.violation)
+			}
+			br, ok := st.Details()[0].(*errdetails.BadRequest)
+			if !ok {
+				t.Fatalf("got details %v, want a BadRequest", st.Details())
+			}
+			if v := br.GetFieldViolations(); len(v) != 1 || v[0].GetField() != "name" || v[0].GetDescription() != tt.violation {
+				t.Errorf("got violations %v, want name: %s", v, tt.violation)
+			}
+		})
+	}
+}
+
+func FuzzHelloRequest(f *testing.F) {
+	for _, seed := range []string{"", "Alice", "Renée", "\xff", "a\x00b", strings.Repeat("é", 300)} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, name []byte) {
+		err := validate.HelloRequest(&pb.HelloRequest{Name: string(name)}, validate.DefaultMaxNameLength)
+		if err == nil {
+			if len(name) == 0 || !utf8.Valid(name) || utf8.RuneCount(name) > validate.DefaultMaxNameLength {
+				t.Errorf("accepted %q", name)
+			}
+		} else if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("got %v for %q, want InvalidArgument", err, name)
+		}
+	})
+}
+
+// start serves the Greeter behind the validation interceptors for opts.
+func start(t *testing.T, opts validate.Options) pb.GreeterClient {
+	t.Helper()
+	return testutil.Start(t, testutil.WithServerOptions(
+		grpc.ChainUnaryInterceptor(validate.UnaryServerInterceptor(opts)),
+		grpc.ChainStreamInterceptor(validate.StreamServerInterceptor(opts))),
+	).Client
+}
+
+func TestInterceptors(t *testing.T) {
+	client := start(t, validate.Options{MaxNameLength: 5})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Bartholomew"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SayHello: got %v, want InvalidArgument", err)
+	}
+
+	// Every message on a client stream is checked, not just the first
+	chat, err := client.SayHelloChat(ctx)
+	if err != nil {
+		t.Fatalf("SayHelloChat: %v", err)
+	}
+	for _, name := range []string{"Alice", "Al\tce"} {
+		if err := chat.Send(&pb.HelloRequest{Name: name}); err != nil && err != io.EOF {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if _, err := chat.Recv(); err != nil {
+		t.Fatalf("Recv for a valid name: %v", err)
+	}
+	if _, err := chat.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Recv for an invalid name: got %v, want InvalidArgument", err)
+	}
+
+	batch, err := client.SayHelloBatch(ctx)
+	if err != nil {
+		t.Fatalf("SayHelloBatch: %v", err)
+	}
+	if err := batch.Send(&pb.HelloRequest{}); err != nil && err != io.EOF {
+		t.Fatalf("Send: %v", err)
+	}
+	if _, err := batch.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SayHelloBatch: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestNoMaxNameLength(t *testing.T) {
+	client := start(t, validate.Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Zero means no limit, as for greeter.WithMaxNameLength
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: strings.Repeat("x", 10*validate.DefaultMaxNameLength)}); err != nil {
+		t.Errorf("SayHello with no limit: %v", err)
+	}
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SayHello with no name: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	client := start(t, validate.Options{Funcs: map[protoreflect.FullName]validate.Func{
+		"example.HelloRequest": func(msg proto.Message) error {
+			if msg.(*pb.HelloRequest).Name == "Mallory" {
+				return status.Error(codes.InvalidArgument, "not Mallory")
+			}
+			return nil
+		},
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Mallory"}); status.Convert(err).Message() != "not Mallory" {
+		t.Errorf("got %v, want the replacement check's error", err)
+	}
+}
+
+func TestV2HelloRequest(t *testing.T) {
+	opts := validate.Options{MaxNameLength: 5}
+	ts := testutil.Start(t, testutil.WithServerOptions(grpc.ChainUnaryInterceptor(validate.UnaryServerInterceptor(opts))))
+	client := pbv2.NewGreeterClient(ts.Conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.SayHello(ctx, &pbv2.HelloRequest{Name: "Bartholomew"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("v2 SayHello: got %v, want InvalidArgument", err)
+	}
+	if _, err := client.SayHello(ctx, &pbv2.HelloRequest{Name: "Bart"}); err != nil {
+		t.Errorf("v2 SayHello: %v", err)
+	}
+}